@@ -0,0 +1,113 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// The active pointer lives beside the sub-logs it names, under the parent
+// prefix. A parent prefix used this way holds sub-logs only and must not be
+// appended to directly.
+const activePointerName = "_active"
+
+var (
+	// ErrNoActivePrefix is returned by ActivePrefix and Active when no
+	// prefix/_active pointer has been written yet.
+	ErrNoActivePrefix = errors.New("no active prefix set")
+	// ErrActivePrefixConflict is returned by SetActivePrefix when another
+	// client changed the pointer between its read and its conditional write.
+	// Read the new pointer before deciding whether to retry.
+	ErrActivePrefixConflict = errors.New("active prefix changed concurrently")
+)
+
+func (w *S3DAL) activePointerKey() string {
+	return w.keyUnder(activePointerName)
+}
+
+// ActivePrefix returns the name of the currently active sub-prefix recorded in
+// the prefix/_active pointer object.
+func (w *S3DAL) ActivePrefix(ctx context.Context) (string, error) {
+	name, _, err := w.readActivePointer(ctx)
+	return name, err
+}
+
+func (w *S3DAL) readActivePointer(ctx context.Context) (name, etag string, err error) {
+	result, err := w.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(w.activePointerKey()),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return "", "", ErrNoActivePrefix
+		}
+		return "", "", fmt.Errorf("failed to get active pointer from S3: %w", err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read active pointer: %w", err)
+	}
+	return string(data), aws.ToString(result.ETag), nil
+}
+
+// SetActivePrefix points prefix/_active at the sub-prefix name. The write is
+// conditional on the pointer not having changed since it was read, so two
+// concurrent rotations cannot silently overwrite each other; the loser gets
+// ErrActivePrefixConflict.
+//
+// Writers that resolved the previous sub-prefix keep appending to it until
+// they call Active again, so there is a window after a switch in which both
+// logs may receive writes. The recommended rotation is: create the new
+// sub-log, SetActivePrefix, have every writer re-resolve via Active, and only
+// then treat the old sub-log as closed. Readers can keep reading the old
+// sub-log throughout.
+func (w *S3DAL) SetActivePrefix(ctx context.Context, name string) error {
+	if name == "" || strings.Contains(name, w.delimiter) || strings.HasPrefix(name, "_") {
+		return fmt.Errorf("invalid active prefix %q", name)
+	}
+
+	_, etag, err := w.readActivePointer(ctx)
+	if err != nil && !errors.Is(err, ErrNoActivePrefix) {
+		return err
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(w.activePointerKey()),
+		Body:   bytes.NewReader([]byte(name)),
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.BucketKeyEnabled = w.sseParams()
+	if etag == "" {
+		input.IfNoneMatch = aws.String("*")
+	} else {
+		input.IfMatch = aws.String(etag)
+	}
+
+	if _, err := w.client.PutObject(ctx, input); err != nil {
+		if isPreconditionFailed(err) {
+			return ErrActivePrefixConflict
+		}
+		return fmt.Errorf("failed to put active pointer to S3%s: %w", w.sseHint(err), err)
+	}
+	return nil
+}
+
+// Active resolves the active sub-prefix and returns a DAL scoped to it,
+// sharing this DAL's client and configuration. Under WithAppendBuffer it has
+// writers of its own, so Close it once done with it.
+func (w *S3DAL) Active(ctx context.Context) (*S3DAL, error) {
+	name, err := w.ActivePrefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// New wraps the client again from the options
+	return New(unwrapClient(w.client), w.bucketName, w.keyUnder(name), w.opts...)
+}
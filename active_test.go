@@ -0,0 +1,115 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestActivePrefix(t *testing.T) {
+	wal, _ := newFakeDAL(t)
+	ctx := context.Background()
+
+	if _, err := wal.ActivePrefix(ctx); !errors.Is(err, ErrNoActivePrefix) {
+		t.Fatalf("expected ErrNoActivePrefix, got %v", err)
+	}
+
+	if err := wal.SetActivePrefix(ctx, "blue"); err != nil {
+		t.Fatalf("failed to set active prefix: %v", err)
+	}
+	blue, err := wal.Active(ctx)
+	if err != nil {
+		t.Fatalf("failed to resolve active prefix: %v", err)
+	}
+	if _, err := blue.Append(ctx, []byte("old")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	if err := wal.SetActivePrefix(ctx, "green"); err != nil {
+		t.Fatalf("failed to rotate active prefix: %v", err)
+	}
+	name, err := wal.ActivePrefix(ctx)
+	if err != nil {
+		t.Fatalf("failed to read active prefix: %v", err)
+	}
+	if name != "green" {
+		t.Errorf("expected active prefix green, got %q", name)
+	}
+
+	green, err := wal.Active(ctx)
+	if err != nil {
+		t.Fatalf("failed to resolve active prefix: %v", err)
+	}
+	if _, err := green.Append(ctx, []byte("new")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	// readers still reach the old log after rotation
+	record, err := blue.Read(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to read old log: %v", err)
+	}
+	if string(record.Data) != "old" {
+		t.Errorf("expected old data, got %q", record.Data)
+	}
+}
+
+func TestSetActivePrefixConflict(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	if err := wal.SetActivePrefix(ctx, "blue"); err != nil {
+		t.Fatalf("failed to set active prefix: %v", err)
+	}
+
+	// another operator rotates between our read and our write
+	other := S3DALClient(fake, wal.bucketName, wal.prefix)
+	fake.beforePut = func(key string) {
+		fake.beforePut = nil
+		if err := other.SetActivePrefix(ctx, "red"); err != nil {
+			t.Errorf("competing rotation failed: %v", err)
+		}
+	}
+
+	if err := wal.SetActivePrefix(ctx, "green"); !errors.Is(err, ErrActivePrefixConflict) {
+		t.Fatalf("expected ErrActivePrefixConflict, got %v", err)
+	}
+	name, err := wal.ActivePrefix(ctx)
+	if err != nil {
+		t.Fatalf("failed to read active prefix: %v", err)
+	}
+	if name != "red" {
+		t.Errorf("expected the competing rotation to win, got %q", name)
+	}
+}
+
+func TestSetActivePrefixInvalid(t *testing.T) {
+	wal, _ := newFakeDAL(t)
+	for _, name := range []string{"", "a/b", "_tail"} {
+		if err := wal.SetActivePrefix(context.Background(), name); err == nil {
+			t.Errorf("expected error for active prefix %q", name)
+		}
+	}
+}
+
+func TestActiveRetriesOnce(t *testing.T) {
+	client := &flakyS3{fakeS3: newFakeS3()}
+	wal, err := New(client, "fake-bucket", "fake-prefix", WithRetryPolicy(3, ConstantBackoff(time.Millisecond)))
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	ctx := context.Background()
+	if err := wal.SetActivePrefix(ctx, "blue"); err != nil {
+		t.Fatalf("failed to set active prefix: %v", err)
+	}
+	blue, err := wal.Active(ctx)
+	if err != nil {
+		t.Fatalf("failed to resolve active prefix: %v", err)
+	}
+
+	client.calls, client.errs = 0, []error{statusError(500), statusError(500), statusError(500), statusError(500)}
+	if _, err := blue.Append(ctx, []byte("lost")); err == nil || client.calls != 3 {
+		t.Errorf("expected the append to give up after 3 attempts, got %v after %d calls", err, client.calls)
+	}
+}
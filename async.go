@@ -0,0 +1,246 @@
+package s3_dal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WithAppendBuffer makes Append asynchronous: it assigns the offset, queues
+// the record and returns, while concurrency background writers put queued
+// records to S3 in offset order. At most size records are queued or being
+// written at once; Append blocks while that many are, until a write finishes
+// or its context is done, so a slow S3 holds the producer back rather than
+// the queue growing. Flush waits for the records appended before it to be
+// written, and Close for all of them.
+//
+// Append returning no longer means its record is durable. A write that fails
+// is passed to onError, if set, from a writer goroutine, and the first failure
+// since the last Flush is returned by Flush or Close; the record's offset is
+// left a hole. After-append hooks and the observer run in the writers too.
+// AppendWithMetadata and AppendWithLimit are buffered as Append is; the batch,
+// idempotent and reserved appends are not. It is not supported with packing.
+func WithAppendBuffer(size, concurrency int, onError func(offset uint64, err error)) Option {
+	return func(w *S3DAL) error {
+		if size <= 0 {
+			return fmt.Errorf("invalid append buffer size %d: must be positive", size)
+		}
+		if concurrency <= 0 {
+			return fmt.Errorf("invalid append buffer concurrency %d: must be positive", concurrency)
+		}
+		w.async = &asyncWriter{
+			slots:       make(chan struct{}, size),
+			jobs:        make(chan asyncJob, size),
+			concurrency: concurrency,
+			onError:     onError,
+			inflight:    make(map[uint64]struct{}),
+			changed:     make(chan struct{}),
+		}
+		return nil
+	}
+}
+
+// asyncWriter is the queue of WithAppendBuffer. An append takes a slot, is
+// queued in offset order and gives its slot back once written.
+type asyncWriter struct {
+	slots       chan struct{}
+	jobs        chan asyncJob
+	concurrency int
+	onError     func(offset uint64, err error)
+
+	mu sync.Mutex
+	// inflight holds the offsets queued or being written
+	inflight map[uint64]struct{}
+	// changed is closed, and replaced, whenever a write finishes
+	changed chan struct{}
+	last    uint64
+	closed  bool
+	// err is the first failed write since the last Flush
+	err error
+}
+
+type asyncJob struct {
+	offset  uint64
+	created int64
+	payload []byte
+	size    int
+	attrs   objectAttrs
+	start   time.Time
+}
+
+// start runs the writers. They stop once Close has drained the queue.
+func (q *asyncWriter) start(w *S3DAL) {
+	for range q.concurrency {
+		go func() {
+			for job := range q.jobs {
+				err := w.writeQueued(job)
+				if err != nil && q.onError != nil {
+					q.onError(job.offset, err)
+				}
+				q.done(job.offset, err)
+				<-q.slots
+			}
+		}()
+	}
+}
+
+// add records offset as queued, or reports false once Close has begun.
+func (q *asyncWriter) add(offset uint64) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	q.inflight[offset] = struct{}{}
+	q.last = offset
+	return true
+}
+
+func (q *asyncWriter) done(offset uint64, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inflight, offset)
+	if err != nil && q.err == nil {
+		q.err = err
+	}
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// wait blocks until every record queued so far is written, or ctx is done,
+// and returns the first failure since the last wait. With closing set no
+// further records are accepted.
+func (q *asyncWriter) wait(ctx context.Context, closing bool) error {
+	q.mu.Lock()
+	if closing {
+		if q.closed {
+			q.mu.Unlock()
+			return nil
+		}
+		q.closed = true
+	}
+	target := q.last
+	for q.pendingUpTo(target) {
+		changed := q.changed
+		q.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		q.mu.Lock()
+	}
+	err := q.err
+	q.err = nil
+	q.mu.Unlock()
+	if closing {
+		close(q.jobs)
+	}
+	return err
+}
+
+// pendingUpTo reports whether a record at or below target is still queued or
+// being written. The caller holds q.mu.
+func (q *asyncWriter) pendingUpTo(target uint64) bool {
+	for offset := range q.inflight {
+		if offset <= target {
+			return true
+		}
+	}
+	return false
+}
+
+// lowest returns the lowest offset still queued or being written, and false
+// if there is none. The caller must not hold q.mu.
+func (q *asyncWriter) lowest() (uint64, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var low uint64
+	for offset := range q.inflight {
+		if low == 0 || offset < low {
+			low = offset
+		}
+	}
+	return low, low > 0
+}
+
+// highest returns the highest offset still queued or being written, 0 if
+// there is none.
+func (q *asyncWriter) highest() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var high uint64
+	for offset := range q.inflight {
+		high = max(high, offset)
+	}
+	return high
+}
+
+// appendAsync is append under WithAppendBuffer: it waits for a slot in the
+// queue, then assigns the offset and queues the record.
+func (w *S3DAL) appendAsync(ctx context.Context, data []byte, fileSizeLimit uint64, attrs objectAttrs) (uint64, error) {
+	start := time.Now()
+	select {
+	case w.async.slots <- struct{}{}:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-w.lifetime.Done():
+		return 0, ErrClosed
+	}
+	offset, err := w.enqueue(data, fileSizeLimit, attrs, start)
+	if err != nil {
+		<-w.async.slots
+		w.observer.RecordAppend(len(data), time.Since(start), err)
+		return 0, err
+	}
+	return offset, nil
+}
+
+// enqueue assigns the next offset to data and queues it for the writers. A
+// slot is already held, so the queue has room.
+func (w *S3DAL) enqueue(data []byte, fileSizeLimit uint64, attrs objectAttrs, start time.Time) (_ uint64, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	offset := w.length + 1
+	defer func() { err = w.opError("append", offset, err) }()
+	if w.lifetime.Err() != nil {
+		return 0, ErrClosed
+	}
+
+	data, err = w.admitRecord(data, w.size, fileSizeLimit)
+	if err != nil {
+		return 0, err
+	}
+	payload, err := compressPayload(w.compression, data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare object body: failed to compress payload: %w", err)
+	}
+	stored := w.storedSize(len(payload))
+	if err := w.checkStoredSize(w.stored, stored); err != nil {
+		return 0, err
+	}
+	if !w.async.add(offset) {
+		return 0, ErrClosed
+	}
+	w.setLength(offset)
+	w.size += uint64(len(data))
+	w.setStored(w.stored + stored)
+	w.async.jobs <- asyncJob{offset: offset, created: w.nextCreated(), payload: payload, size: len(data), attrs: attrs, start: start}
+	return offset, nil
+}
+
+// writeQueued puts a queued record, then records it as Append would have.
+func (w *S3DAL) writeQueued(job asyncJob) (err error) {
+	defer func() { w.observer.RecordAppend(job.size, time.Since(job.start), err) }()
+	if err := w.putRecord(w.lifetime, job.offset, job.created, job.payload, job.attrs); err != nil {
+		return w.opError("append", job.offset, err)
+	}
+	w.recordInManifest(w.lifetime, job.offset)
+	if w.afterAppend != nil {
+		if err := w.afterAppend(job.offset); err != nil {
+			return fmt.Errorf("after-append hook failed for committed offset %d: %w", job.offset, err)
+		}
+	}
+	return nil
+}
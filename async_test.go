@@ -0,0 +1,139 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAppendBufferOrder(t *testing.T) {
+	wal, _ := newFakeDAL(t, WithAppendBuffer(8, 4, nil))
+	ctx := context.Background()
+	for i := range 50 {
+		offset, err := wal.Append(ctx, []byte(fmt.Sprintf("record %d", i)))
+		if err != nil || offset != uint64(i+1) {
+			t.Fatalf("expected offset %d, got %d, %v", i+1, offset, err)
+		}
+	}
+	if err := wal.Flush(ctx); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+	for i := range 50 {
+		record, err := wal.Read(ctx, uint64(i+1))
+		if err != nil || string(record.Data) != fmt.Sprintf("record %d", i) {
+			t.Fatalf("expected record %d at offset %d, got %q, %v", i, i+1, record.Data, err)
+		}
+	}
+	if err := wal.Sync(ctx); err != nil {
+		t.Errorf("expected the tail to match after Flush, got %v", err)
+	}
+}
+
+func TestAppendBufferBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	wal, fake := newFakeDAL(t, WithAppendBuffer(2, 2, nil))
+	fake.beforePut = func(string) { <-release }
+	ctx := context.Background()
+	for range 2 {
+		if _, err := wal.Append(ctx, []byte("record")); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+
+	// the buffer is full, so the third append waits for a write
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := wal.Append(short, []byte("record")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a full buffer to block until the deadline, got %v", err)
+	}
+	if got := wal.Length(); got != 2 {
+		t.Errorf("expected the blocked append to take no offset, got length %d", got)
+	}
+
+	done := make(chan uint64)
+	go func() {
+		offset, err := wal.Append(ctx, []byte("record"))
+		if err != nil {
+			t.Errorf("failed to append: %v", err)
+		}
+		done <- offset
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected the append to block while the buffer is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if offset := <-done; offset != 3 {
+		t.Errorf("expected offset 3 once a write finished, got %d", offset)
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if got := len(fake.objects); got != 3 {
+		t.Errorf("expected Close to drain 3 records, got %d", got)
+	}
+}
+
+func TestAppendBufferErrors(t *testing.T) {
+	var mu sync.Mutex
+	var failed []uint64
+	onError := func(offset uint64, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, offset)
+	}
+	wal, fake := newFakeDAL(t, WithAppendBuffer(4, 1, onError))
+	ctx := context.Background()
+	putErr := errors.New("put failed")
+	fake.mu.Lock()
+	fake.putErr = putErr
+	fake.mu.Unlock()
+	if _, err := wal.Append(ctx, []byte("lost")); err != nil {
+		t.Fatalf("expected the append to be queued, got %v", err)
+	}
+	err := wal.Flush(ctx)
+	var opErr *OpError
+	if !errors.Is(err, putErr) || !errors.As(err, &opErr) || opErr.Offset != 1 {
+		t.Fatalf("expected Flush to report the failed write of offset 1, got %v", err)
+	}
+	mu.Lock()
+	if len(failed) != 1 || failed[0] != 1 {
+		t.Errorf("expected onError for offset 1, got %v", failed)
+	}
+	mu.Unlock()
+	if err := wal.Flush(ctx); err != nil {
+		t.Errorf("expected the failure reported once, got %v", err)
+	}
+
+	fake.mu.Lock()
+	fake.putErr = nil
+	fake.mu.Unlock()
+	if offset, err := wal.Append(ctx, []byte("kept")); err != nil || offset != 2 {
+		t.Fatalf("expected offset 2, got %d, %v", offset, err)
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if _, ok := fake.objects[wal.getObjectKey(2)]; !ok {
+		t.Error("expected Close to write the queued record")
+	}
+	if _, err := wal.Append(ctx, []byte("late")); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed appending after Close, got %v", err)
+	}
+}
+
+func TestAppendBufferInvalid(t *testing.T) {
+	fake := newFakeS3()
+	for _, opt := range []Option{WithAppendBuffer(0, 1, nil), WithAppendBuffer(1, 0, nil)} {
+		if _, err := New(fake, "fake-bucket", "fake-prefix", opt); err == nil {
+			t.Error("expected an invalid append buffer to be rejected")
+		}
+	}
+	if _, err := New(fake, "fake-bucket", "fake-prefix", WithPacking(4), WithAppendBuffer(1, 1, nil)); err == nil {
+		t.Error("expected the append buffer to be rejected with packing")
+	}
+}
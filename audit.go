@@ -0,0 +1,112 @@
+package s3_dal
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var ErrMaxScanExceeded = errors.New("scan limit exceeded")
+
+// FindDuplicates hashes the payload of every record and returns the SHA-256
+// hashes that occur more than once, mapped to the offsets sharing them.
+// Bodies are streamed through the hash rather than buffered. The CRC is not
+// validated; use Read for that.
+func (w *S3DAL) FindDuplicates(ctx context.Context) (map[string][]uint64, error) {
+	objects, err := w.listAllRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if w.maxScan > 0 && len(objects) > w.maxScan {
+		return nil, fmt.Errorf("%w: log has %d records, limit is %d", ErrMaxScanExceeded, len(objects), w.maxScan)
+	}
+
+	offsetsByHash := make(map[string][]uint64)
+	for _, r := range objects {
+		offset := r.offset
+		sum, err := w.hashPayload(ctx, offset)
+		if err != nil {
+			return nil, err
+		}
+		offsetsByHash[sum] = append(offsetsByHash[sum], offset)
+	}
+
+	for sum, offsets := range offsetsByHash {
+		if len(offsets) < 2 {
+			delete(offsetsByHash, sum)
+		}
+	}
+	return offsetsByHash, nil
+}
+
+// hashPayload streams the record at offset and returns the hex SHA-256 of its
+// data, excluding the offset header and CRC trailer.
+func (w *S3DAL) hashPayload(ctx context.Context, offset uint64) (string, error) {
+	result, err := w.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(w.getObjectKey(offset)),
+	})
+	if err != nil {
+		return "", getRecordError(offset, err)
+	}
+	defer result.Body.Close()
+
+	body := bufio.NewReader(result.Body)
+	if header, err := body.Peek(recordHeaderLen); err != nil || !isPlainHeader(header) {
+		// compressed or headerless payloads are decoded whole before hashing
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return "", fmt.Errorf("failed to read object body: %w", err)
+		}
+		record, err := w.decodeBody(offset, data, false)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(record.Data)
+		return hex.EncodeToString(sum[:]), nil
+	}
+
+	// skip the header and offset
+	if _, err := io.CopyN(io.Discard, body, recordHeaderLen+8); err != nil {
+		return "", fmt.Errorf("%w: offset %d", ErrRecordTooShort, offset)
+	}
+
+	h := sha256.New()
+	tw := &trailerWriter{w: h, keep: 2}
+	if _, err := io.Copy(tw, body); err != nil {
+		return "", fmt.Errorf("failed to read object body: %w", err)
+	}
+	if len(tw.tail) < tw.keep {
+		return "", fmt.Errorf("%w: offset %d", ErrRecordTooShort, offset)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// trailerWriter forwards everything written to it except the final keep
+// bytes, which are held back in tail.
+type trailerWriter struct {
+	w    io.Writer
+	keep int
+	tail []byte
+}
+
+func (t *trailerWriter) Write(p []byte) (int, error) {
+	buf := append(t.tail, p...)
+	if len(buf) <= t.keep {
+		t.tail = buf
+		return len(p), nil
+	}
+	flush := len(buf) - t.keep
+	if _, err := t.w.Write(buf[:flush]); err != nil {
+		return 0, err
+	}
+	t.tail = append([]byte(nil), buf[flush:]...)
+	return len(p), nil
+}
@@ -0,0 +1,55 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	wal, _ := newFakeDAL(t)
+	ctx := context.Background()
+
+	payloads := []string{"alpha", "beta", "alpha", "gamma", "beta", "alpha", ""}
+	for _, p := range payloads {
+		if _, err := wal.Append(ctx, []byte(p)); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	dups, err := wal.FindDuplicates(ctx)
+	if err != nil {
+		t.Fatalf("failed to find duplicates: %v", err)
+	}
+	if len(dups) != 2 {
+		t.Fatalf("expected 2 duplicated payloads, got %d: %v", len(dups), dups)
+	}
+
+	var groups [][]uint64
+	for _, offsets := range dups {
+		groups = append(groups, offsets)
+	}
+	slices.SortFunc(groups, func(a, b []uint64) int { return len(b) - len(a) })
+	if !slices.Equal(groups[0], []uint64{1, 3, 6}) {
+		t.Errorf("expected alpha at offsets [1 3 6], got %v", groups[0])
+	}
+	if !slices.Equal(groups[1], []uint64{2, 5}) {
+		t.Errorf("expected beta at offsets [2 5], got %v", groups[1])
+	}
+}
+
+func TestFindDuplicatesMaxScan(t *testing.T) {
+	wal, _ := newFakeDAL(t, WithMaxScan(3))
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if _, err := wal.Append(ctx, []byte("same")); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	if _, err := wal.FindDuplicates(ctx); !errors.Is(err, ErrMaxScanExceeded) {
+		t.Errorf("expected ErrMaxScanExceeded, got %v", err)
+	}
+}
@@ -1,14 +1,49 @@
 package s3_dal
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type Record struct {
 	Offset uint64
 	Data   []byte
+
+	// ETag, Size and LastModified describe the S3 object the record was read
+	// from. Size is the stored object size, including framing, and may differ
+	// from len(Data). They are zero for records that did not come from an
+	// object, such as those read from a snapshot or an InMemoryDAL.
+	ETag         string
+	Size         int64
+	LastModified time.Time
+
+	// CreatedAt is when the record was appended, as stored in its header by
+	// a client with WithTimestamps. Unlike LastModified it survives copies
+	// and replication. It is zero for records written without it.
+	CreatedAt time.Time
+
+	// ContentType and Metadata are the Content-Type and user metadata of the
+	// record's object, as set with WithContentType, WithObjectMetadata or
+	// AppendWithMetadata, less the metadata this package stores itself. They
+	// are set by Read.
+	ContentType string
+	Metadata    map[string]string
 }
 
-type base interface {
+// Log is the core write-ahead log API. *S3DAL is the production
+// implementation and *InMemoryDAL a drop-in for tests.
+type Log interface {
 	Append(ctx context.Context, data []byte) (uint64, error)
 	Read(ctx context.Context, offset uint64) (Record, error)
 	LastRecord(ctx context.Context) (Record, error)
 }
+
+// Logger receives debug output. The default discards everything, so the
+// package is silent unless a logger is configured with WithLogger.
+type Logger interface {
+	Debugf(format string, args ...any)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...any) {}
@@ -0,0 +1,296 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+const defaultBatchConcurrency = 8
+
+// BatchAppendFailure describes one element of an AppendBatch that was not
+// written. Offset is zero when no offset was assigned to it.
+type BatchAppendFailure struct {
+	Index  int
+	Offset uint64
+	Err    error
+}
+
+// BatchAppendError lists the elements of an AppendBatch that failed.
+type BatchAppendError struct {
+	Failures []BatchAppendFailure
+}
+
+func (e *BatchAppendError) Error() string {
+	f := e.Failures[0]
+	if len(e.Failures) == 1 {
+		return fmt.Sprintf("batch append failed at index %d: %v", f.Index, f.Err)
+	}
+	return fmt.Sprintf("batch append failed for %d records (first at index %d: %v)", len(e.Failures), f.Index, f.Err)
+}
+
+func (e *BatchAppendError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		errs = append(errs, f.Err)
+	}
+	return errs
+}
+
+// AppendBatch appends every element of datas and returns the offsets that
+// were durably written, in index order.
+//
+// Offsets are assigned consecutively, in index order, before any write
+// begins; the writes are then issued concurrently (see WithBatchConcurrency),
+// so they may land in S3 in any order. If an element would exceed
+// the configured file size limit (or is rejected by an append hook), it and every later
+// element are not assigned offsets. A write that fails after its offset was
+// assigned leaves a gap at that offset: the other writes are not rolled back
+// unless WithAtomicBatch is set, and the length still advances past it.
+// Failures are reported as a *BatchAppendError alongside the successful
+// offsets, so the number of durably written records is len of the result.
+//
+// Each element is still its own object and its own PutObject; batching saves
+// round-trip latency, not requests. To save requests, use BatchAppend on a
+// log made with WithPacking. For replay, offsets follow index order
+// even though the writes complete out of order.
+func (w *S3DAL) AppendBatch(ctx context.Context, datas [][]byte) ([]uint64, error) {
+	return w.appendBatch(ctx, datas, w.fileSizeLimit)
+}
+
+// BatchAppend is AppendBatch with fileSizeLimit enforced across the batch in
+// place of the configured limit, for this call only. On a packed log, where
+// AppendBatch fails with ErrPackedLog, it instead adds the batch to the pack
+// buffer and flushes it, so the batch costs one PutObject per pack rather
+// than one per record; see appendPackedBatch.
+func (w *S3DAL) BatchAppend(ctx context.Context, datas [][]byte, fileSizeLimit uint64) ([]uint64, error) {
+	if w.packRecords > 0 {
+		return w.appendPackedBatch(ctx, datas, fileSizeLimit)
+	}
+	return w.appendBatch(ctx, datas, fileSizeLimit)
+}
+
+// AppendBatchWithLimit is AppendBatch with fileSizeLimit enforced in place of
+// the configured limit, for this call only.
+//
+// Deprecated: use BatchAppend.
+func (w *S3DAL) AppendBatchWithLimit(ctx context.Context, datas [][]byte, fileSizeLimit uint64) ([]uint64, error) {
+	return w.appendBatch(ctx, datas, fileSizeLimit)
+}
+
+// appendPackedBatch appends datas to a packed log in index order, through the
+// pack buffer as Append does, writing each pack as it fills and then the rest
+// of the buffer. The offsets returned are those durably written. An element
+// rejected by a hook or a size limit is reported with every later element in
+// a *BatchAppendError. If a pack fails to write, the batch stops there: its
+// elements in that pack are reported with their offsets, and stay buffered
+// for the next Flush as after a failed Flush unless another writer took the
+// pack's key, and the later elements are reported without offsets.
+func (w *S3DAL) appendPackedBatch(ctx context.Context, datas [][]byte, fileSizeLimit uint64) ([]uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.lifetime.Err() != nil {
+		return nil, ErrClosed
+	}
+
+	var offsets []uint64
+	var failures []BatchAppendFailure
+	var flushErr error
+	var unflushed uint64 // the first offset of the pack that failed
+	flush := func() {
+		unflushed = w.pending[0].offset
+		if flushErr = w.flushPack(ctx); flushErr == nil {
+			unflushed = 0
+		}
+	}
+	for i, data := range datas {
+		start := time.Now()
+		offset := w.length + 1
+		data, err := w.admitRecord(data, w.size, fileSizeLimit)
+		var stored uint64
+		if err == nil {
+			stored = w.storedSize(len(data))
+			err = w.checkStoredSize(w.stored, stored)
+		}
+		w.observer.RecordAppend(len(data), time.Since(start), err)
+		if err != nil {
+			failures = rejectRemaining(i, len(datas), err)
+			break
+		}
+		w.pending = append(w.pending, packEntry{offset: offset, data: bytes.Clone(data)})
+		w.pendingBytes += len(data)
+		w.setLength(offset)
+		w.size += uint64(len(data))
+		w.setStored(w.stored + stored)
+		offsets = append(offsets, offset)
+		if len(w.pending) >= w.packRecords || w.pendingBytes >= packFlushBytes {
+			if flush(); flushErr != nil {
+				failures = rejectRemaining(i+1, len(datas), flushErr)
+				break
+			}
+		}
+	}
+	if flushErr == nil && len(w.pending) > 0 {
+		flush()
+	}
+
+	written := offsets
+	if flushErr != nil {
+		cut, _ := slices.BinarySearch(offsets, unflushed)
+		written = offsets[:cut]
+		var buffered []BatchAppendFailure
+		for j, offset := range offsets[cut:] {
+			buffered = append(buffered, BatchAppendFailure{Index: cut + j, Offset: offset, Err: flushErr})
+		}
+		failures = append(buffered, failures...)
+	}
+
+	for i, offset := range written {
+		if w.afterAppend != nil {
+			if err := w.afterAppend(offset); err != nil {
+				failures = append(failures, BatchAppendFailure{
+					Index:  i,
+					Offset: offset,
+					Err:    fmt.Errorf("after-append hook failed for committed offset %d: %w", offset, err),
+				})
+			}
+		}
+	}
+	if len(failures) > 0 {
+		sortFailures(failures)
+		return written, &BatchAppendError{Failures: failures}
+	}
+	return written, nil
+}
+
+func (w *S3DAL) appendBatch(ctx context.Context, datas [][]byte, fileSizeLimit uint64) ([]uint64, error) {
+	if w.packRecords > 0 {
+		return nil, ErrPackedLog
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.lifetime.Err() != nil {
+		return nil, ErrClosed
+	}
+
+	startLength := w.length
+	var failures []BatchAppendFailure
+
+	// admit and compress the records and assign their offsets up front,
+	// checking the limits against the running totals of those before them
+	payloads := make([][]byte, 0, len(datas))
+	created := make([]int64, 0, len(datas))
+	sizes := make([]uint64, 0, len(datas))
+	storedSizes := make([]uint64, 0, len(datas))
+	length := startLength
+	size, stored := w.size, w.stored
+	for i, data := range datas {
+		data, err := w.admitRecord(data, size, fileSizeLimit)
+		var payload []byte
+		if err == nil {
+			payload, err = compressPayload(w.compression, data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to prepare object body: failed to compress payload: %w", err)
+			}
+			err = w.checkStoredSize(stored, w.storedSize(len(payload)))
+		}
+		if err != nil {
+			failures = append(failures, rejectRemaining(i, len(datas), err)...)
+			break
+		}
+		length++
+		size += uint64(len(data))
+		stored += w.storedSize(len(payload))
+		payloads = append(payloads, payload)
+		created = append(created, w.nextCreated())
+		sizes = append(sizes, uint64(len(data)))
+		storedSizes = append(storedSizes, w.storedSize(len(payload)))
+	}
+
+	attrs := w.attrs()
+	writeErrs := make([]error, len(payloads))
+	sem := make(chan struct{}, w.batchConcurrency)
+	var wg sync.WaitGroup
+	for i, payload := range payloads {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, payload []byte) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			offset := startLength + uint64(i) + 1
+			start := time.Now()
+			writeErrs[i] = w.putRecord(ctx, offset, created[i], payload, attrs)
+			w.observer.RecordAppend(int(sizes[i]), time.Since(start), writeErrs[i])
+		}(i, payload)
+	}
+	wg.Wait()
+
+	var written []uint64
+	var writtenSize, writtenStored uint64
+	var writeFailures []BatchAppendFailure
+	for i, err := range writeErrs {
+		offset := startLength + uint64(i) + 1
+		if err != nil {
+			writeFailures = append(writeFailures, BatchAppendFailure{Index: i, Offset: offset, Err: err})
+			continue
+		}
+		written = append(written, offset)
+		writtenSize += sizes[i]
+		writtenStored += storedSizes[i]
+	}
+	failures = append(writeFailures, failures...)
+	sortFailures(failures)
+
+	if len(failures) > 0 && w.atomicBatch {
+		keys := make([]string, 0, len(written))
+		for _, offset := range written {
+			keys = append(keys, w.getObjectKey(offset))
+		}
+		if _, err := w.deleteKeys(ctx, keys); err != nil {
+			// the rollback is incomplete, so the written offsets are still taken
+			w.setLength(length)
+			w.size += writtenSize
+			w.setStored(w.stored + writtenStored)
+			w.recordInManifest(ctx, written...)
+			return written, fmt.Errorf("failed to roll back batch: %w (batch error: %w)", err, &BatchAppendError{Failures: failures})
+		}
+		return nil, &BatchAppendError{Failures: failures}
+	}
+
+	w.setLength(length)
+	w.size += writtenSize
+	w.setStored(w.stored + writtenStored)
+	w.recordInManifest(ctx, written...)
+	for _, offset := range written {
+		if w.afterAppend != nil {
+			if err := w.afterAppend(offset); err != nil {
+				failures = append(failures, BatchAppendFailure{
+					Index:  int(offset - startLength - 1),
+					Offset: offset,
+					Err:    fmt.Errorf("after-append hook failed for committed offset %d: %w", offset, err),
+				})
+			}
+		}
+	}
+	if len(failures) > 0 {
+		sortFailures(failures)
+		return written, &BatchAppendError{Failures: failures}
+	}
+	return written, nil
+}
+
+func sortFailures(failures []BatchAppendFailure) {
+	slices.SortStableFunc(failures, func(a, b BatchAppendFailure) int { return a.Index - b.Index })
+}
+
+// rejectRemaining reports indices from..n-1 as not assigned an offset.
+func rejectRemaining(from, n int, err error) []BatchAppendFailure {
+	failures := make([]BatchAppendFailure, 0, n-from)
+	for i := from; i < n; i++ {
+		failures = append(failures, BatchAppendFailure{Index: i, Err: err})
+	}
+	return failures
+}
@@ -0,0 +1,225 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestAppendBatch(t *testing.T) {
+	wal, _ := newFakeDAL(t, WithBatchConcurrency(3))
+	ctx := context.Background()
+
+	datas := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e")}
+	offsets, err := wal.AppendBatch(ctx, datas)
+	if err != nil {
+		t.Fatalf("failed to append batch: %v", err)
+	}
+	if !slices.Equal(offsets, []uint64{1, 2, 3, 4, 5}) {
+		t.Errorf("unexpected offsets %v", offsets)
+	}
+	for i, offset := range offsets {
+		record, err := wal.Read(ctx, offset)
+		if err != nil {
+			t.Fatalf("failed to read offset %d: %v", offset, err)
+		}
+		if string(record.Data) != string(datas[i]) {
+			t.Errorf("offset %d: expected %q, got %q", offset, datas[i], record.Data)
+		}
+	}
+}
+
+func TestAppendBatchSizeLimit(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithFileSizeLimit(50))
+	ctx := context.Background()
+
+	datas := [][]byte{make([]byte, 10), make([]byte, 10), make([]byte, 100), make([]byte, 10)}
+	offsets, err := wal.AppendBatch(ctx, datas)
+	var bae *BatchAppendError
+	if !errors.As(err, &bae) {
+		t.Fatalf("expected BatchAppendError, got %v", err)
+	}
+	if !slices.Equal(offsets, []uint64{1, 2}) {
+		t.Errorf("expected offsets [1 2], got %v", offsets)
+	}
+	if len(bae.Failures) != 2 || bae.Failures[0].Index != 2 || bae.Failures[1].Index != 3 {
+		t.Fatalf("expected indices 2 and 3 to fail, got %+v", bae.Failures)
+	}
+	for _, f := range bae.Failures {
+		if f.Offset != 0 {
+			t.Errorf("index %d: expected no offset assigned, got %d", f.Index, f.Offset)
+		}
+	}
+	if wal.length != 2 || len(fake.objects) != 2 {
+		t.Errorf("expected length 2 and 2 objects, got %d and %d", wal.length, len(fake.objects))
+	}
+}
+
+func TestAppendBatchMultipart(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithMultipartThreshold(minMultipartThreshold), WithContentType("application/x-test"))
+	ctx := context.Background()
+
+	large := make([]byte, minMultipartThreshold+1)
+	for i := range large {
+		large[i] = byte(i)
+	}
+	offsets, err := wal.AppendBatch(ctx, [][]byte{[]byte("small"), large})
+	if err != nil {
+		t.Fatalf("failed to append batch: %v", err)
+	}
+	if fake.putCalls != 1 || fake.partCalls == 0 {
+		t.Errorf("expected one put and a multipart upload, got %d puts and %d parts", fake.putCalls, fake.partCalls)
+	}
+	if got := fake.objects[wal.getObjectKey(offsets[0])].contentType; got != "application/x-test" {
+		t.Errorf("expected the batch's objects to carry the content type, got %q", got)
+	}
+	record, err := wal.Read(ctx, offsets[1])
+	if err != nil || !slices.Equal(record.Data, large) {
+		t.Errorf("expected the multipart record to round-trip, got %d bytes, %v", len(record.Data), err)
+	}
+}
+
+func TestAppendBatchStoredSizeLimit(t *testing.T) {
+	one := recordHeaderLen + 8 + 10 + ChecksumCRC16.Size()
+	wal, _ := newFakeDAL(t, WithStoredSizeLimit(uint64(2*one)))
+	ctx := context.Background()
+
+	// each record fits alone, but the batch's running total stops the third
+	offsets, err := wal.AppendBatch(ctx, [][]byte{make([]byte, 10), make([]byte, 10), make([]byte, 10)})
+	var bae *BatchAppendError
+	var limit *SizeLimitError
+	if !errors.As(err, &bae) || len(bae.Failures) != 1 || bae.Failures[0].Index != 2 || !errors.As(err, &limit) || !limit.Stored {
+		t.Fatalf("expected index 2 over the stored size limit, got %v", err)
+	}
+	if !slices.Equal(offsets, []uint64{1, 2}) || wal.StoredBytes() != uint64(2*one) {
+		t.Errorf("expected offsets [1 2] and %d bytes stored, got %v and %d", 2*one, offsets, wal.StoredBytes())
+	}
+}
+
+func TestBatchAppend(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	datas := [][]byte{make([]byte, 10), make([]byte, 10), make([]byte, 100)}
+	offsets, err := wal.BatchAppend(ctx, datas, 50)
+	var bae *BatchAppendError
+	if !errors.As(err, &bae) || len(bae.Failures) != 1 || bae.Failures[0].Index != 2 {
+		t.Fatalf("expected index 2 over the batch's limit, got %v", err)
+	}
+	if !slices.Equal(offsets, []uint64{1, 2}) || wal.length != 2 || len(fake.objects) != 2 {
+		t.Errorf("expected offsets [1 2] written, got %v, length %d, %d objects", offsets, wal.length, len(fake.objects))
+	}
+}
+
+func TestBatchAppendPacked(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithPacking(4))
+	ctx := context.Background()
+
+	datas := make([][]byte, 10)
+	for i := range datas {
+		datas[i] = []byte(fmt.Sprintf("record %d", i+1))
+	}
+	offsets, err := wal.BatchAppend(ctx, datas, math.MaxUint64)
+	if err != nil {
+		t.Fatalf("failed to append batch: %v", err)
+	}
+	if len(offsets) != 10 || offsets[9] != 10 {
+		t.Fatalf("expected offsets 1 to 10, got %v", offsets)
+	}
+	if fake.putCalls != 3 {
+		t.Errorf("expected the batch written as 3 packs, got %d puts", fake.putCalls)
+	}
+	reader, err := OpenS3DAL(ctx, fake, wal.bucketName, wal.prefix, WithPacking(4))
+	if err != nil {
+		t.Fatalf("failed to open packed log: %v", err)
+	}
+	if record, err := reader.Read(ctx, 10); err != nil || string(record.Data) != "record 10" {
+		t.Errorf("expected the whole batch durable, got %q, %v", record.Data, err)
+	}
+
+	// a failed pack reports its records with their offsets, and stops the batch
+	var bae *BatchAppendError
+	fake.putCalls, fake.putErr = 0, errors.New("injected failure")
+	offsets, err = wal.BatchAppend(ctx, datas[:6], math.MaxUint64)
+	if !errors.As(err, &bae) || len(offsets) != 0 || fake.putCalls != 1 {
+		t.Fatalf("expected the batch to stop at its first pack, got %v, %v after %d puts", offsets, err, fake.putCalls)
+	}
+	if len(bae.Failures) != 6 || bae.Failures[3].Offset != 14 || bae.Failures[4].Offset != 0 {
+		t.Errorf("expected the first pack's offsets reported and the rest unassigned, got %+v", bae.Failures)
+	}
+	fake.putErr = nil
+	if err := wal.Flush(ctx); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+	if record, err := wal.Read(ctx, 14); err != nil || string(record.Data) != "record 4" {
+		t.Errorf("expected the buffered pack written by Flush, got %q, %v", record.Data, err)
+	}
+}
+
+func TestAppendBatchConflict(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	// another writer already holds offset 3
+	other := S3DALClient(fake, wal.bucketName, wal.prefix)
+	other.length = 2
+	if _, err := other.Append(ctx, []byte("theirs")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	datas := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")}
+	offsets, err := wal.AppendBatch(ctx, datas)
+	var bae *BatchAppendError
+	if !errors.As(err, &bae) {
+		t.Fatalf("expected BatchAppendError, got %v", err)
+	}
+	if !slices.Equal(offsets, []uint64{1, 2, 4}) {
+		t.Errorf("expected offsets [1 2 4], got %v", offsets)
+	}
+	if len(bae.Failures) != 1 || bae.Failures[0].Index != 2 || bae.Failures[0].Offset != 3 {
+		t.Fatalf("expected index 2 at offset 3 to fail, got %+v", bae.Failures)
+	}
+	if !errors.Is(err, ErrOffsetConflict) {
+		t.Errorf("expected ErrOffsetConflict, got %v", bae.Failures[0].Err)
+	}
+	if wal.length != 4 {
+		t.Errorf("expected length 4, got %d", wal.length)
+	}
+	record, err := wal.Read(ctx, 3)
+	if err != nil {
+		t.Fatalf("failed to read offset 3: %v", err)
+	}
+	if string(record.Data) != "theirs" {
+		t.Errorf("expected the other writer's record to survive, got %q", record.Data)
+	}
+}
+
+func TestAppendBatchAtomic(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithAtomicBatch())
+	ctx := context.Background()
+
+	other := S3DALClient(fake, wal.bucketName, wal.prefix)
+	other.length = 2
+	if _, err := other.Append(ctx, []byte("theirs")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	datas := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")}
+	offsets, err := wal.AppendBatch(ctx, datas)
+	var bae *BatchAppendError
+	if !errors.As(err, &bae) {
+		t.Fatalf("expected BatchAppendError, got %v", err)
+	}
+	if len(offsets) != 0 {
+		t.Errorf("expected no offsets after rollback, got %v", offsets)
+	}
+	if wal.length != 0 {
+		t.Errorf("expected length unchanged, got %d", wal.length)
+	}
+	if len(fake.objects) != 1 {
+		t.Errorf("expected only the other writer's object to remain, got %d objects", len(fake.objects))
+	}
+}
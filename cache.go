@@ -0,0 +1,133 @@
+package s3_dal
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"maps"
+	"sync"
+)
+
+// recordCache is a least-recently-used cache of decoded records by offset,
+// bounded by entry count and by the total size of their data.
+type recordCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int
+	bytes      int
+	order      *list.List // of Record, most recently used first
+	entries    map[uint64]*list.Element
+}
+
+// WithReadCache caches up to maxEntries records read by Read, holding at most
+// maxBytes of record data, and serves repeat reads of them from memory,
+// evicting the least recently used first. A record larger than maxBytes is
+// not cached. Records do not change once written, so entries are only
+// dropped when this client repairs, trims or deletes them; a record another
+// client repairs is served stale until evicted.
+//
+// It is not supported with packing.
+func WithReadCache(maxEntries int, maxBytes int) Option {
+	return func(w *S3DAL) error {
+		if maxEntries <= 0 || maxBytes <= 0 {
+			return fmt.Errorf("invalid read cache: %d entries and %d bytes must both be positive", maxEntries, maxBytes)
+		}
+		w.cache = &recordCache{
+			maxEntries: maxEntries,
+			maxBytes:   maxBytes,
+			order:      list.New(),
+			entries:    make(map[uint64]*list.Element),
+		}
+		return nil
+	}
+}
+
+// get returns a copy of the cached record at offset, marking it recently
+// used. A nil cache never hits.
+func (c *recordCache) get(offset uint64) (Record, bool) {
+	if c == nil {
+		return Record{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[offset]
+	if !ok {
+		return Record{}, false
+	}
+	c.order.MoveToFront(elem)
+	return cloneRecord(elem.Value.(Record)), true
+}
+
+// put caches a copy of record, evicting the least recently used records
+// until it fits.
+func (c *recordCache) put(record Record) {
+	if c == nil || len(record.Data) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[record.Offset]; ok {
+		c.remove(elem)
+	}
+	c.entries[record.Offset] = c.order.PushFront(cloneRecord(record))
+	c.bytes += len(record.Data)
+	for c.order.Len() > c.maxEntries || c.bytes > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+// evict drops the record at offset, if cached.
+func (c *recordCache) evict(offset uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[offset]; ok {
+		c.remove(elem)
+	}
+}
+
+// purge drops every cached record.
+func (c *recordCache) purge() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	clear(c.entries)
+	c.bytes = 0
+}
+
+// remove drops elem. The caller holds mu.
+func (c *recordCache) remove(elem *list.Element) {
+	record := c.order.Remove(elem).(Record)
+	delete(c.entries, record.Offset)
+	c.bytes -= len(record.Data)
+}
+
+// cloneRecord copies record's data and metadata, so neither the cache nor its
+// callers see each other's changes to them.
+func cloneRecord(record Record) Record {
+	record.Data = bytes.Clone(record.Data)
+	record.Metadata = maps.Clone(record.Metadata)
+	return record
+}
+
+// evictKeys drops the records named by keys from the cache before they are
+// deleted. A key that names no single offset, such as a compacted segment's,
+// purges the whole cache.
+func (w *S3DAL) evictKeys(keys []string) {
+	if w.cache == nil {
+		return
+	}
+	for _, key := range keys {
+		offset, err := w.getOffsetFromKey(key)
+		if err != nil {
+			w.cache.purge()
+			return
+		}
+		w.cache.evict(offset)
+	}
+}
@@ -0,0 +1,89 @@
+package s3_dal
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestReadCache(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithReadCache(2, 1<<10))
+	ctx := context.Background()
+
+	for _, data := range []string{"first", "second", "third"} {
+		if _, err := wal.Append(ctx, []byte(data)); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	read := func(offset uint64, want string) {
+		t.Helper()
+		record, err := wal.Read(ctx, offset)
+		if err != nil || string(record.Data) != want {
+			t.Fatalf("expected %q at offset %d, got %q, %v", want, offset, record.Data, err)
+		}
+	}
+
+	read(1, "first")
+	gets := fake.getCalls
+	record, _ := wal.Read(ctx, 1)
+	if fake.getCalls != gets {
+		t.Errorf("expected a hit to skip S3, got %d gets", fake.getCalls-gets)
+	}
+	record.Data[0] = 'X'
+	read(1, "first")
+
+	// reading 2 and 3 evicts 1, the least recently used
+	read(2, "second")
+	read(3, "third")
+	gets = fake.getCalls
+	read(1, "first")
+	if fake.getCalls != gets+1 {
+		t.Errorf("expected offset 1 evicted by count, got %d gets", fake.getCalls-gets)
+	}
+
+	// a repair evicts the stale entry
+	if err := wal.Repair(ctx, 1, []byte("repaired")); err != nil {
+		t.Fatalf("failed to repair: %v", err)
+	}
+	read(1, "repaired")
+
+	// so does a trim
+	if _, err := wal.TrimBefore(ctx, 2); err != nil {
+		t.Fatalf("failed to trim: %v", err)
+	}
+	if _, err := wal.Read(ctx, 1); err == nil {
+		t.Error("expected the trimmed offset not to be served from the cache")
+	}
+}
+
+func TestReadCacheBytes(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithReadCache(10, 10))
+	ctx := context.Background()
+
+	for _, data := range []string{"aaaaaa", "bbbbbb", strings.Repeat("c", 11)} {
+		if _, err := wal.Append(ctx, []byte(data)); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	for offset := uint64(1); offset <= 3; offset++ {
+		if _, err := wal.Read(ctx, offset); err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+	}
+	// 1 and 2 do not fit together, and 3 never fits
+	gets := fake.getCalls
+	for _, offset := range []uint64{2, 1, 3} {
+		if _, err := wal.Read(ctx, offset); err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+	}
+	if got := fake.getCalls - gets; got != 2 {
+		t.Errorf("expected only offset 2 cached, got %d gets for 3 reads", got)
+	}
+
+	for _, opt := range []Option{WithReadCache(0, 10), WithReadCache(10, 0)} {
+		if _, err := New(newFakeS3(), "fake-bucket", "fake-prefix", opt); err == nil {
+			t.Error("expected a non-positive cache bound to be rejected")
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrConcurrentModification is returned by AppendAt when the tail is not the
+// expected last offset, typically because another writer appended first. The
+// caller should re-read the tail, as with LastRecord, and retry.
+var ErrConcurrentModification = errors.New("log modified concurrently")
+
+// AppendAt appends data as the record at expectedLastOffset+1, only if the
+// tail is exactly expectedLastOffset, and returns its offset: a
+// compare-and-swap on the append position, for writers coordinating without
+// ClaimEpoch fencing. The put carries the If-None-Match guard of every
+// append, so if another writer took the offset the 412 comes back wrapped in
+// ErrConcurrentModification, and ErrOffsetConflict too. The offset is also
+// refused without a put when this client already handed it out, and when
+// expectedLastOffset is beyond the length and holds no record, which one
+// HeadObject finds out. An expectedLastOffset of math.MaxUint64, which no
+// offset follows, is ErrInvalidOffset. Limits and hooks apply as for Append.
+// It is not supported with packing.
+func (w *S3DAL) AppendAt(ctx context.Context, expectedLastOffset uint64, data []byte) (_ uint64, err error) {
+	if w.packRecords > 0 {
+		return 0, ErrPackedLog
+	}
+	if w.overwrite == OverwriteAlways {
+		return 0, errors.New("append aborted: AppendAt needs the If-None-Match guard, which OverwriteAlways drops")
+	}
+	if expectedLastOffset == math.MaxUint64 {
+		return 0, fmt.Errorf("%w: no offset follows %d", ErrInvalidOffset, expectedLastOffset)
+	}
+	start := time.Now()
+	defer func() { w.observer.RecordAppend(len(data), time.Since(start), err) }()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	offset := expectedLastOffset + 1
+	defer func() { err = w.opError("append", offset, err) }()
+	if w.lifetime.Err() != nil {
+		return 0, ErrClosed
+	}
+
+	switch {
+	case w.length > expectedLastOffset:
+		return 0, fmt.Errorf("%w: expected the tail at %d, this client is at %d", ErrConcurrentModification, expectedLastOffset, w.length)
+	case w.length < expectedLastOffset:
+		found, err := w.Exists(ctx, expectedLastOffset)
+		if err != nil {
+			return 0, err
+		}
+		if !found {
+			return 0, fmt.Errorf("%w: expected the tail at %d, which holds no record", ErrConcurrentModification, expectedLastOffset)
+		}
+	}
+
+	data, err = w.admitRecord(data, w.size, w.fileSizeLimit)
+	if err != nil {
+		return 0, err
+	}
+	payload, err := compressPayload(w.compression, data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare object body: failed to compress payload: %w", err)
+	}
+	stored := w.storedSize(len(payload))
+	if err := w.checkStoredSize(w.stored, stored); err != nil {
+		return 0, err
+	}
+	if err := w.putRecord(ctx, offset, w.nextCreated(), payload, w.attrs()); err != nil {
+		if errors.Is(err, ErrOffsetConflict) {
+			return 0, fmt.Errorf("%w: %w", ErrConcurrentModification, err)
+		}
+		return 0, err
+	}
+
+	w.setLength(offset)
+	w.size += uint64(len(data))
+	w.setStored(w.stored + stored)
+	w.recordInManifest(ctx, offset)
+	if w.afterAppend != nil {
+		if err := w.afterAppend(offset); err != nil {
+			return offset, fmt.Errorf("after-append hook failed for committed offset %d: %w", offset, err)
+		}
+	}
+	return offset, nil
+}
@@ -0,0 +1,104 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestAppendAtRace(t *testing.T) {
+	fake := newFakeS3()
+	ctx := context.Background()
+	var writers []*S3DAL
+	for range 2 {
+		wal, err := New(fake, "fake-bucket", "fake-prefix")
+		if err != nil {
+			t.Fatalf("failed to create DAL: %v", err)
+		}
+		writers = append(writers, wal)
+	}
+	if _, err := writers[0].Append(ctx, []byte("first")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	// both puts are in flight before either lands
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	fake.beforePut = func(string) {
+		arrived.Done()
+		arrived.Wait()
+	}
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i, wal := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = wal.AppendAt(ctx, 1, []byte("second"))
+		}()
+	}
+	wg.Wait()
+	fake.beforePut = nil
+
+	var won, lost int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			won++
+		case errors.Is(err, ErrConcurrentModification) && errors.Is(err, ErrOffsetConflict):
+			lost++
+		default:
+			t.Fatalf("expected ErrConcurrentModification, got %v", err)
+		}
+	}
+	if won != 1 || lost != 1 {
+		t.Fatalf("expected exactly one writer to win, got %d wins and %d losses", won, lost)
+	}
+
+	// the loser re-reads the tail and retries
+	loser := writers[0]
+	if errs[1] != nil {
+		loser = writers[1]
+	}
+	if _, err := loser.AppendAt(ctx, 1, []byte("stale")); !errors.Is(err, ErrConcurrentModification) {
+		t.Errorf("expected a stale expectation to fail again, got %v", err)
+	}
+	last, err := loser.LastRecord(ctx)
+	if err != nil {
+		t.Fatalf("failed to read the tail: %v", err)
+	}
+	if offset, err := loser.AppendAt(ctx, last.Offset, []byte("third")); err != nil || offset != 3 {
+		t.Errorf("expected the retry to append at 3, got %d, %v", offset, err)
+	}
+}
+
+func TestAppendAtTailBehind(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+	if _, err := wal.Append(ctx, []byte("only")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	puts := fake.putCalls
+	if _, err := wal.AppendAt(ctx, 5, []byte("ahead")); !errors.Is(err, ErrConcurrentModification) {
+		t.Errorf("expected ErrConcurrentModification for a tail behind the expectation, got %v", err)
+	}
+	if _, err := wal.AppendAt(ctx, 0, []byte("behind")); !errors.Is(err, ErrConcurrentModification) {
+		t.Errorf("expected ErrConcurrentModification for a tail past the expectation, got %v", err)
+	}
+	if _, err := wal.AppendAt(ctx, math.MaxUint64, []byte("wrapped")); !errors.Is(err, ErrInvalidOffset) {
+		t.Errorf("expected ErrInvalidOffset for a tail no offset follows, got %v", err)
+	}
+	if fake.putCalls != puts {
+		t.Errorf("expected no put for a refused expectation, got %d", fake.putCalls-puts)
+	}
+
+	fresh, err := New(fake, "fake-bucket", "fake-prefix")
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	if offset, err := fresh.AppendAt(ctx, 1, []byte("checked")); err != nil || offset != 2 {
+		t.Errorf("expected a client behind the tail to check it and append at 2, got %d, %v", offset, err)
+	}
+}
@@ -0,0 +1,118 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+)
+
+// Reader is the read side of a log.
+type Reader interface {
+	Read(ctx context.Context, offset uint64) (Record, error)
+	LastRecord(ctx context.Context) (Record, error)
+	ScanPage(ctx context.Context, token string, limit int, fn func(Record) error) (string, error)
+}
+
+var _ Reader = (*S3DAL)(nil)
+
+type chain struct {
+	dals []*S3DAL
+}
+
+// Chain returns a Reader presenting several DALs as one continuous log, for
+// example the old and new buckets during a phased migration. When an offset
+// exists in more than one DAL, the earliest DAL in the argument list takes
+// precedence for reads and scans.
+func Chain(readers ...*S3DAL) Reader {
+	return &chain{dals: readers}
+}
+
+// Read returns the record from the first DAL that has the offset. Only a
+// missing key moves on to the next DAL; any other failure is returned as is.
+func (c *chain) Read(ctx context.Context, offset uint64) (Record, error) {
+	var lastErr error = ErrEmptyLog
+	for _, dal := range c.dals {
+		record, err := dal.Read(ctx, offset)
+		if err == nil {
+			return record, nil
+		}
+		if !errors.Is(err, ErrRecordNotFound) {
+			return Record{}, err
+		}
+		lastErr = err
+	}
+	return Record{}, lastErr
+}
+
+// LastRecord returns the record with the highest offset across all DALs.
+func (c *chain) LastRecord(ctx context.Context) (Record, error) {
+	var last Record
+	found := false
+	for _, dal := range c.dals {
+		record, err := dal.LastRecord(ctx)
+		if errors.Is(err, ErrEmptyLog) {
+			continue
+		}
+		if err != nil {
+			return Record{}, err
+		}
+		if !found || record.Offset > last.Offset {
+			last, found = record, true
+		}
+	}
+	if !found {
+		return Record{}, ErrEmptyLog
+	}
+	return last, nil
+}
+
+// ScanPage merges the DALs by offset; tokens have the same meaning as for
+// S3DAL.ScanPage.
+func (c *chain) ScanPage(ctx context.Context, token string, limit int, fn func(Record) error) (string, error) {
+	after, err := parseScanToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	// the first DAL to list an offset owns it
+	owner := make(map[uint64]*S3DAL)
+	var merged []uint64
+	more := false
+	for _, dal := range c.dals {
+		offsets, dalMore, err := dal.listOffsetsAfter(ctx, after, limit)
+		if err != nil {
+			return token, err
+		}
+		for _, offset := range offsets {
+			if _, ok := owner[offset]; !ok {
+				owner[offset] = dal
+				merged = append(merged, offset)
+			}
+		}
+		if dalMore {
+			more = true
+		}
+	}
+
+	slices.Sort(merged)
+	if len(merged) > limit {
+		merged = merged[:limit]
+		more = true
+	}
+	for _, offset := range merged {
+		record, err := owner[offset].Read(ctx, offset)
+		if err != nil {
+			return token, err
+		}
+		if err := fn(record); err != nil {
+			return token, err
+		}
+		token = strconv.FormatUint(offset, 10)
+	}
+
+	if !more {
+		return "", nil
+	}
+	return token, nil
+}
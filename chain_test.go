@@ -0,0 +1,86 @@
+package s3_dal
+
+import (
+	"context"
+	"testing"
+)
+
+// newSplitLog returns a chain over two backends: the old one holds offsets
+// 1-3 and the new one 3-5, with offset 3 present in both.
+func newSplitLog(t *testing.T) Reader {
+	ctx := context.Background()
+	oldDAL, _ := newFakeDAL(t)
+	newDAL, _ := newFakeDAL(t)
+
+	for _, data := range []string{"one", "two", "three-old"} {
+		if _, err := oldDAL.Append(ctx, []byte(data)); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	newDAL.length = 2
+	for _, data := range []string{"three-new", "four", "five"} {
+		if _, err := newDAL.Append(ctx, []byte(data)); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	return Chain(oldDAL, newDAL)
+}
+
+func TestChainRead(t *testing.T) {
+	log := newSplitLog(t)
+	ctx := context.Background()
+
+	want := map[uint64]string{1: "one", 2: "two", 3: "three-old", 4: "four", 5: "five"}
+	for offset, data := range want {
+		record, err := log.Read(ctx, offset)
+		if err != nil {
+			t.Fatalf("failed to read offset %d: %v", offset, err)
+		}
+		if string(record.Data) != data {
+			t.Errorf("offset %d: expected %q, got %q", offset, data, record.Data)
+		}
+	}
+
+	if _, err := log.Read(ctx, 6); err == nil {
+		t.Error("expected error reading past the end of the chain")
+	}
+
+	last, err := log.LastRecord(ctx)
+	if err != nil {
+		t.Fatalf("failed to get last record: %v", err)
+	}
+	if last.Offset != 5 {
+		t.Errorf("expected last offset 5, got %d", last.Offset)
+	}
+}
+
+func TestChainScanPage(t *testing.T) {
+	log := newSplitLog(t)
+	ctx := context.Background()
+
+	var got []string
+	token := ""
+	for {
+		var err error
+		token, err = log.ScanPage(ctx, token, 2, func(r Record) error {
+			got = append(got, string(r.Data))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to scan: %v", err)
+		}
+		if token == "" {
+			break
+		}
+	}
+
+	want := []string{"one", "two", "three-old", "four", "five"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("position %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+}
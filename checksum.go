@@ -0,0 +1,233 @@
+package s3_dal
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Checksummer computes and verifies the trailer that guards each record.
+// Every Checksum is one; WithChecksum also takes other implementations of
+// them.
+type Checksummer interface {
+	// Sum returns the trailer for data.
+	Sum(data []byte) []byte
+	// Size is the length of the trailer in bytes.
+	Size() int
+	// Verify reports whether sum is the trailer for data.
+	Verify(data, sum []byte) bool
+}
+
+// Checksum is the algorithm of the trailer that guards each record. The one
+// used is recorded in each record's header, so Read verifies it whatever the
+// reading client is configured with.
+type Checksum byte
+
+var _ Checksummer = ChecksumCRC16
+
+const (
+	// ChecksumCRC16 is the 2-byte CRC-16-CCITT every headerless record uses.
+	ChecksumCRC16 Checksum = iota
+	// ChecksumCRC32C is the 4-byte Castagnoli CRC, the variant S3 also
+	// supports natively.
+	ChecksumCRC32C
+	// ChecksumSHA256 is a 32-byte SHA-256 digest, for tamper evidence rather
+	// than just corruption detection.
+	ChecksumSHA256
+	// ChecksumNone writes no trailer, for payloads already guarded end to end,
+	// such as sealed with WithClientEncryption. Torn or corrupted bodies are
+	// then caught only by their header, if at all.
+	ChecksumNone
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func (c Checksum) String() string {
+	switch c {
+	case ChecksumCRC16:
+		return "CRC16"
+	case ChecksumCRC32C:
+		return "CRC32C"
+	case ChecksumSHA256:
+		return "SHA256"
+	case ChecksumNone:
+		return "None"
+	}
+	return fmt.Sprintf("Checksum(%d)", byte(c))
+}
+
+func (c Checksum) valid() bool {
+	return c <= ChecksumNone
+}
+
+// Size is the length of the trailer in bytes.
+func (c Checksum) Size() int {
+	switch c {
+	case ChecksumCRC32C:
+		return crc32.Size
+	case ChecksumSHA256:
+		return sha256.Size
+	case ChecksumNone:
+		return 0
+	}
+	return 2
+}
+
+// Sum returns the big-endian trailer for data.
+func (c Checksum) Sum(data []byte) []byte {
+	h := c.newHash()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// Verify reports whether sum is the trailer for data.
+func (c Checksum) Verify(data, sum []byte) bool {
+	return bytes.Equal(c.Sum(data), sum)
+}
+
+// newHash returns a running checksum whose Sum is the trailer, for callers
+// that see a record in pieces.
+func (c Checksum) newHash() hash.Hash {
+	switch c {
+	case ChecksumCRC32C:
+		return crc32.New(castagnoli)
+	case ChecksumSHA256:
+		return sha256.New()
+	case ChecksumNone:
+		return noneHash{}
+	}
+	return &crc16Hash{crc: crc16Init}
+}
+
+// s3Algorithm is the matching checksum S3 can verify on upload, if any.
+func (c Checksum) s3Algorithm() types.ChecksumAlgorithm {
+	switch c {
+	case ChecksumCRC32C:
+		return types.ChecksumAlgorithmCrc32c
+	case ChecksumSHA256:
+		return types.ChecksumAlgorithmSha256
+	}
+	return ""
+}
+
+// algorithmOf is the Checksum whose ID c records in the header: c itself, or
+// the one named by the Algorithm method of another implementation.
+func algorithmOf(c Checksummer) (Checksum, bool) {
+	switch c := c.(type) {
+	case Checksum:
+		return c, c.valid()
+	case interface{ Algorithm() Checksum }:
+		id := c.Algorithm()
+		return id, id.valid()
+	}
+	return 0, false
+}
+
+// verifier is the Checksummer for records whose header names id: the one set
+// with WithChecksum if it is for id, else the built-in one.
+func verifier(id Checksum, configured Checksummer) Checksummer {
+	if configured != nil {
+		if c, ok := algorithmOf(configured); ok && c == id {
+			return configured
+		}
+	}
+	return id
+}
+
+// checksummerFor is verifier for w's configured Checksummer.
+func (w *S3DAL) checksummerFor(id Checksum) Checksummer {
+	return verifier(id, w.checksummer)
+}
+
+// uploadChecksum is the checksum S3 is asked to verify uploads with: the one
+// set with WithS3Checksum, or else the record checksum's match, if any.
+func (w *S3DAL) uploadChecksum() types.ChecksumAlgorithm {
+	if w.s3Checksum != "" {
+		return w.s3Checksum
+	}
+	return w.checksum.s3Algorithm()
+}
+
+// downloadChecksum is the ChecksumMode of a GetObject: enabled with
+// WithS3Checksum or WithStorageChecksum, so S3 returns the stored checksum
+// and the SDK verifies the body against it.
+func (w *S3DAL) downloadChecksum() types.ChecksumMode {
+	if w.s3Checksum != "" || w.verifyStorage {
+		return types.ChecksumModeEnabled
+	}
+	return ""
+}
+
+// checkStorageChecksum compares body with the checksum S3 stored for it and
+// returned in result, under WithStorageChecksum. An object stored without a
+// checksum, or with the composite one of a multipart upload, which covers its
+// parts rather than the body, has nothing to compare.
+func (w *S3DAL) checkStorageChecksum(result *s3.GetObjectOutput, body []byte) error {
+	if !w.verifyStorage {
+		return nil
+	}
+	for _, stored := range []struct {
+		algorithm types.ChecksumAlgorithm
+		value     string
+		hash      func() hash.Hash
+	}{
+		{types.ChecksumAlgorithmCrc32c, aws.ToString(result.ChecksumCRC32C), func() hash.Hash { return crc32.New(castagnoli) }},
+		{types.ChecksumAlgorithmCrc32, aws.ToString(result.ChecksumCRC32), func() hash.Hash { return crc32.NewIEEE() }},
+		{types.ChecksumAlgorithmSha256, aws.ToString(result.ChecksumSHA256), sha256.New},
+		{types.ChecksumAlgorithmSha1, aws.ToString(result.ChecksumSHA1), sha1.New},
+	} {
+		if stored.value == "" || strings.Contains(stored.value, "-") {
+			continue
+		}
+		h := stored.hash()
+		h.Write(body)
+		if got := base64.StdEncoding.EncodeToString(h.Sum(nil)); got != stored.value {
+			return fmt.Errorf("%w: %s stored as %s, body has %s", ErrStorageChecksumMismatch, stored.algorithm, stored.value, got)
+		}
+	}
+	return nil
+}
+
+// storageReadError marks a failed body read as ErrStorageChecksumMismatch
+// when it is the SDK's own verification failing, which it reports only by
+// message.
+func storageReadError(err error) error {
+	if strings.Contains(err.Error(), "checksum did not match") {
+		return fmt.Errorf("%w: %w", ErrStorageChecksumMismatch, err)
+	}
+	return fmt.Errorf("failed to read object body: %w", err)
+}
+
+// crc16Hash adapts crc16Update to hash.Hash.
+type crc16Hash struct {
+	crc uint16
+}
+
+func (h *crc16Hash) Write(p []byte) (int, error) {
+	h.crc = crc16Update(h.crc, p)
+	return len(p), nil
+}
+
+func (h *crc16Hash) Sum(b []byte) []byte { return binary.BigEndian.AppendUint16(b, h.crc) }
+func (h *crc16Hash) Reset()              { h.crc = crc16Init }
+func (h *crc16Hash) Size() int           { return 2 }
+func (h *crc16Hash) BlockSize() int      { return 1 }
+
+// noneHash is the empty trailer of ChecksumNone.
+type noneHash struct{}
+
+func (noneHash) Write(p []byte) (int, error) { return len(p), nil }
+func (noneHash) Sum(b []byte) []byte         { return b }
+func (noneHash) Reset()                      {}
+func (noneHash) Size() int                   { return 0 }
+func (noneHash) BlockSize() int              { return 1 }
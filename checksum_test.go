@@ -0,0 +1,337 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestChecksumsDetectSingleByteFlips(t *testing.T) {
+	for c, algorithm := range map[Checksum]types.ChecksumAlgorithm{
+		ChecksumCRC32C: types.ChecksumAlgorithmCrc32c,
+		ChecksumSHA256: types.ChecksumAlgorithmSha256,
+	} {
+		wal, fake := newFakeDAL(t, WithChecksum(c))
+		ctx := context.Background()
+
+		offset, err := wal.Append(ctx, []byte("guarded by a longer trailer"))
+		if err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+		if fake.lastPut.ChecksumAlgorithm != algorithm {
+			t.Errorf("%s: expected the upload checksum to be %q, got %q", c, algorithm, fake.lastPut.ChecksumAlgorithm)
+		}
+		key := wal.getObjectKey(offset)
+		original := bytes.Clone(fake.objects[key].body)
+		if len(original) != recordHeaderLen+8+len("guarded by a longer trailer")+c.Size() {
+			t.Errorf("%s: expected a %d-byte trailer, got a %d-byte body", c, c.Size(), len(original))
+		}
+
+		for i := range original {
+			for _, mask := range []byte{0x01, 0x80, 0xFF} {
+				obj := fake.objects[key]
+				obj.body = bytes.Clone(original)
+				obj.body[i] ^= mask
+				fake.objects[key] = obj
+
+				_, err := wal.Read(ctx, offset)
+				if err == nil {
+					t.Fatalf("%s: byte %d ^ 0x%02X: expected the corruption to be detected", c, i, mask)
+				}
+				// past the header and offset, only the checksum can catch it
+				if i >= recordHeaderLen+8 && !errors.Is(err, ErrChecksumMismatch) {
+					t.Errorf("%s: byte %d ^ 0x%02X: expected ErrChecksumMismatch, got %v", c, i, mask, err)
+				}
+			}
+		}
+	}
+}
+
+func TestChecksumVerify(t *testing.T) {
+	data := []byte("checksummed")
+	for _, c := range []Checksum{ChecksumCRC16, ChecksumCRC32C, ChecksumSHA256} {
+		trailer := c.Sum(data)
+		if len(trailer) != c.Size() {
+			t.Errorf("%s: expected a %d-byte sum, got %d", c, c.Size(), len(trailer))
+		}
+		if !c.Verify(data, trailer) {
+			t.Errorf("%s: expected its own sum to verify", c)
+		}
+		if c.Verify([]byte("tampered"), trailer) {
+			t.Errorf("%s: expected a sum of other data not to verify", c)
+		}
+	}
+	if got := ChecksumCRC16.Sum(data); !bytes.Equal(got, binary.BigEndian.AppendUint16(nil, crc16Fast(data))) {
+		t.Errorf("expected the CRC16 sum to match crc16Fast, got %X", got)
+	}
+}
+
+// countingSHA256 is a Checksummer for ChecksumSHA256 counting its uses.
+type countingSHA256 struct {
+	sums, verifies int
+}
+
+func (c *countingSHA256) Algorithm() Checksum { return ChecksumSHA256 }
+func (c *countingSHA256) Size() int           { return ChecksumSHA256.Size() }
+
+func (c *countingSHA256) Sum(data []byte) []byte {
+	c.sums++
+	return ChecksumSHA256.Sum(data)
+}
+
+func (c *countingSHA256) Verify(data, sum []byte) bool {
+	c.verifies++
+	return ChecksumSHA256.Verify(data, sum)
+}
+
+func TestChecksummer(t *testing.T) {
+	custom := &countingSHA256{}
+	wal, fake := newFakeDAL(t, WithChecksum(custom))
+	ctx := context.Background()
+
+	offset, err := wal.Append(ctx, []byte("custom"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if custom.sums != 1 {
+		t.Errorf("expected the record summed by the configured Checksummer, got %d sums", custom.sums)
+	}
+	if _, err := wal.Read(ctx, offset); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if custom.verifies != 1 {
+		t.Errorf("expected the read verified by the configured Checksummer, got %d verifies", custom.verifies)
+	}
+
+	// the header names SHA-256, so a client without it verifies with the
+	// built-in one
+	plain, err := New(fake, wal.bucketName, wal.prefix)
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	record, err := plain.Read(ctx, offset)
+	if err != nil {
+		t.Fatalf("failed to read without the Checksummer: %v", err)
+	}
+	if string(record.Data) != "custom" {
+		t.Errorf("expected %q, got %q", "custom", record.Data)
+	}
+	if f, err := parseFrame(fake.objects[wal.getObjectKey(offset)].body, false); err != nil || f.checksum != ChecksumSHA256 {
+		t.Errorf("expected a SHA256 header, got %s, %v", f.checksum, err)
+	}
+
+	// a CRC16 record is still verified with CRC16
+	plain.length = 1
+	if _, err := plain.Append(ctx, []byte("crc16")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	wal.length = 2
+	if _, err := wal.Read(ctx, 2); err != nil {
+		t.Fatalf("failed to read the CRC16 record: %v", err)
+	}
+	if custom.verifies != 1 {
+		t.Errorf("expected the CRC16 record not verified by the SHA-256 Checksummer, got %d verifies", custom.verifies)
+	}
+
+	if _, err := New(fake, wal.bucketName, wal.prefix, WithChecksum(unnamedChecksummer{})); err == nil {
+		t.Error("expected a Checksummer naming no algorithm to be rejected")
+	}
+	if _, err := New(fake, wal.bucketName, wal.prefix, WithChecksum(Checksum(7))); err == nil {
+		t.Error("expected an unknown Checksum to be rejected")
+	}
+}
+
+// unnamedChecksummer has no Algorithm method, so cannot be recorded in a
+// header.
+type unnamedChecksummer struct{}
+
+func (unnamedChecksummer) Sum(data []byte) []byte       { return nil }
+func (unnamedChecksummer) Size() int                    { return 0 }
+func (unnamedChecksummer) Verify(data, sum []byte) bool { return true }
+
+func TestChecksumNone(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithChecksum(ChecksumNone))
+	ctx := context.Background()
+
+	offset, err := wal.Append(ctx, []byte("unguarded"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	body := fake.objects[wal.getObjectKey(offset)].body
+	if len(body) != recordHeaderLen+8+len("unguarded") {
+		t.Errorf("expected no trailer, got a %d-byte body", len(body))
+	}
+	if fake.lastPut.ChecksumAlgorithm != "" {
+		t.Errorf("expected no upload checksum, got %q", fake.lastPut.ChecksumAlgorithm)
+	}
+	record, err := wal.Read(ctx, offset)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if string(record.Data) != "unguarded" {
+		t.Errorf("expected %q, got %q", "unguarded", record.Data)
+	}
+	if decoded, err := DecodeRecord(body); err != nil || string(decoded.Data) != "unguarded" {
+		t.Errorf("expected DecodeRecord to read it, got %q, %v", decoded.Data, err)
+	}
+	if sum := ChecksumNone.Sum([]byte("data")); len(sum) != 0 || !ChecksumNone.Verify([]byte("data"), sum) {
+		t.Errorf("expected an empty sum that verifies, got %X", sum)
+	}
+	if ChecksumNone.Verify([]byte("data"), []byte{0}) {
+		t.Error("expected a non-empty sum not to verify")
+	}
+}
+
+// TestCRC16KnownAnswers pins the record CRC16, since stored records depend on
+// it. The values were computed by crc16Fast itself.
+func TestCRC16KnownAnswers(t *testing.T) {
+	for input, want := range map[string]uint16{
+		"":          0xCACA,
+		"a":         0xCE81,
+		"123456789": 0xA41D,
+		"The quick brown fox jumps over the lazy dog": 0x1FCC,
+		"\x00\xff\x80": 0x8ADE,
+	} {
+		if got := crc16Fast([]byte(input)); got != want {
+			t.Errorf("crc16Fast(%q): expected %#04x, got %#04x", input, want, got)
+		}
+	}
+	// from the standard initial value it is CRC-16/CCITT-FALSE, whose
+	// published check value this is
+	if got := crc16Update(0xFFFF, []byte("123456789")); got != 0x29B1 {
+		t.Errorf("expected the CCITT-FALSE check value 0x29b1, got %#04x", got)
+	}
+}
+
+func TestChecksumChosenPerRecord(t *testing.T) {
+	crc16, fake := newFakeDAL(t)
+	crc32c, err := New(fake, crc16.bucketName, crc16.prefix, WithChecksum(ChecksumCRC32C))
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := crc16.Append(ctx, []byte("short trailer")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	crc32c.length = 1
+	if _, err := crc32c.Append(ctx, []byte("long trailer")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	for _, reader := range []*S3DAL{crc16, crc32c} {
+		for offset, want := range map[uint64]string{1: "short trailer", 2: "long trailer"} {
+			record, err := reader.Read(ctx, offset)
+			if err != nil {
+				t.Fatalf("failed to read offset %d: %v", offset, err)
+			}
+			if string(record.Data) != want {
+				t.Errorf("offset %d: expected %q, got %q", offset, want, record.Data)
+			}
+		}
+	}
+}
+
+func TestS3Checksum(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithS3Checksum(types.ChecksumAlgorithmSha256))
+	ctx := context.Background()
+
+	offset, err := wal.Append(ctx, []byte("checked on the wire"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if fake.lastPut.ChecksumAlgorithm != types.ChecksumAlgorithmSha256 {
+		t.Errorf("expected the upload checksum to be SHA256 over the CRC16 record checksum, got %q", fake.lastPut.ChecksumAlgorithm)
+	}
+	if _, err := wal.Read(ctx, offset); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if fake.lastGet.ChecksumMode != types.ChecksumModeEnabled {
+		t.Errorf("expected the read to ask for the checksum, got %q", fake.lastGet.ChecksumMode)
+	}
+
+	plain, plainFake := newFakeDAL(t)
+	if offset, err = plain.Append(ctx, []byte("unchecked")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if _, err := plain.Read(ctx, offset); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if plainFake.lastPut.ChecksumAlgorithm != "" || plainFake.lastGet.ChecksumMode != "" {
+		t.Errorf("expected no S3 checksum by default, got %q and %q", plainFake.lastPut.ChecksumAlgorithm, plainFake.lastGet.ChecksumMode)
+	}
+
+	if _, err := New(fake, "fake-bucket", "fake-prefix", WithS3Checksum("MD4")); err == nil {
+		t.Error("expected an unknown algorithm to be rejected")
+	}
+}
+
+// storedChecksumS3 returns a CRC32C with every get, as S3 does for an object
+// uploaded with one, corrupted if wrong is set.
+type storedChecksumS3 struct {
+	*fakeS3
+	wrong bool
+}
+
+func (s *storedChecksumS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	output, err := s.fakeS3.GetObject(ctx, params, optFns...)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, err
+	}
+	sum := crc32.Checksum(body, crc32.MakeTable(crc32.Castagnoli))
+	if s.wrong {
+		sum++
+	}
+	output.ChecksumCRC32C = aws.String(base64.StdEncoding.EncodeToString(binary.BigEndian.AppendUint32(nil, sum)))
+	output.Body = io.NopCloser(bytes.NewReader(body))
+	return output, nil
+}
+
+func TestStorageChecksum(t *testing.T) {
+	stored := &storedChecksumS3{fakeS3: newFakeS3()}
+	wal, err := New(stored, "fake-bucket", "fake-prefix", WithStorageChecksum())
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	ctx := context.Background()
+	offset, err := wal.Append(ctx, []byte("checked at rest"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if record, err := wal.Read(ctx, offset); err != nil || string(record.Data) != "checked at rest" {
+		t.Fatalf("expected a matching checksum to read, got %q, %v", record.Data, err)
+	}
+	if stored.lastGet.ChecksumMode != types.ChecksumModeEnabled {
+		t.Errorf("expected the read to ask for the checksum, got %q", stored.lastGet.ChecksumMode)
+	}
+
+	stored.wrong = true
+	if _, err := wal.Read(ctx, offset); !errors.Is(err, ErrStorageChecksumMismatch) || errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrStorageChecksumMismatch alone, got %v", err)
+	}
+	if _, err := wal.ReadRaw(ctx, wal.getObjectKey(offset)); !errors.Is(err, ErrStorageChecksumMismatch) {
+		t.Errorf("expected ReadRaw to check the stored checksum too, got %v", err)
+	}
+
+	// without the option the stored checksum is not compared
+	plain, err := New(stored, "fake-bucket", "fake-prefix")
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	if _, err := plain.Read(ctx, offset); err != nil {
+		t.Errorf("expected the stored checksum ignored by default, got %v", err)
+	}
+}
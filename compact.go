@@ -0,0 +1,477 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// A log with WithCompaction may hold runs of records rewritten by Compact into
+// segments under prefix/_compacted/. A segment is named by its first offset
+// and its number of records, "<offset>-<count>", and framed as a pack whose
+// entries hold whole record objects, header and checksum included. A segment
+// spans fewer than maxPackRecords offsets, so the segment holding an offset is
+// among those named by the maxPackRecords offsets up to it, found with a
+// single list.
+const compactedDirName = "_compacted"
+
+func (w *S3DAL) compactedPrefix() string {
+	return w.keyUnder(compactedDirName) + w.delimiter
+}
+
+func (w *S3DAL) segmentKey(first uint64, count int) string {
+	return w.compactedPrefix() + w.encodeOffset(first) + "-" + strconv.Itoa(count)
+}
+
+// parseSegmentKey returns the first offset and record count a segment key
+// names.
+func (w *S3DAL) parseSegmentKey(key string) (uint64, int, error) {
+	name, ok := strings.CutPrefix(key, w.compactedPrefix())
+	i := strings.LastIndexByte(name, '-')
+	if !ok || i < 0 {
+		return 0, 0, fmt.Errorf("invalid segment key %q", key)
+	}
+	first, err := w.decodeOffset(name[:i])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid segment key %q: %w", key, err)
+	}
+	count, err := strconv.Atoi(name[i+1:])
+	if err != nil || count < 1 {
+		return 0, 0, fmt.Errorf("invalid segment key %q: bad record count", key)
+	}
+	return first, count, nil
+}
+
+func (w *S3DAL) isSegmentKey(key string) bool {
+	return w.compaction && strings.HasPrefix(key, w.compactedPrefix())
+}
+
+// Compact rewrites the records at offsets [start, end) into segments of up to
+// maxPackRecords records each, then deletes the originals,
+// so a range left sparse by trims and deletes takes few objects. Offsets,
+// data and creation times are kept, and holes stay holes. Every record is
+// verified before it is rewritten. The segments are written before anything
+// is deleted, so a call that fails part way leaves every record readable, some
+// of them twice, and can be run again.
+//
+// It needs WithCompaction, as does every client reading the log. The last
+// record is never compacted, so the tail is found as before. A range must
+// cover any segment it touches whole, and trims and deletes fail without
+// deleting anything rather than split a segment; after a failed call, run it
+// again before deleting in the range. ReadPartial and RecordSize address
+// uncompacted records only.
+func (w *S3DAL) Compact(ctx context.Context, start, end uint64) error {
+	if err := checkRange(start, end); err != nil {
+		return err
+	}
+	if !w.compaction {
+		return errors.New("compaction needs WithCompaction")
+	}
+	if w.packRecords > 0 {
+		return ErrPackedLog
+	}
+	if w.lifetime.Err() != nil {
+		return ErrClosed
+	}
+	last, err := w.lastOffset(ctx)
+	if errors.Is(err, ErrEmptyLog) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	end = min(end, last)
+
+	var listed []listedRecord
+	segments := make(map[string]bool)
+	plain := 0
+	err = w.listRecords(ctx, max(start, 1)-1, 0, func(offset uint64, obj types.Object) (bool, error) {
+		if offset >= end {
+			return false, nil
+		}
+		listed = append(listed, listedRecord{offset: offset, obj: obj})
+		if key := aws.ToString(obj.Key); w.isSegmentKey(key) {
+			segments[key] = true
+		} else {
+			plain++
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	// a segment some of whose records are still listed uncompacted, after a
+	// failed call, holds more than the listing shows, so it is read in full
+	contents := make(map[string]map[uint64][]byte, len(segments))
+	for key := range segments {
+		entries, err := w.readSegment(ctx, key)
+		if err != nil {
+			return err
+		}
+		for offset := range entries {
+			if offset < start || offset >= end {
+				return fmt.Errorf("cannot compact part of segment %s: it holds offset %d", key, offset)
+			}
+		}
+		contents[key] = entries
+	}
+	if plain == 0 && len(segments) <= 1 {
+		// already as dense as it gets
+		return nil
+	}
+
+	if err := w.checkFence(ctx); err != nil {
+		return err
+	}
+	var (
+		group   []packEntry
+		size    int
+		written = make(map[string]bool)
+		stale   []string
+	)
+	flush := func() error {
+		if len(group) == 0 {
+			return nil
+		}
+		key := w.segmentKey(group[0].offset, len(group))
+		if err := w.putSegment(ctx, key, encodePack(group)); err != nil {
+			return err
+		}
+		written[key] = true
+		group, size = nil, 0
+		return nil
+	}
+	for _, r := range listed {
+		key := aws.ToString(r.obj.Key)
+		var body []byte
+		if entries, ok := contents[key]; ok {
+			body = entries[r.offset]
+		} else {
+			if body, err = w.compactedBody(ctx, r.offset); err != nil {
+				return err
+			}
+			stale = append(stale, key)
+		}
+		if len(group) > 0 && (len(group) == maxPackRecords || r.offset-group[0].offset >= maxPackRecords || size+len(body) > packFlushBytes) {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		group = append(group, packEntry{offset: r.offset, data: body})
+		size += len(body)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	var originals []string
+	for key := range contents {
+		stale = append(stale, key)
+	}
+	for _, key := range stale {
+		if !written[key] {
+			originals = append(originals, key)
+		}
+	}
+	_, err = w.deleteObjects(ctx, originals, nil)
+	return err
+}
+
+// compactedBody reads and verifies the record object at offset for a
+// segment. A record written with WithSkipCRCOnWrite gets its checksum filled
+// in, since a segment entry carries no metadata.
+func (w *S3DAL) compactedBody(ctx context.Context, offset uint64) ([]byte, error) {
+	result, err := w.getRecord(ctx, offset, "")
+	if err != nil {
+		return nil, err
+	}
+	defer result.Body.Close()
+
+	body, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object body: %w", err)
+	}
+	f, err := parseFrame(body, w.legacyFormat)
+	if err != nil {
+		return nil, fmt.Errorf("offset %d: %w", offset, withSize(err, int64(len(body))))
+	}
+	if f.offset != offset {
+		return nil, offsetMismatch(offset, f.offset)
+	}
+	checksum := w.checksummerFor(f.checksum)
+	n := len(body) - checksum.Size()
+	if unchecked(result.Metadata, f, body) {
+		// the segment entry is checked, so it is no longer flagged otherwise
+		if f.unchecked {
+			body[3] &^= flagUnchecked
+		}
+		return append(body[:n:n], checksum.Sum(body[:n])...), nil
+	}
+	if !validateChecksum(body, checksum, w.logger) {
+		w.observer.RecordChecksumFailure(offset)
+		return nil, fmt.Errorf("%w: offset %d", ErrChecksumMismatch, offset)
+	}
+	return body, nil
+}
+
+// putSegment writes a segment body at key. It is put like a record, but
+// unconditionally, since compacting an unchanged range again rewrites it.
+func (w *S3DAL) putSegment(ctx context.Context, key string, body []byte) error {
+	input := w.putInput(0, body)
+	input.Key = aws.String(key)
+	input.IfNoneMatch = nil
+	input.Metadata = nil
+	if _, err := w.client.PutObject(ctx, input); err != nil {
+		return fmt.Errorf("failed to put segment %s to S3%s: %w", key, w.sseHint(err), err)
+	}
+	return nil
+}
+
+// readSegment returns the record objects in the segment at key by offset,
+// checking the CRC of every entry.
+func (w *S3DAL) readSegment(ctx context.Context, key string) (map[uint64][]byte, error) {
+	body, err := w.getRange(ctx, key, "")
+	if err != nil {
+		return nil, err
+	}
+	entries, err := packEntries(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: segment %s", err, key)
+	}
+	contents := make(map[uint64][]byte, len(entries))
+	for _, e := range entries {
+		contents[e.offset] = e.data
+	}
+	return contents, nil
+}
+
+// packEntries returns every entry of a pack body, checking each CRC.
+func packEntries(body []byte) ([]packEntry, error) {
+	if len(body) < packHeaderLen || body[0] != packMagic0 || body[1] != packMagic1 {
+		return nil, ErrBadMagic
+	}
+	if body[2] != packVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, body[2])
+	}
+	var entries []packEntry
+	for rest := body[packHeaderLen:]; len(rest) > 0; {
+		if len(rest) < packEntryLen {
+			return nil, ErrRecordTooShort
+		}
+		n := uint64(binary.BigEndian.Uint32(rest))
+		if n > uint64(len(rest)-packEntryLen) {
+			return nil, ErrRecordTooShort
+		}
+		entry := rest[4 : packEntryLen+n]
+		if !validateChecksum(entry, ChecksumCRC16, nopLogger{}) {
+			return nil, ErrChecksumMismatch
+		}
+		entries = append(entries, packEntry{offset: binary.BigEndian.Uint64(entry), data: entry[8 : 8+n]})
+		rest = rest[packEntryLen+n:]
+	}
+	return entries, nil
+}
+
+// findSegment returns the listing of the only segment that can hold offset,
+// with a nil Key if there is none.
+func (w *S3DAL) findSegment(ctx context.Context, offset uint64) (types.Object, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(w.bucketName),
+		Prefix:  aws.String(w.compactedPrefix()),
+		MaxKeys: aws.Int32(maxPackRecords),
+	}
+	if offset > maxPackRecords {
+		input.StartAfter = aws.String(w.compactedPrefix() + w.encodeOffset(offset-maxPackRecords))
+	}
+	output, err := w.client.ListObjectsV2(ctx, input)
+	if err != nil {
+		return types.Object{}, fmt.Errorf("failed to list objects from S3: %w", err)
+	}
+	var segment types.Object
+	for _, obj := range output.Contents {
+		first, _, err := w.parseSegmentKey(aws.ToString(obj.Key))
+		if err != nil {
+			continue
+		}
+		if first > offset {
+			break
+		}
+		segment = obj
+	}
+	return segment, nil
+}
+
+// getCompacted stands in for the GetObject of the record at offset when it
+// has been compacted, answering with its entry in the segment holding it; the
+// segment's ETag and last-modified time stand for the record's. notFound is
+// the failed GetObject's error, returned if no segment holds offset either.
+func (w *S3DAL) getCompacted(ctx context.Context, offset uint64, ifNoneMatch string, notFound error) (*s3.GetObjectOutput, error) {
+	segment, err := w.findSegment(ctx, offset)
+	if err != nil {
+		return nil, err
+	}
+	if segment.Key == nil {
+		return nil, getRecordError(offset, notFound)
+	}
+	key := aws.ToString(segment.Key)
+	result, err := w.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:      aws.String(w.bucketName),
+		Key:         aws.String(key),
+		IfNoneMatch: nilIfEmpty(ifNoneMatch),
+	})
+	if err != nil {
+		return nil, getRecordError(offset, err)
+	}
+	defer result.Body.Close()
+	body, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object body: %w", err)
+	}
+	if entries, err := packEntries(body); err == nil {
+		w.segments.put(key, aws.ToString(result.ETag), entries)
+	}
+	data, ok, err := findPackEntry(body, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%w: offset %d in segment %s", err, offset, key)
+	}
+	if !ok {
+		return nil, getRecordError(offset, notFound)
+	}
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: aws.Int64(int64(len(data))),
+		ETag:          result.ETag,
+		LastModified:  result.LastModified,
+	}, nil
+}
+
+// collapseSegments prepares keys listed for deletion, which name a segment
+// once per record in it, for deleteObjects: each segment once, weighted by
+// its records. It fails if keys hold only some of a segment's records.
+func (w *S3DAL) collapseSegments(keys []string) ([]string, map[string]int, error) {
+	if !w.compaction {
+		return keys, nil, nil
+	}
+	seen := make(map[string]int)
+	unique := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !w.isSegmentKey(key) {
+			unique = append(unique, key)
+			continue
+		}
+		if seen[key] == 0 {
+			unique = append(unique, key)
+		}
+		seen[key]++
+	}
+	weights := make(map[string]int, len(seen))
+	for key, n := range seen {
+		_, count, err := w.parseSegmentKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if n != count {
+			return nil, nil, fmt.Errorf("cannot delete %d of the %d records of compacted segment %s", n, count, key)
+		}
+		weights[key] = count
+	}
+	return unique, weights, nil
+}
+
+// existsCompacted is Exists for an offset whose HeadObject found no key:
+// whether a segment holds it. The segment's key names its first offset, and
+// its other offsets come from the index of segments read before, so only a
+// segment not yet indexed is read, once.
+func (w *S3DAL) existsCompacted(ctx context.Context, offset uint64) (bool, error) {
+	segment, err := w.findSegment(ctx, offset)
+	if err != nil || segment.Key == nil {
+		return false, err
+	}
+	key := aws.ToString(segment.Key)
+	first, count, err := w.parseSegmentKey(key)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case offset == first:
+		return true, nil
+	case count == 1 || offset-first >= maxPackRecords:
+		return false, nil
+	}
+	if offsets, ok := w.segments.get(key, aws.ToString(segment.ETag)); ok {
+		_, found := slices.BinarySearch(offsets, offset)
+		return found, nil
+	}
+	body, err := w.getRange(ctx, key, "")
+	if err != nil {
+		if isNotFound(err) {
+			// compacted again or deleted since the listing
+			return false, nil
+		}
+		return false, err
+	}
+	entries, err := packEntries(body)
+	if err != nil {
+		return false, fmt.Errorf("%w: segment %s", err, key)
+	}
+	offsets := w.segments.put(key, aws.ToString(segment.ETag), entries)
+	_, found := slices.BinarySearch(offsets, offset)
+	return found, nil
+}
+
+// segmentIndexSize is how many segments' offsets a segmentIndex holds.
+const segmentIndexSize = 256
+
+// segmentIndex caches the offsets held by recently read segments, by key and
+// ETag, so a segment written again under the same name is read afresh. The
+// oldest is dropped once it is full.
+type segmentIndex struct {
+	mu      sync.Mutex
+	order   []string
+	offsets map[string][]uint64
+}
+
+func newSegmentIndex() *segmentIndex {
+	return &segmentIndex{offsets: make(map[string][]uint64)}
+}
+
+// get returns the offsets of the segment at key with etag, if indexed.
+func (x *segmentIndex) get(key, etag string) ([]uint64, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	offsets, ok := x.offsets[key+"\x00"+etag]
+	return offsets, ok
+}
+
+// put indexes the offsets of entries, the segment at key with etag, and
+// returns them in ascending order.
+func (x *segmentIndex) put(key, etag string, entries []packEntry) []uint64 {
+	offsets := make([]uint64, len(entries))
+	for i, e := range entries {
+		offsets[i] = e.offset
+	}
+	slices.Sort(offsets)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	id := key + "\x00" + etag
+	if _, ok := x.offsets[id]; !ok {
+		if len(x.order) == segmentIndexSize {
+			delete(x.offsets, x.order[0])
+			x.order = x.order[1:]
+		}
+		x.order = append(x.order, id)
+	}
+	x.offsets[id] = offsets
+	return offsets
+}
@@ -0,0 +1,237 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithCompaction(), WithTimestamps())
+	ctx := context.Background()
+
+	for i := 1; i <= 20; i++ {
+		if _, err := wal.Append(ctx, []byte(fmt.Sprintf("record %d", i))); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	for _, r := range [][2]uint64{{3, 5}, {9, 9}, {14, 15}} {
+		if _, err := wal.DeleteRange(ctx, r[0], r[1]+1, false); err != nil {
+			t.Fatalf("failed to delete %v: %v", r, err)
+		}
+	}
+	survivors := []uint64{1, 2, 6, 7, 8, 10, 11, 12, 13, 16, 17, 18, 19, 20}
+	before := make(map[uint64]Record)
+	for _, offset := range survivors {
+		record, err := wal.Read(ctx, offset)
+		if err != nil {
+			t.Fatalf("failed to read %d: %v", offset, err)
+		}
+		before[offset] = record
+	}
+
+	if err := wal.Compact(ctx, 1, 21); err != nil {
+		t.Fatalf("failed to compact: %v", err)
+	}
+	objects := 0
+	for key := range fake.objects {
+		if strings.HasPrefix(key, wal.prefix+"/") && !strings.HasPrefix(key, wal.prefix+"/_") || strings.HasPrefix(key, wal.compactedPrefix()) {
+			objects++
+		}
+	}
+	if objects != 2 {
+		t.Errorf("expected one segment and the last record, got %d objects", objects)
+	}
+
+	check := func(wal *S3DAL) {
+		t.Helper()
+		for _, offset := range survivors {
+			record, err := wal.Read(ctx, offset)
+			if err != nil || string(record.Data) != string(before[offset].Data) || !record.CreatedAt.Equal(before[offset].CreatedAt) {
+				t.Errorf("offset %d: expected %q, got %q, %v", offset, before[offset].Data, record.Data, err)
+			}
+		}
+		for _, hole := range []uint64{3, 9, 15} {
+			if _, err := wal.Read(ctx, hole); !errors.Is(err, ErrRecordNotFound) {
+				t.Errorf("expected hole %d to stay a hole, got %v", hole, err)
+			}
+			if ok, err := wal.Exists(ctx, hole); ok || err != nil {
+				t.Errorf("expected hole %d not to exist, got %v, %v", hole, ok, err)
+			}
+		}
+		if ok, err := wal.Exists(ctx, 7); !ok || err != nil {
+			t.Errorf("expected compacted offset 7 to exist, got %v, %v", ok, err)
+		}
+		var scanned []uint64
+		it, err := wal.Scan(ctx, 5)
+		if err != nil {
+			t.Fatalf("failed to scan: %v", err)
+		}
+		for it.Next() {
+			scanned = append(scanned, it.Record().Offset)
+		}
+		if err := it.Err(); err != nil || fmt.Sprint(scanned) != fmt.Sprint(survivors[2:]) {
+			t.Errorf("expected a scan from 5 to yield %v, got %v, %v", survivors[2:], scanned, err)
+		}
+		if n, err := wal.Count(ctx); err != nil || n != uint64(len(survivors)) {
+			t.Errorf("expected %d records, got %d, %v", len(survivors), n, err)
+		}
+	}
+	check(wal)
+	reopened, err := OpenS3DAL(ctx, fake, wal.bucketName, wal.prefix, WithCompaction())
+	if err != nil || reopened.Length() != 20 {
+		t.Fatalf("expected to reopen at length 20, got %d, %v", reopened.Length(), err)
+	}
+	check(reopened)
+
+	// compacting again rewrites nothing
+	fake.putCalls = 0
+	if err := wal.Compact(ctx, 1, 21); err != nil || fake.putCalls != 0 {
+		t.Errorf("expected a second compaction to do nothing, got %d puts, %v", fake.putCalls, err)
+	}
+	// deletes must not split the segment
+	if _, err := wal.DeleteRange(ctx, 6, 8, false); err == nil {
+		t.Error("expected a delete inside the segment to be rejected")
+	}
+	if ok, _ := wal.Exists(ctx, 6); !ok {
+		t.Error("expected the rejected delete to delete nothing")
+	}
+	if offset, err := wal.Append(ctx, []byte("after")); err != nil || offset != 21 {
+		t.Errorf("expected appends to continue at 21, got %d, %v", offset, err)
+	}
+	if deleted, err := wal.TrimBefore(ctx, 20); err != nil || deleted != 13 {
+		t.Errorf("expected the trim to delete the 13 compacted records, got %d, %v", deleted, err)
+	}
+
+	if err := S3DALClient(fake, wal.bucketName, wal.prefix).Compact(ctx, 1, 21); err == nil {
+		t.Error("expected Compact without WithCompaction to be rejected")
+	}
+}
+
+func TestCompactInterrupted(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithCompaction())
+	ctx := context.Background()
+
+	for i := 1; i <= 10; i++ {
+		if _, err := wal.Append(ctx, []byte(fmt.Sprintf("record %d", i))); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	if _, err := wal.DeleteRange(ctx, 4, 6, false); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+
+	// the segment lands but some originals fail to delete
+	fake.deleteErrors = map[string]string{wal.getObjectKey(2): "InternalError", wal.getObjectKey(7): "InternalError"}
+	if err := wal.Compact(ctx, 1, 10); err == nil {
+		t.Fatal("expected the failed deletes to be reported")
+	}
+	for _, offset := range []uint64{1, 2, 3, 6, 7, 8, 9} {
+		if record, err := wal.Read(ctx, offset); err != nil || string(record.Data) != fmt.Sprintf("record %d", offset) {
+			t.Errorf("offset %d: expected it readable mid-compaction, got %q, %v", offset, record.Data, err)
+		}
+	}
+	if n, err := wal.Count(ctx); err != nil || n != 8 {
+		t.Errorf("expected records in both forms to count once, got %d, %v", n, err)
+	}
+
+	fake.deleteErrors = nil
+	if err := wal.Compact(ctx, 1, 10); err != nil {
+		t.Fatalf("failed to finish the compaction: %v", err)
+	}
+	if _, ok := fake.objects[wal.getObjectKey(2)]; ok {
+		t.Error("expected the rerun to delete the leftover original")
+	}
+	if n, err := wal.Count(ctx); err != nil || n != 8 {
+		t.Errorf("expected 8 records, got %d, %v", n, err)
+	}
+}
+
+func TestCompactedListingCallers(t *testing.T) {
+	wal, _ := newFakeDAL(t, WithCompaction())
+	ctx := context.Background()
+	for i := 1; i <= 8; i++ {
+		if _, err := wal.Append(ctx, []byte(fmt.Sprintf("record %d", i))); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	if _, err := wal.DeleteRange(ctx, 3, 4, false); err != nil {
+		t.Fatalf("failed to delete offset 3: %v", err)
+	}
+	if err := wal.Compact(ctx, 1, 6); err != nil {
+		t.Fatalf("failed to compact: %v", err)
+	}
+
+	if n, err := wal.ExportSnapshot(ctx, "fake-prefix/_snapshot"); err != nil || n != 7 {
+		t.Fatalf("expected a snapshot of 7 records, got %d, %v", n, err)
+	}
+	if record, err := wal.ReadFromSnapshot(ctx, "fake-prefix/_snapshot", 2); err != nil || string(record.Data) != "record 2" {
+		t.Errorf("expected a compacted record in the snapshot, got %q, %v", record.Data, err)
+	}
+
+	inspector, err := NewInspector(wal)
+	if err != nil {
+		t.Fatalf("failed to create inspector: %v", err)
+	}
+	stats, err := inspector.Stats(ctx)
+	if err != nil || stats.Count != 7 || stats.FirstOffset != 1 || stats.LastOffset != 8 {
+		t.Errorf("expected stats over 7 records from 1 to 8, got %+v, %v", stats, err)
+	}
+	gaps, err := inspector.FindGaps(ctx)
+	if err != nil || len(gaps) != 1 || gaps[0] != (Gap{From: 3, To: 3}) {
+		t.Errorf("expected the gap at 3, got %v, %v", gaps, err)
+	}
+}
+
+func TestExistsCompactedReadsSegmentOnce(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithCompaction())
+	ctx := context.Background()
+	for i := 1; i <= 10; i++ {
+		if _, err := wal.Append(ctx, []byte(fmt.Sprintf("record %d", i))); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	if _, err := wal.DeleteRange(ctx, 4, 6, false); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if err := wal.Compact(ctx, 1, 10); err != nil {
+		t.Fatalf("failed to compact: %v", err)
+	}
+
+	// a client that has read no segment yet
+	fresh, err := New(fake, wal.bucketName, wal.prefix, WithCompaction())
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	gets := fake.getCalls
+	if ok, err := fresh.Exists(ctx, 1); !ok || err != nil {
+		t.Errorf("expected the segment's first offset to exist, got %v, %v", ok, err)
+	}
+	if fake.getCalls != gets {
+		t.Errorf("expected the first offset answered from the segment key, got %d gets", fake.getCalls-gets)
+	}
+	for offset, want := range map[uint64]bool{2: true, 4: false, 5: false, 7: true, 9: true} {
+		if ok, err := fresh.Exists(ctx, offset); ok != want || err != nil {
+			t.Errorf("offset %d: expected exists %v, got %v, %v", offset, want, ok, err)
+		}
+	}
+	if fake.getCalls != gets+1 {
+		t.Errorf("expected the segment read once, got %d gets", fake.getCalls-gets)
+	}
+
+	// a segment written again under the same key is read afresh
+	for key, obj := range fake.objects {
+		if strings.HasPrefix(key, wal.compactedPrefix()) {
+			obj.etag = `"rewritten"`
+			fake.objects[key] = obj
+		}
+	}
+	if ok, err := fresh.Exists(ctx, 2); !ok || err != nil {
+		t.Errorf("expected offset 2 to exist, got %v, %v", ok, err)
+	}
+	if fake.getCalls != gets+2 {
+		t.Errorf("expected the changed segment read again, got %d gets", fake.getCalls-gets)
+	}
+}
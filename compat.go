@@ -0,0 +1,22 @@
+package s3_dal
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// NewCompatibleClient returns an S3 client for a self-hosted S3-compatible
+// store such as MinIO or Ceph RGW at endpoint, e.g. "http://localhost:9000".
+// It uses path-style addressing (endpoint/bucket/key), since such stores
+// rarely resolve virtual-hosted bucket names, and static credentials. Any
+// *s3.Client configured the same way works with the DAL; this only saves the
+// boilerplate.
+func NewCompatibleClient(endpoint, region, accessKey, secretKey string) *s3.Client {
+	return s3.New(s3.Options{
+		BaseEndpoint: aws.String(endpoint),
+		Region:       region,
+		UsePathStyle: true,
+		Credentials:  aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")),
+	})
+}
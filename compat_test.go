@@ -0,0 +1,131 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// pathStyleServer is a minimal S3-compatible endpoint that stores puts in
+// memory and records the path of every request.
+type pathStyleServer struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	paths   []string
+}
+
+func (s *pathStyleServer) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths = append(s.paths, r.Method+" "+r.URL.Path)
+
+	switch r.Method {
+	case http.MethodPut:
+		if _, ok := s.objects[r.URL.Path]; ok && r.Header.Get("If-None-Match") == "*" {
+			// no body, as some stores send
+			rw.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.objects[r.URL.Path] = data
+		rw.Header().Set("ETag", `"etag"`)
+	case http.MethodGet, http.MethodHead:
+		data, ok := s.objects[r.URL.Path]
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		if r.Method == http.MethodGet {
+			rw.Write(data)
+		}
+	default:
+		rw.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestCompatibleClientUsesPathStyle(t *testing.T) {
+	server := &pathStyleServer{objects: make(map[string][]byte)}
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+
+	client := NewCompatibleClient(endpoint.URL, "us-east-1", "key", "secret")
+	wal := S3DALClient(client, "compat-bucket", "compat-prefix")
+	ctx := context.Background()
+
+	offset, err := wal.Append(ctx, []byte("off AWS"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	record, err := wal.Read(ctx, offset)
+	if err != nil || string(record.Data) != "off AWS" {
+		t.Fatalf("expected to read the record back, got %q, %v", record.Data, err)
+	}
+	want := "PUT /compat-bucket/" + wal.getObjectKey(offset)
+	if len(server.paths) == 0 || server.paths[0] != want {
+		t.Errorf("expected the bucket in the path, as %q, got %v", want, server.paths)
+	}
+
+	// bare status codes, without an error body, still map to the sentinels
+	wal.length = 0
+	if _, err := wal.Append(ctx, []byte("again")); !errors.Is(err, ErrOffsetConflict) {
+		t.Errorf("expected a bare 412 to be ErrOffsetConflict, got %v", err)
+	}
+	if _, err := wal.Read(ctx, offset+1); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected a bare 404 to be ErrRecordNotFound, got %v", err)
+	}
+	if ok, err := wal.Exists(ctx, offset+1); err != nil || ok {
+		t.Errorf("expected a 404 from HEAD to mean missing, got %v, %v", ok, err)
+	}
+}
+
+func TestErrorClassification(t *testing.T) {
+	status := func(code int) error {
+		return &awshttp.ResponseError{ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: code}},
+			Err:      errors.New("response error"),
+		}}
+	}
+	coded := func(code string) error {
+		return &smithy.GenericAPIError{Code: code}
+	}
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		is   func(error) bool
+		want bool
+	}{
+		{"precondition code", coded("PreconditionFailed"), isPreconditionFailed, true},
+		{"conditional conflict", coded("ConditionalRequestConflict"), isPreconditionFailed, true},
+		{"bare 412", status(http.StatusPreconditionFailed), isPreconditionFailed, true},
+		{"other code", coded("InternalError"), isPreconditionFailed, false},
+		{"no such key code", coded("NoSuchKey"), isNotFound, true},
+		{"not found code", coded("NotFound"), isNotFound, true},
+		{"bare 404", status(http.StatusNotFound), isNotFound, true},
+		{"missing bucket", fmt.Errorf("get: %w", coded("NoSuchBucket")), isNotFound, false},
+		{"slow down", coded("SlowDown"), isSlowDown, true},
+		{"bare 503", status(http.StatusServiceUnavailable), isSlowDown, true},
+		{"bare 500", status(http.StatusInternalServerError), isSlowDown, false},
+		{"not modified code", coded("NotModified"), isNotModified, true},
+		{"bare 304", status(http.StatusNotModified), isNotModified, true},
+		{"bare 404 not modified", status(http.StatusNotFound), isNotModified, false},
+	} {
+		if got := tc.is(tc.err); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
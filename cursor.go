@@ -0,0 +1,84 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// Cursor reads the log in offset order, keeping its own position, for a
+// consumer that works through records one at a time. Missing offsets with
+// records after them, such as a trimmed prefix or holes, are skipped as by
+// Follow. A Cursor is not safe for concurrent use.
+type Cursor struct {
+	w    *S3DAL
+	next uint64
+	poll time.Duration
+}
+
+// Cursor returns a Cursor positioned at from, the first offset Next reads.
+// Its Next returns io.EOF at the tail; a later Next carries on from there, so
+// the same Cursor, or a new one from its Offset, picks up records appended
+// since.
+func (w *S3DAL) Cursor(from uint64) *Cursor {
+	return &Cursor{w: w, next: max(from, 1)}
+}
+
+// FollowCursor is Cursor in follow mode: at the tail Next checks again every
+// poll until a record is appended or ctx is done, instead of returning
+// io.EOF.
+func (w *S3DAL) FollowCursor(from uint64, poll time.Duration) *Cursor {
+	c := w.Cursor(from)
+	c.poll = poll
+	return c
+}
+
+// Offset is the offset Next reads next: one past the last record it returned,
+// or the starting offset before that.
+func (c *Cursor) Offset() uint64 { return c.next }
+
+// Seek moves the cursor to offset, as to skip a record Next failed to read.
+func (c *Cursor) Seek(offset uint64) { c.next = max(offset, 1) }
+
+// Next returns the record at the cursor's position, or the first one after
+// it, and moves past it. At the tail it returns io.EOF, or waits in follow
+// mode. Any other failure, a corrupt record included, is returned with the
+// position left where it was, so Next retries it and Seek skips it.
+func (c *Cursor) Next(ctx context.Context) (Record, error) {
+	for {
+		record, err := c.w.Read(ctx, c.next)
+		if err == nil {
+			c.next = record.Offset + 1
+			return record, nil
+		}
+		if ctx.Err() != nil {
+			return Record{}, ctx.Err()
+		}
+		if !errors.Is(err, ErrRecordNotFound) {
+			return Record{}, err
+		}
+		// at the tail, or at a hole with records after it
+		offsets, _, err := c.w.listOffsetsAfter(ctx, c.next-1, 1)
+		if err != nil {
+			return Record{}, err
+		}
+		if len(offsets) > 0 {
+			c.next = offsets[0]
+			continue
+		}
+		if c.poll <= 0 {
+			return Record{}, io.EOF
+		}
+		timer := time.NewTimer(c.poll)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return Record{}, ctx.Err()
+		case <-c.w.lifetime.Done():
+			timer.Stop()
+			return Record{}, ErrClosed
+		}
+	}
+}
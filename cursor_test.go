@@ -0,0 +1,94 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	wal, _ := newFakeDAL(t)
+	ctx := context.Background()
+	for i := range 5 {
+		if _, err := wal.Append(ctx, []byte(fmt.Sprintf("record %d", i+1))); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	if _, err := wal.TrimBefore(ctx, 2); err != nil {
+		t.Fatalf("failed to trim: %v", err)
+	}
+	// a hole at 4
+	if _, err := wal.DeleteRange(ctx, 4, 5, false); err != nil {
+		t.Fatalf("failed to delete offset 4: %v", err)
+	}
+
+	cursor := wal.Cursor(0)
+	var got []uint64
+	for {
+		record, err := cursor.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		if string(record.Data) != fmt.Sprintf("record %d", record.Offset) {
+			t.Fatalf("expected the data of offset %d, got %q", record.Offset, record.Data)
+		}
+		got = append(got, record.Offset)
+	}
+	if fmt.Sprint(got) != "[2 3 5]" {
+		t.Errorf("expected the trimmed prefix and hole skipped, got %v", got)
+	}
+	if cursor.Offset() != 6 {
+		t.Errorf("expected the cursor past the tail at 6, got %d", cursor.Offset())
+	}
+	if _, err := cursor.Next(ctx); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF again at the tail, got %v", err)
+	}
+
+	// resume, from the same cursor and from its offset, after more appends
+	if _, err := wal.Append(ctx, []byte("record 6")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	resumed := wal.Cursor(cursor.Offset())
+	for _, c := range []*Cursor{cursor, resumed} {
+		if record, err := c.Next(ctx); err != nil || record.Offset != 6 {
+			t.Errorf("expected to resume at offset 6, got %d, %v", record.Offset, err)
+		}
+	}
+}
+
+func TestFollowCursor(t *testing.T) {
+	wal, _ := newFakeDAL(t)
+	ctx := context.Background()
+	cursor := wal.FollowCursor(1, time.Millisecond)
+
+	appended := make(chan error, 1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_, err := wal.Append(ctx, []byte("late"))
+		appended <- err
+	}()
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	record, err := cursor.Next(waitCtx)
+	if err != nil || record.Offset != 1 {
+		t.Fatalf("expected to wait for offset 1, got %d, %v", record.Offset, err)
+	}
+	if err := <-appended; err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := cursor.Next(short); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected to wait at the tail until the deadline, got %v", err)
+	}
+	if cursor.Offset() != 2 {
+		t.Errorf("expected the position kept at 2, got %d", cursor.Offset())
+	}
+}
@@ -0,0 +1,111 @@
+package s3_dal
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// An encrypted record, flagged with flagEncrypted, stores its payload, after
+// any compression, as
+//
+//	[4-byte key ID][1-byte nonce length][nonce][ciphertext and tag]
+//
+// sealed with the AEAD registered under the key ID. The offset, creation time
+// and key ID are authenticated as additional data, so a sealed payload cannot
+// be moved to another offset. The header stays plaintext and the checksum
+// covers the sealed bytes as stored.
+const encryptionHeaderLen = 4 + 1
+
+// ErrDecryptionFailed is returned when an encrypted record cannot be opened:
+// its key ID is not registered, or the ciphertext does not authenticate.
+var ErrDecryptionFailed = errors.New("failed to decrypt record")
+
+// keyRing holds the AEADs records can be opened with, by key ID.
+type keyRing map[uint32]cipher.AEAD
+
+func (k *keyRing) add(keyID uint32, aead cipher.AEAD) error {
+	if aead == nil {
+		return fmt.Errorf("invalid encryption key %d: AEAD is nil", keyID)
+	}
+	if n := aead.NonceSize(); n < 1 || n > 255 {
+		return fmt.Errorf("invalid encryption key %d: nonce size %d must be 1 to 255 bytes", keyID, n)
+	}
+	if *k == nil {
+		*k = make(keyRing)
+	}
+	(*k)[keyID] = aead
+	return nil
+}
+
+// encryptionAAD is the additional data a record's payload is sealed with.
+func encryptionAAD(offset uint64, created int64, keyID uint32) []byte {
+	aad := make([]byte, 0, 8+8+4)
+	aad = binary.BigEndian.AppendUint64(aad, offset)
+	aad = binary.BigEndian.AppendUint64(aad, uint64(created))
+	return binary.BigEndian.AppendUint32(aad, keyID)
+}
+
+// sealPayload encrypts payload for offset under the active key with a fresh
+// random nonce.
+func (w *S3DAL) sealPayload(offset uint64, created int64, payload []byte) ([]byte, error) {
+	aead := w.keys[w.encryptKeyID]
+	nonceSize := aead.NonceSize()
+	buf := make([]byte, 0, encryptionHeaderLen+nonceSize+len(payload)+aead.Overhead())
+	buf = binary.BigEndian.AppendUint32(buf, w.encryptKeyID)
+	buf = append(buf, byte(nonceSize))
+	buf = buf[:len(buf)+nonceSize]
+	nonce := buf[encryptionHeaderLen:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(buf, nonce, payload, encryptionAAD(offset, created, w.encryptKeyID)), nil
+}
+
+// payload returns the stored payload of f, decrypted if it is sealed.
+func (k keyRing) payload(f frame) ([]byte, error) {
+	if !f.sealed {
+		return f.data, nil
+	}
+	if len(f.data) < encryptionHeaderLen {
+		return nil, fmt.Errorf("%w: offset %d: %w", ErrDecryptionFailed, f.offset, ErrRecordTooShort)
+	}
+	keyID := binary.BigEndian.Uint32(f.data)
+	aead, ok := k[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: offset %d: unknown key ID %d", ErrDecryptionFailed, f.offset, keyID)
+	}
+	nonceSize := int(f.data[4])
+	if nonceSize != aead.NonceSize() || len(f.data) < encryptionHeaderLen+nonceSize {
+		return nil, fmt.Errorf("%w: offset %d: bad nonce for key ID %d", ErrDecryptionFailed, f.offset, keyID)
+	}
+	nonce := f.data[encryptionHeaderLen : encryptionHeaderLen+nonceSize]
+	payload, err := aead.Open(nil, nonce, f.data[encryptionHeaderLen+nonceSize:], encryptionAAD(f.offset, f.created, keyID))
+	if err != nil {
+		return nil, fmt.Errorf("%w: offset %d: %w", ErrDecryptionFailed, f.offset, err)
+	}
+	return payload, nil
+}
+
+// encodeBody frames data as the record at offset in w's format: compressed,
+// sealed if encryption is on, and guarded by w's checksum.
+func (w *S3DAL) encodeBody(offset uint64, created int64, data []byte, skipCRC bool) ([]byte, error) {
+	payload, err := compressPayload(w.compression, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress payload: %w", err)
+	}
+	return w.framePayload(offset, created, payload, skipCRC)
+}
+
+// framePayload is encodeBody for a payload already compressed.
+func (w *S3DAL) framePayload(offset uint64, created int64, payload []byte, skipCRC bool) ([]byte, error) {
+	if w.encrypt {
+		var err error
+		if payload, err = w.sealPayload(offset, created, payload); err != nil {
+			return nil, err
+		}
+	}
+	return frameBody(offset, created, payload, w.compression, w.checksummerFor(w.checksum), w.encrypt, skipCRC), nil
+}
@@ -0,0 +1,124 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"testing"
+)
+
+func newGCM(t *testing.T, seed byte) cipher.AEAD {
+	t.Helper()
+	block, err := aes.NewCipher(bytes.Repeat([]byte{seed}, 32))
+	if err != nil {
+		t.Fatalf("failed to create cipher: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("failed to create GCM: %v", err)
+	}
+	return aead
+}
+
+func TestClientEncryption(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithClientEncryption(1, newGCM(t, 1)), WithCompression(CompressionGzip), WithTimestamps())
+	ctx := context.Background()
+
+	plaintext := []byte("a secret worth keeping, a secret worth keeping")
+	offset, err := wal.Append(ctx, plaintext)
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	key := wal.getObjectKey(offset)
+	obj := fake.objects[key]
+	if bytes.Contains(obj.body, plaintext[:8]) {
+		t.Error("expected the stored body not to hold the plaintext")
+	}
+	record, err := wal.Read(ctx, offset)
+	if err != nil || !bytes.Equal(record.Data, plaintext) || record.CreatedAt.IsZero() {
+		t.Fatalf("expected the record to round-trip, got %q, %v", record.Data, err)
+	}
+	stream, _, err := wal.ReadStream(ctx, offset)
+	if err != nil {
+		t.Fatalf("failed to stream: %v", err)
+	}
+	defer stream.Close()
+	if buf, err := io.ReadAll(stream); err != nil || !bytes.Equal(buf, plaintext) {
+		t.Errorf("expected the stream to decrypt, got %q, %v", buf, err)
+	}
+
+	if _, err := S3DALClient(fake, wal.bucketName, wal.prefix).Read(ctx, offset); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("expected a reader without the key to fail, got %v", err)
+	}
+	other, err := New(fake, wal.bucketName, wal.prefix, WithClientEncryption(1, newGCM(t, 2)))
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	if _, err := other.Read(ctx, offset); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("expected a wrong key to fail, got %v", err)
+	}
+
+	// flipping a ciphertext byte fails the checksum; with the checksum
+	// recomputed it fails to authenticate
+	size := wal.checksum.Size()
+	tampered := bytes.Clone(obj.body)
+	tampered[len(tampered)-size-1] ^= 0xFF
+	obj.body = tampered
+	fake.objects[key] = obj
+	if _, err := wal.Read(ctx, offset); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected a checksum mismatch, got %v", err)
+	}
+	obj.body = append(tampered[:len(tampered)-size:len(tampered)-size], wal.checksum.Sum(tampered[:len(tampered)-size])...)
+	fake.objects[key] = obj
+	if _, err := wal.Read(ctx, offset); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("expected tampered ciphertext to be rejected, got %v", err)
+	}
+
+	if _, err := wal.AppendReader(ctx, bytes.NewReader(plaintext), int64(len(plaintext))); err == nil {
+		t.Error("expected AppendReader to be rejected with encryption")
+	}
+	if _, err := New(fake, wal.bucketName, wal.prefix, WithClientEncryption(1, nil)); err == nil {
+		t.Error("expected a nil AEAD to be rejected")
+	}
+	if _, err := New(fake, wal.bucketName, wal.prefix, WithPacking(2), WithClientEncryption(1, newGCM(t, 1))); err == nil {
+		t.Error("expected packing with encryption to be rejected")
+	}
+}
+
+func TestClientEncryptionKeyRotation(t *testing.T) {
+	oldKey, newKey := newGCM(t, 1), newGCM(t, 2)
+	wal, fake := newFakeDAL(t, WithClientEncryption(1, oldKey))
+	ctx := context.Background()
+
+	if _, err := wal.Append(ctx, []byte("under key 1")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	rotated, err := OpenS3DAL(ctx, fake, wal.bucketName, wal.prefix, WithClientEncryption(2, newKey), WithDecryptionKey(1, oldKey))
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	if _, err := rotated.AppendBatch(ctx, [][]byte{[]byte("under key 2")}); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	for offset, want := range map[uint64]string{1: "under key 1", 2: "under key 2"} {
+		if record, err := rotated.Read(ctx, offset); err != nil || string(record.Data) != want {
+			t.Errorf("offset %d: expected %q, got %q, %v", offset, want, record.Data, err)
+		}
+	}
+	if _, err := wal.Read(ctx, 2); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("expected the old writer not to know key 2, got %v", err)
+	}
+
+	// a payload moved to another offset does not authenticate
+	moved := bytes.Clone(fake.objects[wal.getObjectKey(1)].body)
+	moved[recordHeaderLen+7] = 3
+	size := wal.checksum.Size()
+	moved = append(moved[:len(moved)-size], wal.checksum.Sum(moved[:len(moved)-size])...)
+	fake.objects[wal.getObjectKey(3)] = fakeObject{body: moved}
+	if _, err := rotated.Read(ctx, 3); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("expected a moved payload to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package s3_dal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+var (
+	// ErrEmptyLog is returned when the log holds no records.
+	ErrEmptyLog = errors.New("WAL is empty")
+	// ErrRecordNotFound is returned when no record exists at an offset.
+	ErrRecordNotFound = errors.New("record not found")
+	// ErrChecksumMismatch is returned when a record's CRC does not match its
+	// contents.
+	ErrChecksumMismatch = errors.New("CRC mismatch")
+	// ErrStorageChecksumMismatch is returned under WithStorageChecksum when an
+	// object's body does not match the checksum S3 stored for it at upload, as
+	// distinct from a record failing its own checksum, ErrChecksumMismatch.
+	ErrStorageChecksumMismatch = errors.New("storage checksum mismatch")
+	// ErrOffsetMismatch is returned when a record's header names a different
+	// offset than the key it was read from.
+	ErrOffsetMismatch = errors.New("offset mismatch")
+	// ErrRecordTooShort is returned when an object is too small to hold the
+	// offset header and CRC trailer.
+	ErrRecordTooShort = errors.New("invalid record: data too short")
+	// ErrEmptyObject is returned for a zero-byte object at a record key, such
+	// as a placeholder or the result of an aborted upload, as distinct from a
+	// torn record, which is ErrRecordTooShort.
+	ErrEmptyObject = errors.New("invalid record: empty object")
+	// ErrBadMagic is returned when an object does not start with the record
+	// header, such as one written before the header was introduced (see
+	// WithLegacyFormat) or one that is not a record at all.
+	ErrBadMagic = errors.New("invalid record: bad magic")
+	// ErrUnsupportedVersion is returned for a record header with a format
+	// version this package does not know.
+	ErrUnsupportedVersion = errors.New("invalid record: unsupported format version")
+	// ErrUnknownFlags is returned for a record header with flags this package
+	// does not know.
+	ErrUnknownFlags = errors.New("invalid record: unknown flags")
+)
+
+// ErrEmpty is returned when the log holds no records.
+//
+// Deprecated: use ErrEmptyLog, which is the same value.
+var ErrEmpty = ErrEmptyLog
+
+// ErrOffsetConflict is returned when an append targets an offset that
+// already holds a record, typically because another writer got there first.
+// Callers should re-resolve the tail (for example with LastRecord) and retry.
+var ErrOffsetConflict = errors.New("offset already written")
+
+// ErrTailMismatch is returned by Sync when the last offset in S3 is not the
+// one this client last wrote.
+var ErrTailMismatch = errors.New("tail does not match the length")
+
+// ErrInvalidOffset is returned for offset 0, which offsets start after: it
+// means "no record" throughout the API and never names one.
+var ErrInvalidOffset = errors.New("invalid offset")
+
+var errOffsetZero = fmt.Errorf("%w: offsets start at 1", ErrInvalidOffset)
+
+// ErrClosed is returned by appends and reads on an S3DAL after Close.
+var ErrClosed = errors.New("S3DAL is closed")
+
+// OpError is the error of a failed Read or Append, naming the record it was
+// for. The range and scan methods, which read with Read, return it too, as do
+// the per-record errors they report. Key is the record's object key, or empty
+// for a packed log. Err is the cause, so errors.Is still finds sentinels such
+// as ErrRecordNotFound through it.
+type OpError struct {
+	Op     string
+	Offset uint64
+	Key    string
+	Err    error
+}
+
+func (e *OpError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("%s offset %d: %v", e.Op, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("%s offset %d (%s): %v", e.Op, e.Offset, e.Key, e.Err)
+}
+
+func (e *OpError) Unwrap() error { return e.Err }
+
+// opError wraps a non-nil err from op on the record at offset in an *OpError.
+func (w *S3DAL) opError(op string, offset uint64, err error) error {
+	if err == nil {
+		return nil
+	}
+	e := &OpError{Op: op, Offset: offset, Err: err}
+	if w.packRecords == 0 {
+		e.Key = w.getObjectKey(offset)
+	}
+	var mismatch *OffsetMismatchError
+	if errors.As(err, &mismatch) && mismatch.Key == "" {
+		mismatch.Key = e.Key
+	}
+	return e
+}
+
+// OffsetMismatchError is the ErrOffsetMismatch of a record whose body holds
+// another offset than its key names. Key is empty where the key is not
+// known, as from DecodeRecord.
+type OffsetMismatchError struct {
+	Key        string
+	KeyOffset  uint64
+	BodyOffset uint64
+}
+
+func (e *OffsetMismatchError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("%v: expected %d, got %d", ErrOffsetMismatch, e.KeyOffset, e.BodyOffset)
+	}
+	return fmt.Sprintf("%v: key %q names %d, body holds %d", ErrOffsetMismatch, e.Key, e.KeyOffset, e.BodyOffset)
+}
+
+func (e *OffsetMismatchError) Unwrap() error { return ErrOffsetMismatch }
+
+// offsetMismatch is the error for a body holding offset body read for offset
+// want.
+func offsetMismatch(want, body uint64) error {
+	return &OffsetMismatchError{KeyOffset: want, BodyOffset: body}
+}
+
+// ErrInvalidRange is returned by the methods taking a range of offsets when
+// start is after end. Every such range is half-open, [start, end): it holds
+// start but not end, so a range with start equal to end is empty.
+var ErrInvalidRange = errors.New("invalid range")
+
+// checkRange validates the half-open offset range [start, end).
+func checkRange(start, end uint64) error {
+	if start > end {
+		return fmt.Errorf("%w: start %d is after end %d", ErrInvalidRange, start, end)
+	}
+	return nil
+}
+
+// ErrRecordTooLarge is returned by an append whose payload exceeds the limit
+// set with WithMaxRecordSize. Nothing is written.
+var ErrRecordTooLarge = errors.New("record too large")
+
+// putRecordError wraps a failed conditional put of the record at offset,
+// mapping a precondition failure to ErrOffsetConflict.
+func (w *S3DAL) putRecordError(offset uint64, err error) error {
+	if isPreconditionFailed(err) {
+		w.observer.RecordConflict(offset)
+		return fmt.Errorf("%w: offset %d: %w", ErrOffsetConflict, offset, err)
+	}
+	return fmt.Errorf("failed to put object to S3%s: %w", w.sseHint(err), err)
+}
+
+// sseHint explains an access-denied put in terms of the encryption settings,
+// since a bucket policy that enforces encryption rejects puts that omit it
+// with a bare AccessDenied.
+func (w *S3DAL) sseHint(err error) string {
+	if !isAccessDenied(err) {
+		return ""
+	}
+	switch {
+	case w.sse == "":
+		return " without server-side encryption (if the bucket requires it, configure WithSSES3 or WithSSEKMS)"
+	case w.sseKMSKeyID != "":
+		return fmt.Sprintf(" with SSE-KMS key %s (check the bucket policy allows it and the writer may use the key)", w.sseKMSKeyID)
+	}
+	return fmt.Sprintf(" with server-side encryption %s (check the bucket policy allows it)", w.sse)
+}
+
+// isAccessDenied reports whether err is S3 refusing the request with 403.
+func isAccessDenied(err error) bool {
+	return hasErrorCode(err, "AccessDenied")
+}
+
+// getRecordError wraps a failed GetObject of the record at offset, mapping a
+// missing key to ErrRecordNotFound.
+func getRecordError(offset uint64, err error) error {
+	if isNotFound(err) {
+		return fmt.Errorf("%w: offset %d: %w", ErrRecordNotFound, offset, err)
+	}
+	return fmt.Errorf("failed to get object from S3: %w", err)
+}
+
+// isPreconditionFailed reports whether err is S3 rejecting a conditional
+// write (If-None-Match / If-Match) with 412 Precondition Failed, or with 409
+// ConditionalRequestConflict while a competing conditional write is in flight.
+// The status is checked too, for S3-compatible stores that send no code.
+func isPreconditionFailed(err error) bool {
+	return hasErrorCode(err, "PreconditionFailed", "ConditionalRequestConflict") || hasStatus(err, http.StatusPreconditionFailed)
+}
+
+// isNotModified reports whether err is S3 answering a GetObject with
+// If-None-Match with 304 Not Modified, which is not a failure.
+func isNotModified(err error) bool {
+	return hasErrorCode(err, "NotModified") || hasStatus(err, http.StatusNotModified)
+}
+
+// isNotFound reports whether err is S3 reporting a missing key. The SDK maps
+// AWS responses to typed errors; S3-compatible stores are matched by code, or
+// by a bare 404 for a HEAD, which has no body, unless the bucket is missing.
+func isNotFound(err error) bool {
+	var nsk *types.NoSuchKey
+	var nf *types.NotFound
+	if errors.As(err, &nsk) || errors.As(err, &nf) || hasErrorCode(err, "NoSuchKey", "NotFound") {
+		return true
+	}
+	return hasStatus(err, http.StatusNotFound) && !hasErrorCode(err, "NoSuchBucket")
+}
+
+// isSlowDown reports whether err is S3 shedding load with 503 SlowDown.
+func isSlowDown(err error) bool {
+	return hasErrorCode(err, "SlowDown", "ServiceUnavailable") || hasStatus(err, http.StatusServiceUnavailable)
+}
+
+// hasErrorCode reports whether err is an API error with one of codes.
+func hasErrorCode(err error, codes ...string) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && slices.Contains(codes, apiErr.ErrorCode())
+}
+
+// hasStatus reports whether err came from an HTTP response with status.
+func hasStatus(err error, status int) bool {
+	var respErr *awshttp.ResponseError
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == status
+}
@@ -0,0 +1,446 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+type fakeObject struct {
+	body         []byte
+	etag         string
+	contentType  string
+	metadata     map[string]string
+	lastModified time.Time
+}
+
+// fakeUpload is an in-progress multipart upload.
+type fakeUpload struct {
+	key         string
+	contentType string
+	metadata    map[string]string
+	parts       map[int32][]byte
+	// checksum is the algorithm the upload was created with, which every
+	// completed part must carry
+	checksum types.ChecksumAlgorithm
+}
+
+// fakePartChecksum is the checksum S3 returns for a part uploaded with
+// algorithm, set in the field of out for it.
+func fakePartChecksum(algorithm types.ChecksumAlgorithm, body []byte, out *s3.UploadPartOutput) {
+	var h hash.Hash
+	var field **string
+	switch algorithm {
+	case types.ChecksumAlgorithmCrc32:
+		h, field = crc32.NewIEEE(), &out.ChecksumCRC32
+	case types.ChecksumAlgorithmCrc32c:
+		h, field = crc32.New(castagnoli), &out.ChecksumCRC32C
+	case types.ChecksumAlgorithmSha1:
+		h, field = sha1.New(), &out.ChecksumSHA1
+	case types.ChecksumAlgorithmSha256:
+		h, field = sha256.New(), &out.ChecksumSHA256
+	default:
+		return
+	}
+	h.Write(body)
+	*field = aws.String(base64.StdEncoding.EncodeToString(h.Sum(nil)))
+}
+
+// completedChecksum is the checksum a completed part carries for algorithm.
+func completedChecksum(algorithm types.ChecksumAlgorithm, part types.CompletedPart) *string {
+	switch algorithm {
+	case types.ChecksumAlgorithmCrc32:
+		return part.ChecksumCRC32
+	case types.ChecksumAlgorithmCrc32c:
+		return part.ChecksumCRC32C
+	case types.ChecksumAlgorithmSha1:
+		return part.ChecksumSHA1
+	case types.ChecksumAlgorithmSha256:
+		return part.ChecksumSHA256
+	}
+	return nil
+}
+
+// fakeS3 is an in-memory stand-in for the subset of S3 used by S3DAL.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]fakeObject
+	uploads map[string]*fakeUpload
+	now     func() time.Time
+
+	uploadSeq int
+
+	// beforePut, if set, runs before each put is applied, outside the lock,
+	// so tests can interleave a competing writer.
+	beforePut func(key string)
+	// beforeGet, if set, runs before each get, outside the lock.
+	beforeGet func(key string)
+
+	// deleteErrors maps keys to the error code DeleteObjects reports for them.
+	deleteErrors map[string]string
+
+	// putErr, if set, fails every put
+	putErr error
+	// headErr, if set, fails every head
+	headErr error
+	// bucketErr, if set, fails every head of the bucket
+	bucketErr error
+	// listErr, if set, fails every list
+	listErr error
+	// getMisses maps keys to how many more gets report them missing, like an
+	// eventually consistent store.
+	getMisses map[string]int
+
+	lastPut    *s3.PutObjectInput
+	lastGet    *s3.GetObjectInput
+	lastCreate *s3.CreateMultipartUploadInput
+
+	putCalls    int
+	getCalls    int
+	listCalls   int
+	headCalls   int
+	copyCalls   int
+	deleteCalls int
+	partCalls   int
+	abortCalls  int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: make(map[string]fakeObject), uploads: make(map[string]*fakeUpload), now: time.Now}
+}
+
+func newFakeDAL(t *testing.T, opts ...Option) (*S3DAL, *fakeS3) {
+	fake := newFakeS3()
+	wal, err := New(fake, "fake-bucket", "fake-prefix", opts...)
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	return wal, fake
+}
+
+// TestFakeRoundTrip appends and reads back through the in-memory fake, with
+// no AWS credentials or network.
+func TestFakeRoundTrip(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	offset, err := wal.Append(ctx, []byte("hello world"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if offset != 1 || fake.putCalls != 1 {
+		t.Errorf("expected offset 1 from a single put, got %d after %d puts", offset, fake.putCalls)
+	}
+	record, err := wal.Read(ctx, offset)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if record.Offset != offset || string(record.Data) != "hello world" {
+		t.Errorf("expected offset %d to read back, got %d, %q", offset, record.Offset, record.Data)
+	}
+}
+
+func errPreconditionFailed() error {
+	return &smithy.GenericAPIError{Code: "PreconditionFailed", Message: "At least one of the pre-conditions you specified did not hold"}
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	key := aws.ToString(params.Key)
+	if f.beforePut != nil {
+		f.beforePut(key)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.putCalls++
+	f.lastPut = params
+	if f.putErr != nil {
+		return nil, f.putErr
+	}
+	if want := aws.ToString(params.ContentMD5); want != "" {
+		sum := md5.Sum(body)
+		if base64.StdEncoding.EncodeToString(sum[:]) != want {
+			return nil, &smithy.GenericAPIError{Code: "BadDigest", Message: "The Content-MD5 you specified did not match what we received."}
+		}
+	}
+	existing, ok := f.objects[key]
+	if ok && aws.ToString(params.IfNoneMatch) == "*" {
+		return nil, errPreconditionFailed()
+	}
+	if ifMatch := aws.ToString(params.IfMatch); ifMatch != "" && (!ok || existing.etag != ifMatch) {
+		return nil, errPreconditionFailed()
+	}
+	obj := fakeObject{
+		body:         body,
+		etag:         fmt.Sprintf("\"%x\"", md5.Sum(body)),
+		contentType:  aws.ToString(params.ContentType),
+		metadata:     params.Metadata,
+		lastModified: f.now(),
+	}
+	f.objects[key] = obj
+	return &s3.PutObjectOutput{ETag: aws.String(obj.etag)}, nil
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if f.beforeGet != nil {
+		f.beforeGet(aws.ToString(params.Key))
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.getCalls++
+	f.lastGet = params
+	obj, ok := f.objects[aws.ToString(params.Key)]
+	if f.getMisses[aws.ToString(params.Key)] > 0 {
+		f.getMisses[aws.ToString(params.Key)]--
+		ok = false
+	}
+	if !ok {
+		return nil, &types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+	}
+	if params.IfNoneMatch != nil && aws.ToString(params.IfNoneMatch) == obj.etag {
+		return nil, &smithy.GenericAPIError{Code: "NotModified", Message: "Not Modified"}
+	}
+	body := obj.body
+	var contentRange *string
+	if r := aws.ToString(params.Range); r != "" {
+		var start int
+		body, start = applyRange(body, r)
+		contentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", start, start+len(body)-1, len(obj.body)))
+	}
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: aws.Int64(int64(len(body))),
+		ContentRange:  contentRange,
+		ETag:          aws.String(obj.etag),
+		LastModified:  aws.Time(obj.lastModified),
+		ContentType:   nilIfEmpty(obj.contentType),
+		Metadata:      obj.metadata,
+	}, nil
+}
+
+// applyRange slices body by an HTTP Range header of the form "bytes=a-b",
+// "bytes=a-" or "bytes=-n", clamping to the body like S3 does, and returns
+// the slice with its start.
+func applyRange(body []byte, r string) ([]byte, int) {
+	spec := strings.TrimPrefix(r, "bytes=")
+	first, last, _ := strings.Cut(spec, "-")
+	size := int64(len(body))
+	if first == "" {
+		n, _ := strconv.ParseInt(last, 10, 64)
+		return body[max(size-n, 0):], int(max(size-n, 0))
+	}
+	start, _ := strconv.ParseInt(first, 10, 64)
+	end := size - 1
+	if last != "" {
+		end, _ = strconv.ParseInt(last, 10, 64)
+	}
+	if start >= size {
+		return nil, int(start)
+	}
+	return body[start : min(end, size-1)+1], int(start)
+}
+
+func (f *fakeS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listCalls++
+	if f.listErr != nil {
+		return nil, f.listErr
+	}
+
+	prefix := aws.ToString(params.Prefix)
+	after := aws.ToString(params.StartAfter)
+	if token := aws.ToString(params.ContinuationToken); token != "" {
+		after = token
+	}
+	maxKeys := int(aws.ToInt32(params.MaxKeys))
+	if maxKeys <= 0 || maxKeys > 1000 {
+		maxKeys = 1000
+	}
+
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	output := &s3.ListObjectsV2Output{}
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		output.IsTruncated = aws.Bool(true)
+		output.NextContinuationToken = aws.String(keys[len(keys)-1])
+	}
+	for _, key := range keys {
+		obj := f.objects[key]
+		output.Contents = append(output.Contents, types.Object{
+			Key:          aws.String(key),
+			ETag:         aws.String(obj.etag),
+			Size:         aws.Int64(int64(len(obj.body))),
+			LastModified: aws.Time(obj.lastModified),
+		})
+	}
+	output.KeyCount = aws.Int32(int32(len(output.Contents)))
+	return output, nil
+}
+
+func (f *fakeS3) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleteCalls++
+	output := &s3.DeleteObjectsOutput{}
+	for _, obj := range params.Delete.Objects {
+		if code, ok := f.deleteErrors[aws.ToString(obj.Key)]; ok {
+			output.Errors = append(output.Errors, types.Error{Key: obj.Key, Code: aws.String(code), Message: aws.String(code)})
+			continue
+		}
+		delete(f.objects, aws.ToString(obj.Key))
+		if !aws.ToBool(params.Delete.Quiet) {
+			output.Deleted = append(output.Deleted, types.DeletedObject{Key: obj.Key})
+		}
+	}
+	return output, nil
+}
+
+func (f *fakeS3) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.headCalls++
+	if f.headErr != nil {
+		return nil, f.headErr
+	}
+	obj, ok := f.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NotFound{Message: aws.String("Not Found")}
+	}
+	return &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(obj.body))),
+		ETag:          aws.String(obj.etag),
+		LastModified:  aws.Time(obj.lastModified),
+		ContentType:   nilIfEmpty(obj.contentType),
+		Metadata:      obj.metadata,
+	}, nil
+}
+
+func (f *fakeS3) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.bucketErr != nil {
+		return nil, f.bucketErr
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+// CopyObject copies within the fake, which holds every bucket's keys in one
+// map, so the source bucket is ignored.
+func (f *fakeS3) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	source, err := url.PathUnescape(aws.ToString(params.CopySource))
+	if err != nil {
+		return nil, err
+	}
+	_, sourceKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.copyCalls++
+	obj, ok := f.objects[sourceKey]
+	if !ok {
+		return nil, &types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+	}
+	obj.lastModified = f.now()
+	f.objects[aws.ToString(params.Key)] = obj
+	return &s3.CopyObjectOutput{CopyObjectResult: &types.CopyObjectResult{ETag: aws.String(obj.etag)}}, nil
+}
+
+func (f *fakeS3) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.uploadSeq++
+	f.lastCreate = params
+	id := fmt.Sprintf("upload-%d", f.uploadSeq)
+	f.uploads[id] = &fakeUpload{key: aws.ToString(params.Key), contentType: aws.ToString(params.ContentType), metadata: params.Metadata, parts: make(map[int32][]byte), checksum: params.ChecksumAlgorithm}
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String(id)}, nil
+}
+
+func (f *fakeS3) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.partCalls++
+	upload, ok := f.uploads[aws.ToString(params.UploadId)]
+	if !ok {
+		return nil, &types.NoSuchUpload{Message: aws.String("The specified upload does not exist.")}
+	}
+	upload.parts[aws.ToInt32(params.PartNumber)] = body
+	output := &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("\"%x\"", md5.Sum(body)))}
+	fakePartChecksum(params.ChecksumAlgorithm, body, output)
+	return output, nil
+}
+
+func (f *fakeS3) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	upload, ok := f.uploads[aws.ToString(params.UploadId)]
+	if !ok {
+		return nil, &types.NoSuchUpload{Message: aws.String("The specified upload does not exist.")}
+	}
+	if _, exists := f.objects[upload.key]; exists && aws.ToString(params.IfNoneMatch) == "*" {
+		return nil, errPreconditionFailed()
+	}
+	var body []byte
+	for _, part := range params.MultipartUpload.Parts {
+		data, ok := upload.parts[aws.ToInt32(part.PartNumber)]
+		if !ok || aws.ToString(part.ETag) != fmt.Sprintf("\"%x\"", md5.Sum(data)) {
+			return nil, &smithy.GenericAPIError{Code: "InvalidPart", Message: "One or more of the specified parts could not be found."}
+		}
+		if upload.checksum != "" && completedChecksum(upload.checksum, part) == nil {
+			return nil, &smithy.GenericAPIError{Code: "InvalidRequest", Message: fmt.Sprintf("The upload was created using a %s checksum. The complete request must include the checksum for each part.", upload.checksum)}
+		}
+		body = append(body, data...)
+	}
+	delete(f.uploads, aws.ToString(params.UploadId))
+	obj := fakeObject{
+		body:         body,
+		etag:         fmt.Sprintf("\"%x-%d\"", md5.Sum(body), len(params.MultipartUpload.Parts)),
+		contentType:  upload.contentType,
+		metadata:     upload.metadata,
+		lastModified: f.now(),
+	}
+	f.objects[upload.key] = obj
+	return &s3.CompleteMultipartUploadOutput{ETag: aws.String(obj.etag)}, nil
+}
+
+func (f *fakeS3) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.abortCalls++
+	delete(f.uploads, aws.ToString(params.UploadId))
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
@@ -0,0 +1,73 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// readFallback is a bucket holding a replica of the log. A nil client means
+// the log's own.
+type readFallback struct {
+	client     s3API
+	bucketName string
+}
+
+// WithReadFallback adds a bucket that record reads fail over to when the log's
+// own bucket reports a record missing or fails with a transient error, such
+// as a read replica kept up to date with Replicate in another region. It
+// holds the same prefix and key layout. client is the one to reach it with,
+// since a bucket in another region needs its own, or nil to use the log's;
+// it gets the same WithOperationTimeout and WithRetryPolicy. Fallbacks are
+// tried in the order added, after any WithReadRetry attempts on the primary.
+//
+// Only Read and the reads built on it fail over. Appends, deletes, listings
+// and the tail lookups use the primary bucket alone. It is not supported
+// with packing.
+func WithReadFallback(client s3API, bucketName string) Option {
+	return func(w *S3DAL) error {
+		if bucketName == "" {
+			return errors.New("invalid read fallback: bucket name is empty")
+		}
+		w.fallbacks = append(w.fallbacks, readFallback{client: client, bucketName: bucketName})
+		return nil
+	}
+}
+
+// canFailOver reports whether a failed read from the primary bucket is worth
+// trying a fallback for: a missing record, or a failure that a retry could
+// get past.
+func canFailOver(ctx context.Context, err error) bool {
+	return isNotFound(err) || isRetryable(ctx, err)
+}
+
+// getFallbackRecord fetches the object at offset from each fallback bucket in
+// turn, after the primary failed with primaryErr, which is returned if none
+// has it.
+func (w *S3DAL) getFallbackRecord(ctx context.Context, offset uint64, ifNoneMatch string, primaryErr error) (*s3.GetObjectOutput, error) {
+	key := w.getObjectKey(offset)
+	for _, fallback := range w.fallbacks {
+		client := fallback.client
+		if client == nil {
+			client = w.client
+		}
+		result, err := client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket:       aws.String(fallback.bucketName),
+			Key:          aws.String(key),
+			IfNoneMatch:  nilIfEmpty(ifNoneMatch),
+			ChecksumMode: w.downloadChecksum(),
+		})
+		if err == nil {
+			w.logger.Debugf("offset %d read from fallback bucket %s: %v", offset, fallback.bucketName, primaryErr)
+			return result, nil
+		}
+		if !canFailOver(ctx, err) {
+			return nil, fmt.Errorf("failed to get object from fallback bucket %s: %w", fallback.bucketName, err)
+		}
+		w.logger.Debugf("offset %d not read from fallback bucket %s: %v", offset, fallback.bucketName, err)
+	}
+	return nil, primaryErr
+}
@@ -0,0 +1,78 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go"
+)
+
+func TestReadFallback(t *testing.T) {
+	ctx := context.Background()
+	replica := newFakeS3()
+	source, err := New(replica, "replica-bucket", "fake-prefix")
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	for _, data := range []string{"first", "second"} {
+		if _, err := source.Append(ctx, []byte(data)); err != nil {
+			t.Fatalf("failed to append to the replica: %v", err)
+		}
+	}
+
+	primary := &flakyS3{fakeS3: newFakeS3()}
+	wal, err := New(primary, "primary-bucket", "fake-prefix", WithReadFallback(replica, "replica-bucket"))
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+
+	// the primary has no record 1, so the replica serves it
+	record, err := wal.Read(ctx, 1)
+	if err != nil || string(record.Data) != "first" {
+		t.Fatalf("expected the replica to serve offset 1, got %q, %v", record.Data, err)
+	}
+	if got := aws.ToString(replica.lastGet.Bucket); got != "replica-bucket" {
+		t.Errorf("expected the read from replica-bucket, got %s", got)
+	}
+
+	// a 5xx fails over too
+	primary.errs = []error{statusError(http.StatusInternalServerError)}
+	if record, err := wal.Read(ctx, 2); err != nil || string(record.Data) != "second" {
+		t.Errorf("expected the replica to serve offset 2 after a 500, got %q, %v", record.Data, err)
+	}
+
+	// appends only go to the primary, which is then read first
+	puts := replica.putCalls
+	offset, err := wal.Append(ctx, []byte("primary only"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if replica.putCalls != puts {
+		t.Errorf("expected no puts to the replica, got %d", replica.putCalls-puts)
+	}
+	gets := replica.getCalls
+	if record, err := wal.Read(ctx, offset); err != nil || string(record.Data) != "primary only" || replica.getCalls != gets {
+		t.Errorf("expected offset %d from the primary alone, got %q, %v after %d replica gets", offset, record.Data, err, replica.getCalls-gets)
+	}
+
+	// missing everywhere is still ErrRecordNotFound
+	if _, err := wal.Read(ctx, 10); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound, got %v", err)
+	}
+	// a permanent failure does not fail over
+	primary.errs = []error{&smithy.GenericAPIError{Code: "AccessDenied"}}
+	gets = replica.getCalls
+	if _, err := wal.Read(ctx, 1); err == nil || replica.getCalls != gets {
+		t.Errorf("expected access denied not to fail over, got %v after %d replica gets", err, replica.getCalls-gets)
+	}
+
+	if _, err := New(primary, "primary-bucket", "fake-prefix", WithReadFallback(nil, "")); err == nil {
+		t.Error("expected an empty fallback bucket name to be rejected")
+	}
+	if _, err := New(primary, "primary-bucket", "fake-prefix", WithPacking(10), WithReadFallback(replica, "replica-bucket")); err == nil {
+		t.Error("expected a read fallback to be rejected with packing")
+	}
+}
@@ -0,0 +1,131 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// The epoch marker holds the epoch of the log's current writer, in decimal.
+const epochMarkerName = "_epoch"
+
+// ErrFencedOut is returned by the writes of a client whose epoch has been
+// claimed by a newer writer, and by a ClaimEpoch that lost a race for it.
+var ErrFencedOut = errors.New("fenced out by a newer writer")
+
+// epochClaim is the epoch a client holds and the marker's ETag when it claimed
+// it.
+type epochClaim struct {
+	epoch uint64
+	etag  string
+}
+
+func (w *S3DAL) epochKey() string {
+	return w.keyUnder(epochMarkerName)
+}
+
+// ClaimEpoch makes this client the log's writer and returns its epoch. It
+// increments the epoch in prefix/_epoch with a conditional put, so of two
+// writers claiming at once one fails with ErrFencedOut. From then on every
+// write this client makes, appends and deletes alike, first checks the marker
+// with HeadObject and fails with ErrFencedOut once a newer writer has claimed
+// it, so a writer thought dead cannot resume writing.
+//
+// A writer taking over claims the epoch first, then calls LastRecord to
+// resume at the tail. The check and the write are two requests, so an append
+// the old writer had already checked can still land; the new writer sees it
+// as the tail, or as ErrOffsetConflict if it appended first.
+func (w *S3DAL) ClaimEpoch(ctx context.Context) (uint64, error) {
+	if w.lifetime.Err() != nil {
+		return 0, ErrClosed
+	}
+	current, etag, err := w.readEpoch(ctx)
+	if err != nil {
+		return 0, err
+	}
+	next := current + 1
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(w.epochKey()),
+		Body:   bytes.NewReader([]byte(strconv.FormatUint(next, 10))),
+	}
+	if etag == "" {
+		input.IfNoneMatch = aws.String("*")
+	} else {
+		input.IfMatch = aws.String(etag)
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.BucketKeyEnabled = w.sseParams()
+	output, err := w.client.PutObject(ctx, input)
+	if err != nil {
+		if isPreconditionFailed(err) {
+			return 0, fmt.Errorf("%w: epoch %d was claimed concurrently", ErrFencedOut, next)
+		}
+		return 0, fmt.Errorf("failed to put epoch marker to S3: %w", err)
+	}
+	w.fence.Store(&epochClaim{epoch: next, etag: aws.ToString(output.ETag)})
+	return next, nil
+}
+
+// Epoch returns the epoch this client claimed with ClaimEpoch, or 0.
+func (w *S3DAL) Epoch() uint64 {
+	if claim := w.fence.Load(); claim != nil {
+		return claim.epoch
+	}
+	return 0
+}
+
+// readEpoch returns the stored epoch and the marker's ETag, or an empty ETag
+// if there is no marker.
+func (w *S3DAL) readEpoch(ctx context.Context) (uint64, string, error) {
+	result, err := w.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(w.epochKey()),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return 0, "", nil
+		}
+		return 0, "", fmt.Errorf("failed to get epoch marker from S3: %w", err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read epoch marker: %w", err)
+	}
+	epoch, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid epoch marker %q: %w", data, err)
+	}
+	return epoch, aws.ToString(result.ETag), nil
+}
+
+// checkFence fails with ErrFencedOut if this client claimed an epoch and the
+// marker no longer holds it. Without a claim it makes no request.
+func (w *S3DAL) checkFence(ctx context.Context) error {
+	claim := w.fence.Load()
+	if claim == nil {
+		return nil
+	}
+	output, err := w.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(w.epochKey()),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("%w: epoch marker for epoch %d is gone", ErrFencedOut, claim.epoch)
+		}
+		return fmt.Errorf("failed to check epoch marker in S3: %w", err)
+	}
+	if aws.ToString(output.ETag) != claim.etag {
+		return fmt.Errorf("%w: epoch %d is no longer current", ErrFencedOut, claim.epoch)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFencing(t *testing.T) {
+	old, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	if epoch, err := old.ClaimEpoch(ctx); err != nil || epoch != 1 {
+		t.Fatalf("expected to claim epoch 1, got %d, %v", epoch, err)
+	}
+	if _, err := old.Append(ctx, []byte("from the first writer")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	// a replacement takes over while the first writer is presumed dead
+	replacement, err := New(fake, old.bucketName, old.prefix)
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	if epoch, err := replacement.ClaimEpoch(ctx); err != nil || epoch != 2 {
+		t.Fatalf("expected to claim epoch 2, got %d, %v", epoch, err)
+	}
+	if _, err := replacement.LastRecord(ctx); err != nil {
+		t.Fatalf("failed to find the tail: %v", err)
+	}
+	if offset, err := replacement.Append(ctx, []byte("from the replacement")); err != nil || offset != 2 {
+		t.Fatalf("expected the replacement to append at 2, got %d, %v", offset, err)
+	}
+
+	puts := fake.putCalls
+	if _, err := old.Append(ctx, []byte("resurrected")); !errors.Is(err, ErrFencedOut) {
+		t.Errorf("expected the old writer to be fenced out, got %v", err)
+	}
+	if _, err := old.AppendBatch(ctx, [][]byte{[]byte("resurrected")}); !errors.Is(err, ErrFencedOut) {
+		t.Errorf("expected the old writer's batch to be fenced out, got %v", err)
+	}
+	if _, err := old.TrimBefore(ctx, 2); !errors.Is(err, ErrFencedOut) {
+		t.Errorf("expected the old writer's trim to be fenced out, got %v", err)
+	}
+	if fake.putCalls != puts || len(fake.objects) != 3 {
+		t.Errorf("expected the fenced writes to reach no record, got %d puts and %d objects", fake.putCalls-puts, len(fake.objects))
+	}
+	if record, err := replacement.Read(ctx, 2); err != nil || string(record.Data) != "from the replacement" {
+		t.Errorf("expected the replacement's record intact, got %q, %v", record.Data, err)
+	}
+
+	// a claim racing another fails rather than sharing the epoch
+	racer, _ := New(fake, old.bucketName, old.prefix)
+	fake.beforePut = func(key string) {
+		if key == old.epochKey() {
+			fake.beforePut = nil
+			if _, err := replacement.ClaimEpoch(ctx); err != nil {
+				t.Errorf("failed to claim epoch: %v", err)
+			}
+		}
+	}
+	if _, err := racer.ClaimEpoch(ctx); !errors.Is(err, ErrFencedOut) {
+		t.Errorf("expected the losing claim to be fenced out, got %v", err)
+	}
+	if replacement.Epoch() != 3 || racer.Epoch() != 0 {
+		t.Errorf("expected epochs 3 and 0, got %d and %d", replacement.Epoch(), racer.Epoch())
+	}
+}
@@ -0,0 +1,104 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Follow emits the records at or after from in order, like tail -f: once it
+// reaches the tail it checks again every poll, emitting records as they are
+// appended. A missing offset is skipped only once a later record exists, so
+// holes and trimmed prefixes do not stall it, while the tail is simply waited
+// on.
+//
+// Errors are sent on the error channel without stopping the follow. A corrupt
+// record is reported and skipped; any other failure is reported and the same
+// offset retried after poll. Both channels are closed once ctx is done or the
+// S3DAL is closed, and the caller must keep receiving from both until then.
+func (w *S3DAL) Follow(ctx context.Context, from uint64, poll time.Duration) (<-chan Record, <-chan error) {
+	records := make(chan Record)
+	errs := make(chan error)
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(w.lifetime, cancel)
+	go func() {
+		defer close(records)
+		defer close(errs)
+		defer cancel()
+		defer stop()
+		w.follow(ctx, max(from, 1), poll, records, errs)
+	}()
+	return records, errs
+}
+
+func (w *S3DAL) follow(ctx context.Context, next uint64, poll time.Duration, records chan<- Record, errs chan<- error) {
+	report := func(err error) bool {
+		select {
+		case errs <- err:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	wait := func() bool {
+		timer := time.NewTimer(poll)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for ctx.Err() == nil {
+		record, err := w.Read(ctx, next)
+		switch {
+		case err == nil:
+			select {
+			case records <- record:
+				next++
+			case <-ctx.Done():
+				return
+			}
+		case ctx.Err() != nil:
+			return
+		case errors.Is(err, ErrRecordNotFound):
+			// at the tail, or at a hole with records after it
+			offsets, _, err := w.listOffsetsAfter(ctx, next-1, 1)
+			if err != nil {
+				if !report(err) || !wait() {
+					return
+				}
+				continue
+			}
+			if len(offsets) > 0 {
+				next = offsets[0]
+				continue
+			}
+			if !wait() {
+				return
+			}
+		case isCorruptRecord(err):
+			if !report(err) {
+				return
+			}
+			next++
+		default:
+			if !report(err) || !wait() {
+				return
+			}
+		}
+	}
+}
+
+// isCorruptRecord reports whether err means the record itself is unreadable,
+// so reading it again cannot succeed.
+func isCorruptRecord(err error) bool {
+	for _, target := range []error{ErrChecksumMismatch, ErrOffsetMismatch, ErrRecordTooShort, ErrEmptyObject, ErrBadMagic, ErrUnsupportedVersion, ErrUnknownFlags} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
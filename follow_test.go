@@ -0,0 +1,74 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFollow(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		if _, err := wal.Append(ctx, []byte("existing")); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	records, errs := wal.Follow(ctx, 0, time.Millisecond)
+
+	expect := func(offset uint64) {
+		t.Helper()
+		select {
+		case record := <-records:
+			if record.Offset != offset {
+				t.Fatalf("expected offset %d, got %d", offset, record.Offset)
+			}
+		case err := <-errs:
+			t.Fatalf("expected offset %d, got error %v", offset, err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for offset %d", offset)
+		}
+	}
+	expect(1)
+	expect(2)
+
+	// appended after the follower reached the tail, past a hole at 3
+	wal.length = 3
+	if _, err := wal.Append(ctx, []byte("after a hole")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	expect(4)
+
+	// a corrupt record is reported and skipped
+	body, err := prepareBody(5, 0, []byte("corrupt"), CompressionNone, ChecksumCRC16, false)
+	if err != nil {
+		t.Fatalf("failed to prepare body: %v", err)
+	}
+	body[len(body)-1] ^= 0xFF
+	fake.mu.Lock()
+	fake.objects[wal.getObjectKey(5)] = fakeObject{body: body}
+	fake.mu.Unlock()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the corrupt record to be reported")
+	}
+	wal.length = 5
+	if _, err := wal.Append(ctx, []byte("after the corrupt record")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	expect(6)
+
+	cancel()
+	for range records {
+	}
+	if _, ok := <-errs; ok {
+		t.Error("expected the error channel to be closed after cancellation")
+	}
+}
@@ -0,0 +1,324 @@
+package s3_dal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Records are framed as
+//
+//	[2-byte magic][1-byte version][1-byte flags][8-byte offset][8-byte created, if flagged][data][checksum]
+//
+// The checksum covers everything before it and is 0, 2, 4 or 32 bytes depending
+// on its algorithm. Bits 0-2 of flags hold the Compression of data and bits 3-4
+// the Checksum. Bit 5 marks a creation time after the offset, in Unix
+// nanoseconds, bit 6 a payload sealed with WithClientEncryption, and bit 7 a
+// zero trailer written under WithSkipCRCOnWrite, which is not checked.
+const (
+	recordMagic0    byte = 'S'
+	recordMagic1    byte = 'D'
+	recordVersion   byte = 1
+	recordHeaderLen      = 4
+
+	flagCompressionMask byte = 0x07
+	flagChecksumShift        = 3
+	flagChecksumMask    byte = 0x03 << flagChecksumShift
+	flagTimestamp       byte = 0x20
+	flagEncrypted       byte = 0x40
+	flagUnchecked       byte = 0x80
+)
+
+// legacyFlagged is set in the first byte of headerless records written with
+// compression, whose low bits hold the Compression. Other headerless records
+// start with the high byte of their offset, which is zero below 2^56.
+const legacyFlagged byte = 0x80
+
+// frame is a record body split into its parts, with data still as stored.
+type frame struct {
+	version  byte // 0 for headerless records
+	codec    Compression
+	checksum Checksum
+	offset   uint64
+	created  int64 // Unix nanoseconds, 0 if not recorded
+	sealed   bool  // data is encrypted
+	// unchecked is set for records written with a zero trailer under
+	// WithSkipCRCOnWrite
+	unchecked bool
+	data      []byte
+}
+
+// prepareBody frames data for offset, compressing it first with codec and
+// guarding it with checksum. A non-zero created is stored as the creation
+// time. With skipCRC the trailer is written as zero instead of computed.
+func prepareBody(offset uint64, created int64, data []byte, codec Compression, checksum Checksum, skipCRC bool) ([]byte, error) {
+	data, err := compressPayload(codec, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress payload: %w", err)
+	}
+	return frameBody(offset, created, data, codec, checksum, false, skipCRC), nil
+}
+
+// frameBody is prepareBody for data that is already compressed with codec,
+// and sealed if encrypted is set. The header records the algorithm checksum
+// implements.
+func frameBody(offset uint64, created int64, data []byte, codec Compression, checksum Checksummer, encrypted, skipCRC bool) []byte {
+	id, _ := algorithmOf(checksum)
+	// 4 bytes for the header, 8 bytes for offset, maybe 8 for the creation time, len(data) bytes for data, then the checksum
+	bufferLen := maxHeaderLen + len(data) + checksum.Size()
+	buf := appendHeader(make([]byte, 0, bufferLen), offset, created, codec, id, encrypted, skipCRC)
+	buf = append(buf, data...)
+	if skipCRC {
+		return append(buf, make([]byte, checksum.Size())...)
+	}
+	return append(buf, checksum.Sum(buf)...) // Exclude space for the checksum during calculation
+}
+
+// appendHeader appends the framing that precedes the data of a record, marked
+// as unchecked if its trailer will be written as zero.
+func appendHeader(buf []byte, offset uint64, created int64, codec Compression, checksum Checksum, encrypted, unchecked bool) []byte {
+	flags := byte(codec)&flagCompressionMask | byte(checksum)<<flagChecksumShift&flagChecksumMask
+	if created != 0 {
+		flags |= flagTimestamp
+	}
+	if encrypted {
+		flags |= flagEncrypted
+	}
+	if unchecked {
+		flags |= flagUnchecked
+	}
+	buf = append(buf, recordMagic0, recordMagic1, recordVersion, flags)
+	buf = binary.BigEndian.AppendUint64(buf, offset)
+	if created != 0 {
+		buf = binary.BigEndian.AppendUint64(buf, uint64(created))
+	}
+	return buf
+}
+
+// parseFrame splits a record body without checking its checksum. Headerless
+// bodies are only accepted if legacy is set.
+func parseFrame(body []byte, legacy bool) (frame, error) {
+	f, n, err := parseHeader(body, legacy)
+	if err != nil {
+		return frame{}, err
+	}
+	if len(body) < n+f.checksum.Size() {
+		return frame{}, ErrRecordTooShort
+	}
+	f.data = body[n : len(body)-f.checksum.Size()]
+	return f, nil
+}
+
+// skipsChecksum reports whether body, framed as f, was written under
+// WithSkipCRCOnWrite: flagged unchecked, with the zero trailer written with
+// the flag. A checked record whose flag bit flipped in storage keeps its real
+// trailer, so is still checked.
+func (f frame) skipsChecksum(body []byte) bool {
+	return f.unchecked && isZeroTrailer(body[len(body)-f.checksum.Size():])
+}
+
+func isZeroTrailer(trailer []byte) bool {
+	for _, b := range trailer {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// maxHeaderLen is the most bytes parseHeader needs to see.
+const maxHeaderLen = recordHeaderLen + 8 + 8
+
+// parseHeader parses the header and offset at the start of prefix and
+// returns them with the number of bytes they take. Headerless bodies are only
+// accepted if legacy is set.
+func parseHeader(prefix []byte, legacy bool) (frame, int, error) {
+	if len(prefix) == 0 {
+		return frame{}, 0, ErrEmptyObject
+	}
+	if len(prefix) >= 2 && prefix[0] == recordMagic0 && prefix[1] == recordMagic1 {
+		if len(prefix) < recordHeaderLen+8 {
+			return frame{}, 0, ErrRecordTooShort
+		}
+		if prefix[2] != recordVersion {
+			return frame{}, 0, fmt.Errorf("%w: %d", ErrUnsupportedVersion, prefix[2])
+		}
+		flags := prefix[3]
+		f := frame{
+			version:   prefix[2],
+			codec:     Compression(flags & flagCompressionMask),
+			checksum:  Checksum((flags & flagChecksumMask) >> flagChecksumShift),
+			sealed:    flags&flagEncrypted != 0,
+			unchecked: flags&flagUnchecked != 0,
+		}
+		if !f.codec.valid() || !f.checksum.valid() || flags&^(flagCompressionMask|flagChecksumMask|flagTimestamp|flagEncrypted|flagUnchecked) != 0 {
+			return frame{}, 0, fmt.Errorf("%w 0x%02X", ErrUnknownFlags, flags)
+		}
+		f.offset = binary.BigEndian.Uint64(prefix[recordHeaderLen : recordHeaderLen+8])
+		n := recordHeaderLen + 8
+		if flags&flagTimestamp != 0 {
+			if len(prefix) < n+8 {
+				return frame{}, 0, ErrRecordTooShort
+			}
+			f.created = int64(binary.BigEndian.Uint64(prefix[n : n+8]))
+			n += 8
+		}
+		return f, n, nil
+	}
+
+	if !legacy {
+		if len(prefix) < recordHeaderLen+8 {
+			return frame{}, 0, ErrRecordTooShort
+		}
+		return frame{}, 0, ErrBadMagic
+	}
+	header := 8
+	var f frame
+	if len(prefix) > 0 && prefix[0]&legacyFlagged != 0 {
+		f.codec = Compression(prefix[0] &^ legacyFlagged)
+		if !f.codec.valid() {
+			return frame{}, 0, fmt.Errorf("%w 0x%02X", ErrUnknownFlags, prefix[0])
+		}
+		header++
+	}
+	if len(prefix) < header {
+		return frame{}, 0, ErrRecordTooShort
+	}
+	f.offset = binary.BigEndian.Uint64(prefix[header-8 : header])
+	return f, header, nil
+}
+
+// isPlainHeader reports whether header opens a current-version record with an
+// uncompressed payload and a CRC16 trailer, whose data can be streamed as
+// stored.
+func isPlainHeader(header []byte) bool {
+	return len(header) >= recordHeaderLen && header[0] == recordMagic0 && header[1] == recordMagic1 &&
+		header[2] == recordVersion && header[3] == byte(CompressionNone)
+}
+
+// decodeBody parses a record body read for offset, checking the CRC unless
+// checkCRC is false or the header marks it unchecked, then decrypting and
+// decompressing the payload.
+func (w *S3DAL) decodeBody(offset uint64, body []byte, checkCRC bool) (Record, error) {
+	return decodeRecord(offset, body, checkCRC, w.legacyFormat, w.logger, w.keys, w.checksummer)
+}
+
+// decodeRecord is decodeBody for callers without an S3DAL, opening encrypted
+// records with keys and verifying with checksummer where the header names its
+// algorithm.
+func decodeRecord(offset uint64, body []byte, checkCRC, legacy bool, logger Logger, keys keyRing, checksummer Checksummer) (Record, error) {
+	f, err := parseFrame(body, legacy)
+	if err != nil {
+		return Record{}, fmt.Errorf("offset %d: %w", offset, withSize(err, int64(len(body))))
+	}
+	if f.offset != offset {
+		return Record{}, offsetMismatch(offset, f.offset)
+	}
+	if checkCRC && !f.skipsChecksum(body) && !validateChecksum(body, verifier(f.checksum, checksummer), logger) {
+		return Record{}, fmt.Errorf("%w: offset %d", ErrChecksumMismatch, offset)
+	}
+	data, err := keys.payload(f)
+	if err != nil {
+		return Record{}, err
+	}
+	data, err = decompressPayload(f.codec, data)
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to decompress record %d: %w", offset, err)
+	}
+	return Record{Offset: f.offset, Data: data, CreatedAt: createdAt(f.created)}, nil
+}
+
+// withSize adds the size of the object to an error for one too short to be a
+// record.
+func withSize(err error, size int64) error {
+	if errors.Is(err, ErrRecordTooShort) || errors.Is(err, ErrEmptyObject) {
+		return fmt.Errorf("%w: got %d bytes", err, size)
+	}
+	return err
+}
+
+// createdAt converts a stored creation time, where 0 means none, to the zero
+// time or a time.Time.
+func createdAt(created int64) time.Time {
+	if created == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, created)
+}
+
+// unixNanos is the stored form of t, 0 for the zero time.
+func unixNanos(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// RecordFormat is how a record object is framed, for tools that read or
+// write record objects without going through an S3DAL. The zero value is the
+// default format: uncompressed, with a CRC16 trailer.
+type RecordFormat struct {
+	Compression Compression
+	Checksum    Checksum
+	// Legacy makes Decode accept headerless records too, as
+	// WithLegacyFormat does.
+	Legacy bool
+}
+
+// Encode frames data as the record object for offset, byte for byte as an
+// S3DAL with the same compression and checksum writes it.
+func (f RecordFormat) Encode(offset uint64, data []byte) ([]byte, error) {
+	if !f.Compression.valid() {
+		return nil, fmt.Errorf("invalid compression %d", f.Compression)
+	}
+	if !f.Checksum.valid() {
+		return nil, fmt.Errorf("invalid checksum %d", f.Checksum)
+	}
+	return prepareBody(offset, 0, data, f.Compression, f.Checksum, false)
+}
+
+// Decode parses a record object, verifies its checksum unless the header
+// marks it written under WithSkipCRCOnWrite, and decompresses its
+// data, as Read does. The offset is the one in the header; compression and
+// checksum come from the header too, so any current-version record decodes
+// whatever f's own are. An encrypted record fails with ErrDecryptionFailed;
+// use S3DAL.DecodeRecord for those.
+func (f RecordFormat) Decode(raw []byte) (Record, error) {
+	return decodeRaw(raw, f.Legacy, nopLogger{}, nil, nil)
+}
+
+// EncodeRecord is Encode in the default format.
+func EncodeRecord(offset uint64, data []byte) ([]byte, error) {
+	return RecordFormat{}.Encode(offset, data)
+}
+
+// DecodeRecord is Decode in the default format.
+func DecodeRecord(raw []byte) (Record, error) {
+	return RecordFormat{}.Decode(raw)
+}
+
+// EncodeRecord frames data as the record object for offset in w's format,
+// compressed, sealed and stamped as Append would write it, with a zero
+// trailer flagged unchecked under WithSkipCRCOnWrite.
+func (w *S3DAL) EncodeRecord(offset uint64, data []byte) ([]byte, error) {
+	w.mu.Lock()
+	created := w.nextCreated()
+	w.mu.Unlock()
+	return w.encodeBody(offset, created, data, w.skipCRC)
+}
+
+// DecodeRecord parses a record object as Read would, opening it with w's
+// decryption keys and accepting headerless records under WithLegacyFormat.
+func (w *S3DAL) DecodeRecord(raw []byte) (Record, error) {
+	return decodeRaw(raw, w.legacyFormat, w.logger, w.keys, w.checksummer)
+}
+
+// decodeRaw is decodeRecord for the offset raw's header holds.
+func decodeRaw(raw []byte, legacy bool, logger Logger, keys keyRing, checksummer Checksummer) (Record, error) {
+	f, err := parseFrame(raw, legacy)
+	if err != nil {
+		return Record{}, withSize(err, int64(len(raw)))
+	}
+	return decodeRecord(f.offset, raw, true, legacy, logger, keys, checksummer)
+}
@@ -0,0 +1,312 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// legacyBody frames data the way records were written before the format
+// header: [8-byte offset][data][2-byte CRC16].
+func legacyBody(offset uint64, data []byte) []byte {
+	body := binary.BigEndian.AppendUint64(nil, offset)
+	body = append(body, data...)
+	return binary.BigEndian.AppendUint16(body, crc16Fast(body))
+}
+
+func TestRecordHeader(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithCompression(CompressionGzip))
+	ctx := context.Background()
+
+	offset, err := wal.Append(ctx, []byte("payload"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	body := fake.objects[wal.getObjectKey(offset)].body
+	want := []byte{recordMagic0, recordMagic1, recordVersion, byte(CompressionGzip)}
+	if !bytes.Equal(body[:recordHeaderLen], want) {
+		t.Errorf("expected header %v, got %v", want, body[:recordHeaderLen])
+	}
+}
+
+func TestHeaderlessRecordDetected(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	payload := []byte("written before the header existed")
+	fake.objects[wal.getObjectKey(1)] = fakeObject{body: legacyBody(1, payload)}
+
+	// without opting in, the old layout is reported rather than misparsed
+	if _, err := wal.Read(ctx, 1); !errors.Is(err, ErrBadMagic) {
+		t.Fatalf("expected ErrBadMagic for a headerless record, got %v", err)
+	}
+
+	legacy, err := OpenS3DAL(ctx, fake, wal.bucketName, wal.prefix, WithLegacyFormat())
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	record, err := legacy.Read(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to read headerless record in legacy mode: %v", err)
+	}
+	if !bytes.Equal(record.Data, payload) {
+		t.Errorf("expected %q, got %q", payload, record.Data)
+	}
+
+	// new records are still read in legacy mode
+	offset, err := legacy.Append(ctx, []byte("new"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if record, err = legacy.Read(ctx, offset); err != nil || string(record.Data) != "new" {
+		t.Errorf("expected to read the new record back, got %q, %v", record.Data, err)
+	}
+}
+
+func TestUnsupportedRecordVersion(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	offset, err := wal.Append(ctx, []byte("payload"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	obj := fake.objects[wal.getObjectKey(offset)]
+	obj.body[2] = recordVersion + 1
+	if _, err := wal.Read(ctx, offset); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("expected ErrUnsupportedVersion, got %v", err)
+	}
+}
+
+func TestRecordTimestamps(t *testing.T) {
+	clock := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	wal, fake := newFakeDAL(t, WithTimestamps(), WithCompression(CompressionZstd))
+	wal.now = func() time.Time { return clock }
+	ctx := context.Background()
+
+	first, err := wal.Append(ctx, []byte("stamped"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	// a clock that does not advance still yields increasing times
+	offsets, err := wal.AppendBatch(ctx, [][]byte{[]byte("a"), []byte("b")})
+	if err != nil {
+		t.Fatalf("failed to append batch: %v", err)
+	}
+
+	var last time.Time
+	for _, offset := range append([]uint64{first}, offsets...) {
+		record, err := wal.Read(ctx, offset)
+		if err != nil {
+			t.Fatalf("failed to read %d: %v", offset, err)
+		}
+		if record.CreatedAt.Before(clock) || !record.CreatedAt.After(last) {
+			t.Errorf("offset %d: expected a creation time after %v, got %v", offset, last, record.CreatedAt)
+		}
+		last = record.CreatedAt
+	}
+	if record, err := wal.ReadRaw(ctx, wal.getObjectKey(first)); err != nil || !record.CreatedAt.Equal(clock) {
+		t.Errorf("expected ReadRaw to report %v, got %v, %v", clock, record.CreatedAt, err)
+	}
+
+	// records from a client without the option have no time
+	plain := S3DALClient(fake, wal.bucketName, wal.prefix)
+	plain.length = wal.Length()
+	offset, err := plain.Append(ctx, []byte("unstamped"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if record, err := wal.Read(ctx, offset); err != nil || !record.CreatedAt.IsZero() {
+		t.Errorf("expected a zero creation time, got %v, %v", record.CreatedAt, err)
+	}
+}
+
+func TestEmptyRecord(t *testing.T) {
+	ctx := context.Background()
+	for name, opts := range map[string][]Option{
+		"default":    nil,
+		"gzip":       {WithCompression(CompressionGzip)},
+		"crc32c":     {WithChecksum(ChecksumCRC32C)},
+		"timestamps": {WithTimestamps()},
+	} {
+		wal, fake := newFakeDAL(t, opts...)
+		offset, err := wal.Append(ctx, nil)
+		if err != nil {
+			t.Fatalf("%s: failed to append an empty record: %v", name, err)
+		}
+		record, err := wal.Read(ctx, offset)
+		if err != nil || len(record.Data) != 0 {
+			t.Errorf("%s: expected an empty record back, got %q, %v", name, record.Data, err)
+		}
+		if name == "default" {
+			body := fake.objects[wal.getObjectKey(offset)].body
+			if len(body) != recordHeaderLen+8+2 {
+				t.Errorf("expected a %d-byte body, got %d", recordHeaderLen+8+2, len(body))
+			}
+		}
+	}
+
+	// the headerless layout of an empty record is exactly 10 bytes, its CRC
+	// taken over the offset alone
+	body := legacyBody(1, nil)
+	if len(body) != 10 || binary.BigEndian.Uint16(body[8:]) != crc16Fast(body[:8]) || !validateChecksum(body, ChecksumCRC16, nopLogger{}) {
+		t.Fatalf("expected a 10-byte body checksummed over its offset, got %x", body)
+	}
+	wal, fake := newFakeDAL(t, WithLegacyFormat())
+	fake.objects[wal.getObjectKey(1)] = fakeObject{body: body}
+	fake.objects[wal.getObjectKey(2)] = fakeObject{body: body[:9]}
+	if record, err := wal.Read(ctx, 1); err != nil || len(record.Data) != 0 {
+		t.Errorf("expected an empty headerless record to read, got %q, %v", record.Data, err)
+	}
+	if _, err := wal.Read(ctx, 2); err == nil {
+		t.Error("expected a 9-byte body to be rejected")
+	}
+}
+
+func TestEmptyObject(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := wal.Append(ctx, []byte("record")); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	fake.objects[wal.getObjectKey(1)] = fakeObject{body: []byte{}}
+	fake.objects[wal.getObjectKey(2)] = fakeObject{body: []byte{'S', 'D', 1}}
+
+	for offset, tc := range map[uint64]struct {
+		want, not error
+		size      string
+	}{
+		1: {ErrEmptyObject, ErrRecordTooShort, "got 0 bytes"},
+		2: {ErrRecordTooShort, ErrEmptyObject, "got 3 bytes"},
+	} {
+		_, err := wal.Read(ctx, offset)
+		if !errors.Is(err, tc.want) || errors.Is(err, tc.not) || !strings.Contains(err.Error(), tc.size) {
+			t.Errorf("offset %d: expected %v with %q, got %v", offset, tc.want, tc.size, err)
+		}
+		if _, _, err := wal.ReadStream(ctx, offset); !errors.Is(err, tc.want) || !strings.Contains(err.Error(), tc.size) {
+			t.Errorf("offset %d: expected ReadStream to fail with %v, got %v", offset, tc.want, err)
+		}
+		if _, err := wal.ReadRaw(ctx, wal.getObjectKey(offset)); !errors.Is(err, tc.want) {
+			t.Errorf("offset %d: expected ReadRaw to fail with %v, got %v", offset, tc.want, err)
+		}
+	}
+}
+
+func TestEncodeDecodeRecord(t *testing.T) {
+	for _, format := range []RecordFormat{
+		{},
+		{Compression: CompressionGzip, Checksum: ChecksumCRC32C},
+		{Compression: CompressionZstd, Checksum: ChecksumSHA256},
+	} {
+		raw, err := format.Encode(7, []byte("round trip"))
+		if err != nil {
+			t.Fatalf("%+v: failed to encode: %v", format, err)
+		}
+		record, err := DecodeRecord(raw)
+		if err != nil || record.Offset != 7 || string(record.Data) != "round trip" {
+			t.Errorf("%+v: expected offset 7 to round-trip, got %d, %q, %v", format, record.Offset, record.Data, err)
+		}
+
+		corrupt := bytes.Clone(raw)
+		corrupt[len(corrupt)/2] ^= 0xff
+		if _, err := format.Decode(corrupt); err == nil {
+			t.Errorf("%+v: expected a corrupted record to be rejected", format)
+		}
+		if _, err := format.Decode(raw[:maxHeaderLen-1]); err == nil {
+			t.Errorf("%+v: expected a truncated record to be rejected", format)
+		}
+	}
+
+	raw, err := EncodeRecord(1, []byte("plain"))
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	raw[recordHeaderLen+8] ^= 0xff
+	if _, err := DecodeRecord(raw); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if _, err := DecodeRecord(legacyBody(3, []byte("old"))); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("expected a headerless record rejected by default, got %v", err)
+	}
+	if record, err := (RecordFormat{Legacy: true}).Decode(legacyBody(3, []byte("old"))); err != nil || string(record.Data) != "old" {
+		t.Errorf("expected a headerless record to decode as legacy, got %q, %v", record.Data, err)
+	}
+	if _, err := (RecordFormat{Checksum: 4}).Encode(1, nil); err == nil {
+		t.Error("expected an unknown checksum to be rejected")
+	}
+}
+
+func TestDecodeRecordSkipCRC(t *testing.T) {
+	wal, _ := newFakeDAL(t, WithSkipCRCOnWrite(), WithChecksum(ChecksumCRC32C))
+	raw, err := wal.EncodeRecord(4, []byte("unchecked"))
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	if raw[3]&flagUnchecked == 0 {
+		t.Errorf("expected the header flagged unchecked, got flags 0x%02X", raw[3])
+	}
+	for name, decode := range map[string]func([]byte) (Record, error){
+		"DecodeRecord":       DecodeRecord,
+		"S3DAL.DecodeRecord": wal.DecodeRecord,
+	} {
+		record, err := decode(raw)
+		if err != nil || record.Offset != 4 || string(record.Data) != "unchecked" {
+			t.Errorf("%s: expected the skip-CRC record to decode, got %d, %q, %v", name, record.Offset, record.Data, err)
+		}
+	}
+
+	// a checked record whose flag flips still has its trailer checked
+	checked, err := EncodeRecord(4, []byte("checked"))
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	checked[3] |= flagUnchecked
+	if _, err := DecodeRecord(checked); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+}
+
+func TestEncodeRecordMatchesAppend(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithCompression(CompressionGzip), WithChecksum(ChecksumCRC32C))
+	ctx := context.Background()
+
+	offset, err := wal.Append(ctx, []byte("same bytes"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	raw, err := wal.EncodeRecord(offset, []byte("same bytes"))
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	if stored := fake.objects[wal.getObjectKey(offset)].body; !bytes.Equal(raw, stored) {
+		t.Errorf("expected EncodeRecord to match the stored object, got %x and %x", raw, stored)
+	}
+	if external, err := (RecordFormat{Compression: CompressionGzip, Checksum: ChecksumCRC32C}).Encode(offset, []byte("same bytes")); err != nil || !bytes.Equal(external, raw) {
+		t.Errorf("expected RecordFormat to match too, got %x, %v", external, err)
+	}
+	if record, err := wal.DecodeRecord(raw); err != nil || string(record.Data) != "same bytes" {
+		t.Errorf("expected the stored object to decode, got %q, %v", record.Data, err)
+	}
+}
+
+func TestDecodeEncryptedRecord(t *testing.T) {
+	wal, _ := newFakeDAL(t, WithClientEncryption(1, newGCM(t, 1)), WithTimestamps())
+
+	raw, err := wal.EncodeRecord(4, []byte("sealed"))
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	if record, err := wal.DecodeRecord(raw); err != nil || string(record.Data) != "sealed" || record.CreatedAt.IsZero() {
+		t.Errorf("expected the DAL to open its own record, got %q, %v", record.Data, err)
+	}
+	if _, err := DecodeRecord(raw); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("expected ErrDecryptionFailed without the key, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var (
+	// ErrBucketNotFound is returned by Healthcheck when the bucket does not
+	// exist.
+	ErrBucketNotFound = errors.New("bucket not found")
+	// ErrAccessDenied is returned by Healthcheck when the credentials may not
+	// access the bucket or list the log's prefix.
+	ErrAccessDenied = errors.New("access denied")
+	// ErrUnreachable is returned by Healthcheck when S3 could not be reached
+	// at all, or did not answer in time.
+	ErrUnreachable = errors.New("S3 unreachable")
+)
+
+// Healthcheck checks that the log's bucket exists and that its prefix can be
+// listed, with a HeadBucket and a List of at most one key, so a service can
+// fail fast at startup or from a readiness probe. It writes nothing, so it
+// cannot tell whether appends are allowed. Failures wrap ErrBucketNotFound,
+// ErrAccessDenied or ErrUnreachable where the cause is one of those.
+func (w *S3DAL) Healthcheck(ctx context.Context) error {
+	if _, err := w.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(w.bucketName),
+	}); err != nil {
+		return healthError(fmt.Sprintf("bucket %s", w.bucketName), err)
+	}
+	if _, err := w.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(w.bucketName),
+		Prefix:  aws.String(w.keyPrefix()),
+		MaxKeys: aws.Int32(1),
+	}); err != nil {
+		return healthError(fmt.Sprintf("prefix %s/ in bucket %s", w.prefix, w.bucketName), err)
+	}
+	return nil
+}
+
+// healthError classifies a failed request of Healthcheck against what. A
+// HeadBucket answers with a bare status, as a HEAD has no body, so statuses
+// are checked as well as codes.
+func healthError(what string, err error) error {
+	switch {
+	case hasErrorCode(err, "NoSuchBucket", "NotFound") || hasStatus(err, http.StatusNotFound):
+		return fmt.Errorf("%w: %s: %w", ErrBucketNotFound, what, err)
+	case isAccessDenied(err) || hasStatus(err, http.StatusForbidden):
+		return fmt.Errorf("%w: %s: %w", ErrAccessDenied, what, err)
+	case isUnreachable(err):
+		return fmt.Errorf("%w: %s: %w", ErrUnreachable, what, err)
+	}
+	return fmt.Errorf("failed health check of %s: %w", what, err)
+}
+
+// isUnreachable reports whether err is a failure to get any response from S3:
+// a network error, or a timeout.
+func isUnreachable(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,49 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+
+	"github.com/aws/smithy-go"
+)
+
+func TestHealthcheck(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	if err := wal.Healthcheck(ctx); err != nil {
+		t.Fatalf("expected a healthy log, got %v", err)
+	}
+	if fake.putCalls != 0 || fake.listCalls != 1 {
+		t.Errorf("expected one list and no puts, got %d lists and %d puts", fake.listCalls, fake.putCalls)
+	}
+
+	refused := &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}
+	for _, tc := range []struct {
+		name      string
+		bucketErr error
+		listErr   error
+		want      error
+	}{
+		{"missing bucket", statusError(http.StatusNotFound), nil, ErrBucketNotFound},
+		{"bucket forbidden", statusError(http.StatusForbidden), nil, ErrAccessDenied},
+		{"prefix forbidden", nil, &smithy.GenericAPIError{Code: "AccessDenied"}, ErrAccessDenied},
+		{"bucket gone before list", nil, &smithy.GenericAPIError{Code: "NoSuchBucket"}, ErrBucketNotFound},
+		{"network", refused, nil, ErrUnreachable},
+		{"timeout", nil, context.DeadlineExceeded, ErrUnreachable},
+	} {
+		fake.bucketErr, fake.listErr = tc.bucketErr, tc.listErr
+		if err := wal.Healthcheck(ctx); !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+	}
+
+	fake.bucketErr, fake.listErr = nil, &smithy.GenericAPIError{Code: "InvalidRequest"}
+	if err := wal.Healthcheck(ctx); err == nil || errors.Is(err, ErrAccessDenied) || errors.Is(err, ErrBucketNotFound) || errors.Is(err, ErrUnreachable) {
+		t.Errorf("expected an unclassified failure, got %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// An idempotency key is stored as a marker object under prefix/_idempotency/,
+// named by the SHA-256 of the key and holding, in decimal, the offset reserved
+// for it. The record written there carries the same hash in its metadata, so
+// a record at the reserved offset is known to be the key's own.
+const (
+	idempotencyDirName     = "_idempotency"
+	metaIdempotencyKeyHash = "dal-idempotency-key"
+)
+
+func (w *S3DAL) idempotencyMarkerKey(hash string) string {
+	return w.keyUnder(idempotencyDirName, hash)
+}
+
+// AppendIdempotent is Append for producers that retry: the first call with
+// idemKey appends data and returns its offset and true, and any later call
+// with the same key returns that offset and false without writing again.
+//
+// The key first reserves the next offset in a marker object, written with a
+// conditional put, and the record is then written there tagged with the key.
+// Concurrent calls sharing a key, from this client or others, all reserve the
+// same offset and race the conditional put of the record itself, which only
+// one wins; the others find the record tagged with their key and report it as
+// already written. A call that failed between the two puts is completed by the
+// retry. If another writer has taken the reserved offset meanwhile, the
+// reservation moves on to the next one.
+//
+// Markers are never deleted, so keys stay reserved for the life of the log,
+// and a key whose record has since been trimmed is still reported as written.
+// It is not supported with packing.
+func (w *S3DAL) AppendIdempotent(ctx context.Context, idemKey string, data []byte) (offset uint64, written bool, err error) {
+	if idemKey == "" {
+		return 0, false, errors.New("invalid idempotency key: key is empty")
+	}
+	if w.packRecords > 0 {
+		return 0, false, ErrPackedLog
+	}
+	start := time.Now()
+	defer func() {
+		if written || err != nil {
+			w.observer.RecordAppend(len(data), time.Since(start), err)
+		}
+	}()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.lifetime.Err() != nil {
+		return 0, false, ErrClosed
+	}
+
+	data, err = w.admitRecord(data, w.size, w.fileSizeLimit)
+	if err != nil {
+		return 0, false, err
+	}
+	payload, err := compressPayload(w.compression, data)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to prepare object body: failed to compress payload: %w", err)
+	}
+	stored := w.storedSize(len(payload))
+	if err := w.checkStoredSize(w.stored, stored); err != nil {
+		return 0, false, err
+	}
+	sum := sha256.Sum256([]byte(idemKey))
+	hash := hex.EncodeToString(sum[:])
+
+	for {
+		offset, etag, err := w.readIdempotencyMarker(ctx, hash)
+		if err != nil {
+			return 0, false, err
+		}
+		if etag == "" {
+			offset = w.length + 1
+			if won, err := w.putIdempotencyMarker(ctx, hash, offset, ""); err != nil || !won {
+				if err != nil {
+					return 0, false, err
+				}
+				continue
+			}
+		} else {
+			owned, taken, err := w.idempotentRecord(ctx, offset, hash)
+			if err != nil {
+				return 0, false, err
+			}
+			if owned {
+				w.setLength(max(w.length, offset))
+				return offset, false, nil
+			}
+			if !taken && offset <= w.length {
+				// written before this client's view of the tail, then trimmed
+				return offset, false, nil
+			}
+			if taken {
+				w.setLength(max(w.length, offset))
+				offset = w.length + 1
+				if won, err := w.putIdempotencyMarker(ctx, hash, offset, etag); err != nil || !won {
+					if err != nil {
+						return 0, false, err
+					}
+					continue
+				}
+			}
+		}
+
+		err = w.putIdempotentRecord(ctx, offset, payload, hash)
+		if errors.Is(err, ErrOffsetConflict) {
+			// whoever took the offset first, the next pass finds out
+			continue
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		w.setLength(max(w.length, offset))
+		w.size += uint64(len(data))
+		w.setStored(w.stored + stored)
+		w.recordInManifest(ctx, offset)
+		if w.afterAppend != nil {
+			if err := w.afterAppend(offset); err != nil {
+				return offset, true, fmt.Errorf("after-append hook failed for committed offset %d: %w", offset, err)
+			}
+		}
+		return offset, true, nil
+	}
+}
+
+// readIdempotencyMarker returns the offset reserved for the key hash and the
+// marker's ETag, or an empty ETag if the key has no marker.
+func (w *S3DAL) readIdempotencyMarker(ctx context.Context, hash string) (uint64, string, error) {
+	result, err := w.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(w.idempotencyMarkerKey(hash)),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return 0, "", nil
+		}
+		return 0, "", fmt.Errorf("failed to get idempotency marker from S3: %w", err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read idempotency marker: %w", err)
+	}
+	offset, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid idempotency marker %q: %w", data, err)
+	}
+	return offset, aws.ToString(result.ETag), nil
+}
+
+// putIdempotencyMarker reserves offset for the key hash, creating the marker
+// if etag is empty and replacing it only if it still has etag otherwise. It
+// reports false if another call changed the marker first.
+func (w *S3DAL) putIdempotencyMarker(ctx context.Context, hash string, offset uint64, etag string) (bool, error) {
+	if err := w.checkFence(ctx); err != nil {
+		return false, err
+	}
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(w.idempotencyMarkerKey(hash)),
+		Body:   bytes.NewReader([]byte(strconv.FormatUint(offset, 10))),
+	}
+	if etag == "" {
+		input.IfNoneMatch = aws.String("*")
+	} else {
+		input.IfMatch = aws.String(etag)
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.BucketKeyEnabled = w.sseParams()
+	if _, err := w.client.PutObject(ctx, input); err != nil {
+		if isPreconditionFailed(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to put idempotency marker to S3: %w", err)
+	}
+	return true, nil
+}
+
+// idempotentRecord reports whether the record at offset exists, as taken, and
+// whether it was written for the key hash, as owned.
+func (w *S3DAL) idempotentRecord(ctx context.Context, offset uint64, hash string) (owned, taken bool, err error) {
+	output, err := w.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(w.getObjectKey(offset)),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return false, false, nil
+		}
+		return false, false, fmt.Errorf("failed to head object in S3: %w", err)
+	}
+	return output.Metadata[metaIdempotencyKeyHash] == hash, true, nil
+}
+
+// putIdempotentRecord writes data as the record at offset, tagged with the key
+// hash, with a conditional put even under OverwriteAlways. The caller holds
+// mu.
+func (w *S3DAL) putIdempotentRecord(ctx context.Context, offset uint64, payload []byte, hash string) error {
+	if err := w.checkFence(ctx); err != nil {
+		return err
+	}
+	body, err := w.framePayload(offset, w.nextCreated(), payload, w.skipCRC)
+	if err != nil {
+		return err
+	}
+	input := w.putInput(offset, body)
+	// guarded whatever the overwrite policy, as the race handling relies on it
+	input.IfNoneMatch = aws.String("*")
+	metadata := map[string]string{metaIdempotencyKeyHash: hash}
+	for k, v := range input.Metadata {
+		metadata[k] = v
+	}
+	input.Metadata = metadata
+	if _, err := w.client.PutObject(ctx, input); err != nil {
+		return w.putRecordError(offset, err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"testing"
+)
+
+func TestAppendIdempotent(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	first, written, err := wal.AppendIdempotent(ctx, "request-1", []byte("once"))
+	if err != nil || !written {
+		t.Fatalf("expected the first call to write, got %d, %v, %v", first, written, err)
+	}
+	again, written, err := wal.AppendIdempotent(ctx, "request-1", []byte("once"))
+	if err != nil || written || again != first {
+		t.Fatalf("expected the retry to return offset %d unwritten, got %d, %v, %v", first, again, written, err)
+	}
+	if n, err := wal.Count(ctx); err != nil || n != 1 {
+		t.Fatalf("expected one record, got %d, %v", n, err)
+	}
+	if record, err := wal.Read(ctx, first); err != nil || string(record.Data) != "once" {
+		t.Errorf("expected the record to read back, got %q, %v", record.Data, err)
+	}
+
+	// an offset taken by a plain append moves the reservation on
+	sum := sha256.Sum256([]byte("request-2"))
+	marker := wal.idempotencyMarkerKey(hex.EncodeToString(sum[:]))
+	fake.objects[marker] = fakeObject{body: []byte("2"), etag: `"stale"`}
+	if offset, err := wal.Append(ctx, []byte("plain")); err != nil || offset != 2 {
+		t.Fatalf("failed to append: %d, %v", offset, err)
+	}
+	if offset, written, err := wal.AppendIdempotent(ctx, "request-2", []byte("moved")); err != nil || !written || offset != 3 {
+		t.Errorf("expected the key to move to offset 3, got %d, %v, %v", offset, written, err)
+	}
+
+	// a reservation whose record never landed is completed by the retry
+	sum = sha256.Sum256([]byte("request-3"))
+	fake.objects[wal.idempotencyMarkerKey(hex.EncodeToString(sum[:]))] = fakeObject{body: []byte("4"), etag: `"pending"`}
+	if offset, written, err := wal.AppendIdempotent(ctx, "request-3", []byte("completed")); err != nil || !written || offset != 4 {
+		t.Errorf("expected the retry to write offset 4, got %d, %v, %v", offset, written, err)
+	}
+
+	if _, _, err := wal.AppendIdempotent(ctx, "", []byte("x")); err == nil {
+		t.Error("expected an empty key to be rejected")
+	}
+}
+
+func TestAppendIdempotentConcurrent(t *testing.T) {
+	for _, policy := range []OverwritePolicy{OverwriteNever, OverwriteAlways} {
+		t.Run(policy.String(), func(t *testing.T) { testAppendIdempotentConcurrent(t, policy) })
+	}
+}
+
+func testAppendIdempotentConcurrent(t *testing.T, policy OverwritePolicy) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	const writers = 8
+	offsets := make([]uint64, writers)
+	written := make([]bool, writers)
+	var wg sync.WaitGroup
+	for i := range writers {
+		client, err := New(fake, wal.bucketName, wal.prefix, WithOverwritePolicy(policy))
+		if err != nil {
+			t.Fatalf("failed to create DAL: %v", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			offsets[i], written[i], err = client.AppendIdempotent(ctx, "shared", []byte("payload"))
+			if err != nil {
+				t.Errorf("writer %d: %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	wins := 0
+	for i := range writers {
+		if offsets[i] != offsets[0] {
+			t.Errorf("writer %d: expected offset %d, got %d", i, offsets[0], offsets[i])
+		}
+		if written[i] {
+			wins++
+		}
+	}
+	if wins != 1 {
+		t.Errorf("expected exactly one writer to write, got %d", wins)
+	}
+	if n, err := wal.Count(ctx); err != nil || n != 1 {
+		t.Errorf("expected one record, got %d, %v", n, err)
+	}
+	if record, err := wal.Read(ctx, offsets[0]); err != nil || !bytes.Equal(record.Data, []byte("payload")) {
+		t.Errorf("expected the record to read back, got %q, %v", record.Data, err)
+	}
+}
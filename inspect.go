@@ -0,0 +1,222 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var (
+	// ErrReadOnly is returned by an Inspector's client for any write, so an
+	// operation that would change the log fails rather than happening.
+	ErrReadOnly = errors.New("write attempted through a read-only client")
+	// ErrWriteOptions is returned by NewInspector for a DAL configured with
+	// options that only matter to writes.
+	ErrWriteOptions = errors.New("inspector requires a DAL without write options")
+)
+
+// readOnlyClient forwards reads to the wrapped client and refuses writes.
+type readOnlyClient struct {
+	s3API
+}
+
+func (readOnlyClient) PutObject(context.Context, *s3.PutObjectInput, ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return nil, ErrReadOnly
+}
+
+func (readOnlyClient) CreateMultipartUpload(context.Context, *s3.CreateMultipartUploadInput, ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return nil, ErrReadOnly
+}
+
+func (readOnlyClient) CopyObject(context.Context, *s3.CopyObjectInput, ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	return nil, ErrReadOnly
+}
+
+func (readOnlyClient) DeleteObjects(context.Context, *s3.DeleteObjectsInput, ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	return nil, ErrReadOnly
+}
+
+// Inspector bundles read-only diagnostics over a log. It never writes: its
+// client refuses PutObject, CopyObject, multipart uploads and DeleteObjects outright, and it does not share
+// the length of the DAL it was created from.
+type Inspector struct {
+	dal *S3DAL
+}
+
+// NewInspector returns an Inspector over the same log as dal. It rejects a
+// DAL configured with write-side options (append hooks, skipped CRCs, atomic
+// batches, an append buffer) with ErrWriteOptions.
+func NewInspector(dal *S3DAL) (*Inspector, error) {
+	if dal.beforeAppend != nil || dal.afterAppend != nil || dal.skipCRC || dal.atomicBatch || dal.async != nil {
+		return nil, ErrWriteOptions
+	}
+	// the client wrappers in the options wrap the read-only client instead
+	ro, err := New(readOnlyClient{unwrapClient(dal.client)}, dal.bucketName, dal.prefix, dal.opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Inspector{dal: ro}, nil
+}
+
+// LogStats summarises a log from its listing alone.
+type LogStats struct {
+	Count       uint64
+	FirstOffset uint64
+	LastOffset  uint64
+	// TotalBytes is the stored size, including headers and CRC trailers.
+	TotalBytes int64
+}
+
+// Gap is an inclusive range of missing offsets.
+type Gap struct {
+	From uint64
+	To   uint64
+}
+
+// RecordDump is the decoded framing of one stored object, reported even when
+// the record fails validation. Version is 0 for headerless records. Data is
+// the payload as stored, so it is still compressed unless Compression is
+// CompressionNone.
+type RecordDump struct {
+	Key          string
+	Size         int
+	Version      byte
+	StoredOffset uint64
+	Compression  Compression
+	Checksum     Checksum
+	// Encrypted is set if Data is sealed with WithClientEncryption.
+	Encrypted bool
+	// CreatedAt is the stored creation time, zero if the record has none.
+	CreatedAt time.Time
+	// StoredChecksum and ComputedChecksum are the record's trailer and what
+	// it should be; they differ for a corrupt record.
+	StoredChecksum   []byte
+	ComputedChecksum []byte
+	Data             []byte
+	Metadata         map[string]string
+}
+
+// FirstRecord returns the lowest-offset record of the log, as
+// S3DAL.FirstRecord does.
+func (i *Inspector) FirstRecord(ctx context.Context) (Record, error) {
+	record, err := i.dal.FirstRecord(ctx)
+	if err != nil {
+		return Record{}, fmt.Errorf("inspect first record: %w", err)
+	}
+	return record, nil
+}
+
+// LastRecord returns the highest-offset record of the log, as
+// S3DAL.LastRecord does.
+func (i *Inspector) LastRecord(ctx context.Context) (Record, error) {
+	record, err := i.dal.LastRecord(ctx)
+	if err != nil {
+		return Record{}, fmt.Errorf("inspect last record: %w", err)
+	}
+	return record, nil
+}
+
+// Stats counts the records of the log and the bytes they take, and finds its
+// first and last offsets. It lists the log once; no bodies are read. An empty
+// log fails with ErrEmptyLog.
+func (i *Inspector) Stats(ctx context.Context) (LogStats, error) {
+	objects, err := i.dal.listAllRecords(ctx)
+	if err != nil {
+		return LogStats{}, fmt.Errorf("inspect stats: %w", err)
+	}
+	if len(objects) == 0 {
+		return LogStats{}, fmt.Errorf("inspect stats: %w", ErrEmptyLog)
+	}
+
+	var stats LogStats
+	for n, r := range objects {
+		if n == 0 {
+			stats.FirstOffset = r.offset
+		}
+		stats.LastOffset = r.offset
+		stats.Count++
+		stats.TotalBytes += aws.ToInt64(r.obj.Size)
+	}
+	return stats, nil
+}
+
+// VerifyAll reads and validates every record, returning the offsets that
+// failed. An empty result means the log is healthy. See S3DAL.VerifyAll.
+func (i *Inspector) VerifyAll(ctx context.Context) ([]uint64, error) {
+	bad, err := i.dal.VerifyAll(ctx, 0)
+	if err != nil {
+		return bad, fmt.Errorf("inspect verify: %w", err)
+	}
+	return bad, nil
+}
+
+// FindGaps returns the ranges of offsets missing between the first and last
+// records, in ascending order, from a listing of the log. It is empty for a
+// log without holes.
+func (i *Inspector) FindGaps(ctx context.Context) ([]Gap, error) {
+	offsets, err := i.offsets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("inspect gaps: %w", err)
+	}
+
+	var gaps []Gap
+	for n := 1; n < len(offsets); n++ {
+		if offsets[n] > offsets[n-1]+1 {
+			gaps = append(gaps, Gap{From: offsets[n-1] + 1, To: offsets[n] - 1})
+		}
+	}
+	return gaps, nil
+}
+
+// DumpRecord returns the raw framing of the object at offset without
+// rejecting it on a CRC or offset mismatch, for looking into a damaged
+// record. A body too short or malformed to frame is returned with what was
+// read, its key, size and metadata, and the parse error.
+func (i *Inspector) DumpRecord(ctx context.Context, offset uint64) (RecordDump, error) {
+	key := i.dal.getObjectKey(offset)
+	result, err := i.dal.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(i.dal.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return RecordDump{}, fmt.Errorf("inspect dump %s: %w", key, getRecordError(offset, err))
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return RecordDump{}, fmt.Errorf("inspect dump %s: failed to read object body: %w", key, err)
+	}
+	dump := RecordDump{Key: key, Size: len(data), Metadata: result.Metadata}
+	f, err := parseFrame(data, true)
+	if err != nil {
+		return dump, fmt.Errorf("inspect dump %s: %w", key, err)
+	}
+	dump.Version = f.version
+	dump.StoredOffset = f.offset
+	dump.Compression = f.codec
+	dump.Checksum = f.checksum
+	dump.Encrypted = f.sealed
+	dump.CreatedAt = createdAt(f.created)
+	dump.StoredChecksum = data[len(data)-f.checksum.Size():]
+	dump.ComputedChecksum = f.checksum.Sum(data[:len(data)-f.checksum.Size()])
+	dump.Data = f.data
+	return dump, nil
+}
+
+func (i *Inspector) offsets(ctx context.Context) ([]uint64, error) {
+	records, err := i.dal.listAllRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	offsets := make([]uint64, 0, len(records))
+	for _, r := range records {
+		offsets = append(offsets, r.offset)
+	}
+	return offsets, nil
+}
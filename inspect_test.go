@@ -0,0 +1,92 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestInspectorNeverWrites(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 6; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	// punch a gap at 3 and corrupt 5
+	delete(fake.objects, wal.getObjectKey(3))
+	corrupt := fake.objects[wal.getObjectKey(5)]
+	corrupt.body[len(corrupt.body)-3] ^= 0xFF
+
+	inspector, err := NewInspector(wal)
+	if err != nil {
+		t.Fatalf("failed to create inspector: %v", err)
+	}
+	putsBefore := fake.putCalls
+
+	stats, err := inspector.Stats(ctx)
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if stats.Count != 5 || stats.FirstOffset != 1 || stats.LastOffset != 6 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	bad, err := inspector.VerifyAll(ctx)
+	if err != nil {
+		t.Fatalf("failed to verify: %v", err)
+	}
+	if !slices.Equal(bad, []uint64{5}) {
+		t.Errorf("expected offset 5 to fail verification, got %v", bad)
+	}
+
+	gaps, err := inspector.FindGaps(ctx)
+	if err != nil {
+		t.Fatalf("failed to find gaps: %v", err)
+	}
+	if !slices.Equal(gaps, []Gap{{From: 3, To: 3}}) {
+		t.Errorf("expected gap at 3, got %v", gaps)
+	}
+
+	dump, err := inspector.DumpRecord(ctx, 5)
+	if err != nil {
+		t.Fatalf("failed to dump record: %v", err)
+	}
+	if dump.StoredOffset != 5 || bytes.Equal(dump.StoredChecksum, dump.ComputedChecksum) {
+		t.Errorf("expected dump to expose the CRC mismatch, got %+v", dump)
+	}
+
+	if _, err := inspector.FirstRecord(ctx); err != nil {
+		t.Fatalf("failed to get first record: %v", err)
+	}
+	if _, err := inspector.LastRecord(ctx); err != nil {
+		t.Fatalf("failed to get last record: %v", err)
+	}
+
+	if fake.putCalls != putsBefore {
+		t.Errorf("inspector issued %d PutObject calls", fake.putCalls-putsBefore)
+	}
+	if inspector.dal.client.(readOnlyClient).s3API != fake {
+		t.Error("expected inspector to wrap the DAL's client")
+	}
+	if _, err := inspector.dal.Append(ctx, []byte("nope")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly from a write through the inspector, got %v", err)
+	}
+}
+
+func TestInspectorRejectsWriteOptions(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"WithSkipCRCOnWrite": WithSkipCRCOnWrite(),
+		"WithAppendBuffer":   WithAppendBuffer(4, 2, nil),
+	} {
+		wal, _ := newFakeDAL(t, opt)
+		defer wal.Close()
+		if _, err := NewInspector(wal); !errors.Is(err, ErrWriteOptions) {
+			t.Errorf("%s: expected ErrWriteOptions, got %v", name, err)
+		}
+	}
+}
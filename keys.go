@@ -0,0 +1,187 @@
+package s3_dal
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const defaultKeyWidth = 20 // digits in math.MaxUint64
+
+// defaultKeyDelimiter separates the parts of keys unless WithKeyDelimiter
+// says otherwise.
+const defaultKeyDelimiter = "/"
+
+var (
+	defaultEncodeOffset = paddedEncodeOffset(defaultKeyWidth)
+	defaultDecodeOffset = paddedDecodeOffset(defaultKeyWidth)
+)
+
+// paddedEncodeOffset zero-pads offsets to width decimal digits.
+func paddedEncodeOffset(width int) func(uint64) string {
+	return func(offset uint64) string {
+		return fmt.Sprintf("%0*d", width, offset)
+	}
+}
+
+// paddedDecodeOffset parses keys produced by paddedEncodeOffset(width). Keys
+// of other lengths, with anything but digits, or above math.MaxUint64, which
+// a width over 20 can hold, are rejected by name rather than with
+// strconv's error.
+func paddedDecodeOffset(width int) func(string) (uint64, error) {
+	return func(s string) (uint64, error) {
+		if len(s) != width {
+			return 0, fmt.Errorf("invalid offset key %q: expected %d digits", s, width)
+		}
+		if i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+			return 0, fmt.Errorf("invalid offset key %q: non-digit at position %d", s, i)
+		}
+		offset, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid offset key %q: overflows uint64", s)
+		}
+		return offset, nil
+	}
+}
+
+// keyCodecProbes are the offsets a key codec is checked against: both ends of
+// the range and the digit-count boundaries where naive encodings misorder.
+var keyCodecProbes = func() []uint64 {
+	probes := []uint64{0, 1, math.MaxUint32, math.MaxUint32 + 1, math.MaxUint64 - 1, math.MaxUint64}
+	for p := uint64(10); p <= math.MaxUint64/10; p *= 10 {
+		probes = append(probes, p-1, p, p+1)
+	}
+	slices.Sort(probes)
+	return slices.Compact(probes)
+}()
+
+// validateKeyCodec checks that encode/decode round-trip, that encoded keys
+// sort lexically in the same order as their offsets, and that they cannot be
+// confused with control objects. New checks them against the delimiter.
+func validateKeyCodec(encode func(uint64) string, decode func(string) (uint64, error)) error {
+	prev := ""
+	for i, offset := range keyCodecProbes {
+		key := encode(offset)
+		if key == "" || strings.HasPrefix(key, "_") {
+			return fmt.Errorf("invalid key codec: offset %d encodes to unusable key %q", offset, key)
+		}
+		decoded, err := decode(key)
+		if err != nil {
+			return fmt.Errorf("invalid key codec: cannot decode %q: %w", key, err)
+		}
+		if decoded != offset {
+			return fmt.Errorf("invalid key codec: %d round-trips to %d", offset, decoded)
+		}
+		if i > 0 && key <= prev {
+			return fmt.Errorf("invalid key codec: %q for offset %d does not sort after %q", key, offset, prev)
+		}
+		prev = key
+	}
+	return nil
+}
+
+// keyPrefix is what every key of the log starts with: the prefix and the
+// delimiter.
+func (w *S3DAL) keyPrefix() string {
+	return w.prefix + w.delimiter
+}
+
+// keyUnder returns the key of the object named by parts under the prefix,
+// joined by the delimiter.
+func (w *S3DAL) keyUnder(parts ...string) string {
+	return w.keyPrefix() + strings.Join(parts, w.delimiter)
+}
+
+// normalizePrefix strips trailing delimiters from prefix, so "logs/" and
+// "logs" name the same log, and rejects a prefix left empty.
+func normalizePrefix(prefix, delimiter string) (string, error) {
+	trimmed := prefix
+	for strings.HasSuffix(trimmed, delimiter) {
+		trimmed = strings.TrimSuffix(trimmed, delimiter)
+	}
+	if trimmed == "" {
+		return "", fmt.Errorf("invalid prefix %q: must not be empty", prefix)
+	}
+	return trimmed, nil
+}
+
+// validateKeys checks that record keys round-trip through getObjectKey and
+// getOffsetFromKey with the configured codec, delimiter and shards, and that
+// no encoded offset holds the delimiter.
+func (w *S3DAL) validateKeys() error {
+	for _, offset := range keyCodecProbes {
+		if name := w.encodeOffset(offset); strings.Contains(name, w.delimiter) {
+			return fmt.Errorf("invalid key scheme: offset %d encodes to %q, which holds the delimiter %q", offset, name, w.delimiter)
+		}
+		key := w.getObjectKey(offset)
+		got, err := w.getOffsetFromKey(key)
+		if err != nil {
+			return fmt.Errorf("invalid key scheme: cannot parse key %q: %w", key, err)
+		}
+		if got != offset {
+			return fmt.Errorf("invalid key scheme: offset %d round-trips through key %q to %d", offset, key, got)
+		}
+	}
+	return nil
+}
+
+// maxKeyVersion bounds WithKeyVersion, since every read miss and listing
+// visits each version.
+const maxKeyVersion = 99
+
+// versionName is the sub-prefix of key version version, above 1.
+func versionName(version int) string {
+	return "v" + strconv.Itoa(version)
+}
+
+// isVersionName reports whether name is the sub-prefix of a key version from
+// 2 up to the current one.
+func (w *S3DAL) isVersionName(name string) bool {
+	digits, ok := strings.CutPrefix(name, "v")
+	if !ok || w.keyVersion < 2 {
+		return false
+	}
+	version, err := strconv.Atoi(digits)
+	return err == nil && versionName(version) == name && version >= 2 && version <= w.keyVersion
+}
+
+// keyVersions returns the key versions records may be under, newest first.
+func (w *S3DAL) keyVersions() []int {
+	var versions []int
+	for v := w.keyVersion; v > 1; v-- {
+		versions = append(versions, v)
+	}
+	return append(versions, 1)
+}
+
+// objectKeys returns the keys the record at offset may be stored under, that
+// of the current key version first.
+func (w *S3DAL) objectKeys(offset uint64) []string {
+	versions := w.keyVersions()
+	keys := make([]string, len(versions))
+	for i, version := range versions {
+		keys[i] = w.recordPrefix(version, w.shardOf(offset)) + w.encodeOffset(offset)
+	}
+	return keys
+}
+
+// getOlderVersion gets the record at offset from the first older key version
+// holding it, with input as for the current one.
+func (w *S3DAL) getOlderVersion(ctx context.Context, offset uint64, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	var err error
+	for _, key := range w.objectKeys(offset)[1:] {
+		older := *input
+		older.Key = aws.String(key)
+		var result *s3.GetObjectOutput
+		if result, err = w.client.GetObject(ctx, &older); !isNotFound(err) {
+			return result, err
+		}
+	}
+	return nil, err
+}
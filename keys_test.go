@@ -0,0 +1,261 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func hexEncode(offset uint64) string { return fmt.Sprintf("%016x", offset) }
+
+func hexDecode(s string) (uint64, error) {
+	if len(s) != 16 {
+		return 0, fmt.Errorf("invalid hex offset %q", s)
+	}
+	return strconv.ParseUint(s, 16, 64)
+}
+
+func TestDefaultKeyCodecValid(t *testing.T) {
+	if err := validateKeyCodec(defaultEncodeOffset, defaultDecodeOffset); err != nil {
+		t.Fatalf("default key codec failed validation: %v", err)
+	}
+}
+
+func TestCustomKeyCodec(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithKeyCodec(hexEncode, hexDecode))
+	ctx := context.Background()
+
+	for _, offset := range []uint64{0, 1, 15, 16, 255, 256, math.MaxUint64} {
+		got, err := wal.getOffsetFromKey(wal.getObjectKey(offset))
+		if err != nil || got != offset {
+			t.Errorf("offset %d round-tripped to %d (%v)", offset, got, err)
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	if _, ok := fake.objects["fake-prefix/0000000000000010"]; !ok {
+		t.Error("expected offset 16 to be stored under its hex key")
+	}
+
+	keys := make([]string, 0, len(fake.objects))
+	for key := range fake.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		offset, err := wal.getOffsetFromKey(key)
+		if err != nil || offset != uint64(i+1) {
+			t.Errorf("key %q at position %d decoded to %d (%v)", key, i, offset, err)
+		}
+	}
+
+	last, err := wal.LastRecord(ctx)
+	if err != nil {
+		t.Fatalf("failed to get last record: %v", err)
+	}
+	if last.Offset != 20 {
+		t.Errorf("expected last offset 20, got %d", last.Offset)
+	}
+}
+
+func TestKeyCodecRejected(t *testing.T) {
+	unpadded := func(offset uint64) string { return strconv.FormatUint(offset, 10) }
+	decode := func(s string) (uint64, error) { return strconv.ParseUint(s, 10, 64) }
+	if _, err := New(newFakeS3(), "fake-bucket", "fake-prefix", WithKeyCodec(unpadded, decode)); err == nil {
+		t.Error("expected an unpadded codec to be rejected for misordering")
+	}
+
+	lossy := func(offset uint64) string { return fmt.Sprintf("%020d", offset/2) }
+	if _, err := New(newFakeS3(), "fake-bucket", "fake-prefix", WithKeyCodec(lossy, defaultDecodeOffset)); err == nil {
+		t.Error("expected a codec that does not round-trip to be rejected")
+	}
+}
+
+func TestKeyWidth(t *testing.T) {
+	for _, width := range []int{defaultKeyWidth, 24} {
+		wal, _ := newFakeDAL(t, WithKeyWidth(width))
+		for _, offset := range []uint64{0, 1, 9, 10, math.MaxUint64} {
+			key := wal.getObjectKey(offset)
+			suffix := key[len("fake-prefix/"):]
+			if want := fmt.Sprintf("%0*d", width, offset); suffix != want {
+				t.Errorf("width %d: expected offset %d under %q, got %q", width, offset, want, suffix)
+			}
+			if got, err := wal.getOffsetFromKey(key); err != nil || got != offset {
+				t.Errorf("width %d: offset %d round-tripped to %d (%v)", width, offset, got, err)
+			}
+		}
+		if wal.getObjectKey(9) >= wal.getObjectKey(10) {
+			t.Errorf("width %d: expected offset 10 to sort after 9", width)
+		}
+	}
+	if _, err := New(newFakeS3(), "fake-bucket", "fake-prefix", WithKeyWidth(defaultKeyWidth-1)); err == nil {
+		t.Error("expected a width too narrow for uint64 to be rejected")
+	}
+}
+
+func TestMalformedKeys(t *testing.T) {
+	wal, _ := newFakeDAL(t, WithKeyWidth(24))
+	for _, key := range []string{
+		"fake-prefix/00000000000000000000001x",
+		"fake-prefix/+00000000000000000000001",
+		"fake-prefix/000000000000000000001",
+		"fake-prefix/999999999999999999999999",
+		"other-prefix/000000000000000000000001",
+		"short",
+	} {
+		if _, err := wal.getOffsetFromKey(key); err == nil {
+			t.Errorf("expected key %q to be rejected", key)
+		}
+	}
+	if _, err := wal.getOffsetFromKey("fake-prefix/999999999999999999999999"); err == nil || !strings.Contains(err.Error(), "overflows") {
+		t.Errorf("expected an overflow error, got %v", err)
+	}
+}
+
+func TestPrefixNormalized(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeS3()
+	wal, err := New(fake, "fake-bucket", "logs/app//")
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	offset, err := wal.Append(ctx, []byte("under one slash"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if _, ok := fake.objects["logs/app/00000000000000000001"]; !ok {
+		t.Fatalf("expected the record at logs/app/00000000000000000001, got keys %v", slices.Collect(maps.Keys(fake.objects)))
+	}
+	other, err := OpenS3DAL(ctx, fake, "fake-bucket", "logs/app")
+	if err != nil || other.Length() != offset {
+		t.Fatalf("expected the same log without the trailing slash, got length %d, %v", other.Length(), err)
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, w := range []*S3DAL{wal, mustNew(t, fake, "logs|app|", WithKeyDelimiter("|"), WithShards(4))} {
+		for i := 0; i < 1000; i++ {
+			n := rng.Uint64()
+			if got, err := w.getOffsetFromKey(w.getObjectKey(n)); err != nil || got != n {
+				t.Fatalf("offset %d round-tripped through %q to %d (%v)", n, w.getObjectKey(n), got, err)
+			}
+		}
+	}
+	if key := mustNew(t, fake, "logs|app|", WithKeyDelimiter("|")).getObjectKey(1); key != "logs|app|00000000000000000001" {
+		t.Errorf("expected the custom delimiter in keys, got %q", key)
+	}
+
+	for _, prefix := range []string{"", "/", "///"} {
+		if _, err := New(fake, "fake-bucket", prefix); err == nil {
+			t.Errorf("expected prefix %q to be rejected", prefix)
+		}
+	}
+
+	// S3DALClient still takes an empty prefix, keeping keys under the bare
+	// delimiter
+	bare := S3DALClient(fake, "fake-bucket", "")
+	if _, err := bare.Append(ctx, []byte("no prefix")); err != nil {
+		t.Fatalf("failed to append without a prefix: %v", err)
+	}
+	if _, ok := fake.objects["/00000000000000000001"]; !ok {
+		t.Errorf("expected the record at /00000000000000000001, got keys %v", slices.Collect(maps.Keys(fake.objects)))
+	}
+	if record, err := bare.Read(ctx, 1); err != nil || string(record.Data) != "no prefix" {
+		t.Errorf("expected to read it back, got %q, %v", record.Data, err)
+	}
+	if _, err := New(fake, "fake-bucket", "logs", WithKeyDelimiter("-"), WithKeyCodec(func(o uint64) string {
+		return fmt.Sprintf("%010d-%010d", o>>32, o&math.MaxUint32)
+	}, func(s string) (uint64, error) {
+		var hi, lo uint64
+		_, err := fmt.Sscanf(s, "%010d-%010d", &hi, &lo)
+		return hi<<32 | lo, err
+	})); err == nil {
+		t.Error("expected a codec whose keys hold the delimiter to be rejected")
+	}
+	for _, delimiter := range []string{"", "x", "_"} {
+		if _, err := New(fake, "fake-bucket", "logs", WithKeyDelimiter(delimiter)); err == nil {
+			t.Errorf("expected delimiter %q to be rejected", delimiter)
+		}
+	}
+}
+
+func mustNew(t *testing.T, client s3API, prefix string, opts ...Option) *S3DAL {
+	t.Helper()
+	w, err := New(client, "fake-bucket", prefix, opts...)
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	return w
+}
+
+func TestKeyVersion(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeS3()
+	v1, err := New(fake, "fake-bucket", "logs")
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	for _, data := range []string{"v1 first", "v1 second"} {
+		if _, err := v1.Append(ctx, []byte(data)); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+
+	// the writer restarts under v2 with a new format and resumes at the tail
+	v2, err := OpenS3DAL(ctx, fake, "fake-bucket", "logs", WithKeyVersion(2), WithChecksum(ChecksumCRC32C), WithTimestamps())
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	offset, err := v2.Append(ctx, []byte("v2 third"))
+	if err != nil || offset != 3 {
+		t.Fatalf("expected the v2 append at offset 3, got %d, %v", offset, err)
+	}
+	if _, ok := fake.objects["logs/v2/00000000000000000003"]; !ok {
+		t.Fatalf("expected the record under logs/v2/, got keys %v", slices.Sorted(maps.Keys(fake.objects)))
+	}
+
+	var got []string
+	it, err := v2.Scan(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to scan: %v", err)
+	}
+	for it.Next() {
+		got = append(got, string(it.Record().Data))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	it.Close()
+	if want := []string{"v1 first", "v1 second", "v2 third"}; !slices.Equal(got, want) {
+		t.Errorf("expected %q across versions, got %q", want, got)
+	}
+	if found, err := v2.Exists(ctx, 1); err != nil || !found {
+		t.Errorf("expected offset 1 to exist under v1, got %v, %v", found, err)
+	}
+	if last, err := v2.LastRecord(ctx); err != nil || last.Offset != 3 {
+		t.Errorf("expected the tail at 3, got %d, %v", last.Offset, err)
+	}
+
+	// trims reach the older version too
+	if deleted, err := v2.TrimBefore(ctx, 3); err != nil || deleted != 2 {
+		t.Errorf("expected both v1 records trimmed, got %d, %v", deleted, err)
+	}
+	if _, err := v2.Read(ctx, 1); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected offset 1 trimmed, got %v", err)
+	}
+
+	if _, err := New(fake, "fake-bucket", "logs", WithKeyVersion(0)); err == nil {
+		t.Error("expected key version 0 to be rejected")
+	}
+}
@@ -0,0 +1,154 @@
+package s3_dal
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// maxListPageSize is the most keys S3 returns per ListObjectsV2 call.
+	maxListPageSize = 1000
+	// listSpanPages is how many pages of offsets each span of a parallel
+	// listing covers.
+	listSpanPages = 4
+)
+
+// WithMaxListPageSize caps the keys each ListObjectsV2 call returns at n, at
+// most S3's own cap of 1000, for listings that do not pick a page size of
+// their own. Smaller pages mean more calls but less work lost to a cancelled
+// or failed listing.
+func WithMaxListPageSize(n int) Option {
+	return func(w *S3DAL) error {
+		if n <= 0 || n > maxListPageSize {
+			return fmt.Errorf("invalid list page size %d: must be between 1 and %d", n, maxListPageSize)
+		}
+		w.listPageSize = int32(n)
+		return nil
+	}
+}
+
+// WithParallelListing lists up to n spans of the key space at once in the
+// operations that enumerate the whole log, such as Count, Stat, Scan and the
+// last resort of LastRecord, rather than one page after another. Offsets are
+// numeric and mostly contiguous, so the offsets from the first record on are
+// split into spans of a few pages each, listed concurrently and handed on in
+// order. Listing stops at the first span with no record after it, so a
+// listing costs up to n list calls more than a serial one. A span's listing
+// also finds the first record after it, and later spans start from there, so
+// a large hole in the log costs up to n calls rather than one per span it
+// covers.
+func WithParallelListing(n int) Option {
+	return func(w *S3DAL) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid list parallelism %d: must be positive", n)
+		}
+		w.listParallelism = n
+		return nil
+	}
+}
+
+// listedSpan is the records a parallel listing found in one span, and the
+// first record beyond it, if any.
+type listedSpan struct {
+	records []listedRecord
+	beyond  bool
+	next    uint64
+	err     error
+}
+
+// listAll is listRecords for a full enumeration, listing spans concurrently
+// under WithParallelListing.
+func (w *S3DAL) listAll(ctx context.Context, after uint64, fn func(offset uint64, obj types.Object) (bool, error)) error {
+	if w.listParallelism <= 1 {
+		return w.listRecords(ctx, after, 0, fn)
+	}
+	var first uint64
+	found := false
+	err := w.listRecords(ctx, after, 2, func(offset uint64, _ types.Object) (bool, error) {
+		first, found = offset, true
+		return false, nil
+	})
+	if err != nil || !found {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	spans := make(chan chan listedSpan, w.listParallelism-1)
+	go w.listSpans(ctx, first-1, spans)
+	for res := range spans {
+		span := <-res
+		if span.err != nil {
+			return span.err
+		}
+		for _, r := range span.records {
+			if more, err := fn(r.offset, r.obj); err != nil || !more {
+				return err
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// listSpans lists consecutive spans of offsets after from, each in its own
+// goroutine, queueing their results in order until a span has nothing beyond
+// it. Offsets between a span and the first record beyond it are known to be
+// empty, so the next span not yet started skips them.
+func (w *S3DAL) listSpans(ctx context.Context, from uint64, spans chan<- chan listedSpan) {
+	defer close(spans)
+	size := uint64(maxListPageSize)
+	if w.listPageSize > 0 {
+		size = uint64(w.listPageSize)
+	}
+	size *= listSpanPages
+
+	var done atomic.Bool
+	// skip is the highest offset below which no unlisted record is left
+	var skip atomic.Uint64
+	for lo := from; !done.Load(); lo += size {
+		lo = max(lo, skip.Load())
+		hi := lo + size
+		if hi < lo {
+			hi = math.MaxUint64
+		}
+		res := make(chan listedSpan, 1)
+		select {
+		case spans <- res:
+		case <-ctx.Done():
+			return
+		}
+		go func() {
+			span := w.listSpan(ctx, lo, hi)
+			if !span.beyond || span.err != nil {
+				done.Store(true)
+			}
+			for span.beyond {
+				if prev := skip.Load(); prev >= span.next-1 || skip.CompareAndSwap(prev, span.next-1) {
+					break
+				}
+			}
+			res <- span
+		}()
+		if hi == math.MaxUint64 {
+			return
+		}
+	}
+}
+
+// listSpan lists the records with offsets above lo and up to hi.
+func (w *S3DAL) listSpan(ctx context.Context, lo, hi uint64) listedSpan {
+	var span listedSpan
+	span.err = w.listRecords(ctx, lo, 0, func(offset uint64, obj types.Object) (bool, error) {
+		if offset > hi {
+			span.beyond, span.next = true, offset
+			return false, nil
+		}
+		span.records = append(span.records, listedRecord{offset: offset, obj: obj})
+		return true, nil
+	})
+	return span
+}
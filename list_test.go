@@ -0,0 +1,176 @@
+package s3_dal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// slowListS3 delays each list call, as a round trip to S3 would, and records
+// how many are in flight at once.
+type slowListS3 struct {
+	*fakeS3
+	delay time.Duration
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (s *slowListS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	s.mu.Lock()
+	s.inFlight++
+	s.maxInFlight = max(s.maxInFlight, s.inFlight)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+	time.Sleep(s.delay)
+	return s.fakeS3.ListObjectsV2(ctx, params, optFns...)
+}
+
+// fillFake writes records 1 to n straight into fake, skipping those in holes.
+func fillFake(t testing.TB, wal *S3DAL, fake *fakeS3, n uint64, holes func(uint64) bool) []uint64 {
+	t.Helper()
+	var offsets []uint64
+	for offset := uint64(1); offset <= n; offset++ {
+		if holes != nil && holes(offset) {
+			continue
+		}
+		body, err := wal.encodeBody(offset, 0, []byte(fmt.Sprint(offset)), false)
+		if err != nil {
+			t.Fatalf("failed to encode offset %d: %v", offset, err)
+		}
+		fake.objects[wal.getObjectKey(offset)] = fakeObject{body: body, etag: fmt.Sprintf(`"%d"`, offset)}
+		offsets = append(offsets, offset)
+	}
+	return offsets
+}
+
+func TestParallelListing(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeS3()
+	wal, err := New(fake, "fake-bucket", "fake-prefix", WithMaxListPageSize(10), WithParallelListing(4))
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	// a trimmed head, a hole wider than a span and a sparse stretch
+	want := fillFake(t, wal, fake, 500, func(offset uint64) bool {
+		return offset < 30 || (offset > 100 && offset <= 250) || (offset > 400 && offset%7 != 0)
+	})
+
+	var got []uint64
+	objects, err := wal.listObjects(ctx)
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	for _, obj := range objects {
+		offset, err := wal.getOffsetFromKey(aws.ToString(obj.Key))
+		if err != nil {
+			t.Fatalf("failed to parse key: %v", err)
+		}
+		got = append(got, offset)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected every record in order, got %v", got)
+	}
+	if count, err := wal.Count(ctx); err != nil || count != uint64(len(want)) {
+		t.Errorf("expected a count of %d, got %d, %v", len(want), count, err)
+	}
+	first, last, count, err := wal.Stat(ctx)
+	if err != nil || first != want[0] || last != want[len(want)-1] || count != uint64(len(want)) {
+		t.Errorf("expected stat %d..%d of %d, got %d..%d of %d, %v", want[0], want[len(want)-1], len(want), first, last, count, err)
+	}
+
+	it, err := wal.Scan(ctx, 300)
+	if err != nil {
+		t.Fatalf("failed to scan: %v", err)
+	}
+	defer it.Close()
+	got = got[:0]
+	for it.Next() {
+		got = append(got, it.Record().Offset)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("failed to scan: %v", err)
+	}
+	if from := slices.Index(want, 300); !slices.Equal(got, want[from:]) {
+		t.Errorf("expected the scan from 300 in order, got %v", got)
+	}
+
+	for _, opt := range []Option{WithMaxListPageSize(0), WithMaxListPageSize(1001), WithParallelListing(0)} {
+		if _, err := New(newFakeS3(), "fake-bucket", "fake-prefix", opt); err == nil {
+			t.Error("expected the option to be rejected")
+		}
+	}
+}
+
+func TestParallelListingIsConcurrent(t *testing.T) {
+	ctx := context.Background()
+	count := func(opts ...Option) (time.Duration, int) {
+		slow := &slowListS3{fakeS3: newFakeS3(), delay: 5 * time.Millisecond}
+		wal, err := New(slow, "fake-bucket", "fake-prefix", append(opts, WithMaxListPageSize(10))...)
+		if err != nil {
+			t.Fatalf("failed to create DAL: %v", err)
+		}
+		fillFake(t, wal, slow.fakeS3, 400, nil)
+		start := time.Now()
+		if n, err := wal.Count(ctx); err != nil || n != 400 {
+			t.Fatalf("expected a count of 400, got %d, %v", n, err)
+		}
+		return time.Since(start), slow.maxInFlight
+	}
+
+	// 40 pages one after another, against 10 spans of 4 pages 8 at a time
+	serial, serialInFlight := count()
+	parallel, parallelInFlight := count(WithParallelListing(8))
+	if serialInFlight != 1 || parallelInFlight < 2 {
+		t.Errorf("expected serial calls alone and parallel ones together, got %d and %d in flight", serialInFlight, parallelInFlight)
+	}
+	if parallel >= serial/2 {
+		t.Errorf("expected the parallel count well under the serial %v, took %v", serial, parallel)
+	}
+}
+
+func TestParallelListingSkipsHoles(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeS3()
+	wal, err := New(fake, "fake-bucket", "fake-prefix", WithMaxListPageSize(10), WithParallelListing(4))
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	// spans are 40 offsets wide, so the hole covers 25,000 of them
+	want := fillFake(t, wal, fake, 20, nil)
+	for offset := uint64(1_000_001); offset <= 1_000_020; offset++ {
+		body, err := wal.encodeBody(offset, 0, []byte(fmt.Sprint(offset)), false)
+		if err != nil {
+			t.Fatalf("failed to encode offset %d: %v", offset, err)
+		}
+		fake.objects[wal.getObjectKey(offset)] = fakeObject{body: body}
+		want = append(want, offset)
+	}
+
+	var got []uint64
+	err = wal.listAll(ctx, 0, func(offset uint64, _ types.Object) (bool, error) {
+		got = append(got, offset)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected every record in order, got %v", got)
+	}
+	if fake.listCalls > 30 {
+		t.Errorf("expected the hole skipped in a few calls, took %d", fake.listCalls)
+	}
+}
@@ -0,0 +1,167 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const manifestName = "_manifest"
+
+// manifestRetries bounds how often an update is retried after losing a race
+// with another writer.
+const manifestRetries = 5
+
+// manifest summarises the records under a prefix, so the tail and count can be
+// read without listing. A zero manifest is an empty log.
+type manifest struct {
+	First uint64 `json:"first"`
+	Last  uint64 `json:"last"`
+	Count uint64 `json:"count"`
+}
+
+// add accounts for a newly written record at offset.
+func (m *manifest) add(offset uint64) {
+	if m.Count == 0 || offset < m.First {
+		m.First = offset
+	}
+	m.Last = max(m.Last, offset)
+	m.Count++
+}
+
+func (w *S3DAL) manifestKey() string {
+	return w.keyUnder(manifestName)
+}
+
+// readManifest returns the manifest and its ETag, or an empty ETag if there is
+// none.
+func (w *S3DAL) readManifest(ctx context.Context) (manifest, string, error) {
+	result, err := w.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(w.manifestKey()),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return manifest{}, "", nil
+		}
+		return manifest{}, "", fmt.Errorf("failed to get manifest from S3: %w", err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return manifest{}, "", fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return manifest{}, "", fmt.Errorf("invalid manifest: %w", err)
+	}
+	return m, aws.ToString(result.ETag), nil
+}
+
+// listManifest builds a manifest from a full listing of the prefix.
+func (w *S3DAL) listManifest(ctx context.Context) (manifest, error) {
+	records, err := w.listAllRecords(ctx)
+	if err != nil {
+		return manifest{}, err
+	}
+	var m manifest
+	for _, r := range records {
+		m.add(r.offset)
+	}
+	return m, nil
+}
+
+// updateManifest applies update to the stored manifest with a conditional put,
+// re-reading and retrying if another writer changed it in between. A missing
+// manifest, or a nil update, rebuilds it from a listing instead.
+func (w *S3DAL) updateManifest(ctx context.Context, update func(*manifest)) error {
+	for attempt := 0; attempt < manifestRetries; attempt++ {
+		m, etag, err := w.readManifest(ctx)
+		if err != nil {
+			return err
+		}
+		if etag == "" || update == nil {
+			if m, err = w.listManifest(ctx); err != nil {
+				return err
+			}
+		} else {
+			update(&m)
+		}
+
+		data, err := json.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("failed to encode manifest: %w", err)
+		}
+		input := &s3.PutObjectInput{
+			Bucket: aws.String(w.bucketName),
+			Key:    aws.String(w.manifestKey()),
+			Body:   bytes.NewReader(data),
+		}
+		input.ServerSideEncryption, input.SSEKMSKeyId, input.BucketKeyEnabled = w.sseParams()
+		if etag == "" {
+			input.IfNoneMatch = aws.String("*")
+		} else {
+			input.IfMatch = aws.String(etag)
+		}
+		_, err = w.client.PutObject(ctx, input)
+		if err == nil {
+			return nil
+		}
+		if !isPreconditionFailed(err) {
+			return fmt.Errorf("failed to put manifest to S3%s: %w", w.sseHint(err), err)
+		}
+	}
+	return fmt.Errorf("manifest changed concurrently %d times", manifestRetries)
+}
+
+// recordInManifest adds offsets to the manifest after they were written. The
+// records are already committed, so a failure only leaves the manifest stale,
+// which readers detect; it is logged rather than returned.
+func (w *S3DAL) recordInManifest(ctx context.Context, offsets ...uint64) {
+	if !w.manifest || len(offsets) == 0 {
+		return
+	}
+	err := w.updateManifest(ctx, func(m *manifest) {
+		for _, offset := range offsets {
+			m.add(offset)
+		}
+	})
+	if err != nil {
+		w.logger.Debugf("failed to update manifest after writing offsets %d-%d: %v", offsets[0], offsets[len(offsets)-1], err)
+	}
+}
+
+// rebuildManifest replaces the manifest from a listing after records were
+// deleted. Like recordInManifest, failures are logged.
+func (w *S3DAL) rebuildManifest(ctx context.Context) {
+	if !w.manifest {
+		return
+	}
+	if err := w.updateManifest(ctx, nil); err != nil {
+		w.logger.Debugf("failed to rebuild manifest: %v", err)
+	}
+}
+
+// freshManifest returns the stored manifest if it is usable: present, and with
+// no record after its Last, which would mean a write it does not account for.
+// ok is false if the caller should fall back to listing.
+func (w *S3DAL) freshManifest(ctx context.Context) (m manifest, ok bool, err error) {
+	if !w.manifest {
+		return manifest{}, false, nil
+	}
+	m, etag, err := w.readManifest(ctx)
+	if err != nil || etag == "" {
+		return manifest{}, false, err
+	}
+	beyond, err := w.hasRecordAfter(ctx, m.Last)
+	if err != nil || beyond {
+		return manifest{}, false, err
+	}
+	return m, true, nil
+}
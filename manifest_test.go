@@ -0,0 +1,120 @@
+package s3_dal
+
+import (
+	"context"
+	"testing"
+)
+
+func TestManifestTracksAppends(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithManifest())
+	ctx := context.Background()
+
+	if count, err := wal.Count(ctx); err != nil || count != 0 {
+		t.Fatalf("expected an empty log to count 0, got %d, %v", count, err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := wal.Append(ctx, []byte("single")); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	if _, err := wal.AppendBatch(ctx, [][]byte{[]byte("a"), []byte("b")}); err != nil {
+		t.Fatalf("failed to append batch: %v", err)
+	}
+
+	m, _, err := wal.readManifest(ctx)
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	if m != (manifest{First: 1, Last: 5, Count: 5}) {
+		t.Errorf("expected manifest {1 5 5}, got %+v", m)
+	}
+
+	fake.listCalls, fake.headCalls = 0, 0
+	count, err := wal.Count(ctx)
+	if err != nil || count != 5 {
+		t.Errorf("expected count 5, got %d, %v", count, err)
+	}
+	record, err := wal.LastRecord(ctx)
+	if err != nil || record.Offset != 5 {
+		t.Errorf("expected last record 5, got %d, %v", record.Offset, err)
+	}
+	// one list each to confirm nothing follows the manifest's tail
+	if fake.listCalls != 2 || fake.headCalls != 1 {
+		t.Errorf("expected 2 lists and 1 head, got %d and %d", fake.listCalls, fake.headCalls)
+	}
+
+	if _, err := wal.TrimBefore(ctx, 3); err != nil {
+		t.Fatalf("failed to trim: %v", err)
+	}
+	if m, _, _ = wal.readManifest(ctx); m != (manifest{First: 3, Last: 5, Count: 3}) {
+		t.Errorf("expected the trim to rebuild the manifest as {3 5 3}, got %+v", m)
+	}
+}
+
+func TestManifestStaleFallsBack(t *testing.T) {
+	ctx := context.Background()
+	plain, fake := newFakeDAL(t)
+	for i := 0; i < 4; i++ {
+		if _, err := plain.Append(ctx, []byte("before the manifest")); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+
+	wal, err := OpenS3DAL(ctx, fake, plain.bucketName, plain.prefix, WithManifest())
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	if _, err := wal.Append(ctx, []byte("first with the manifest")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if m, _, _ := wal.readManifest(ctx); m != (manifest{First: 1, Last: 5, Count: 5}) {
+		t.Errorf("expected the manifest bootstrapped from the existing log, got %+v", m)
+	}
+
+	// a writer that does not maintain the manifest leaves it stale
+	plain.length = 5
+	if _, err := plain.Append(ctx, []byte("unrecorded")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if count, err := wal.Count(ctx); err != nil || count != 6 {
+		t.Errorf("expected the stale manifest to be bypassed for count 6, got %d, %v", count, err)
+	}
+	if record, err := wal.LastRecord(ctx); err != nil || record.Offset != 6 {
+		t.Errorf("expected the stale manifest to be bypassed for last record 6, got %d, %v", record.Offset, err)
+	}
+}
+
+func TestManifestConcurrentWriters(t *testing.T) {
+	ctx := context.Background()
+	a, fake := newFakeDAL(t, WithManifest())
+	b, err := New(fake, a.bucketName, a.prefix, WithManifest())
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	if _, err := a.Append(ctx, []byte("seed")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	// b appends and updates the manifest between a's read and write of it
+	interleaved := false
+	fake.beforePut = func(key string) {
+		if key != a.manifestKey() || interleaved {
+			return
+		}
+		interleaved = true
+		b.length = 2
+		if _, err := b.Append(ctx, []byte("from b")); err != nil {
+			t.Errorf("failed to append from b: %v", err)
+		}
+	}
+	if _, err := a.Append(ctx, []byte("from a")); err != nil {
+		t.Fatalf("failed to append from a: %v", err)
+	}
+	if !interleaved {
+		t.Fatal("expected b to interleave with a's manifest update")
+	}
+
+	if m, _, _ := a.readManifest(ctx); m != (manifest{First: 1, Last: 3, Count: 3}) {
+		t.Errorf("expected both writers' records in the manifest, got %+v", m)
+	}
+}
@@ -0,0 +1,68 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestInMemoryDAL(t *testing.T) {
+	var dal Log = NewInMemoryDAL()
+	ctx := context.Background()
+
+	if _, err := dal.LastRecord(ctx); !errors.Is(err, ErrEmptyLog) {
+		t.Fatalf("expected ErrEmptyLog from an empty log, got %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		offset, err := dal.Append(ctx, []byte(generateRandomStr()))
+		if err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+		if offset != uint64(i+1) {
+			t.Errorf("expected offset %d, got %d", i+1, offset)
+		}
+	}
+	last, err := dal.LastRecord(ctx)
+	if err != nil {
+		t.Fatalf("failed to get last record: %v", err)
+	}
+	if last.Offset != 3 {
+		t.Errorf("expected last offset 3, got %d", last.Offset)
+	}
+
+	if _, err := dal.Read(ctx, 4); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound, got %v", err)
+	}
+	mem := dal.(*InMemoryDAL)
+	if err := mem.Corrupt(2); err != nil {
+		t.Fatalf("failed to corrupt record: %v", err)
+	}
+	if _, err := dal.Read(ctx, 2); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if _, err := dal.Read(ctx, 1); err != nil {
+		t.Errorf("expected other records to stay readable, got %v", err)
+	}
+}
+
+func TestLogImplementationsAgree(t *testing.T) {
+	wal, _ := newFakeDAL(t)
+	ctx := context.Background()
+
+	for name, dal := range map[string]Log{"s3": wal, "memory": NewInMemoryDAL()} {
+		if _, err := dal.LastRecord(ctx); !errors.Is(err, ErrEmptyLog) {
+			t.Errorf("%s: expected ErrEmptyLog, got %v", name, err)
+		}
+		offset, err := dal.Append(ctx, []byte("same everywhere"))
+		if err != nil {
+			t.Fatalf("%s: failed to append: %v", name, err)
+		}
+		record, err := dal.Read(ctx, offset)
+		if err != nil || string(record.Data) != "same everywhere" {
+			t.Errorf("%s: expected to read the record back, got %q, %v", name, record.Data, err)
+		}
+		if _, err := dal.Read(ctx, offset+1); !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("%s: expected ErrRecordNotFound, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package s3_dal
+
+import (
+	"fmt"
+	"maps"
+	"mime"
+	"strings"
+)
+
+const (
+	// maxMetadataSize is the room S3's 2 KB limit on user metadata leaves
+	// for the caller's keys and values, after the metadata this package
+	// stores itself.
+	maxMetadataSize = 2<<10 - 128
+	// reservedMetadataPrefix marks the metadata keys this package stores.
+	reservedMetadataPrefix = "dal-"
+)
+
+// objectAttrs are the S3 attributes a record object is written with,
+// besides its storage class and encryption.
+type objectAttrs struct {
+	tagging     string
+	contentType string
+	metadata    map[string]string
+}
+
+// attrs returns the configured attributes, for records appended without
+// their own.
+func (w *S3DAL) attrs() objectAttrs {
+	return objectAttrs{tagging: w.tagging, contentType: w.contentType, metadata: w.metadata}
+}
+
+// validateContentType rejects a Content-Type that is not a media type.
+func validateContentType(contentType string) error {
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		return fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+	return nil
+}
+
+// normalizeMetadata lower-cases the keys of metadata, as S3 returns them, and
+// rejects metadata S3 would refuse or that collides with this package's own.
+func normalizeMetadata(metadata map[string]string) (map[string]string, error) {
+	normalized := make(map[string]string, len(metadata))
+	size := 0
+	for key, value := range metadata {
+		lower := strings.ToLower(key)
+		if lower == "" || !validMetadataText(lower, false) {
+			return nil, fmt.Errorf("invalid metadata key %q: must be letters, digits, '-', '_' or '.'", key)
+		}
+		if strings.HasPrefix(lower, reservedMetadataPrefix) {
+			return nil, fmt.Errorf("invalid metadata key %q: the %s prefix is reserved", key, reservedMetadataPrefix)
+		}
+		if _, dup := normalized[lower]; dup {
+			return nil, fmt.Errorf("invalid metadata key %q: duplicates another key but for case", key)
+		}
+		if !validMetadataText(value, true) {
+			return nil, fmt.Errorf("invalid metadata value %q for key %q: only printable ASCII is allowed", value, key)
+		}
+		normalized[lower] = value
+		size += len(lower) + len(value)
+	}
+	if size > maxMetadataSize {
+		return nil, fmt.Errorf("invalid metadata: %d bytes, at most %d are allowed", size, maxMetadataSize)
+	}
+	return normalized, nil
+}
+
+// validMetadataText reports whether s may be sent in a metadata header, as a
+// value if value is set and as a key otherwise.
+func validMetadataText(s string, value bool) bool {
+	for _, r := range s {
+		switch {
+		case value && r >= ' ' && r <= '~':
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// attrsFor is the attributes for an append whose own content type, if set,
+// replaces the configured one and whose own metadata overrides it key by key.
+func (w *S3DAL) attrsFor(contentType string, metadata map[string]string) (objectAttrs, error) {
+	attrs := w.attrs()
+	if contentType != "" {
+		if err := validateContentType(contentType); err != nil {
+			return objectAttrs{}, err
+		}
+		attrs.contentType = contentType
+	}
+	if len(metadata) > 0 {
+		own, err := normalizeMetadata(metadata)
+		if err != nil {
+			return objectAttrs{}, err
+		}
+		merged := maps.Clone(w.metadata)
+		if merged == nil {
+			merged = make(map[string]string, len(own))
+		}
+		maps.Copy(merged, own)
+		if attrs.metadata, err = normalizeMetadata(merged); err != nil {
+			return objectAttrs{}, err
+		}
+	}
+	return attrs, nil
+}
+
+// objectMetadata is the metadata to write with a record: the caller's, or nil
+// if there is none.
+func (w *S3DAL) objectMetadata(user map[string]string) map[string]string {
+	if len(user) == 0 {
+		return nil
+	}
+	return maps.Clone(user)
+}
+
+// unchecked reports whether body, framed as f and stored with metadata, was
+// written under WithSkipCRCOnWrite: flagged in its header, or, for records
+// from before the flag, marked in its metadata.
+func unchecked(metadata map[string]string, f frame, body []byte) bool {
+	return f.skipsChecksum(body) || metadata[metaChecksum] == checksumNone
+}
+
+// userMetadata strips the keys this package stores from the metadata of a
+// read object, returning nil if none are left.
+func userMetadata(metadata map[string]string) map[string]string {
+	var user map[string]string
+	for key, value := range metadata {
+		if strings.HasPrefix(strings.ToLower(key), reservedMetadataPrefix) {
+			continue
+		}
+		if user == nil {
+			user = make(map[string]string, len(metadata))
+		}
+		user[key] = value
+	}
+	return user
+}
@@ -0,0 +1,98 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestObjectMetadata(t *testing.T) {
+	wal, fake := newFakeDAL(t,
+		WithContentType("application/vnd.example.wal"),
+		WithObjectMetadata(map[string]string{"Source": "ingest-7", "schema": "v2"}),
+		WithSkipCRCOnWrite(),
+	)
+	ctx := context.Background()
+
+	offset, err := wal.Append(ctx, []byte("governed"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if got := aws.ToString(fake.lastPut.ContentType); got != "application/vnd.example.wal" {
+		t.Errorf("expected the configured content type, got %q", got)
+	}
+	record, err := wal.Read(ctx, offset)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	want := map[string]string{"source": "ingest-7", "schema": "v2"}
+	if !bytes.Equal(record.Data, []byte("governed")) || record.ContentType != "application/vnd.example.wal" || !maps.Equal(record.Metadata, want) {
+		t.Errorf("expected the attributes to round-trip, got %q, %q, %v", record.Data, record.ContentType, record.Metadata)
+	}
+
+	offset, err = wal.AppendWithMetadata(ctx, []byte("overridden"), "application/json", map[string]string{"schema": "v3", "trace": "abc"})
+	if err != nil {
+		t.Fatalf("failed to append with metadata: %v", err)
+	}
+	record, err = wal.Read(ctx, offset)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	want = map[string]string{"source": "ingest-7", "schema": "v3", "trace": "abc"}
+	if record.ContentType != "application/json" || !maps.Equal(record.Metadata, want) {
+		t.Errorf("expected the per-append attributes to override, got %q, %v", record.ContentType, record.Metadata)
+	}
+	if _, err := wal.AppendWithMetadata(ctx, []byte("bad"), "", map[string]string{"dal-checksum": "crc32"}); err == nil {
+		t.Error("expected a reserved per-append metadata key to be rejected")
+	}
+
+	plain, fake := newFakeDAL(t)
+	offset, err = plain.Append(ctx, []byte("plain"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if fake.lastPut.ContentType != nil || fake.lastPut.Metadata != nil {
+		t.Errorf("expected no content type or metadata by default, got %v, %v", fake.lastPut.ContentType, fake.lastPut.Metadata)
+	}
+	if record, err := plain.Read(ctx, offset); err != nil || record.ContentType != "" || record.Metadata != nil {
+		t.Errorf("expected a plain record, got %q, %v, %v", record.ContentType, record.Metadata, err)
+	}
+}
+
+func TestObjectMetadataMultipart(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithMultipartThreshold(5<<20), WithObjectMetadata(map[string]string{"source": "bulk"}))
+	ctx := context.Background()
+
+	offset, err := wal.AppendWithMetadata(ctx, bytes.Repeat([]byte("x"), 6<<20), "application/octet-stream", nil)
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if fake.lastCreate == nil || aws.ToString(fake.lastCreate.ContentType) != "application/octet-stream" {
+		t.Fatalf("expected a multipart upload with the content type, got %+v", fake.lastCreate)
+	}
+	record, err := wal.Read(ctx, offset)
+	if err != nil || record.Metadata["source"] != "bulk" {
+		t.Errorf("expected the metadata to survive a multipart upload, got %v, %v", record.Metadata, err)
+	}
+}
+
+func TestObjectMetadataRejectsInvalid(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"empty content type": WithContentType(""),
+		"bad content type":   WithContentType("not a type"),
+		"empty key":          WithObjectMetadata(map[string]string{"": "v"}),
+		"bad key":            WithObjectMetadata(map[string]string{"has space": "v"}),
+		"reserved key":       WithObjectMetadata(map[string]string{"DAL-offset": "v"}),
+		"case duplicate":     WithObjectMetadata(map[string]string{"Key": "a", "key": "b"}),
+		"non-ASCII value":    WithObjectMetadata(map[string]string{"k": "café"}),
+		"too large":          WithObjectMetadata(map[string]string{"k": strings.Repeat("v", maxMetadataSize)}),
+	} {
+		if _, err := New(newFakeS3(), "fake-bucket", "fake-prefix", opt); err == nil {
+			t.Errorf("%s: expected the option to be rejected", name)
+		}
+	}
+}
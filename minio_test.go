@@ -0,0 +1,64 @@
+//go:build minio
+
+// Run with a MinIO server, e.g.
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	go test -tags minio -run MinIO .
+//
+// S3_DAL_MINIO_ENDPOINT, S3_DAL_MINIO_ACCESS_KEY and S3_DAL_MINIO_SECRET_KEY
+// override the defaults of a local container.
+
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func minioEnv(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func TestMinIOCompatibility(t *testing.T) {
+	client := NewCompatibleClient(
+		minioEnv("S3_DAL_MINIO_ENDPOINT", "http://localhost:9000"),
+		"us-east-1",
+		minioEnv("S3_DAL_MINIO_ACCESS_KEY", "minioadmin"),
+		minioEnv("S3_DAL_MINIO_SECRET_KEY", "minioadmin"),
+	)
+	ctx := context.Background()
+	bucket, prefix := "s3-dal-minio", generateRandomStr()
+	if err := setupBucket(client, bucket); err != nil {
+		t.Skipf("MinIO is not reachable: %v", err)
+	}
+	defer emptyBucket(ctx, client, bucket, prefix)
+
+	wal := S3DALClient(client, bucket, prefix)
+	for i := 0; i < 3; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	if record, err := wal.LastRecord(ctx); err != nil || record.Offset != 3 {
+		t.Errorf("expected last record 3, got %d, %v", record.Offset, err)
+	}
+
+	rival := S3DALClient(client, bucket, prefix)
+	if _, err := rival.Append(ctx, []byte("stale writer")); !errors.Is(err, ErrOffsetConflict) {
+		t.Errorf("expected ErrOffsetConflict from a stale writer, got %v", err)
+	}
+	if _, err := wal.Read(ctx, 4); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound past the tail, got %v", err)
+	}
+	if ok, err := wal.Exists(ctx, 4); err != nil || ok {
+		t.Errorf("expected offset 4 to be missing, got %v, %v", ok, err)
+	}
+	if count, err := wal.Count(ctx); err != nil || count != 3 {
+		t.Errorf("expected count 3, got %d, %v", count, err)
+	}
+}
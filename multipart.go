@@ -0,0 +1,131 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	defaultMultipartThreshold = 16 << 20
+	// minMultipartThreshold is the smallest part S3 accepts other than the last.
+	minMultipartThreshold = 5 << 20
+	// multipartPartSize is the size of every part but the last. S3 allows at
+	// most 10,000 parts, so records up to about 80 GB fit.
+	multipartPartSize = 8 << 20
+)
+
+// putMultipart writes the record at offset through a multipart upload. body
+// yields the size bytes of its header and stored data, and must end there.
+// Parts are staged one at a time in a single part-sized buffer, so the framed
+// body is never built whole, and the checksum is computed over each part as
+// it is staged. The upload is completed with If-None-Match, so like a single
+// put it fails with ErrOffsetConflict if the offset is taken. On any failure
+// the upload is aborted.
+func (w *S3DAL) putMultipart(ctx context.Context, offset uint64, body io.Reader, size int, attrs objectAttrs) error {
+	key := w.getObjectKey(offset)
+	create := &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(w.bucketName),
+		Key:         aws.String(key),
+		ContentType: nilIfEmpty(attrs.contentType),
+		Metadata:    w.objectMetadata(attrs.metadata),
+	}
+	if w.storageClass != "" {
+		create.StorageClass = w.storageClass
+	}
+	create.Tagging = nilIfEmpty(attrs.tagging)
+	create.ServerSideEncryption, create.SSEKMSKeyId, create.BucketKeyEnabled = w.sseParams()
+	create.ChecksumAlgorithm = w.uploadChecksum()
+	upload, err := w.client.CreateMultipartUpload(ctx, create)
+	if err != nil {
+		return fmt.Errorf("failed to create multipart upload in S3%s: %w", w.sseHint(err), err)
+	}
+
+	parts, err := w.uploadParts(ctx, key, upload.UploadId, offset, body, size)
+	if err == nil {
+		err = expectEOF(body)
+	}
+	if err == nil {
+		_, err = w.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(w.bucketName),
+			Key:             aws.String(key),
+			UploadId:        upload.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+			IfNoneMatch:     w.ifNoneMatch(),
+		})
+		if err != nil {
+			err = w.putRecordError(offset, err)
+		}
+	}
+	if err != nil {
+		// abort even if ctx is done, or the staged parts are billed until a
+		// lifecycle rule removes them
+		_, abortErr := w.client.AbortMultipartUpload(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(w.bucketName),
+			Key:      aws.String(key),
+			UploadId: upload.UploadId,
+		})
+		if abortErr != nil {
+			w.logger.Debugf("failed to abort multipart upload %s for offset %d: %v", aws.ToString(upload.UploadId), offset, abortErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// uploadParts uploads the remaining bytes of src in multipartPartSize parts,
+// appending the checksum trailer to the last.
+func (w *S3DAL) uploadParts(ctx context.Context, key string, uploadID *string, offset uint64, src io.Reader, remaining int) ([]types.CompletedPart, error) {
+
+	buf := make([]byte, multipartPartSize, multipartPartSize+w.checksum.Size())
+	sum := w.checksum.newHash()
+	var parts []types.CompletedPart
+	for number := int32(1); remaining > 0; number++ {
+		part := buf[:min(remaining, multipartPartSize)]
+		if _, err := io.ReadFull(src, part); err != nil {
+			return nil, fmt.Errorf("failed to stage part %d: %w", number, err)
+		}
+		remaining -= len(part)
+		sum.Write(part)
+		switch {
+		case remaining > 0:
+		case w.skipCRC:
+			part = append(part, make([]byte, w.checksum.Size())...)
+		default:
+			part = sum.Sum(part)
+		}
+
+		input := &s3.UploadPartInput{
+			Bucket:            aws.String(w.bucketName),
+			Key:               aws.String(key),
+			UploadId:          uploadID,
+			PartNumber:        aws.Int32(number),
+			Body:              bytes.NewReader(part),
+			ChecksumAlgorithm: w.uploadChecksum(),
+		}
+		if w.contentMD5 {
+			digest := md5.Sum(part)
+			input.ContentMD5 = aws.String(base64.StdEncoding.EncodeToString(digest[:]))
+		}
+		output, err := w.client.UploadPart(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload part %d of offset %d to S3: %w", number, offset, err)
+		}
+		parts = append(parts, types.CompletedPart{
+			ETag:           output.ETag,
+			PartNumber:     aws.Int32(number),
+			ChecksumCRC32:  output.ChecksumCRC32,
+			ChecksumCRC32C: output.ChecksumCRC32C,
+			ChecksumSHA1:   output.ChecksumSHA1,
+			ChecksumSHA256: output.ChecksumSHA256,
+		})
+	}
+	return parts, nil
+}
@@ -0,0 +1,79 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestAppendMultipart(t *testing.T) {
+	// three 8 MiB parts, the last short, with no byte pattern repeating on a
+	// part boundary
+	payload := make([]byte, 2*multipartPartSize+12345)
+	for i := range payload {
+		payload[i] = byte(i * 7 / 3)
+	}
+
+	for _, opts := range [][]Option{
+		nil,
+		{WithChecksum(ChecksumCRC32C), WithContentMD5()},
+		{WithS3Checksum(types.ChecksumAlgorithmCrc32)},
+		{WithS3Checksum(types.ChecksumAlgorithmCrc32c)},
+		{WithS3Checksum(types.ChecksumAlgorithmSha1)},
+		{WithS3Checksum(types.ChecksumAlgorithmSha256)},
+	} {
+		opts = append(opts, WithMultipartThreshold(minMultipartThreshold))
+		wal, fake := newFakeDAL(t, opts...)
+		ctx := context.Background()
+
+		offset, err := wal.Append(ctx, payload)
+		if err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+		if fake.putCalls != 0 || fake.partCalls != 3 {
+			t.Errorf("expected 3 parts and no PutObject, got %d parts and %d puts", fake.partCalls, fake.putCalls)
+		}
+		if len(fake.uploads) != 0 {
+			t.Errorf("expected no uploads left open, got %d", len(fake.uploads))
+		}
+		record, err := wal.Read(ctx, offset)
+		if err != nil {
+			t.Fatalf("failed to read multipart record: %v", err)
+		}
+		if !bytes.Equal(record.Data, payload) {
+			t.Error("multipart record did not round-trip")
+		}
+
+		// a record under the threshold still takes a single put
+		if _, err := wal.Append(ctx, []byte("small")); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+		if fake.putCalls != 1 {
+			t.Errorf("expected a small record to use PutObject, got %d puts", fake.putCalls)
+		}
+	}
+}
+
+func TestAppendMultipartConflict(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithMultipartThreshold(minMultipartThreshold))
+	ctx := context.Background()
+
+	other, _ := New(fake, wal.bucketName, wal.prefix)
+	if _, err := other.Append(ctx, []byte("already here")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	_, err := wal.Append(ctx, make([]byte, minMultipartThreshold))
+	if !errors.Is(err, ErrOffsetConflict) {
+		t.Fatalf("expected ErrOffsetConflict, got %v", err)
+	}
+	if fake.abortCalls != 1 || len(fake.uploads) != 0 {
+		t.Errorf("expected the upload to be aborted, got %d aborts and %d open uploads", fake.abortCalls, len(fake.uploads))
+	}
+	if wal.Length() != 0 {
+		t.Errorf("expected the length to stay 0, got %d", wal.Length())
+	}
+}
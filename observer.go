@@ -0,0 +1,46 @@
+package s3_dal
+
+import (
+	"errors"
+	"time"
+)
+
+// Observer receives metrics about the DAL's operations, for wiring it into a
+// metrics system such as Prometheus. Methods are called synchronously, from
+// concurrent goroutines during batch appends, so they must be fast and safe
+// for concurrent use. The default discards everything; see WithObserver.
+type Observer interface {
+	// RecordAppend is called once per record written by Append or
+	// AppendBatch, with the payload size before compression and how long
+	// the write took. err is nil on success.
+	RecordAppend(bytes int, dur time.Duration, err error)
+	// RecordRead is called once per Read, with the payload size returned.
+	RecordRead(bytes int, dur time.Duration, err error)
+	// RecordChecksumFailure is called when a record read by Read, ReadRaw
+	// or ReadStream fails its checksum.
+	RecordChecksumFailure(offset uint64)
+	// RecordConflict is called when a write loses offset to another writer.
+	RecordConflict(offset uint64)
+}
+
+// RetentionObserver is an Observer that is also told of each pass the
+// retention worker of StartRetention makes: how many records it trimmed, and
+// the error if the pass failed. An Observer need not implement it.
+type RetentionObserver interface {
+	RecordRetention(trimmed int, err error)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) RecordAppend(int, time.Duration, error) {}
+func (nopObserver) RecordRead(int, time.Duration, error)   {}
+func (nopObserver) RecordChecksumFailure(uint64)           {}
+func (nopObserver) RecordConflict(uint64)                  {}
+
+// observeRead reports a Read of offset that started at start.
+func (w *S3DAL) observeRead(offset uint64, start time.Time, record Record, err error) {
+	w.observer.RecordRead(len(record.Data), time.Since(start), err)
+	if errors.Is(err, ErrChecksumMismatch) {
+		w.observer.RecordChecksumFailure(offset)
+	}
+}
@@ -0,0 +1,103 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The Prometheus adapter below only needs these method sets, which
+// prometheus.Counter and prometheus.Observer (a Histogram) satisfy, so in real
+// code the fields are filled with prometheus.NewCounter and
+// prometheus.NewHistogram values registered on a registry.
+type counter interface{ Inc() }
+type adder interface{ Add(float64) }
+type histogram interface{ Observe(float64) }
+
+type promObserver struct {
+	appends, appendErrors, reads, readErrors counter
+	checksumFailures, conflicts              counter
+	bytesWritten                             adder
+	appendSeconds, readSeconds               histogram
+}
+
+func (p *promObserver) RecordAppend(bytes int, dur time.Duration, err error) {
+	p.appends.Inc()
+	p.appendSeconds.Observe(dur.Seconds())
+	if err != nil {
+		p.appendErrors.Inc()
+		return
+	}
+	p.bytesWritten.Add(float64(bytes))
+}
+
+func (p *promObserver) RecordRead(bytes int, dur time.Duration, err error) {
+	p.reads.Inc()
+	p.readSeconds.Observe(dur.Seconds())
+	if err != nil {
+		p.readErrors.Inc()
+	}
+}
+
+func (p *promObserver) RecordChecksumFailure(uint64) { p.checksumFailures.Inc() }
+func (p *promObserver) RecordConflict(uint64)        { p.conflicts.Inc() }
+
+// metric stands in for the Prometheus types in the test.
+type metric struct {
+	mu    sync.Mutex
+	value float64
+	count int
+}
+
+func (m *metric) Inc()              { m.Add(1) }
+func (m *metric) Observe(v float64) { m.Add(v) }
+func (m *metric) Add(v float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.value += v
+	m.count++
+}
+
+func TestObserver(t *testing.T) {
+	var appends, appendErrors, reads, readErrors, checksumFailures, conflicts, written, appendSeconds, readSeconds metric
+	obs := &promObserver{
+		appends: &appends, appendErrors: &appendErrors, reads: &reads, readErrors: &readErrors,
+		checksumFailures: &checksumFailures, conflicts: &conflicts, bytesWritten: &written,
+		appendSeconds: &appendSeconds, readSeconds: &readSeconds,
+	}
+	wal, fake := newFakeDAL(t, WithObserver(obs))
+	ctx := context.Background()
+
+	if _, err := wal.Append(ctx, []byte("hello")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if _, err := wal.AppendBatch(ctx, [][]byte{[]byte("ab"), []byte("cde")}); err != nil {
+		t.Fatalf("failed to append batch: %v", err)
+	}
+	if appends.count != 3 || written.value != 10 || appendSeconds.count != 3 {
+		t.Errorf("expected 3 appends of 10 bytes timed, got %d of %v, %d timings", appends.count, written.value, appendSeconds.count)
+	}
+
+	// a second writer that lost track of the tail conflicts
+	stale, _ := New(fake, wal.bucketName, wal.prefix, WithObserver(obs))
+	if _, err := stale.Append(ctx, []byte("late")); !errors.Is(err, ErrOffsetConflict) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	if conflicts.count != 1 || appendErrors.count != 1 {
+		t.Errorf("expected 1 conflict and 1 failed append, got %d and %d", conflicts.count, appendErrors.count)
+	}
+
+	if _, err := wal.Read(ctx, 1); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	obj := fake.objects[wal.getObjectKey(2)]
+	obj.body[len(obj.body)-1] ^= 0xFF
+	if _, err := wal.Read(ctx, 2); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+	if reads.count != 2 || readErrors.count != 1 || checksumFailures.count != 1 {
+		t.Errorf("expected 2 reads, 1 failed on its checksum, got %d, %d, %d", reads.count, readErrors.count, checksumFailures.count)
+	}
+}
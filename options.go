@@ -0,0 +1,720 @@
+package s3_dal
+
+import (
+	"context"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Option configures an S3DAL constructed with New.
+type Option func(*S3DAL) error
+
+// New returns an S3DAL for the given bucket and prefix configured with opts.
+func New(client s3API, bucketName, prefix string, opts ...Option) (*S3DAL, error) {
+	w := &S3DAL{
+		client:     client,
+		bucketName: bucketName,
+		prefix:     prefix,
+		length:     0,
+		now:        time.Now,
+		logger:     nopLogger{},
+		observer:   nopObserver{},
+
+		fileSizeLimit:    math.MaxUint64,
+		storedSizeLimit:  math.MaxUint64,
+		maxRecordSize:    defaultMaxRecordSize,
+		readAttempts:     1,
+		batchConcurrency: defaultBatchConcurrency,
+		readConcurrency:  defaultReadConcurrency,
+		scanPrefetch:     defaultScanPrefetch,
+
+		multipartThreshold: defaultMultipartThreshold,
+
+		encodeOffset: defaultEncodeOffset,
+		decodeOffset: defaultDecodeOffset,
+		delimiter:    defaultKeyDelimiter,
+	}
+	for _, opt := range opts {
+		if err := opt(w); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	if w.prefix, err = normalizePrefix(prefix, w.delimiter); err != nil && !w.emptyPrefix {
+		return nil, err
+	}
+	if err := w.validateKeys(); err != nil {
+		return nil, err
+	}
+	if w.bucketKey != nil && w.sse != types.ServerSideEncryptionAwsKms {
+		return nil, errors.New("invalid bucket key setting: WithBucketKeyEnabled needs SSE-KMS, configure WithSSEKMS")
+	}
+	if w.packRecords > 0 {
+		if err := w.validatePacking(); err != nil {
+			return nil, err
+		}
+	}
+	w.observer = &statsObserver{Observer: w.observer, stats: &w.stats}
+	w.client = w.wrapClient(w.client)
+	for i, fallback := range w.fallbacks {
+		if fallback.client != nil {
+			w.fallbacks[i].client = w.wrapClient(fallback.client)
+		}
+	}
+	w.opts = opts
+	w.lifetime, w.stop = context.WithCancel(context.Background())
+	if w.async != nil {
+		w.async.start(w)
+	}
+	return w, nil
+}
+
+// wrapClient adds the request payer, per-request timeout, rate limit and
+// retries configured with WithRequestPayer, WithOperationTimeout,
+// WithRateLimit and WithRetryPolicy to client, the primary's or a fallback's.
+// The timeout goes inside the limiter, so it bounds each attempt rather than
+// the wait for a token and the SlowDown retries, and each retry waits for the
+// limiter again. unwrapClient takes them off in the same order.
+func (w *S3DAL) wrapClient(client s3API) s3API {
+	if w.requestPayer {
+		client = &requesterPaysClient{s3API: client}
+	}
+	if w.opTimeout > 0 {
+		client = &timeoutClient{s3API: client, timeout: w.opTimeout}
+	}
+	if w.limiter != nil {
+		client = &throttledClient{s3API: client, limiter: w.limiter, attempts: slowDownAttempts, backoff: slowDownBackoff}
+	}
+	if w.retryAttempts > 1 {
+		client = &retryClient{s3API: client, attempts: w.retryAttempts, backoff: w.retryBackoff, stats: &w.stats}
+	}
+	return client
+}
+
+// OpenS3DAL returns an S3DAL for an existing log, with its length recovered
+// from the highest offset already in the bucket so the next Append continues
+// the log. An empty prefix yields a DAL at length 0. Only keys are listed; no
+// record bodies are read.
+func OpenS3DAL(ctx context.Context, client s3API, bucketName, prefix string, opts ...Option) (*S3DAL, error) {
+	w, err := New(client, bucketName, prefix, opts...)
+	if err != nil {
+		return nil, err
+	}
+	last, err := w.lastOffset(ctx)
+	if err != nil && !errors.Is(err, ErrEmptyLog) {
+		return nil, fmt.Errorf("failed to recover length: %w", err)
+	}
+	w.setLength(last)
+	return w, nil
+}
+
+// WithMaxScan bounds the number of records read by whole-log scans such as
+// FindDuplicates. A scan that would read more returns ErrMaxScanExceeded.
+func WithMaxScan(n int) Option {
+	return func(w *S3DAL) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid max scan %d: must be positive", n)
+		}
+		w.maxScan = n
+		return nil
+	}
+}
+
+// WithSkipCRCOnWrite stores a zero CRC instead of computing one on Append and
+// flags the record's header as unchecked so Read, and DecodeRecord, skip the
+// check for it. This trades
+// the in-body integrity check for write throughput, and is only advisable
+// when something else (S3 checksums, SSE) already guards the payload.
+// Records written without this option are still validated as usual.
+func WithSkipCRCOnWrite() Option {
+	return func(w *S3DAL) error {
+		w.skipCRC = true
+		return nil
+	}
+}
+
+// WithAppendHook registers hooks that run around the put in Append, inside
+// the append lock so offset allocation stays consistent. before may transform
+// the payload (for example to add an HMAC); if it returns an error the append
+// is aborted and nothing is written. after receives the committed offset; if
+// it fails the record is already durable, so Append returns the offset
+// together with the error. Either hook may be nil.
+func WithAppendHook(before func(data []byte) ([]byte, error), after func(offset uint64) error) Option {
+	return func(w *S3DAL) error {
+		w.beforeAppend = before
+		w.afterAppend = after
+		return nil
+	}
+}
+
+// WithBatchConcurrency sets how many puts AppendBatch issues at once.
+func WithBatchConcurrency(n int) Option {
+	return func(w *S3DAL) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid batch concurrency %d: must be positive", n)
+		}
+		w.batchConcurrency = n
+		return nil
+	}
+}
+
+// WithAtomicBatch makes AppendBatch delete the records it wrote and leave the
+// length unchanged when any element fails, instead of keeping the partial
+// result. Offsets claimed by a concurrent writer are still not reusable.
+func WithAtomicBatch() Option {
+	return func(w *S3DAL) error {
+		w.atomicBatch = true
+		return nil
+	}
+}
+
+// WithContentMD5 sends the base64 MD5 of each framed body as Content-MD5, so
+// S3 rejects an upload corrupted in transit. This complements the in-body
+// CRC, which is only checked on read.
+func WithContentMD5() Option {
+	return func(w *S3DAL) error {
+		w.contentMD5 = true
+		return nil
+	}
+}
+
+// WithReadConcurrency sets how many GetObject calls range reads issue at once.
+func WithReadConcurrency(n int) Option {
+	return func(w *S3DAL) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid read concurrency %d: must be positive", n)
+		}
+		w.readConcurrency = n
+		return nil
+	}
+}
+
+// WithKeyCodec replaces how offsets are turned into object key suffixes and
+// back. The codec is rejected unless it round-trips and sorts lexically in
+// offset order, since listing-based lookups depend on that.
+func WithKeyCodec(encode func(uint64) string, decode func(string) (uint64, error)) Option {
+	return func(w *S3DAL) error {
+		if err := validateKeyCodec(encode, decode); err != nil {
+			return err
+		}
+		w.encodeOffset = encode
+		w.decodeOffset = decode
+		return nil
+	}
+}
+
+// WithKeyDelimiter sets what separates the prefix, shard and offset parts of
+// object keys, and names control objects such as prefix/_manifest, instead of
+// "/". It must not be a letter, digit or "_", nor appear in encoded offsets.
+// Every client of a log must use the same one.
+func WithKeyDelimiter(delimiter string) Option {
+	return func(w *S3DAL) error {
+		if delimiter == "" || strings.ContainsFunc(delimiter, func(r rune) bool {
+			return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+		}) {
+			return fmt.Errorf("invalid key delimiter %q: must be non-empty, with no letters, digits or '_'", delimiter)
+		}
+		w.delimiter = delimiter
+		return nil
+	}
+}
+
+// WithKeyVersion writes records under the versioned sub-prefix prefix/v<N>/
+// instead of directly under the prefix, which is version 1, so a new record
+// format can be rolled out without rewriting the log. Reads, Exists and
+// listings also look under every older version, down to 1, and merge them in
+// offset order, so offsets run on across versions and LastRecord, Scan and
+// the trims see one log. ReadPartial, Repair and the other calls that address
+// a single key only look under the current version.
+//
+// To migrate, stop the writers, restart them all with the next version and
+// whatever new format options go with it, and let them resume at the tail.
+// Their conditional puts only guard keys of their own version, so a writer
+// left on the old one could reuse an offset. Readers on the old version do
+// not see the new records, so upgrade them first: those on the new version
+// read both. Each older version costs a request per read miss and a listing
+// per listing, even once its records are trimmed. Names such as "v2" must not
+// also be used for active sub-prefixes.
+//
+// It is not supported with packing.
+func WithKeyVersion(version int) Option {
+	return func(w *S3DAL) error {
+		if version < 1 || version > maxKeyVersion {
+			return fmt.Errorf("invalid key version %d: must be 1 to %d", version, maxKeyVersion)
+		}
+		w.keyVersion = version
+		return nil
+	}
+}
+
+// WithScanPrefetch sets how many records a Scan iterator fetches ahead of the
+// consumer.
+func WithScanPrefetch(n int) Option {
+	return func(w *S3DAL) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid scan prefetch %d: must be positive", n)
+		}
+		w.scanPrefetch = n
+		return nil
+	}
+}
+
+// WithLogger sends debug output, such as checksum details on read, to l.
+func WithLogger(l Logger) Option {
+	return func(w *S3DAL) error {
+		if l == nil {
+			return fmt.Errorf("invalid logger: nil")
+		}
+		w.logger = l
+		return nil
+	}
+}
+
+// WithObserver reports appends, reads, checksum failures and offset conflicts
+// to o, for metrics. Without it nothing is reported.
+func WithObserver(o Observer) Option {
+	return func(w *S3DAL) error {
+		if o == nil {
+			return fmt.Errorf("invalid observer: nil")
+		}
+		w.observer = o
+		return nil
+	}
+}
+
+// WithFileSizeLimit caps the total payload bytes Append and AppendBatch accept
+// through this client, counted before compression and framing; see
+// WithStoredSizeLimit for the object bytes. Without it there is no limit.
+func WithFileSizeLimit(n uint64) Option {
+	return func(w *S3DAL) error {
+		if n == 0 {
+			return fmt.Errorf("invalid file size limit %d: must be positive", n)
+		}
+		w.fileSizeLimit = n
+		return nil
+	}
+}
+
+// WithStoredSizeLimit caps the total object bytes Append and AppendBatch
+// write through this client: the payloads as stored, after compression and
+// encryption, with the header and checksum of each record. It applies
+// alongside WithFileSizeLimit, which caps the payload bytes before any of
+// that. Without it there is no limit.
+func WithStoredSizeLimit(n uint64) Option {
+	return func(w *S3DAL) error {
+		if n == 0 {
+			return fmt.Errorf("invalid stored size limit %d: must be positive", n)
+		}
+		w.storedSizeLimit = n
+		return nil
+	}
+}
+
+// defaultMaxRecordSize is the largest object a single PutObject accepts.
+const defaultMaxRecordSize = 5 << 30
+
+// WithMaxRecordSize caps the payload of a single record, checked before any
+// request is made. The default is 5 GiB, the PutObject limit; since large
+// records are uploaded in parts, it may be raised past that.
+func WithMaxRecordSize(n uint64) Option {
+	return func(w *S3DAL) error {
+		if n == 0 {
+			return fmt.Errorf("invalid max record size %d: must be positive", n)
+		}
+		w.maxRecordSize = n
+		return nil
+	}
+}
+
+// WithKeyWidth zero-pads offsets in object keys to width digits instead of
+// the default 20. The width must fit every uint64, so anything narrower than
+// 20 is rejected. It replaces any codec set by WithKeyCodec.
+func WithKeyWidth(width int) Option {
+	return func(w *S3DAL) error {
+		if width < defaultKeyWidth {
+			return fmt.Errorf("invalid key width %d: must be at least %d", width, defaultKeyWidth)
+		}
+		w.encodeOffset = paddedEncodeOffset(width)
+		w.decodeOffset = paddedDecodeOffset(width)
+		return nil
+	}
+}
+
+// WithStorageClass sets the S3 storage class records are written with. class
+// must be one of types.StorageClass.Values(), such as STANDARD, STANDARD_IA or
+// INTELLIGENT_TIERING.
+func WithStorageClass(class types.StorageClass) Option {
+	return func(w *S3DAL) error {
+		if known := class.Values(); !slices.Contains(known, class) {
+			return fmt.Errorf("invalid storage class %q: must be one of %v", class, known)
+		}
+		w.storageClass = class
+		return nil
+	}
+}
+
+// WithCompression compresses record payloads with c on Append. Compressed
+// records are flagged in their framing, so Read decodes them regardless of how
+// the reading client is configured, and logs may mix codecs.
+func WithCompression(c Compression) Option {
+	return func(w *S3DAL) error {
+		if !c.valid() {
+			return fmt.Errorf("invalid compression %s", c)
+		}
+		w.compression = c
+		return nil
+	}
+}
+
+// withEmptyPrefix accepts an empty prefix, for S3DALClient.
+func withEmptyPrefix() Option {
+	return func(w *S3DAL) error {
+		w.emptyPrefix = true
+		return nil
+	}
+}
+
+// WithLegacyFormat lets Read accept records written without the format
+// header by older versions of this package. Without it they fail with
+// ErrBadMagic. Headerless records are told apart by their first byte, so
+// offsets of 2^56 and above cannot be read this way.
+func WithLegacyFormat() Option {
+	return func(w *S3DAL) error {
+		w.legacyFormat = true
+		return nil
+	}
+}
+
+// WithChecksum selects the algorithm guarding records written by Append. The
+// algorithm is recorded in each record's header, so Read verifies any mix of
+// them. ChecksumCRC32C and ChecksumSHA256 are also sent to S3 as the upload
+// checksum, so the transfer is verified server-side too.
+//
+// c is one of the Checksum values, or another implementation of one, such as
+// a hardware-accelerated SHA-256, naming it with an Algorithm() Checksum
+// method; records it writes are readable by any client. It is used for whole
+// records, and to verify any read whose header names its algorithm; records
+// streamed in parts, by AppendReader, ReadStream and multipart uploads, use
+// the built-in one.
+func WithChecksum(c Checksummer) Option {
+	return func(w *S3DAL) error {
+		id, ok := algorithmOf(c)
+		if !ok {
+			return fmt.Errorf("invalid checksum %v: not a Checksum and has no Algorithm method naming one", c)
+		}
+		w.checksum, w.checksummer = id, c
+		return nil
+	}
+}
+
+// WithS3Checksum has S3 verify every upload with algorithm, such as
+// types.ChecksumAlgorithmCrc32c or types.ChecksumAlgorithmSha256, rejecting a
+// body corrupted in transit, whatever the record checksum. Reads of a record
+// ask for the stored checksum back, and the SDK fails reading a body that does
+// not match it. The record checksum still guards the data end to end.
+func WithS3Checksum(algorithm types.ChecksumAlgorithm) Option {
+	return func(w *S3DAL) error {
+		if !slices.Contains(algorithm.Values(), algorithm) {
+			return fmt.Errorf("invalid S3 checksum algorithm %q", algorithm)
+		}
+		w.s3Checksum = algorithm
+		return nil
+	}
+}
+
+// WithStorageChecksum has reads ask S3 for the checksum it stored with each
+// object at upload, as WithS3Checksum or a CRC32C or SHA-256 record checksum
+// has it store, and compare the body with it, failing with
+// ErrStorageChecksumMismatch on a difference. It is a second check,
+// independent of the record checksum and wider than the default CRC16, that
+// catches corruption at rest. Objects stored without a checksum, and range
+// reads, are not checked.
+func WithStorageChecksum() Option {
+	return func(w *S3DAL) error {
+		w.verifyStorage = true
+		return nil
+	}
+}
+
+// WithSSES3 encrypts every object the DAL writes with S3-managed keys
+// (SSE-S3). It replaces any earlier WithSSEKMS.
+func WithSSES3() Option {
+	return func(w *S3DAL) error {
+		w.sse = types.ServerSideEncryptionAes256
+		w.sseKMSKeyID = ""
+		return nil
+	}
+}
+
+// WithSSEKMS encrypts every object the DAL writes with the given KMS key
+// (SSE-KMS). It replaces any earlier WithSSES3. Reads need no configuration,
+// but the reader must be allowed to decrypt with the key.
+func WithSSEKMS(keyID string) Option {
+	return func(w *S3DAL) error {
+		if keyID == "" {
+			return fmt.Errorf("invalid KMS key ID: empty")
+		}
+		w.sse = types.ServerSideEncryptionAwsKms
+		w.sseKMSKeyID = keyID
+		return nil
+	}
+}
+
+// WithBucketKeyEnabled sets whether SSE-KMS writes use an S3 Bucket Key,
+// which cuts the KMS requests S3 makes on the DAL's behalf, overriding the
+// bucket's default either way. It requires WithSSEKMS.
+func WithBucketKeyEnabled(enabled bool) Option {
+	return func(w *S3DAL) error {
+		w.bucketKey = &enabled
+		return nil
+	}
+}
+
+// WithCompaction lets the DAL read records that Compact has rewritten into
+// segments, and lets it call Compact. Every client of a compacted log needs
+// it. A read of a missing offset costs a list more, to rule out a segment.
+func WithCompaction() Option {
+	return func(w *S3DAL) error {
+		w.compaction = true
+		w.segments = newSegmentIndex()
+		return nil
+	}
+}
+
+// WithMultipartThreshold sets the framed record size above which Append uploads
+// a record in parts rather than with a single PutObject. The default is 16 MiB;
+// values below the 5 MiB S3 minimum part size are rejected.
+func WithMultipartThreshold(n int) Option {
+	return func(w *S3DAL) error {
+		if n < minMultipartThreshold {
+			return fmt.Errorf("invalid multipart threshold %d: must be at least %d", n, minMultipartThreshold)
+		}
+		w.multipartThreshold = n
+		return nil
+	}
+}
+
+// WithManifest maintains a prefix/_manifest object recording the first and last
+// offsets and the record count, updated after every append with a conditional
+// put, so LastRecord, OpenS3DAL and Count can skip listing. A missing manifest
+// is built from a listing on the first append, so it can be enabled on an
+// existing log. It is a hint: readers fall back to listing if it is missing or
+// records exist past its tail, and records deleted by a writer without the
+// option are not noticed, so every writer to a log should enable it.
+func WithManifest() Option {
+	return func(w *S3DAL) error {
+		w.manifest = true
+		return nil
+	}
+}
+
+// WithObjectTags attaches tags to every record object written, for lifecycle
+// rules and cost allocation; AppendWithTags adds to them per record. Tags are
+// checked against S3's rules up front: at most 10, keys of 1 to 128 and values
+// of up to 256 letters, digits, spaces or "+-=._:/@", and no "aws:" keys.
+func WithObjectTags(tags map[string]string) Option {
+	return func(w *S3DAL) error {
+		if err := validateTags(tags); err != nil {
+			return err
+		}
+		w.tags = maps.Clone(tags)
+		w.tagging = encodeTags(tags)
+		return nil
+	}
+}
+
+// WithContentType sets the Content-Type of every record object written, which
+// is otherwise left for S3 to default to binary/octet-stream, for tools that
+// classify objects by it; AppendWithMetadata overrides it per record. It must
+// be a media type such as "application/vnd.example.wal". The record format is
+// unchanged.
+func WithContentType(contentType string) Option {
+	return func(w *S3DAL) error {
+		if err := validateContentType(contentType); err != nil {
+			return err
+		}
+		w.contentType = contentType
+		return nil
+	}
+}
+
+// WithObjectMetadata attaches user metadata to every record object written,
+// sent as x-amz-meta- headers and reported as Record.Metadata;
+// AppendWithMetadata adds to it per record. Keys are lower-cased, as S3
+// returns them, and must be letters, digits, '-', '_' or '.', without the
+// "dal-" prefix this package uses; values must be printable ASCII, and the
+// whole set at most 1920 bytes.
+func WithObjectMetadata(metadata map[string]string) Option {
+	return func(w *S3DAL) error {
+		normalized, err := normalizeMetadata(metadata)
+		if err != nil {
+			return err
+		}
+		w.metadata = normalized
+		return nil
+	}
+}
+
+// WithTimestamps stores the time of each Append in its record header, from the
+// DAL's clock in Unix nanoseconds and strictly increasing per client, and
+// reports it as Record.CreatedAt. Records written with it cannot be read by
+// versions of this package that predate the field.
+func WithTimestamps() Option {
+	return func(w *S3DAL) error {
+		w.timestamps = true
+		return nil
+	}
+}
+
+// WithReadRetry makes Read and ReadStream try a missing record up to attempts
+// times, waiting backoff before the first retry and doubling it each time, for
+// S3-compatible stores that can briefly miss an object just after it was
+// written. Only a missing key is retried; a corrupt record fails at once. The
+// default is a single attempt.
+func WithReadRetry(attempts int, backoff time.Duration) Option {
+	return func(w *S3DAL) error {
+		if attempts < 1 {
+			return fmt.Errorf("invalid read attempts %d: must be at least 1", attempts)
+		}
+		if backoff < 0 {
+			return fmt.Errorf("invalid read backoff %v: must not be negative", backoff)
+		}
+		w.readAttempts = attempts
+		w.readBackoff = backoff
+		return nil
+	}
+}
+
+// WithShards spreads records over n sub-prefixes, storing offset o at
+// prefix/shard-XX/<o> with XX = o % n, so writes are not throttled by S3's
+// per-prefix request rate. Reads of a known offset cost the same, but every
+// listing, as done by Scan, ScanPage, Count, the trims and the LastRecord
+// fallback, lists all n shards and merges them, so a scan costs n list calls
+// at its start. The shard count is part of the key layout: a log must always
+// be opened with the same n, and by clients that all use it. n must be
+// between 2 and 100.
+func WithShards(n int) Option {
+	return func(w *S3DAL) error {
+		if n < 2 || n > maxShards {
+			return fmt.Errorf("invalid shard count %d: must be between 2 and %d", n, maxShards)
+		}
+		w.shards = n
+		return nil
+	}
+}
+
+// WithPacking makes a packed log, which stores up to records records per
+// object instead of one, for high rates of small records. Append buffers
+// records and writes them as one pack when records are buffered or their data
+// reaches 8 MiB, or on Flush or Close; until then they are readable through
+// this client only and are lost if the process exits. Read finds a record's pack with one list.
+//
+// Packs are a different object format: a log must be written and read with
+// packing throughout, and a reader without it fails on packs with ErrBadMagic.
+// Operations that address records one object each, such as Scan, Count, the
+// trims and AppendBatch, fail with ErrPackedLog, while BatchAppend writes its
+// batch as packs. records must be 2 to 1000.
+func WithPacking(records int) Option {
+	return func(w *S3DAL) error {
+		if records < 2 || records > maxPackRecords {
+			return fmt.Errorf("invalid packing %d: must be 2 to %d records", records, maxPackRecords)
+		}
+		w.packRecords = records
+		return nil
+	}
+}
+
+// WithClientEncryption seals the payload of every new record with aead, such
+// as AES-GCM from crypto/cipher, before it is written, and registers it to
+// open records sealed under keyID. The key ID is stored in each record so keys
+// can be rotated: register retired keys with WithDecryptionKey. Each record
+// gets a random nonce, so one key should seal no more than 2^32 records with
+// a 96-bit nonce.
+//
+// Offsets, creation times and the checksum stay readable without the key; the
+// checksum covers the ciphertext. Export and ExportSnapshot write decrypted
+// data. Not supported with AppendReader or WithPacking.
+func WithClientEncryption(keyID uint32, aead cipher.AEAD) Option {
+	return func(w *S3DAL) error {
+		if err := w.keys.add(keyID, aead); err != nil {
+			return err
+		}
+		w.encryptKeyID, w.encrypt = keyID, true
+		return nil
+	}
+}
+
+// WithDecryptionKey registers aead to open records sealed under keyID without
+// sealing new records with it.
+func WithDecryptionKey(keyID uint32, aead cipher.AEAD) Option {
+	return func(w *S3DAL) error {
+		return w.keys.add(keyID, aead)
+	}
+}
+
+// WithOperationTimeout bounds every S3 request with timeout, so a stalled
+// request fails with context.DeadlineExceeded even if the caller's context
+// has no deadline. A caller deadline that is already tighter is left as is.
+// Under WithRateLimit it bounds each attempt, not the retries.
+func WithOperationTimeout(timeout time.Duration) Option {
+	return func(w *S3DAL) error {
+		if timeout <= 0 {
+			return fmt.Errorf("invalid operation timeout %v: must be positive", timeout)
+		}
+		w.opTimeout = timeout
+		return nil
+	}
+}
+
+// WithRetryPolicy retries GetObject, PutObject, ListObjectsV2 and HeadObject
+// requests that fail transiently, with throttling, a 5xx or a network error,
+// up to attempts tries in all, waiting backoff(n) before retry n. Permanent
+// failures, such as a missing key, a conditional write conflict or a denied
+// request, are returned at once, and no retry is made once the request's
+// context is done. Under WithRateLimit each retry waits for the limiter, and
+// under WithOperationTimeout each attempt has its own timeout.
+//
+// A put whose failed attempt reached S3 anyway is seen by its retry as taken,
+// so an Append can fail with ErrOffsetConflict for a record it wrote; Read the
+// offset to tell.
+func WithRetryPolicy(attempts int, backoff Backoff) Option {
+	return func(w *S3DAL) error {
+		if attempts < 1 {
+			return fmt.Errorf("invalid retry attempts %d: must be at least 1", attempts)
+		}
+		if backoff == nil {
+			return fmt.Errorf("invalid retry policy: backoff is nil")
+		}
+		w.retryAttempts = attempts
+		w.retryBackoff = backoff
+		return nil
+	}
+}
+
+// WithRateLimit throttles every S3 request the DAL makes to rps a second, with
+// bursts of up to burst, waiting for capacity unless the request's context is
+// done first. Requests S3 still answers with 503 SlowDown are retried up to 5
+// times, with a backoff starting at 50ms and doubling. The limit is per S3DAL,
+// shared by its primary and WithReadFallback buckets; clients sharing a prefix
+// each get their own.
+func WithRateLimit(rps int, burst int) Option {
+	return func(w *S3DAL) error {
+		if rps <= 0 {
+			return fmt.Errorf("invalid rate limit %d: must be positive", rps)
+		}
+		if burst <= 0 {
+			return fmt.Errorf("invalid rate limit burst %d: must be positive", burst)
+		}
+		w.limiter = newRateLimiter(rps, burst)
+		return nil
+	}
+}
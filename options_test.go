@@ -0,0 +1,252 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestOptionsRejectInvalidValues(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"file size limit":   WithFileSizeLimit(0),
+		"stored size limit": WithStoredSizeLimit(0),
+		"key width":         WithKeyWidth(defaultKeyWidth - 1),
+		"storage class":     WithStorageClass("NOT_A_CLASS"),
+		"KMS key":           WithSSEKMS(""),
+		"multipart":         WithMultipartThreshold(minMultipartThreshold - 1),
+		"max record size":   WithMaxRecordSize(0),
+		"read attempts":     WithReadRetry(0, time.Millisecond),
+		"read backoff":      WithReadRetry(2, -time.Millisecond),
+	} {
+		if _, err := New(newFakeS3(), "fake-bucket", "fake-prefix", opt); err == nil {
+			t.Errorf("expected %s option to be rejected", name)
+		}
+	}
+}
+
+func TestWithFileSizeLimit(t *testing.T) {
+	wal, _ := newFakeDAL(t, WithFileSizeLimit(100))
+	ctx := context.Background()
+
+	// 100 appends of one byte each fill the limit exactly
+	for i := 0; i < 100; i++ {
+		if _, err := wal.Append(ctx, []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to append record %d within the configured limit: %v", i, err)
+		}
+	}
+	if _, err := wal.Append(ctx, []byte{0}); err == nil {
+		t.Fatal("expected the configured limit to reject the 101st byte")
+	}
+	if _, err := wal.AppendBatch(ctx, [][]byte{{0}}); err == nil {
+		t.Fatal("expected the configured limit to apply to batches too")
+	}
+	if wal.length != 100 || wal.size != 100 {
+		t.Errorf("expected length 100 and size 100, got %d and %d", wal.length, wal.size)
+	}
+
+	// the deprecated per-call limit overrides the configured one for that call
+	if _, err := wal.AppendWithLimit(ctx, []byte{0}, 101); err != nil {
+		t.Fatalf("expected the per-call limit to allow one more byte: %v", err)
+	}
+	if _, err := wal.Append(ctx, []byte{0}); err == nil {
+		t.Error("expected the configured limit to apply again after the override")
+	}
+}
+
+func TestWithKeyWidth(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithKeyWidth(24))
+	ctx := context.Background()
+
+	offset, err := wal.Append(ctx, []byte("wide"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if _, ok := fake.objects["fake-prefix/000000000000000000000001"]; !ok {
+		t.Errorf("expected a 24-digit key, got %v", fake.objects)
+	}
+	record, err := wal.LastRecord(ctx)
+	if err != nil {
+		t.Fatalf("failed to get last record: %v", err)
+	}
+	if record.Offset != offset {
+		t.Errorf("expected last offset %d, got %d", offset, record.Offset)
+	}
+}
+
+func TestWithStorageClass(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithStorageClass(types.StorageClassStandardIa))
+
+	if _, err := wal.Append(context.Background(), []byte("cold")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if fake.lastPut.StorageClass != types.StorageClassStandardIa {
+		t.Errorf("expected storage class %q, got %q", types.StorageClassStandardIa, fake.lastPut.StorageClass)
+	}
+}
+
+func TestWithStorageClassListsKnownClasses(t *testing.T) {
+	_, err := New(newFakeS3(), "fake-bucket", "fake-prefix", WithStorageClass("standard-ia"))
+	if err == nil || !strings.Contains(err.Error(), string(types.StorageClassIntelligentTiering)) {
+		t.Errorf("expected the error to list the known storage classes, got %v", err)
+	}
+}
+
+func TestWithSSE(t *testing.T) {
+	ctx := context.Background()
+
+	kms, fake := newFakeDAL(t, WithSSEKMS("alias/wal"))
+	if _, err := kms.Append(ctx, []byte("secret")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if fake.lastPut.ServerSideEncryption != types.ServerSideEncryptionAwsKms {
+		t.Errorf("expected SSE %q, got %q", types.ServerSideEncryptionAwsKms, fake.lastPut.ServerSideEncryption)
+	}
+	if got := aws.ToString(fake.lastPut.SSEKMSKeyId); got != "alias/wal" {
+		t.Errorf("expected KMS key %q, got %q", "alias/wal", got)
+	}
+	if err := kms.PersistLength(ctx); err != nil {
+		t.Fatalf("failed to persist length: %v", err)
+	}
+	if fake.lastPut.ServerSideEncryption != types.ServerSideEncryptionAwsKms {
+		t.Errorf("expected the tail hint to be encrypted too, got %q", fake.lastPut.ServerSideEncryption)
+	}
+
+	managed, fake := newFakeDAL(t, WithSSES3())
+	if _, err := managed.Append(ctx, []byte("secret")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if fake.lastPut.ServerSideEncryption != types.ServerSideEncryptionAes256 || fake.lastPut.SSEKMSKeyId != nil {
+		t.Errorf("expected SSE-S3 without a key, got %q, %v", fake.lastPut.ServerSideEncryption, fake.lastPut.SSEKMSKeyId)
+	}
+}
+
+func TestWithBucketKeyEnabled(t *testing.T) {
+	ctx := context.Background()
+
+	wal, fake := newFakeDAL(t, WithSSEKMS("alias/wal"), WithBucketKeyEnabled(true), WithMultipartThreshold(minMultipartThreshold))
+	if _, err := wal.Append(ctx, []byte("secret")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if got := fake.lastPut.BucketKeyEnabled; got == nil || !*got {
+		t.Errorf("expected the put to enable the bucket key, got %v", got)
+	}
+	if _, err := wal.Append(ctx, make([]byte, minMultipartThreshold)); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if got := fake.lastCreate.BucketKeyEnabled; got == nil || !*got {
+		t.Errorf("expected the multipart upload to enable the bucket key, got %v", got)
+	}
+
+	disabled, fake := newFakeDAL(t, WithSSEKMS("alias/wal"), WithBucketKeyEnabled(false))
+	if _, err := disabled.Append(ctx, []byte("secret")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if got := fake.lastPut.BucketKeyEnabled; got == nil || *got {
+		t.Errorf("expected the put to disable the bucket key, got %v", got)
+	}
+
+	for name, opts := range map[string][]Option{
+		"without SSE": {WithBucketKeyEnabled(true)},
+		"with SSE-S3": {WithSSES3(), WithBucketKeyEnabled(true)},
+	} {
+		if _, err := New(fake, "fake-bucket", "fake-prefix", opts...); err == nil {
+			t.Errorf("%s: expected the bucket key to be rejected", name)
+		}
+	}
+}
+
+func TestAccessDeniedMentionsSSE(t *testing.T) {
+	denied := &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}
+
+	plain, fake := newFakeDAL(t)
+	fake.putErr = denied
+	_, err := plain.Append(context.Background(), []byte("rejected"))
+	if err == nil || !strings.Contains(err.Error(), "WithSSEKMS") {
+		t.Errorf("expected the error to suggest configuring encryption, got %v", err)
+	}
+
+	kms, fake := newFakeDAL(t, WithSSEKMS("alias/wal"))
+	fake.putErr = denied
+	_, err = kms.Append(context.Background(), []byte("rejected"))
+	if err == nil || !strings.Contains(err.Error(), "alias/wal") {
+		t.Errorf("expected the error to name the KMS key, got %v", err)
+	}
+}
+
+func TestWithMaxRecordSize(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithMaxRecordSize(10))
+	ctx := context.Background()
+
+	if _, err := wal.Append(ctx, make([]byte, 11)); !errors.Is(err, ErrRecordTooLarge) {
+		t.Fatalf("expected ErrRecordTooLarge, got %v", err)
+	}
+	if fake.putCalls != 0 || wal.Length() != 0 {
+		t.Errorf("expected nothing written, got %d puts and length %d", fake.putCalls, wal.Length())
+	}
+	if _, err := wal.Append(ctx, make([]byte, 10)); err != nil {
+		t.Errorf("expected a record at the limit to be accepted, got %v", err)
+	}
+	// empty records are allowed
+	if _, err := wal.Append(ctx, nil); err != nil {
+		t.Errorf("expected an empty record to be accepted, got %v", err)
+	}
+
+	written, err := wal.AppendBatch(ctx, [][]byte{[]byte("ok"), make([]byte, 11), []byte("after")})
+	if !errors.Is(err, ErrRecordTooLarge) {
+		t.Fatalf("expected the batch to fail with ErrRecordTooLarge, got %v", err)
+	}
+	if len(written) != 1 {
+		t.Errorf("expected only the record before the oversized one written, got %v", written)
+	}
+}
+
+func TestWithReadRetry(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithReadRetry(3, time.Millisecond))
+	ctx := context.Background()
+
+	offset, err := wal.Append(ctx, []byte("eventually visible"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	key := wal.getObjectKey(offset)
+
+	fake.getMisses = map[string]int{key: 1}
+	fake.getCalls = 0
+	if record, err := wal.Read(ctx, offset); err != nil || string(record.Data) != "eventually visible" {
+		t.Fatalf("expected the retry to find the record, got %q, %v", record.Data, err)
+	}
+	if fake.getCalls != 2 {
+		t.Errorf("expected 2 gets, got %d", fake.getCalls)
+	}
+
+	fake.getMisses[key] = 3
+	fake.getCalls = 0
+	if _, err := wal.Read(ctx, offset); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound once attempts run out, got %v", err)
+	}
+	if fake.getCalls != 3 {
+		t.Errorf("expected 3 gets, got %d", fake.getCalls)
+	}
+
+	// corruption is permanent and not retried
+	obj := fake.objects[key]
+	obj.body[len(obj.body)-3] ^= 0xFF
+	fake.getCalls = 0
+	if _, err := wal.Read(ctx, offset); !errors.Is(err, ErrChecksumMismatch) || fake.getCalls != 1 {
+		t.Errorf("expected a single get failing with ErrChecksumMismatch, got %d gets and %v", fake.getCalls, err)
+	}
+
+	slow, fake := newFakeDAL(t, WithReadRetry(5, time.Hour))
+	fake.getMisses = map[string]int{slow.getObjectKey(1): 1}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := slow.Read(cancelled, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the backoff to stop on cancellation, got %v", err)
+	}
+}
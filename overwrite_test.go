@@ -0,0 +1,108 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// writeAt appends data through a second client on the same bucket, as another
+// writer or an earlier attempt would have, and returns its offset.
+func writeAt(t *testing.T, fake *fakeS3, data string) uint64 {
+	t.Helper()
+	other, err := New(fake, "fake-bucket", "fake-prefix")
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	if _, err := other.LoadLength(context.Background()); err != nil && !errors.Is(err, ErrEmptyLog) {
+		t.Fatalf("failed to load length: %v", err)
+	}
+	offset, err := other.Append(context.Background(), []byte(data))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	return offset
+}
+
+func TestOverwriteNever(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	writeAt(t, fake, "theirs")
+	if _, err := wal.Append(context.Background(), []byte("theirs")); !errors.Is(err, ErrOffsetConflict) {
+		t.Errorf("expected ErrOffsetConflict by default, even for the same data, got %v", err)
+	}
+}
+
+func TestOverwriteAlways(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithOverwritePolicy(OverwriteAlways))
+	ctx := context.Background()
+	writeAt(t, fake, "old")
+	offset, err := wal.Append(ctx, []byte("imported"))
+	if err != nil || offset != 1 {
+		t.Fatalf("expected the import to replace offset 1, got %d, %v", offset, err)
+	}
+	if fake.lastPut.IfNoneMatch != nil {
+		t.Errorf("expected no If-None-Match, got %q", *fake.lastPut.IfNoneMatch)
+	}
+	if record, err := wal.Read(ctx, 1); err != nil || string(record.Data) != "imported" {
+		t.Errorf("expected the imported record, got %q, %v", record.Data, err)
+	}
+	if _, err := wal.AppendAt(ctx, 1, []byte("cas")); err == nil {
+		t.Error("expected AppendAt to be refused without the guard")
+	}
+
+	// an idempotent append from a client behind the tail keeps the guard
+	behind, err := New(fake, wal.bucketName, wal.prefix, WithOverwritePolicy(OverwriteAlways))
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	if offset, _, err := behind.AppendIdempotent(ctx, "request-1", []byte("idempotent")); err != nil || offset != 2 {
+		t.Errorf("expected the idempotent append to move past offset 1, got %d, %v", offset, err)
+	}
+	if record, err := wal.Read(ctx, 1); err != nil || string(record.Data) != "imported" {
+		t.Errorf("expected offset 1 left alone, got %q, %v", record.Data, err)
+	}
+}
+
+func TestOverwriteIfSame(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithOverwritePolicy(OverwriteIfSame), WithCompression(CompressionGzip))
+	ctx := context.Background()
+
+	// a retry finding its own earlier write
+	writeAt(t, fake, "retried")
+	offset, err := wal.Append(ctx, []byte("retried"))
+	if err != nil || offset != 1 {
+		t.Fatalf("expected the identical record kept at offset 1, got %d, %v", offset, err)
+	}
+	if fake.lastPut.IfNoneMatch == nil {
+		t.Error("expected the put to keep its If-None-Match guard")
+	}
+
+	// a record that differs is still a conflict
+	writeAt(t, fake, "theirs")
+	_, err = wal.Append(ctx, []byte("mine"))
+	if !errors.Is(err, ErrOffsetConflict) {
+		t.Fatalf("expected ErrOffsetConflict for different data, got %v", err)
+	}
+	if record, err := wal.Read(ctx, 2); err != nil || string(record.Data) != "theirs" {
+		t.Errorf("expected the existing record left alone, got %q, %v", record.Data, err)
+	}
+
+	// batches compare record by record
+	if _, err := wal.LoadLength(ctx); err != nil {
+		t.Fatalf("failed to load length: %v", err)
+	}
+	writeAt(t, fake, "batched")
+	if offsets, err := wal.AppendBatch(ctx, [][]byte{[]byte("batched"), []byte("new")}); err != nil || len(offsets) != 2 || offsets[0] != 3 {
+		t.Errorf("expected the batch to keep offset 3 and write 4, got %v, %v", offsets, err)
+	}
+}
+
+func TestOverwritePolicyInvalid(t *testing.T) {
+	fake := newFakeS3()
+	if _, err := New(fake, "fake-bucket", "fake-prefix", WithOverwritePolicy(OverwritePolicy(7))); err == nil {
+		t.Error("expected an unknown policy to be rejected")
+	}
+	if _, err := New(fake, "fake-bucket", "fake-prefix", WithPacking(4), WithOverwritePolicy(OverwriteIfSame)); err == nil {
+		t.Error("expected OverwriteIfSame to be rejected with packing")
+	}
+}
@@ -0,0 +1,301 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// A packed log, selected with WithPacking, stores many records per object.
+// Each pack is keyed by the offset of its first record and framed as
+//
+//	[2-byte magic "SP"][1-byte version][entry]...[entry]
+//
+// where each entry is a big-endian uint32 data length, the big-endian uint64
+// offset, the data and a CRC16 over the offset and data. A pack's offsets are
+// consecutive and a pack holds at most maxPackRecords of them, so the pack
+// holding an offset is the last key at or below it among the maxPackRecords
+// keys before it, found with a single list.
+const (
+	packMagic0    byte = 'S'
+	packMagic1    byte = 'P'
+	packVersion   byte = 1
+	packHeaderLen      = 3
+	packEntryLen       = 4 + 8 + 2
+
+	maxPackRecords = 1000
+	// packFlushBytes flushes a pack early once its data reaches this size
+	packFlushBytes = 8 << 20
+)
+
+// ErrPackedLog is returned by operations that address records as one object
+// each, such as Scan, Count, the trims, ReadStream, Exists, AppendBatch and
+// Reserve, when called on a packed log.
+var ErrPackedLog = errors.New("operation not supported on a packed log")
+
+// packEntry is a record waiting in the pack buffer.
+type packEntry struct {
+	offset uint64
+	data   []byte
+}
+
+// validatePacking rejects options a packed log cannot honour: entries are
+// uncompressed, unencrypted, untimed and CRC16-checked, and packs are not
+// sharded, compacted or tracked in a manifest.
+func (w *S3DAL) validatePacking() error {
+	switch {
+	case w.shards > 0:
+		return fmt.Errorf("invalid packing: not supported with WithShards")
+	case w.manifest:
+		return fmt.Errorf("invalid packing: not supported with WithManifest")
+	case w.compression != CompressionNone:
+		return fmt.Errorf("invalid packing: not supported with WithCompression")
+	case w.checksum != ChecksumCRC16:
+		return fmt.Errorf("invalid packing: entries are always checked with %s", ChecksumCRC16)
+	case w.skipCRC, w.timestamps, w.atomicBatch:
+		return fmt.Errorf("invalid packing: not supported with WithSkipCRCOnWrite, WithTimestamps or WithAtomicBatch")
+	case len(w.keys) > 0:
+		return fmt.Errorf("invalid packing: not supported with WithClientEncryption")
+	case w.compaction:
+		return fmt.Errorf("invalid packing: packs are dense already, WithCompaction is not supported")
+	case len(w.fallbacks) > 0:
+		return fmt.Errorf("invalid packing: not supported with WithReadFallback")
+	case w.keyVersion > 1:
+		return fmt.Errorf("invalid packing: not supported with WithKeyVersion")
+	case w.cache != nil:
+		return fmt.Errorf("invalid packing: not supported with WithReadCache")
+	case w.overwrite == OverwriteIfSame:
+		return fmt.Errorf("invalid packing: not supported with OverwriteIfSame")
+	case w.async != nil:
+		return fmt.Errorf("invalid packing: not supported with WithAppendBuffer")
+	}
+	return nil
+}
+
+// bufferRecord adds the record at offset to the pack buffer and writes the
+// pack once it is full. If that write fails the record is taken back out, so
+// the append fails without effect; the records before it stay buffered for
+// the next write unless another writer took the pack's key, in which case
+// they are dropped. The caller holds mu.
+func (w *S3DAL) bufferRecord(ctx context.Context, offset uint64, data []byte) error {
+	w.pending = append(w.pending, packEntry{offset: offset, data: bytes.Clone(data)})
+	w.pendingBytes += len(data)
+	if len(w.pending) < w.packRecords && w.pendingBytes < packFlushBytes {
+		return nil
+	}
+	if err := w.flushPack(ctx); err != nil {
+		if !errors.Is(err, ErrOffsetConflict) {
+			w.pending = w.pending[:len(w.pending)-1]
+			w.pendingBytes -= len(data)
+		}
+		return err
+	}
+	return nil
+}
+
+// flushPack writes the pack buffer as one object keyed by its first offset,
+// with the same If-None-Match guard as a single record. The buffer is kept if
+// the write fails, unless the key was taken. The caller holds mu.
+func (w *S3DAL) flushPack(ctx context.Context) error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	if err := w.checkFence(ctx); err != nil {
+		return err
+	}
+	first := w.pending[0].offset
+	if _, err := w.client.PutObject(ctx, w.putInput(first, encodePack(w.pending))); err != nil {
+		err = w.putRecordError(first, err)
+		if errors.Is(err, ErrOffsetConflict) {
+			w.pending, w.pendingBytes = nil, 0
+		}
+		return err
+	}
+	w.pending, w.pendingBytes = nil, 0
+	return nil
+}
+
+func encodePack(entries []packEntry) []byte {
+	size := packHeaderLen
+	for _, e := range entries {
+		size += packEntryLen + len(e.data)
+	}
+	buf := make([]byte, 0, size)
+	buf = append(buf, packMagic0, packMagic1, packVersion)
+	for _, e := range entries {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(e.data)))
+		start := len(buf)
+		buf = binary.BigEndian.AppendUint64(buf, e.offset)
+		buf = append(buf, e.data...)
+		buf = binary.BigEndian.AppendUint16(buf, crc16Fast(buf[start:]))
+	}
+	return buf
+}
+
+// findPackEntry returns the data of the entry for offset in a pack body,
+// checking the CRC of that entry only. ok is false if the pack does not hold
+// offset.
+func findPackEntry(body []byte, offset uint64) (data []byte, ok bool, err error) {
+	if len(body) < packHeaderLen || body[0] != packMagic0 || body[1] != packMagic1 {
+		return nil, false, ErrBadMagic
+	}
+	if body[2] != packVersion {
+		return nil, false, fmt.Errorf("%w: %d", ErrUnsupportedVersion, body[2])
+	}
+	for rest := body[packHeaderLen:]; len(rest) > 0; {
+		if len(rest) < packEntryLen {
+			return nil, false, ErrRecordTooShort
+		}
+		n := uint64(binary.BigEndian.Uint32(rest))
+		if n > uint64(len(rest)-packEntryLen) {
+			return nil, false, ErrRecordTooShort
+		}
+		entry := rest[4 : packEntryLen+n]
+		if binary.BigEndian.Uint64(entry) == offset {
+			if !validateChecksum(entry, ChecksumCRC16, nopLogger{}) {
+				return nil, false, ErrChecksumMismatch
+			}
+			return entry[8 : 8+n], true, nil
+		}
+		rest = rest[packEntryLen+n:]
+	}
+	return nil, false, nil
+}
+
+// lastPackEntry returns the offset of the last entry in a pack body.
+func lastPackEntry(body []byte) (uint64, error) {
+	if len(body) < packHeaderLen || body[0] != packMagic0 || body[1] != packMagic1 {
+		return 0, ErrBadMagic
+	}
+	var last uint64
+	for rest := body[packHeaderLen:]; len(rest) > 0; {
+		if len(rest) < packEntryLen {
+			return 0, ErrRecordTooShort
+		}
+		n := uint64(binary.BigEndian.Uint32(rest))
+		if n > uint64(len(rest)-packEntryLen) {
+			return 0, ErrRecordTooShort
+		}
+		last = binary.BigEndian.Uint64(rest[4:])
+		rest = rest[packEntryLen+n:]
+	}
+	if last == 0 {
+		return 0, ErrRecordTooShort
+	}
+	return last, nil
+}
+
+// readPacked reads the record at offset from the buffer, or from the pack
+// holding it.
+func (w *S3DAL) readPacked(ctx context.Context, offset uint64) (Record, error) {
+	if w.lifetime.Err() != nil {
+		return Record{}, ErrClosed
+	}
+	w.mu.Lock()
+	for _, e := range w.pending {
+		if e.offset == offset {
+			w.mu.Unlock()
+			return Record{Offset: offset, Data: bytes.Clone(e.data)}, nil
+		}
+	}
+	w.mu.Unlock()
+
+	key, err := w.packKeyFor(ctx, offset)
+	if err != nil {
+		return Record{}, err
+	}
+	if key == "" {
+		return Record{}, fmt.Errorf("%w: offset %d", ErrRecordNotFound, offset)
+	}
+	result, err := w.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return Record{}, getRecordError(offset, err)
+	}
+	defer result.Body.Close()
+	body, err := io.ReadAll(result.Body)
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to read object body: %w", err)
+	}
+	data, ok, err := findPackEntry(body, offset)
+	if err != nil {
+		return Record{}, fmt.Errorf("%w: offset %d in pack %s", err, offset, key)
+	}
+	if !ok {
+		return Record{}, fmt.Errorf("%w: offset %d", ErrRecordNotFound, offset)
+	}
+	return Record{
+		Offset:       offset,
+		Data:         data,
+		ETag:         aws.ToString(result.ETag),
+		Size:         aws.ToInt64(result.ContentLength),
+		LastModified: aws.ToTime(result.LastModified),
+	}, nil
+}
+
+// packKeyFor returns the key of the only pack that can hold offset, or ""
+// if there is none.
+func (w *S3DAL) packKeyFor(ctx context.Context, offset uint64) (string, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(w.bucketName),
+		Prefix:  aws.String(w.keyPrefix()),
+		MaxKeys: aws.Int32(maxPackRecords),
+	}
+	if offset > maxPackRecords {
+		input.StartAfter = aws.String(w.getObjectKey(offset - maxPackRecords))
+	}
+	output, err := w.client.ListObjectsV2(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("failed to list objects from S3: %w", err)
+	}
+	want := w.getObjectKey(offset)
+	var key string
+	for _, obj := range output.Contents {
+		if aws.ToString(obj.Key) > want {
+			break
+		}
+		key = aws.ToString(obj.Key)
+	}
+	return key, nil
+}
+
+// lastPackedOffset returns the offset of the last entry of the last pack, or
+// ErrEmptyLog if there are no packs.
+func (w *S3DAL) lastPackedOffset(ctx context.Context) (uint64, error) {
+	paginator := s3.NewListObjectsV2Paginator(w.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(w.bucketName),
+		Prefix: aws.String(w.keyPrefix()),
+	})
+	var key string
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list objects from S3: %w", err)
+		}
+		for _, obj := range output.Contents {
+			if _, err := w.getOffsetFromKey(aws.ToString(obj.Key)); err == nil {
+				key = aws.ToString(obj.Key)
+			}
+		}
+	}
+	if key == "" {
+		return 0, ErrEmptyLog
+	}
+	body, err := w.getRange(ctx, key, "")
+	if err != nil {
+		return 0, err
+	}
+	last, err := lastPackEntry(body)
+	if err != nil {
+		return 0, fmt.Errorf("%w: pack %s", err, key)
+	}
+	return last, nil
+}
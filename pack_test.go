@@ -0,0 +1,154 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestPacking(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithPacking(4))
+	ctx := context.Background()
+
+	for i := 1; i <= 10; i++ {
+		if _, err := wal.Append(ctx, []byte(fmt.Sprintf("record %d", i))); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	if fake.putCalls != 2 || len(fake.objects) != 2 {
+		t.Fatalf("expected 2 packs of 4 written, got %d puts, %d objects", fake.putCalls, len(fake.objects))
+	}
+	if _, ok := fake.objects[wal.getObjectKey(5)]; !ok {
+		t.Error("expected the second pack keyed by its first offset")
+	}
+	// the buffered records are readable through the writer
+	for offset := uint64(1); offset <= 10; offset++ {
+		record, err := wal.Read(ctx, offset)
+		if want := fmt.Sprintf("record %d", offset); err != nil || string(record.Data) != want {
+			t.Errorf("offset %d: expected %q, got %q, %v", offset, want, record.Data, err)
+		}
+	}
+
+	reader, err := OpenS3DAL(ctx, fake, wal.bucketName, wal.prefix, WithPacking(4))
+	if err != nil {
+		t.Fatalf("failed to open packed log: %v", err)
+	}
+	if reader.Length() != 8 {
+		t.Errorf("expected a fresh client to see 8 written records, got %d", reader.Length())
+	}
+	if _, err := reader.Read(ctx, 9); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected a buffered record to be missing elsewhere, got %v", err)
+	}
+	if record, err := reader.LastRecord(ctx); err != nil || record.Offset != 8 {
+		t.Errorf("expected the last record 8, got %d, %v", record.Offset, err)
+	}
+
+	plain := S3DALClient(fake, wal.bucketName, wal.prefix)
+	if _, err := plain.Read(ctx, 1); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("expected a reader without packing to reject a pack, got %v", err)
+	}
+	if _, err := reader.Count(ctx); !errors.Is(err, ErrPackedLog) {
+		t.Errorf("expected Count to fail with ErrPackedLog, got %v", err)
+	}
+
+	obj := fake.objects[wal.getObjectKey(5)]
+	obj.body[len(obj.body)-1] ^= 0xFF
+	if _, err := reader.Read(ctx, 8); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected a damaged entry to fail its checksum, got %v", err)
+	}
+	if _, err := reader.Read(ctx, 6); err != nil {
+		t.Errorf("expected the other entries of the pack to still read, got %v", err)
+	}
+}
+
+func TestPackingFailedFlush(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithPacking(3))
+	ctx := context.Background()
+
+	for i := 1; i <= 2; i++ {
+		if _, err := wal.Append(ctx, []byte(fmt.Sprintf("record %d", i))); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	fake.putErr = errors.New("network down")
+	if _, err := wal.Append(ctx, []byte("record 3")); err == nil {
+		t.Fatal("expected the append that fills the pack to fail")
+	}
+	if wal.Length() != 2 {
+		t.Errorf("expected the failed append to take no offset, got length %d", wal.Length())
+	}
+
+	fake.putErr = nil
+	if offset, err := wal.Append(ctx, []byte("record 3")); err != nil || offset != 3 {
+		t.Fatalf("expected the retry to take offset 3, got %d, %v", offset, err)
+	}
+	reader, err := New(fake, wal.bucketName, wal.prefix, WithPacking(3))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	for offset := uint64(1); offset <= 3; offset++ {
+		if _, err := reader.Read(ctx, offset); err != nil {
+			t.Errorf("offset %d: expected the pack to hold it, got %v", offset, err)
+		}
+	}
+
+	if _, err := New(fake, wal.bucketName, wal.prefix, WithPacking(3), WithCompression(CompressionGzip)); err == nil {
+		t.Error("expected packing with compression to be rejected")
+	}
+	if _, err := New(fake, wal.bucketName, wal.prefix, WithPacking(maxPackRecords+1)); err == nil {
+		t.Error("expected more than the pack limit to be rejected")
+	}
+}
+
+func TestFlush(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithPacking(10))
+	ctx := context.Background()
+	fresh := func() *S3DAL {
+		reader, err := OpenS3DAL(ctx, fake, wal.bucketName, wal.prefix, WithPacking(10))
+		if err != nil && !errors.Is(err, ErrEmptyLog) {
+			t.Fatalf("failed to open reader: %v", err)
+		}
+		return reader
+	}
+
+	for i := 1; i <= 3; i++ {
+		if _, err := wal.Append(ctx, []byte(fmt.Sprintf("record %d", i))); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	if fake.putCalls != 0 || fresh().Length() != 0 {
+		t.Fatalf("expected the records to be buffered, got %d puts", fake.putCalls)
+	}
+	if err := wal.Flush(ctx); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+	reader := fresh()
+	for offset := uint64(1); offset <= 3; offset++ {
+		if _, err := reader.Read(ctx, offset); err != nil {
+			t.Errorf("offset %d: expected it durable after Flush, got %v", offset, err)
+		}
+	}
+	if err := wal.Flush(ctx); err != nil || fake.putCalls != 1 {
+		t.Errorf("expected an empty flush to write nothing, got %d puts, %v", fake.putCalls, err)
+	}
+
+	if _, err := wal.Append(ctx, []byte("record 4")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if record, err := fresh().Read(ctx, 4); err != nil || string(record.Data) != "record 4" {
+		t.Errorf("expected Close to flush record 4, got %q, %v", record.Data, err)
+	}
+	if err := wal.Flush(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed after Close, got %v", err)
+	}
+
+	// without packing every append is already durable
+	plain, _ := newFakeDAL(t)
+	if err := plain.Flush(ctx); err != nil {
+		t.Errorf("expected Flush to be a no-op, got %v", err)
+	}
+}
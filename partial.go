@@ -0,0 +1,108 @@
+package s3_dal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ReadPartial returns up to length bytes of the payload of the record at
+// offset, starting at byte start of the payload, with ranged GETs: one for
+// the header, and one for the bytes unless the header's range already held
+// them. A range running past the end of the payload is cut short, and one
+// starting past it returns no bytes.
+//
+// The checksum covers the whole record, so the bytes returned are not
+// verified; only the header's offset is checked. Use Read when integrity
+// matters. The payload must be stored as written, so compressed and encrypted
+// records are rejected.
+func (w *S3DAL) ReadPartial(ctx context.Context, offset uint64, start, length int64) ([]byte, error) {
+	if start < 0 || length < 0 {
+		return nil, fmt.Errorf("invalid byte range: start %d, length %d", start, length)
+	}
+	if w.packRecords > 0 {
+		return nil, ErrPackedLog
+	}
+	key := w.getObjectKey(offset)
+	result, err := w.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=0-%d", maxHeaderLen-1)),
+	})
+	if err != nil {
+		return nil, getRecordError(offset, err)
+	}
+	prefix, err := io.ReadAll(result.Body)
+	result.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object body: %w", err)
+	}
+	size, ok := objectSize(result, len(prefix))
+	if !ok {
+		return nil, fmt.Errorf("failed to read size of record %d from content range %q", offset, aws.ToString(result.ContentRange))
+	}
+	f, n, err := parseHeader(prefix, w.legacyFormat)
+	if err != nil {
+		return nil, fmt.Errorf("offset %d: %w", offset, withSize(err, size))
+	}
+	if f.offset != offset {
+		return nil, offsetMismatch(offset, f.offset)
+	}
+	if f.codec != CompressionNone || f.sealed {
+		return nil, fmt.Errorf("cannot read part of record %d: its payload is compressed or encrypted", offset)
+	}
+
+	payloadLen := size - int64(n) - int64(f.checksum.Size())
+	if payloadLen < 0 {
+		return nil, fmt.Errorf("offset %d: %w", offset, withSize(ErrRecordTooShort, size))
+	}
+	if start >= payloadLen || length == 0 {
+		return []byte{}, nil
+	}
+	end := payloadLen
+	if length < payloadLen-start {
+		end = start + length
+	}
+	first, last := int64(n)+start, int64(n)+end
+	if last <= int64(len(prefix)) {
+		return prefix[first:last], nil
+	}
+
+	result, err = w.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", first, last-1)),
+	})
+	if err != nil {
+		return nil, getRecordError(offset, err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object body: %w", err)
+	}
+	if int64(len(data)) != end-start {
+		return nil, fmt.Errorf("record %d changed while reading part of it: expected %d bytes, got %d", offset, end-start, len(data))
+	}
+	return data, nil
+}
+
+// objectSize returns the size of the whole object a ranged GET of the first
+// maxHeaderLen bytes read from, got bytes of it: from the Content-Range, or
+// got itself when the range held the whole object.
+func objectSize(result *s3.GetObjectOutput, got int) (int64, bool) {
+	if _, total, ok := strings.Cut(aws.ToString(result.ContentRange), "/"); ok && total != "*" {
+		size, err := strconv.ParseInt(total, 10, 64)
+		return size, err == nil
+	}
+	if got < maxHeaderLen {
+		return int64(got), true
+	}
+	return 0, false
+}
@@ -0,0 +1,72 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestReadPartial(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	payload := make([]byte, 100)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	offset, err := wal.Append(ctx, payload)
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name          string
+		start, length int64
+		want          []byte
+		gets          int
+	}{
+		{"start", 0, 4, payload[:4], 1},
+		{"middle", 40, 10, payload[40:50], 2},
+		{"whole", 0, 100, payload, 2},
+		{"past the end", 95, 20, payload[95:], 2},
+		{"at the end", 100, 10, nil, 1},
+		{"far past the end", 500, 10, nil, 1},
+		{"empty", 10, 0, nil, 1},
+	} {
+		fake.getCalls = 0
+		data, err := wal.ReadPartial(ctx, offset, tc.start, tc.length)
+		if err != nil || !bytes.Equal(data, tc.want) {
+			t.Errorf("%s: expected %v, got %v, %v", tc.name, tc.want, data, err)
+		}
+		if fake.getCalls != tc.gets {
+			t.Errorf("%s: expected %d GETs, got %d", tc.name, tc.gets, fake.getCalls)
+		}
+	}
+
+	if _, err := wal.ReadPartial(ctx, offset+1, 0, 10); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected a missing record to be ErrRecordNotFound, got %v", err)
+	}
+	if _, err := wal.ReadPartial(ctx, offset, -1, 10); err == nil {
+		t.Error("expected a negative start to be rejected")
+	}
+
+	// the creation time lengthens the header
+	stamped, _ := newFakeDAL(t, WithTimestamps())
+	offset, err = stamped.Append(ctx, payload)
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if data, err := stamped.ReadPartial(ctx, offset, 2, 3); err != nil || !bytes.Equal(data, payload[2:5]) {
+		t.Errorf("expected bytes 2 to 5 of a timestamped record, got %v, %v", data, err)
+	}
+
+	compressed, _ := newFakeDAL(t, WithCompression(CompressionGzip))
+	offset, err = compressed.Append(ctx, payload)
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if _, err := compressed.ReadPartial(ctx, offset, 0, 10); err == nil {
+		t.Error("expected a compressed record to be rejected")
+	}
+}
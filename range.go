@@ -0,0 +1,390 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// RangeGapError reports that ReadRange found no record at Offset, the first
+// missing offset of the requested range.
+type RangeGapError struct {
+	Offset uint64
+	Err    error
+}
+
+func (e *RangeGapError) Error() string {
+	return fmt.Sprintf("record missing at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *RangeGapError) Unwrap() error { return e.Err }
+
+// ReadRange returns the records at offsets [start, end), from offset 1 if
+// start is 0, fetched concurrently (see WithReadConcurrency) and returned in
+// ascending order. The offsets to read are found by listing, so a range
+// reaching far past the tail costs no more than one ending there. Missing offsets do not abort the
+// range: the records that could be read are returned with a *RangeGapError
+// naming the first gap, which past the tail is the offset after the last
+// record. Any other failure is returned, with the records read, for the
+// lowest failing offset.
+func (w *S3DAL) ReadRange(ctx context.Context, start, end uint64) ([]Record, error) {
+	if err := checkRange(start, end); err != nil {
+		return nil, err
+	}
+	start = max(start, 1)
+
+	offsets, records, errs, err := w.readOffsets(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Record, 0, len(records))
+	var firstErr error
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	next := start
+	for i, offset := range offsets {
+		if offset > next {
+			fail(w.rangeGap(next))
+		}
+		next = offset + 1
+		switch {
+		case errs[i] == nil:
+			result = append(result, records[i])
+		case errors.Is(errs[i], ErrRecordNotFound):
+			// deleted since it was listed
+			fail(&RangeGapError{Offset: offset, Err: errs[i]})
+		default:
+			fail(errs[i])
+		}
+	}
+	if next < end {
+		fail(w.rangeGap(next))
+	}
+	return result, firstErr
+}
+
+// rangeGap is the *RangeGapError of offset, which the listing did not find.
+func (w *S3DAL) rangeGap(offset uint64) error {
+	err := fmt.Errorf("%w: offset %d is not listed", ErrRecordNotFound, offset)
+	return &RangeGapError{Offset: offset, Err: w.opError("read", offset, err)}
+}
+
+// TailRecords returns the last n records in ascending offset order: those in
+// the n offsets ending at the tail, which is found as LastRecord finds it.
+// Offsets in that window with no record, such as a trimmed prefix, are
+// skipped, so fewer than n records, or none for an empty log, are returned
+// without error. A failure to read a record that exists is returned, with the
+// records read, for the lowest failing offset.
+func (w *S3DAL) TailRecords(ctx context.Context, n int) ([]Record, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid tail count %d", n)
+	}
+	last, err := w.lastOffset(ctx)
+	if errors.Is(err, ErrEmptyLog) {
+		return []Record{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	start := uint64(1)
+	if last > uint64(n) {
+		start = last - uint64(n) + 1
+	}
+
+	_, records, errs, err := w.readOffsets(ctx, start, last+1)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Record, 0, len(records))
+	var firstErr error
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			result = append(result, records[i])
+		case errors.Is(err, ErrRecordNotFound):
+		case firstErr == nil:
+			firstErr = err
+		}
+	}
+	return result, firstErr
+}
+
+// readOffsets reads the offsets in [start, end) that hold a record,
+// concurrently, returning them with each one's record and error by position.
+// err is set if they could not be listed or ctx was done first.
+func (w *S3DAL) readOffsets(ctx context.Context, start, end uint64) (offsets []uint64, records []Record, errs []error, err error) {
+	err = w.eachOffset(ctx, start, end, func(offset uint64) (bool, error) {
+		offsets = append(offsets, offset)
+		return true, nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	records, errs, err = w.readEach(ctx, offsets)
+	return offsets, records, errs, err
+}
+
+// eachOffset calls fn for the offsets in [start, end) that hold a record, in
+// ascending order, until fn returns false. They are listed, except in a
+// packed log, whose offsets are not keys: there it is every offset up to the
+// tail.
+func (w *S3DAL) eachOffset(ctx context.Context, start, end uint64, fn func(offset uint64) (bool, error)) error {
+	start = max(start, 1)
+	if start >= end {
+		return nil
+	}
+	if w.packRecords == 0 {
+		return w.listRecords(ctx, start-1, 0, func(offset uint64, _ types.Object) (bool, error) {
+			if offset >= end {
+				return false, nil
+			}
+			return fn(offset)
+		})
+	}
+	last, err := w.lastOffset(ctx)
+	if errors.Is(err, ErrEmptyLog) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for offset := start; offset <= min(last, end-1); offset++ {
+		if more, err := fn(offset); err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// readEach reads offsets, at most WithReadConcurrency at once.
+func (w *S3DAL) readEach(ctx context.Context, offsets []uint64) (records []Record, errs []error, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	records = make([]Record, len(offsets))
+	errs = make([]error, len(offsets))
+	sem := make(chan struct{}, w.readConcurrency)
+	var wg sync.WaitGroup
+	for i, offset := range offsets {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, nil, ctx.Err()
+		}
+		wg.Add(1)
+		go func(i int, offset uint64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			records[i], errs[i] = w.Read(ctx, offset)
+		}(i, offset)
+	}
+	wg.Wait()
+	return records, errs, nil
+}
+
+// RecordResult is the outcome of reading one of the offsets passed to
+// ReadMany: the record, or the error Read returned for it.
+type RecordResult struct {
+	Record Record
+	Err    error
+}
+
+// ReadMany reads the records at offsets, in any order and with repeats, and
+// returns one result for each, in the same order. Each distinct offset is read
+// once, at most WithReadConcurrency at once, so repeats share their Record.
+// A record that cannot be read, as with a missing offset's ErrRecordNotFound,
+// fails only its own results; the error is only set if ctx was done first.
+func (w *S3DAL) ReadMany(ctx context.Context, offsets []uint64) ([]RecordResult, error) {
+	index := make(map[uint64]int, len(offsets))
+	var distinct []uint64
+	for _, offset := range offsets {
+		if _, seen := index[offset]; !seen {
+			index[offset] = len(distinct)
+			distinct = append(distinct, offset)
+		}
+	}
+	records, errs, err := w.readEach(ctx, distinct)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]RecordResult, len(offsets))
+	for i, offset := range offsets {
+		j := index[offset]
+		results[i] = RecordResult{Record: records[j], Err: errs[j]}
+	}
+	return results, nil
+}
+
+// sinceSlack is how many offsets before the one ReadSince's search lands on
+// are also checked, to catch records whose clock ran slightly behind.
+const sinceSlack = 32
+
+// ReadSince returns the records created at or after t, by the creation time
+// WithTimestamps stores, in ascending offset order. It assumes append order
+// approximates time order and that offsets are dense, as LastRecord does: the
+// first qualifying offset is found by binary search over record headers, read
+// with small ranged GETs, then the sinceSlack offsets before it and everything
+// after it up to the tail are read and filtered by time. A record stamped more
+// than sinceSlack records out of order can be missed. Records without a
+// creation time are treated as older than any t. ErrEmptyLog is returned if
+// no record qualifies; otherwise a failure to read a record that exists is
+// returned, with the records read, for the lowest failing offset.
+func (w *S3DAL) ReadSince(ctx context.Context, t time.Time) ([]Record, error) {
+	var first uint64
+	err := w.listRecords(ctx, 0, 2, func(offset uint64, _ types.Object) (bool, error) {
+		first = offset
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	last, err := w.lastOffset(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if first == 0 || first > last {
+		return nil, ErrEmptyLog
+	}
+
+	// the first offset in [first, last+1) stamped at or after t
+	since := t.UnixNano()
+	lo, hi := first, last+1
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		created, err := w.readCreated(ctx, mid)
+		if err != nil && !errors.Is(err, ErrRecordNotFound) {
+			return nil, err
+		}
+		if created != 0 && created >= since {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	start := lo - min(lo-first, sinceSlack)
+	if start > last {
+		return nil, ErrEmptyLog
+	}
+
+	_, records, errs, err := w.readOffsets(ctx, start, last+1)
+	if err != nil {
+		return nil, err
+	}
+	var result []Record
+	var firstErr error
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			if !records[i].CreatedAt.IsZero() && !records[i].CreatedAt.Before(t) {
+				result = append(result, records[i])
+			}
+		case errors.Is(err, ErrRecordNotFound):
+		case firstErr == nil:
+			firstErr = err
+		}
+	}
+	if len(result) == 0 && firstErr == nil {
+		return nil, ErrEmptyLog
+	}
+	return result, firstErr
+}
+
+// readCreated returns the creation time stored in the header of the record at
+// offset, 0 if it has none, fetching only the header.
+func (w *S3DAL) readCreated(ctx context.Context, offset uint64) (int64, error) {
+	return w.readCreatedAt(ctx, offset, w.getObjectKey(offset))
+}
+
+// readCreatedAt is readCreated for the record stored at key.
+func (w *S3DAL) readCreatedAt(ctx context.Context, offset uint64, key string) (int64, error) {
+	result, err := w.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=0-%d", maxHeaderLen-1)),
+	})
+	if err != nil {
+		return 0, getRecordError(offset, err)
+	}
+	defer result.Body.Close()
+
+	prefix, err := io.ReadAll(result.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read object body: %w", err)
+	}
+	f, _, err := parseHeader(prefix, w.legacyFormat)
+	if err != nil {
+		return 0, fmt.Errorf("offset %d: %w", offset, err)
+	}
+	if f.offset != offset {
+		return 0, offsetMismatch(offset, f.offset)
+	}
+	return f.created, nil
+}
+
+// seekWindow is how many offsets below its target ReadAtOrBefore first lists;
+// each further listing looks twice as far back.
+const seekWindow = 1000
+
+// ReadAtOrBefore returns the record at target or, if there is none, as after
+// a trim, the one at the highest offset below it, for seeking in a log with
+// holes. S3 cannot list backwards, so the offsets below target are listed in
+// windows reaching further back each time, starting seekWindow below it. It
+// returns ErrRecordNotFound if no record is at or before target. It is not
+// supported with packing.
+func (w *S3DAL) ReadAtOrBefore(ctx context.Context, target uint64) (Record, error) {
+	if w.packRecords > 0 {
+		return Record{}, ErrPackedLog
+	}
+	for offset := target; offset > 0; {
+		record, err := w.Read(ctx, offset)
+		if !errors.Is(err, ErrRecordNotFound) {
+			return record, err
+		}
+		below, ok, err := w.offsetBelow(ctx, offset)
+		if err != nil {
+			return Record{}, err
+		}
+		if !ok {
+			break
+		}
+		// the next pass reads it, or looks below it if it is gone meanwhile
+		offset = below
+	}
+	return Record{}, fmt.Errorf("%w: no record at or before offset %d", ErrRecordNotFound, target)
+}
+
+// offsetBelow returns the highest record offset below target, or false if
+// there is none.
+func (w *S3DAL) offsetBelow(ctx context.Context, target uint64) (uint64, bool, error) {
+	hi := target
+	for window := uint64(seekWindow); hi > 1; window *= 2 {
+		lo := hi - 1 - min(window, hi-1)
+		var found uint64
+		err := w.listRecords(ctx, lo, 0, func(offset uint64, _ types.Object) (bool, error) {
+			if offset >= hi {
+				return false, nil
+			}
+			found = offset
+			return true, nil
+		})
+		if err != nil {
+			return 0, false, err
+		}
+		if found > 0 {
+			return found, true, nil
+		}
+		hi = lo + 1
+	}
+	return 0, false, nil
+}
@@ -0,0 +1,312 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReadRange(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithReadConcurrency(3))
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	records, err := wal.ReadRange(ctx, 3, 9)
+	if err != nil {
+		t.Fatalf("failed to read range: %v", err)
+	}
+	if len(records) != 6 {
+		t.Fatalf("expected 6 records, got %d", len(records))
+	}
+	for i, r := range records {
+		if r.Offset != uint64(i+3) {
+			t.Errorf("position %d: expected offset %d, got %d", i, i+3, r.Offset)
+		}
+	}
+
+	delete(fake.objects, wal.getObjectKey(5))
+	delete(fake.objects, wal.getObjectKey(7))
+	records, err = wal.ReadRange(ctx, 3, 9)
+	var gap *RangeGapError
+	if !errors.As(err, &gap) {
+		t.Fatalf("expected RangeGapError, got %v", err)
+	}
+	if gap.Offset != 5 {
+		t.Errorf("expected first gap at 5, got %d", gap.Offset)
+	}
+	if len(records) != 4 {
+		t.Errorf("expected the 4 surviving records, got %d", len(records))
+	}
+
+	if _, err := wal.ReadRange(ctx, 8, 3); !errors.Is(err, ErrInvalidRange) {
+		t.Errorf("expected ErrInvalidRange for an inverted range, got %v", err)
+	}
+
+	// an open-ended range reads only what is listed, and gaps past the tail
+	fake.getCalls = 0
+	records, err = wal.ReadRange(ctx, 9, math.MaxUint64)
+	if !errors.As(err, &gap) || gap.Offset != 11 || !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected the gap past the tail at 11, got %v", err)
+	}
+	if len(records) != 2 || fake.getCalls != 2 {
+		t.Errorf("expected offsets 9 and 10 read with 2 gets, got %d records and %d gets", len(records), fake.getCalls)
+	}
+}
+
+func TestHalfOpenRanges(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	dst, _ := newFakeDAL(t)
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		if _, err := wal.Append(ctx, []byte("record")); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+
+	fake.getCalls, fake.putCalls = 0, 0
+	if records, err := wal.ReadRange(ctx, 3, 3); err != nil || len(records) != 0 {
+		t.Errorf("ReadRange: expected no records for an empty range, got %d, %v", len(records), err)
+	}
+	if bad, err := wal.ReadValidateRange(ctx, 3, 3); err != nil || len(bad) != 0 {
+		t.Errorf("ReadValidateRange: expected nothing checked, got %v, %v", bad, err)
+	}
+	if keys, err := wal.DeleteRange(ctx, 3, 3, false); err != nil || len(keys) != 0 {
+		t.Errorf("DeleteRange: expected nothing deleted, got %v, %v", keys, err)
+	}
+	if total, err := wal.TotalBytes(ctx, 3, 3); err != nil || total != 0 {
+		t.Errorf("TotalBytes: expected 0 for an empty range, got %d, %v", total, err)
+	}
+	if copied, err := wal.Replicate(ctx, dst, 3, 3); err != nil || copied != 0 {
+		t.Errorf("Replicate: expected nothing copied, got %d, %v", copied, err)
+	}
+	var file bytes.Buffer
+	if err := wal.Export(ctx, 3, 3, &file); err != nil {
+		t.Errorf("Export: expected an empty range to export, got %v", err)
+	}
+	if first, last, err := dst.Import(ctx, &file); err != nil || first != 0 || last != 0 {
+		t.Errorf("Export: expected an empty segment file, got %d to %d, %v", first, last, err)
+	}
+	if fake.getCalls != 0 || fake.putCalls != 0 {
+		t.Errorf("expected empty ranges to read and write nothing, got %d gets and %d puts", fake.getCalls, fake.putCalls)
+	}
+	if n, err := wal.Count(ctx); err != nil || n != 5 {
+		t.Errorf("expected the 5 records untouched, got %d, %v", n, err)
+	}
+
+	for name, call := range map[string]func() error{
+		"ReadRange":         func() error { _, err := wal.ReadRange(ctx, 4, 3); return err },
+		"ReadValidateRange": func() error { _, err := wal.ReadValidateRange(ctx, 4, 3); return err },
+		"DeleteRange":       func() error { _, err := wal.DeleteRange(ctx, 4, 3, true); return err },
+		"TotalBytes":        func() error { _, err := wal.TotalBytes(ctx, 4, 3); return err },
+		"Replicate":         func() error { _, err := wal.Replicate(ctx, dst, 4, 3); return err },
+		"Export":            func() error { return wal.Export(ctx, 4, 3, &file) },
+		"Compact":           func() error { return wal.Compact(ctx, 4, 3) },
+	} {
+		if err := call(); !errors.Is(err, ErrInvalidRange) {
+			t.Errorf("%s: expected ErrInvalidRange for an inverted range, got %v", name, err)
+		}
+	}
+}
+
+func TestRangeFromZero(t *testing.T) {
+	wal, _ := newFakeDAL(t)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := wal.Append(ctx, []byte("record")); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+
+	records, err := wal.ReadRange(ctx, 0, 3)
+	if err != nil || len(records) != 2 || records[0].Offset != 1 {
+		t.Errorf("ReadRange: expected offsets 1 and 2, got %d records, %v", len(records), err)
+	}
+	if bad, err := wal.ReadValidateRange(ctx, 0, 4); err != nil || len(bad) != 0 {
+		t.Errorf("ReadValidateRange: expected offset 0 not checked, got %v, %v", bad, err)
+	}
+	if records, err := wal.ReadRange(ctx, 0, 1); err != nil || len(records) != 0 {
+		t.Errorf("ReadRange: expected nothing below offset 1, got %d records, %v", len(records), err)
+	}
+}
+
+func TestTailRecords(t *testing.T) {
+	wal, _ := newFakeDAL(t)
+	ctx := context.Background()
+
+	if records, err := wal.TailRecords(ctx, 5); err != nil || len(records) != 0 {
+		t.Fatalf("expected no records from an empty log, got %d, %v", len(records), err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	offsetsOf := func(records []Record) []uint64 {
+		var offsets []uint64
+		for _, r := range records {
+			offsets = append(offsets, r.Offset)
+		}
+		return offsets
+	}
+	records, err := wal.TailRecords(ctx, 3)
+	if err != nil {
+		t.Fatalf("failed to read tail: %v", err)
+	}
+	if got := offsetsOf(records); !slices.Equal(got, []uint64{8, 9, 10}) {
+		t.Errorf("expected offsets 8-10, got %v", got)
+	}
+
+	if _, err := wal.TrimBefore(ctx, 7); err != nil {
+		t.Fatalf("failed to trim: %v", err)
+	}
+	records, err = wal.TailRecords(ctx, 100)
+	if err != nil {
+		t.Fatalf("failed to read tail: %v", err)
+	}
+	if got := offsetsOf(records); !slices.Equal(got, []uint64{7, 8, 9, 10}) {
+		t.Errorf("expected the surviving offsets 7-10, got %v", got)
+	}
+}
+
+func TestReadSince(t *testing.T) {
+	base := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	clock := base
+	wal, fake := newFakeDAL(t, WithTimestamps())
+	wal.now = func() time.Time { return clock }
+	ctx := context.Background()
+	// a second writer whose clock runs ahead
+	ahead, err := New(fake, wal.bucketName, wal.prefix, WithTimestamps())
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	ahead.now = func() time.Time { return base.Add(55 * time.Second) }
+
+	if _, err := wal.ReadSince(ctx, base); !errors.Is(err, ErrEmptyLog) {
+		t.Fatalf("expected ErrEmptyLog from an empty log, got %v", err)
+	}
+	for i := 1; i <= 100; i++ {
+		clock = base.Add(time.Duration(i) * time.Second)
+		writer := wal
+		if i == 48 {
+			writer = ahead
+		}
+		writer.length = uint64(i - 1)
+		if _, err := writer.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	records, err := wal.ReadSince(ctx, base.Add(50*time.Second))
+	if err != nil {
+		t.Fatalf("failed to read since: %v", err)
+	}
+	want := append([]uint64{48}, offsetRange(50, 100)...)
+	var got []uint64
+	for _, r := range records {
+		got = append(got, r.Offset)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected offsets %v, got %v", want, got)
+	}
+
+	if _, err := wal.ReadSince(ctx, base.Add(time.Hour)); !errors.Is(err, ErrEmptyLog) {
+		t.Errorf("expected ErrEmptyLog when nothing is recent enough, got %v", err)
+	}
+	if records, err := wal.ReadSince(ctx, base); err != nil || len(records) != 100 {
+		t.Errorf("expected every record since the start, got %d, %v", len(records), err)
+	}
+}
+
+func TestReadMany(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		if _, err := wal.Append(ctx, []byte{byte('a' + i)}); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	fake.getCalls = 0
+	offsets := []uint64{5, 100, 7, 5, 1, 100}
+	results, err := wal.ReadMany(ctx, offsets)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if len(results) != len(offsets) {
+		t.Fatalf("expected %d results, got %d", len(offsets), len(results))
+	}
+	for i, offset := range offsets {
+		r := results[i]
+		if offset == 100 {
+			if !errors.Is(r.Err, ErrRecordNotFound) {
+				t.Errorf("result %d: expected ErrRecordNotFound for offset 100, got %v", i, r.Err)
+			}
+			continue
+		}
+		if r.Err != nil || r.Record.Offset != offset || r.Record.Data[0] != byte('a'+offset-1) {
+			t.Errorf("result %d: expected offset %d, got %d %q, %v", i, offset, r.Record.Offset, r.Record.Data, r.Err)
+		}
+	}
+	if fake.getCalls != 4 {
+		t.Errorf("expected each of the 4 distinct offsets read once, got %d gets", fake.getCalls)
+	}
+
+	if results, err := wal.ReadMany(ctx, nil); err != nil || len(results) != 0 {
+		t.Errorf("expected no results for no offsets, got %d, %v", len(results), err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := wal.ReadMany(cancelled, offsets); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled read to fail, got %v", err)
+	}
+}
+
+func TestReadAtOrBefore(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 2500; i++ {
+		if _, err := wal.Append(ctx, []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	// holes at 1-9, 11-1500 and 2001-2500
+	for offset := uint64(1); offset <= 2500; offset++ {
+		if offset < 10 || (offset > 10 && offset <= 1500) || offset > 2000 {
+			delete(fake.objects, wal.getObjectKey(offset))
+		}
+	}
+
+	for _, tc := range []struct {
+		target, want uint64
+	}{
+		{1501, 1501},
+		{1800, 1800},
+		{2000, 2000},
+		{2001, 2000},
+		{math.MaxUint32, 2000},
+		{1500, 10},
+		{12, 10},
+		{10, 10},
+	} {
+		record, err := wal.ReadAtOrBefore(ctx, tc.target)
+		if err != nil || record.Offset != tc.want {
+			t.Errorf("target %d: expected offset %d, got %d, %v", tc.target, tc.want, record.Offset, err)
+		}
+	}
+	for _, target := range []uint64{0, 1, 9} {
+		if _, err := wal.ReadAtOrBefore(ctx, target); !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("target %d: expected ErrRecordNotFound, got %v", target, err)
+		}
+	}
+}
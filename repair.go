@@ -0,0 +1,92 @@
+package s3_dal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Repair rewrites the record at offset with data, such as a record VerifyAll
+// found corrupt whose bytes are known from elsewhere. data is the payload as
+// Read returns it; it is framed afresh, with a new header and checksum, in the
+// DAL's format, and the before-append hook does not run. The record must
+// exist, or the error wraps ErrRecordNotFound. The put is guarded by the ETag
+// the record had when Repair looked, so if another client repaired it
+// meanwhile Repair fails with ErrOffsetConflict instead of overwriting that.
+//
+// It is not supported with packing, nor for records only held in compacted
+// segments.
+func (w *S3DAL) Repair(ctx context.Context, offset uint64, data []byte) error {
+	output, err := w.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(w.getObjectKey(offset)),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("cannot repair offset %d: %w", offset, ErrRecordNotFound)
+		}
+		return fmt.Errorf("failed to head object in S3: %w", err)
+	}
+	return w.repair(ctx, offset, data, aws.ToString(output.ETag))
+}
+
+// RepairIfMatch is Repair for a record the caller last saw with etag, as in
+// Record.ETag: it overwrites the record only if it still has that ETag, and
+// fails with ErrOffsetConflict if it has changed or is gone.
+func (w *S3DAL) RepairIfMatch(ctx context.Context, offset uint64, etag string, data []byte) error {
+	if etag == "" {
+		return fmt.Errorf("cannot repair offset %d: ETag is empty", offset)
+	}
+	return w.repair(ctx, offset, data, etag)
+}
+
+// ForceRepair is Repair without its guards: it writes the record at offset
+// whether or not one exists there, creating it if need be, as when restoring
+// a lost record. If offset is past the length, the length moves up to it.
+func (w *S3DAL) ForceRepair(ctx context.Context, offset uint64, data []byte) error {
+	return w.repair(ctx, offset, data, "")
+}
+
+// repair writes data as the record at offset, conditional on the object
+// having ifMatch as its ETag if that is set and unconditionally otherwise.
+func (w *S3DAL) repair(ctx context.Context, offset uint64, data []byte, ifMatch string) error {
+	if offset == 0 {
+		return fmt.Errorf("cannot repair offset 0: %w", errOffsetZero)
+	}
+	if w.packRecords > 0 {
+		return ErrPackedLog
+	}
+	if uint64(len(data)) > w.maxRecordSize {
+		return fmt.Errorf("%w: %d bytes exceeds the limit of %d", ErrRecordTooLarge, len(data), w.maxRecordSize)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.lifetime.Err() != nil {
+		return ErrClosed
+	}
+	if err := w.checkFence(ctx); err != nil {
+		return err
+	}
+
+	body, err := w.encodeBody(offset, w.nextCreated(), data, w.skipCRC)
+	if err != nil {
+		return err
+	}
+	input := w.putInput(offset, body)
+	input.IfNoneMatch = nil
+	input.IfMatch = nilIfEmpty(ifMatch)
+	defer w.cache.evict(offset)
+	if _, err := w.client.PutObject(ctx, input); err != nil {
+		if isPreconditionFailed(err) || (ifMatch != "" && isNotFound(err)) {
+			return fmt.Errorf("%w: offset %d changed since ETag %s: %w", ErrOffsetConflict, offset, ifMatch, err)
+		}
+		return fmt.Errorf("failed to put object to S3%s: %w", w.sseHint(err), err)
+	}
+	if offset > w.length {
+		w.setLength(offset)
+		w.recordInManifest(ctx, offset)
+	}
+	return nil
+}
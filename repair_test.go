@@ -0,0 +1,62 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRepair(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithTimestamps())
+	ctx := context.Background()
+
+	for _, data := range []string{"first", "second"} {
+		if _, err := wal.Append(ctx, []byte(data)); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	key := wal.getObjectKey(1)
+	obj := fake.objects[key]
+	obj.body[len(obj.body)-1] ^= 0xff
+	fake.objects[key] = obj
+	if _, err := wal.Read(ctx, 1); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected the corrupted record to fail its checksum, got %v", err)
+	}
+
+	if err := wal.Repair(ctx, 1, []byte("first")); err != nil {
+		t.Fatalf("failed to repair: %v", err)
+	}
+	record, err := wal.Read(ctx, 1)
+	if err != nil || string(record.Data) != "first" || record.CreatedAt.IsZero() {
+		t.Fatalf("expected the repaired record, got %q, %v", record.Data, err)
+	}
+	if fake.lastPut.IfNoneMatch != nil || fake.lastPut.IfMatch == nil {
+		t.Errorf("expected the repair guarded by If-Match only, got If-None-Match %v, If-Match %v", fake.lastPut.IfNoneMatch, fake.lastPut.IfMatch)
+	}
+
+	// a stale ETag does not clobber a concurrent repair
+	if err := wal.RepairIfMatch(ctx, 1, obj.etag, []byte("stale")); !errors.Is(err, ErrOffsetConflict) {
+		t.Errorf("expected ErrOffsetConflict for a stale ETag, got %v", err)
+	}
+	if err := wal.RepairIfMatch(ctx, 1, record.ETag, []byte("first again")); err != nil {
+		t.Errorf("failed to repair with the current ETag: %v", err)
+	}
+
+	// only existing offsets are repaired unless forced
+	objects := len(fake.objects)
+	if err := wal.Repair(ctx, 3, []byte("new")); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound for a missing offset, got %v", err)
+	}
+	if len(fake.objects) != objects {
+		t.Errorf("expected nothing created for a missing offset, got %d new objects", len(fake.objects)-objects)
+	}
+	if err := wal.ForceRepair(ctx, 3, []byte("restored")); err != nil {
+		t.Fatalf("failed to force a repair: %v", err)
+	}
+	if record, err := wal.Read(ctx, 3); err != nil || string(record.Data) != "restored" {
+		t.Errorf("expected the restored record, got %q, %v", record.Data, err)
+	}
+	if got := wal.Length(); got != 3 {
+		t.Errorf("expected the length to move up to 3, got %d", got)
+	}
+}
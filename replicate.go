@@ -0,0 +1,130 @@
+package s3_dal
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Replicate copies the records at offsets [start, end) into dst at the same
+// offsets and returns how many it copied. Holes in the range
+// stay holes. Records are never overwritten: one dst already holds fails the
+// replication with ErrOffsetConflict, after the records before it were copied,
+// so a retry can resume from the offset after the last one copied.
+//
+// When both logs share a client and dst would store a record in the same
+// bytes, each record is copied server-side with CopyObject, which leaves its
+// body, checksum and metadata untouched. Otherwise, or if a copy is refused
+// with AccessDenied as it is across accounts, records are read, verified and
+// written again in dst's format. CopyObject cannot be made conditional, so a
+// copied record is only checked against an existing one with HeadObject
+// first; dst must not be written by other clients while it runs.
+func (w *S3DAL) Replicate(ctx context.Context, dst *S3DAL, start, end uint64) (copied int, err error) {
+	if err := checkRange(start, end); err != nil {
+		return 0, err
+	}
+	if w.lifetime.Err() != nil || dst.lifetime.Err() != nil {
+		return 0, ErrClosed
+	}
+	serverSide := w.canCopyTo(dst)
+	if serverSide && w.bucketName == dst.bucketName && w.prefix == dst.prefix {
+		return 0, fmt.Errorf("invalid replication destination: s3://%s/%s is the source log", dst.bucketName, dst.prefix)
+	}
+
+	dst.mu.Lock()
+	defer dst.mu.Unlock()
+	var offsets []uint64
+	defer func() { dst.recordInManifest(ctx, offsets...) }()
+
+	err = w.listRecords(ctx, max(start, 1)-1, 0, func(offset uint64, obj types.Object) (bool, error) {
+		if offset >= end {
+			return false, nil
+		}
+		var size uint64
+		if serverSide {
+			err := w.copyRecord(ctx, dst, offset, aws.ToString(obj.Key))
+			if isAccessDenied(err) {
+				w.logger.Debugf("server-side copy of offset %d refused, replicating the rest by read and write: %v", offset, err)
+				serverSide = false
+			} else if err != nil {
+				return false, err
+			} else {
+				// the stored size, as the body is not read
+				size = uint64(aws.ToInt64(obj.Size))
+			}
+		}
+		if !serverSide {
+			record, err := w.Read(ctx, offset)
+			if err != nil {
+				return false, err
+			}
+			payload, err := compressPayload(dst.compression, record.Data)
+			if err != nil {
+				return false, fmt.Errorf("failed to prepare object body: failed to compress payload: %w", err)
+			}
+			if err := dst.putRecord(ctx, offset, unixNanos(record.CreatedAt), payload, dst.attrs()); err != nil {
+				return false, err
+			}
+			size = uint64(len(record.Data))
+		}
+		dst.setLength(max(dst.length, offset))
+		dst.size += size
+		offsets = append(offsets, offset)
+		copied++
+		return true, nil
+	})
+	return copied, err
+}
+
+// canCopyTo reports whether records can be copied server-side into dst: the
+// same client, and so the same account and region, and the same record
+// format and object attributes, so the copied object is what dst would have
+// written. Encrypted logs are always re-encrypted for dst.
+func (w *S3DAL) canCopyTo(dst *S3DAL) bool {
+	return unwrapClient(w.client) == unwrapClient(dst.client) &&
+		len(w.keys) == 0 && len(dst.keys) == 0 && !w.compaction &&
+		w.compression == dst.compression &&
+		w.checksum == dst.checksum &&
+		w.skipCRC == dst.skipCRC &&
+		w.contentType == dst.contentType && maps.Equal(w.metadata, dst.metadata)
+}
+
+// copyRecord copies the object at key to offset's key in dst, with dst's
+// storage class, encryption and tags.
+func (w *S3DAL) copyRecord(ctx context.Context, dst *S3DAL, offset uint64, key string) error {
+	dstKey := dst.getObjectKey(offset)
+	_, err := dst.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(dst.bucketName),
+		Key:    aws.String(dstKey),
+	})
+	if err == nil {
+		dst.observer.RecordConflict(offset)
+		return fmt.Errorf("%w: offset %d", ErrOffsetConflict, offset)
+	}
+	if !isNotFound(err) {
+		return fmt.Errorf("failed to check object in S3: %w", err)
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(dst.bucketName),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String((&url.URL{Path: w.bucketName + "/" + key}).EscapedPath()),
+	}
+	if dst.storageClass != "" {
+		input.StorageClass = dst.storageClass
+	}
+	if dst.tagging != "" {
+		input.TaggingDirective = types.TaggingDirectiveReplace
+		input.Tagging = aws.String(dst.tagging)
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.BucketKeyEnabled = dst.sseParams()
+	if _, err := dst.client.CopyObject(ctx, input); err != nil {
+		return fmt.Errorf("failed to copy object in S3%s: %w", dst.sseHint(err), err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestReplicate(t *testing.T) {
+	src, _ := newFakeDAL(t, WithTimestamps())
+	ctx := context.Background()
+	for i := 1; i <= 6; i++ {
+		if i == 3 {
+			// abandoned, so the range has a hole
+			if _, err := src.Reserve(ctx); err != nil {
+				t.Fatalf("failed to reserve: %v", err)
+			}
+			continue
+		}
+		if _, err := src.Append(ctx, []byte(fmt.Sprintf("record %d", i))); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+
+	// a second backend, so records are read and written again, here gzipped
+	backup := newFakeS3()
+	dst, err := New(backup, "backup-bucket", "backup-prefix", WithCompression(CompressionGzip))
+	if err != nil {
+		t.Fatalf("failed to create destination: %v", err)
+	}
+	copied, err := src.Replicate(ctx, dst, 2, 6)
+	if err != nil || copied != 3 {
+		t.Fatalf("expected 3 records replicated, got %d, %v", copied, err)
+	}
+	if backup.copyCalls != 0 {
+		t.Errorf("expected no server-side copies across backends, got %d", backup.copyCalls)
+	}
+	if dst.Length() != 5 {
+		t.Errorf("expected the destination length to be 5, got %d", dst.Length())
+	}
+	for _, offset := range []uint64{2, 4, 5} {
+		want, err := src.Read(ctx, offset)
+		if err != nil {
+			t.Fatalf("failed to read source offset %d: %v", offset, err)
+		}
+		got, err := dst.Read(ctx, offset)
+		if err != nil {
+			t.Fatalf("failed to read replicated offset %d: %v", offset, err)
+		}
+		if !bytes.Equal(got.Data, want.Data) || !got.CreatedAt.Equal(want.CreatedAt) {
+			t.Errorf("offset %d: expected %q created %v, got %q created %v", offset, want.Data, want.CreatedAt, got.Data, got.CreatedAt)
+		}
+	}
+	for _, offset := range []uint64{1, 3, 6} {
+		if _, err := dst.Read(ctx, offset); !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("expected offset %d not to be replicated, got %v", offset, err)
+		}
+	}
+
+	if copied, err := src.Replicate(ctx, dst, 4, 7); !errors.Is(err, ErrOffsetConflict) || copied != 0 {
+		t.Errorf("expected replicating over offset 4 to conflict, got %d, %v", copied, err)
+	}
+}
+
+func TestReplicateServerSide(t *testing.T) {
+	src, fake := newFakeDAL(t)
+	ctx := context.Background()
+	for i := 1; i <= 4; i++ {
+		if _, err := src.Append(ctx, []byte(fmt.Sprintf("record %d", i))); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	if _, err := src.Replicate(ctx, src, 1, 5); err == nil {
+		t.Error("expected replicating a log onto itself to be rejected")
+	}
+
+	dst := S3DALClient(fake, src.bucketName, "replica-prefix")
+	puts := fake.putCalls
+	copied, err := src.Replicate(ctx, dst, 0, 11)
+	if err != nil || copied != 4 {
+		t.Fatalf("expected 4 records replicated, got %d, %v", copied, err)
+	}
+	if fake.copyCalls != 4 || fake.putCalls != puts {
+		t.Errorf("expected 4 server-side copies and no puts, got %d and %d", fake.copyCalls, fake.putCalls-puts)
+	}
+	for offset := uint64(1); offset <= 4; offset++ {
+		if !bytes.Equal(fake.objects[dst.getObjectKey(offset)].body, fake.objects[src.getObjectKey(offset)].body) {
+			t.Errorf("offset %d: expected the stored bytes to be copied unchanged", offset)
+		}
+	}
+	if record, err := dst.LastRecord(ctx); err != nil || string(record.Data) != "record 4" {
+		t.Errorf("expected the replica to end with record 4, got %q, %v", record.Data, err)
+	}
+}
@@ -0,0 +1,85 @@
+package s3_dal
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// WithRequestPayer sends every object and listing request with
+// RequestPayer: requester, to read and write a requester-pays bucket, whose
+// charges for them then go to the caller's account. Read fallbacks get it
+// too. Without it S3 refuses those requests with 403 Access Denied.
+func WithRequestPayer() Option {
+	return func(w *S3DAL) error {
+		w.requestPayer = true
+		return nil
+	}
+}
+
+// requesterPaysClient sets RequestPayer on every request that takes one.
+// HeadBucket has none; S3 checks only bucket permissions for it.
+type requesterPaysClient struct {
+	s3API
+}
+
+func (c *requesterPaysClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	input := *params
+	input.RequestPayer = types.RequestPayerRequester
+	return c.s3API.PutObject(ctx, &input, optFns...)
+}
+
+func (c *requesterPaysClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	input := *params
+	input.RequestPayer = types.RequestPayerRequester
+	return c.s3API.GetObject(ctx, &input, optFns...)
+}
+
+func (c *requesterPaysClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	input := *params
+	input.RequestPayer = types.RequestPayerRequester
+	return c.s3API.ListObjectsV2(ctx, &input, optFns...)
+}
+
+func (c *requesterPaysClient) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	input := *params
+	input.RequestPayer = types.RequestPayerRequester
+	return c.s3API.DeleteObjects(ctx, &input, optFns...)
+}
+
+func (c *requesterPaysClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	input := *params
+	input.RequestPayer = types.RequestPayerRequester
+	return c.s3API.HeadObject(ctx, &input, optFns...)
+}
+
+func (c *requesterPaysClient) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	input := *params
+	input.RequestPayer = types.RequestPayerRequester
+	return c.s3API.CopyObject(ctx, &input, optFns...)
+}
+
+func (c *requesterPaysClient) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	input := *params
+	input.RequestPayer = types.RequestPayerRequester
+	return c.s3API.CreateMultipartUpload(ctx, &input, optFns...)
+}
+
+func (c *requesterPaysClient) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	input := *params
+	input.RequestPayer = types.RequestPayerRequester
+	return c.s3API.UploadPart(ctx, &input, optFns...)
+}
+
+func (c *requesterPaysClient) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	input := *params
+	input.RequestPayer = types.RequestPayerRequester
+	return c.s3API.CompleteMultipartUpload(ctx, &input, optFns...)
+}
+
+func (c *requesterPaysClient) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	input := *params
+	input.RequestPayer = types.RequestPayerRequester
+	return c.s3API.AbortMultipartUpload(ctx, &input, optFns...)
+}
@@ -0,0 +1,140 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// payerS3 records the requests that came without RequestPayer: requester.
+type payerS3 struct {
+	*fakeS3
+
+	mu     sync.Mutex
+	unpaid []string
+}
+
+func (p *payerS3) check(op string, payer types.RequestPayer) {
+	if payer != types.RequestPayerRequester {
+		p.mu.Lock()
+		p.unpaid = append(p.unpaid, op)
+		p.mu.Unlock()
+	}
+}
+
+func (p *payerS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	p.check("PutObject", params.RequestPayer)
+	return p.fakeS3.PutObject(ctx, params, optFns...)
+}
+
+func (p *payerS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	p.check("GetObject", params.RequestPayer)
+	return p.fakeS3.GetObject(ctx, params, optFns...)
+}
+
+func (p *payerS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	p.check("ListObjectsV2", params.RequestPayer)
+	return p.fakeS3.ListObjectsV2(ctx, params, optFns...)
+}
+
+func (p *payerS3) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	p.check("HeadObject", params.RequestPayer)
+	return p.fakeS3.HeadObject(ctx, params, optFns...)
+}
+
+func (p *payerS3) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	p.check("DeleteObjects", params.RequestPayer)
+	return p.fakeS3.DeleteObjects(ctx, params, optFns...)
+}
+
+func (p *payerS3) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	p.check("CreateMultipartUpload", params.RequestPayer)
+	return p.fakeS3.CreateMultipartUpload(ctx, params, optFns...)
+}
+
+func (p *payerS3) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	p.check("UploadPart", params.RequestPayer)
+	return p.fakeS3.UploadPart(ctx, params, optFns...)
+}
+
+func (p *payerS3) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	p.check("CompleteMultipartUpload", params.RequestPayer)
+	return p.fakeS3.CompleteMultipartUpload(ctx, params, optFns...)
+}
+
+// exerciseLog appends, reads, lists and trims, touching every kind of
+// request a log makes in normal use.
+func exerciseLog(t *testing.T, wal *S3DAL) {
+	t.Helper()
+	ctx := context.Background()
+	for _, data := range [][]byte{[]byte("first"), []byte("second"), bytes.Repeat([]byte("x"), 6<<20)} {
+		if _, err := wal.Append(ctx, data); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	if record, err := wal.Read(ctx, 2); err != nil || string(record.Data) != "second" {
+		t.Fatalf("expected to read offset 2, got %q, %v", record.Data, err)
+	}
+	if found, err := wal.Exists(ctx, 1); err != nil || !found {
+		t.Fatalf("expected offset 1 to exist, got %v, %v", found, err)
+	}
+	if record, err := wal.LastRecord(ctx); err != nil || record.Offset != 3 {
+		t.Fatalf("expected the last record at offset 3, got %d, %v", record.Offset, err)
+	}
+	if count, err := wal.Count(ctx); err != nil || count != 3 {
+		t.Fatalf("expected a count of 3, got %d, %v", count, err)
+	}
+	if removed, err := wal.TrimBefore(ctx, 2); err != nil || removed != 1 {
+		t.Fatalf("expected to trim offset 1, got %d, %v", removed, err)
+	}
+}
+
+func TestRequestPayer(t *testing.T) {
+	payer := &payerS3{fakeS3: newFakeS3()}
+	wal, err := New(payer, "fake-bucket", "fake-prefix", WithRequestPayer(), WithMultipartThreshold(5<<20), WithRateLimit(1000, 100), WithOperationTimeout(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	exerciseLog(t, wal)
+	if len(payer.unpaid) > 0 {
+		t.Errorf("expected every request to name the requester as payer, got %v without", payer.unpaid)
+	}
+
+	plain := &payerS3{fakeS3: newFakeS3()}
+	wal, err = New(plain, "fake-bucket", "fake-prefix")
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	if _, err := wal.Append(context.Background(), []byte("plain")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if len(plain.unpaid) == 0 {
+		t.Error("expected no request payer by default")
+	}
+}
+
+func TestAccessPointBucket(t *testing.T) {
+	const accessPoint = "arn:aws:s3:us-west-2:123456789012:accesspoint/wal-ap"
+	fake := newFakeS3()
+	wal, err := New(fake, accessPoint, "fake-prefix")
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	exerciseLog(t, wal)
+
+	if got := aws.ToString(fake.lastPut.Bucket); got != accessPoint {
+		t.Errorf("expected the access point ARN as the bucket, got %q", got)
+	}
+	for key := range fake.objects {
+		if strings.Contains(key, "arn:") || strings.Contains(key, "accesspoint") {
+			t.Errorf("expected keys free of the bucket ARN, got %q", key)
+		}
+	}
+}
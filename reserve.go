@@ -0,0 +1,120 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotReserved is returned by Commit for an offset that Reserve did not
+// hand out, or that was already committed.
+var ErrNotReserved = errors.New("offset not reserved")
+
+// Reserve allocates the next offset without writing anything, for callers
+// that must do work keyed by the offset before its body exists. Write it with
+// Commit. Appends made meanwhile take the offsets after it.
+//
+// A reservation only exists in this S3DAL: it is lost if the process exits,
+// and it does not stop another client from writing the offset, in which case
+// Commit fails with ErrOffsetConflict. A reservation that is never committed
+// leaves a hole in the log, which Scan, ScanPage, Follow and VerifyAll skip
+// and which makes LastRecord fall back to listing, as any hole does.
+func (w *S3DAL) Reserve(ctx context.Context) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.lifetime.Err() != nil {
+		return 0, ErrClosed
+	}
+	if w.packRecords > 0 {
+		return 0, ErrPackedLog
+	}
+	w.setLength(w.length + 1)
+	if w.reserved == nil {
+		w.reserved = make(map[uint64]struct{})
+	}
+	w.reserved[w.length] = struct{}{}
+	return w.length, nil
+}
+
+// resetLength sets the length to n, found in S3, but never below an
+// outstanding reservation or a buffered or queued record, so Append does not
+// hand it out again. The caller holds mu.
+func (w *S3DAL) resetLength(n uint64) {
+	for offset := range w.reserved {
+		n = max(n, offset)
+	}
+	if len(w.pending) > 0 {
+		n = max(n, w.pending[len(w.pending)-1].offset)
+	}
+	if w.async != nil {
+		n = max(n, w.async.highest())
+	}
+	w.setLength(n)
+}
+
+// Commit writes data as the record at offset, which must have come from
+// Reserve, with the same If-None-Match guard and limits as Append. The put is
+// made without holding up other appends. If it fails the offset stays
+// reserved and Commit may be retried, unless the failure is
+// ErrOffsetConflict: another writer owns the offset, and the reservation is
+// dropped.
+func (w *S3DAL) Commit(ctx context.Context, offset uint64, data []byte) (err error) {
+	start := time.Now()
+	defer func() { w.observer.RecordAppend(len(data), time.Since(start), err) }()
+
+	w.mu.Lock()
+	if w.lifetime.Err() != nil {
+		w.mu.Unlock()
+		return ErrClosed
+	}
+	if _, ok := w.reserved[offset]; !ok {
+		w.mu.Unlock()
+		return fmt.Errorf("%w: offset %d", ErrNotReserved, offset)
+	}
+	data, err = w.admitRecord(data, w.size, w.fileSizeLimit)
+	if err != nil {
+		w.mu.Unlock()
+		return err
+	}
+	// taken out while the put runs, so a concurrent Commit of the same
+	// offset fails rather than racing it
+	delete(w.reserved, offset)
+	created := w.nextCreated()
+	w.mu.Unlock()
+
+	var stored uint64
+	payload, err := compressPayload(w.compression, data)
+	if err == nil {
+		stored = w.storedSize(len(payload))
+		w.mu.Lock()
+		err = w.checkStoredSize(w.stored, stored)
+		w.mu.Unlock()
+	} else {
+		err = fmt.Errorf("failed to prepare object body: failed to compress payload: %w", err)
+	}
+	if err == nil {
+		err = w.putRecord(ctx, offset, created, payload, w.attrs())
+	}
+	if err != nil {
+		if !errors.Is(err, ErrOffsetConflict) {
+			w.mu.Lock()
+			w.reserved[offset] = struct{}{}
+			w.mu.Unlock()
+		}
+		return err
+	}
+
+	w.mu.Lock()
+	w.size += uint64(len(data))
+	w.setStored(w.stored + stored)
+	w.mu.Unlock()
+	w.recordInManifest(ctx, offset)
+
+	if w.afterAppend != nil {
+		if err := w.afterAppend(offset); err != nil {
+			return fmt.Errorf("after-append hook failed for committed offset %d: %w", offset, err)
+		}
+	}
+	return nil
+}
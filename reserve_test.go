@@ -0,0 +1,99 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestReserveThenCommit(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	reserved, err := wal.Reserve(ctx)
+	if err != nil || reserved != 1 {
+		t.Fatalf("expected to reserve offset 1, got %d, %v", reserved, err)
+	}
+	if appended, err := wal.Append(ctx, []byte("after the reservation")); err != nil || appended != 2 {
+		t.Fatalf("expected the append to take offset 2, got %d, %v", appended, err)
+	}
+	// finding the tail does not give the reservation away
+	if _, err := wal.LastRecord(ctx); err != nil || wal.Length() != 2 {
+		t.Fatalf("expected the length to stay 2, got %d, %v", wal.Length(), err)
+	}
+
+	fake.putErr = errors.New("network down")
+	if err := wal.Commit(ctx, reserved, []byte("side work done")); err == nil {
+		t.Fatal("expected the commit to fail")
+	}
+	fake.putErr = nil
+	if err := wal.Commit(ctx, reserved, []byte("side work done")); err != nil {
+		t.Fatalf("expected a failed commit to be retryable, got %v", err)
+	}
+	if err := wal.Commit(ctx, reserved, []byte("twice")); !errors.Is(err, ErrNotReserved) {
+		t.Errorf("expected ErrNotReserved for a second commit, got %v", err)
+	}
+	if err := wal.Commit(ctx, 2, []byte("appended")); !errors.Is(err, ErrNotReserved) {
+		t.Errorf("expected ErrNotReserved for an appended offset, got %v", err)
+	}
+
+	record, err := wal.Read(ctx, reserved)
+	if err != nil || string(record.Data) != "side work done" {
+		t.Errorf("expected the committed record, got %q, %v", record.Data, err)
+	}
+}
+
+func TestReserveConflict(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	reserved, err := wal.Reserve(ctx)
+	if err != nil {
+		t.Fatalf("failed to reserve: %v", err)
+	}
+	other := S3DALClient(fake, wal.bucketName, wal.prefix)
+	if _, err := other.Append(ctx, []byte("unaware of the reservation")); err != nil {
+		t.Fatalf("failed to append from another client: %v", err)
+	}
+	if err := wal.Commit(ctx, reserved, []byte("too late")); !errors.Is(err, ErrOffsetConflict) {
+		t.Fatalf("expected ErrOffsetConflict, got %v", err)
+	}
+	if err := wal.Commit(ctx, reserved, []byte("too late")); !errors.Is(err, ErrNotReserved) {
+		t.Errorf("expected the reservation to be dropped after a conflict, got %v", err)
+	}
+}
+
+func TestReserveThenAbandon(t *testing.T) {
+	wal, _ := newFakeDAL(t)
+	ctx := context.Background()
+
+	if _, err := wal.Append(ctx, []byte("one")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if _, err := wal.Reserve(ctx); err != nil {
+		t.Fatalf("failed to reserve: %v", err)
+	}
+	if _, err := wal.Append(ctx, []byte("three")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	var scanned []uint64
+	it, err := wal.Scan(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to scan: %v", err)
+	}
+	for it.Next() {
+		scanned = append(scanned, it.Record().Offset)
+	}
+	it.Close()
+	if err := it.Err(); err != nil || !slices.Equal(scanned, []uint64{1, 3}) {
+		t.Errorf("expected the scan to skip the abandoned offset, got %v, %v", scanned, err)
+	}
+	if record, err := wal.LastRecord(ctx); err != nil || record.Offset != 3 {
+		t.Errorf("expected last record 3 past the hole, got %d, %v", record.Offset, err)
+	}
+	if bad, err := wal.VerifyAll(ctx, 1); err != nil || len(bad) != 0 {
+		t.Errorf("expected the hole not to be reported as corrupt, got %v, %v", bad, err)
+	}
+}
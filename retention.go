@@ -0,0 +1,190 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// defaultRetentionInterval is how often the retention worker runs unless the
+// policy says otherwise.
+const defaultRetentionInterval = time.Minute
+
+// RetentionPolicy is which records the retention worker keeps. Any mix of the
+// limits may be set, and a record is trimmed once any of them excludes it;
+// the zero value of each means no limit. The last record is always kept, so
+// the log's tail survives a policy that would trim everything.
+type RetentionPolicy struct {
+	// KeepLast keeps only the newest KeepLast records.
+	KeepLast uint64
+	// MaxAge trims records created longer ago than this. With WithTimestamps
+	// a record's age is its CreatedAt, found by binary search over record
+	// headers; without it, or for a record without one, it is the object's
+	// LastModified.
+	MaxAge time.Duration
+	// MaxBytes keeps the newest records whose objects total at most this
+	// many bytes.
+	MaxBytes int64
+	// Interval is the time between passes, a minute if zero.
+	Interval time.Duration
+}
+
+func (p RetentionPolicy) validate() error {
+	switch {
+	case p.KeepLast == 0 && p.MaxAge == 0 && p.MaxBytes == 0:
+		return errors.New("invalid retention policy: no limit is set")
+	case p.MaxAge < 0:
+		return fmt.Errorf("invalid retention policy: max age %v is negative", p.MaxAge)
+	case p.MaxBytes < 0:
+		return fmt.Errorf("invalid retention policy: max bytes %d is negative", p.MaxBytes)
+	case p.Interval < 0:
+		return fmt.Errorf("invalid retention policy: interval %v is negative", p.Interval)
+	}
+	return nil
+}
+
+// StartRetention starts a worker that enforces policy every policy.Interval,
+// the first time right away, until ctx is done or the S3DAL is closed. Each
+// pass is EnforceRetention; its result goes to the observer if it is a
+// RetentionObserver, and a failed pass is logged and retried at the next
+// interval. The worker is safe to run alongside appends: it only deletes
+// records below the last one it listed. It is not supported with packing.
+func (w *S3DAL) StartRetention(ctx context.Context, policy RetentionPolicy) error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+	if w.packRecords > 0 {
+		return ErrPackedLog
+	}
+	if w.lifetime.Err() != nil {
+		return ErrClosed
+	}
+	interval := policy.Interval
+	if interval == 0 {
+		interval = defaultRetentionInterval
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(w.lifetime, cancel)
+	go func() {
+		defer cancel()
+		defer stop()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			trimmed, err := w.EnforceRetention(ctx, policy)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				w.logger.Debugf("retention pass failed: %v", err)
+			}
+			if o, ok := w.observer.(RetentionObserver); ok {
+				o.RecordRetention(trimmed, err)
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// EnforceRetention makes a single pass of policy, ignoring its Interval, and
+// returns how many records it trimmed. It lists the log once and deletes the
+// records below the oldest one every limit keeps, never the last listed
+// record, so records appended meanwhile are not touched.
+func (w *S3DAL) EnforceRetention(ctx context.Context, policy RetentionPolicy) (trimmed int, err error) {
+	if err := policy.validate(); err != nil {
+		return 0, err
+	}
+	objects, err := w.listObjects(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(objects) <= 1 {
+		return 0, nil
+	}
+
+	keep := 0
+	if policy.KeepLast > 0 && uint64(len(objects)) > policy.KeepLast {
+		keep = len(objects) - int(policy.KeepLast)
+	}
+	if policy.MaxBytes > 0 {
+		var total int64
+		for i := len(objects) - 1; i >= keep; i-- {
+			if total += aws.ToInt64(objects[i].Size); total > policy.MaxBytes {
+				keep = i + 1
+				break
+			}
+		}
+	}
+	if policy.MaxAge > 0 {
+		young, err := w.firstYoung(ctx, objects[keep:], w.now().Add(-policy.MaxAge))
+		if err != nil {
+			return 0, err
+		}
+		keep += young
+	}
+	// the tail stays, whatever the policy
+	keep = min(keep, len(objects)-1)
+	if keep == 0 {
+		return 0, nil
+	}
+
+	keys := make([]string, 0, keep)
+	for _, obj := range objects[:keep] {
+		keys = append(keys, aws.ToString(obj.Key))
+	}
+	return w.deleteKeys(ctx, keys)
+}
+
+// firstYoung returns the index of the first of objects, in ascending offset
+// order, created at or after cutoff, or len(objects) if none is. Ages are
+// assumed to grow with offsets, so it binary searches them.
+func (w *S3DAL) firstYoung(ctx context.Context, objects []types.Object, cutoff time.Time) (int, error) {
+	var searchErr error
+	i := sort.Search(len(objects), func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+		created, err := w.objectCreated(ctx, objects[i])
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		return !created.Before(cutoff)
+	})
+	return i, searchErr
+}
+
+// objectCreated is when the record listed as obj was appended: the creation
+// time in its header under WithTimestamps, or else its LastModified, as for
+// records listed from a compacted segment. A record trimmed since it was
+// listed counts as older than any cutoff.
+func (w *S3DAL) objectCreated(ctx context.Context, obj types.Object) (time.Time, error) {
+	if !w.timestamps {
+		return aws.ToTime(obj.LastModified), nil
+	}
+	key := aws.ToString(obj.Key)
+	if offset, err := w.getOffsetFromKey(key); err == nil {
+		created, err := w.readCreatedAt(ctx, offset, key)
+		if errors.Is(err, ErrRecordNotFound) {
+			return time.Time{}, nil
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if created != 0 {
+			return createdAt(created), nil
+		}
+	}
+	return aws.ToTime(obj.LastModified), nil
+}
@@ -0,0 +1,215 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// remainingOffsets lists the offsets left in the log.
+func remainingOffsets(t *testing.T, wal *S3DAL) []uint64 {
+	t.Helper()
+	objects, err := wal.listObjects(context.Background())
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	var offsets []uint64
+	for _, obj := range objects {
+		offset, err := wal.getOffsetFromKey(*obj.Key)
+		if err != nil {
+			t.Fatalf("failed to parse key: %v", err)
+		}
+		offsets = append(offsets, offset)
+	}
+	return offsets
+}
+
+func TestRetentionKeepLast(t *testing.T) {
+	wal, _ := newFakeDAL(t)
+	ctx := context.Background()
+	for range 10 {
+		if _, err := wal.Append(ctx, []byte("record")); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+
+	trimmed, err := wal.EnforceRetention(ctx, RetentionPolicy{KeepLast: 3})
+	if err != nil || trimmed != 7 {
+		t.Fatalf("expected 7 records trimmed, got %d, %v", trimmed, err)
+	}
+	if got := remainingOffsets(t, wal); !slices.Equal(got, []uint64{8, 9, 10}) {
+		t.Errorf("expected offsets 8 to 10 kept, got %v", got)
+	}
+	if trimmed, err := wal.EnforceRetention(ctx, RetentionPolicy{KeepLast: 3}); err != nil || trimmed != 0 {
+		t.Errorf("expected a second pass to trim nothing, got %d, %v", trimmed, err)
+	}
+}
+
+func TestRetentionMaxAge(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, timestamps := range []bool{false, true} {
+		var opts []Option
+		if timestamps {
+			opts = append(opts, WithTimestamps())
+		}
+		wal, fake := newFakeDAL(t, opts...)
+		ctx := context.Background()
+		for i := range 6 {
+			written := base.Add(time.Duration(i) * time.Hour)
+			wal.now = func() time.Time { return written }
+			fake.now = func() time.Time { return written }
+			if _, err := wal.Append(ctx, []byte("record")); err != nil {
+				t.Fatalf("failed to append: %v", err)
+			}
+		}
+
+		// records from 0h to 5h old at 5h30; keep the last two hours
+		wal.now = func() time.Time { return base.Add(5*time.Hour + 30*time.Minute) }
+		trimmed, err := wal.EnforceRetention(ctx, RetentionPolicy{MaxAge: 2 * time.Hour})
+		if err != nil || trimmed != 4 {
+			t.Fatalf("timestamps %v: expected 4 records trimmed, got %d, %v", timestamps, trimmed, err)
+		}
+		if got := remainingOffsets(t, wal); !slices.Equal(got, []uint64{5, 6}) {
+			t.Errorf("timestamps %v: expected offsets 5 and 6 kept, got %v", timestamps, got)
+		}
+
+		// even when every record is too old, the tail stays
+		wal.now = func() time.Time { return base.Add(100 * time.Hour) }
+		if _, err := wal.EnforceRetention(ctx, RetentionPolicy{MaxAge: time.Hour}); err != nil {
+			t.Fatalf("failed to enforce retention: %v", err)
+		}
+		if got := remainingOffsets(t, wal); !slices.Equal(got, []uint64{6}) {
+			t.Errorf("timestamps %v: expected the tail kept, got %v", timestamps, got)
+		}
+	}
+}
+
+func TestRetentionMaxBytes(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+	for _, data := range []string{"aaaa", "bbbbbbbb", "cc", "dddd", "eeeeee"} {
+		if _, err := wal.Append(ctx, []byte(data)); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	size := func(offset uint64) int64 { return int64(len(fake.objects[wal.getObjectKey(offset)].body)) }
+
+	// room for the last three objects but not the fourth
+	limit := size(3) + size(4) + size(5) + size(2) - 1
+	trimmed, err := wal.EnforceRetention(ctx, RetentionPolicy{MaxBytes: limit})
+	if err != nil || trimmed != 2 {
+		t.Fatalf("expected 2 records trimmed, got %d, %v", trimmed, err)
+	}
+	if got := remainingOffsets(t, wal); !slices.Equal(got, []uint64{3, 4, 5}) {
+		t.Errorf("expected offsets 3 to 5 kept, got %v", got)
+	}
+
+	// combined limits trim as far as the strictest
+	trimmed, err = wal.EnforceRetention(ctx, RetentionPolicy{KeepLast: 2, MaxBytes: limit})
+	if err != nil || trimmed != 1 {
+		t.Errorf("expected KeepLast to trim one more, got %d, %v", trimmed, err)
+	}
+}
+
+// retentionObserver collects the passes of the retention worker.
+type retentionObserver struct {
+	nopObserver
+	mu     sync.Mutex
+	passes []int
+	errs   []error
+}
+
+func (o *retentionObserver) RecordRetention(trimmed int, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.passes = append(o.passes, trimmed)
+	o.errs = append(o.errs, err)
+}
+
+func (o *retentionObserver) count() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.passes)
+}
+
+func TestStartRetention(t *testing.T) {
+	observer := &retentionObserver{}
+	wal, fake := newFakeDAL(t, WithObserver(observer))
+	ctx := context.Background()
+	for range 5 {
+		if _, err := wal.Append(ctx, []byte("record")); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err := wal.StartRetention(runCtx, RetentionPolicy{KeepLast: 2, Interval: time.Millisecond}); err != nil {
+		t.Fatalf("failed to start retention: %v", err)
+	}
+	// appends carry on while the worker trims
+	for range 20 {
+		if _, err := wal.Append(ctx, []byte("record")); err != nil {
+			t.Fatalf("failed to append during retention: %v", err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for observer.count() < 3 || len(remainingOffsets(t, wal)) > 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the worker to trim to 2 records, got %v after %d passes", remainingOffsets(t, wal), observer.count())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := remainingOffsets(t, wal); !slices.Equal(got, []uint64{24, 25}) {
+		t.Errorf("expected the newest records kept, got %v", got)
+	}
+	observer.mu.Lock()
+	total := 0
+	for i, trimmed := range observer.passes {
+		if observer.errs[i] != nil {
+			t.Errorf("expected pass %d to succeed, got %v", i, observer.errs[i])
+		}
+		total += trimmed
+	}
+	observer.mu.Unlock()
+	if total != 23 {
+		t.Errorf("expected the passes to report 23 records trimmed, got %d", total)
+	}
+
+	// the worker stops with the DAL
+	if err := wal.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	listCalls := func() int {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return fake.listCalls
+	}
+	time.Sleep(10 * time.Millisecond)
+	lists := listCalls()
+	time.Sleep(20 * time.Millisecond)
+	if got := listCalls(); got != lists {
+		t.Errorf("expected no passes after Close, got %d more list calls", got-lists)
+	}
+	if err := wal.StartRetention(ctx, RetentionPolicy{KeepLast: 1}); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed starting retention on a closed DAL, got %v", err)
+	}
+}
+
+func TestRetentionPolicyInvalid(t *testing.T) {
+	wal, _ := newFakeDAL(t)
+	for _, policy := range []RetentionPolicy{
+		{},
+		{MaxAge: -time.Second},
+		{MaxBytes: -1},
+		{KeepLast: 1, Interval: -time.Second},
+	} {
+		if err := wal.StartRetention(context.Background(), policy); err == nil || !strings.Contains(err.Error(), "invalid retention policy") {
+			t.Errorf("expected %+v to be rejected, got %v", policy, err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Backoff returns how long to wait before retry n, counting from 1.
+type Backoff func(retry int) time.Duration
+
+// ConstantBackoff waits d before every retry.
+func ConstantBackoff(d time.Duration) Backoff {
+	return func(int) time.Duration { return d }
+}
+
+// ExponentialBackoff waits initial before the first retry and doubles the
+// wait after each one, up to limit.
+func ExponentialBackoff(initial, limit time.Duration) Backoff {
+	return func(retry int) time.Duration {
+		d := initial
+		for i := 1; i < retry && d < limit; i++ {
+			d *= 2
+		}
+		return min(d, limit)
+	}
+}
+
+// retryClient retries the record requests S3 fails transiently under a retry
+// policy; see WithRetryPolicy.
+type retryClient struct {
+	s3API
+	attempts int
+	backoff  Backoff
+	// stats counts the retries for Stats
+	stats *dalStats
+}
+
+// retry runs call up to c's attempts times while it fails with a retryable
+// error, waiting out the backoff in between unless ctx is done first. A
+// request with a body is only retried if the body can be rewound.
+func retry[T any](ctx context.Context, c *retryClient, body io.Reader, call func() (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		out, err := call()
+		if err == nil || attempt == c.attempts || !isRetryable(ctx, err) || !rewind(body) {
+			return out, err
+		}
+
+		timer := time.NewTimer(c.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return out, err
+		}
+		c.stats.retries.Add(1)
+	}
+}
+
+// isRetryable reports whether a request that failed with err may succeed if
+// sent again: S3 throttling it or failing with a 5xx, or the connection
+// failing. Answers about the request itself, such as a missing key, a failed
+// precondition or a denied request, are permanent, and so is any error once
+// the caller's ctx is done. An attempt cut off by WithOperationTimeout while
+// ctx is still live is retried.
+func isRetryable(ctx context.Context, err error) bool {
+	switch {
+	case ctx.Err() != nil, errors.Is(err, context.Canceled):
+		return false
+	case isNotFound(err), isPreconditionFailed(err), isNotModified(err), isAccessDenied(err):
+		return false
+	case errors.Is(err, ErrChecksumMismatch), errors.Is(err, ErrReadOnly):
+		return false
+	case isSlowDown(err), hasErrorCode(err, "Throttling", "ThrottlingException", "RequestTimeout", "InternalError"):
+		return true
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.EPIPE):
+		return true
+	}
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.HTTPStatusCode() >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func (c *retryClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return retry(ctx, c, params.Body, func() (*s3.PutObjectOutput, error) {
+		return c.s3API.PutObject(ctx, params, optFns...)
+	})
+}
+
+func (c *retryClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return retry(ctx, c, nil, func() (*s3.GetObjectOutput, error) {
+		return c.s3API.GetObject(ctx, params, optFns...)
+	})
+}
+
+func (c *retryClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return retry(ctx, c, nil, func() (*s3.ListObjectsV2Output, error) {
+		return c.s3API.ListObjectsV2(ctx, params, optFns...)
+	})
+}
+
+func (c *retryClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return retry(ctx, c, nil, func() (*s3.HeadObjectOutput, error) {
+		return c.s3API.HeadObject(ctx, params, optFns...)
+	})
+}
+
+func (c *retryClient) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	return retry(ctx, c, nil, func() (*s3.HeadBucketOutput, error) {
+		return c.s3API.HeadBucket(ctx, params, optFns...)
+	})
+}
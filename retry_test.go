@@ -0,0 +1,165 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// flakyS3 fails each request with the next of errs until they run out.
+type flakyS3 struct {
+	*fakeS3
+	errs  []error
+	calls int
+}
+
+func (s *flakyS3) fail() error {
+	s.calls++
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func (s *flakyS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+	return s.fakeS3.PutObject(ctx, params, optFns...)
+}
+
+func (s *flakyS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+	return s.fakeS3.GetObject(ctx, params, optFns...)
+}
+
+func (s *flakyS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+	return s.fakeS3.ListObjectsV2(ctx, params, optFns...)
+}
+
+func statusError(code int) error {
+	return &awshttp.ResponseError{ResponseError: &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: code}},
+		Err:      errors.New("response error"),
+	}}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	client := &flakyS3{fakeS3: newFakeS3()}
+	wal, err := New(client, "fake-bucket", "fake-prefix", WithRetryPolicy(3, ConstantBackoff(time.Millisecond)))
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	ctx := context.Background()
+
+	client.errs = []error{statusError(http.StatusInternalServerError), &net.OpError{Op: "read", Err: syscall.ECONNRESET}}
+	offset, err := wal.Append(ctx, []byte("after two failures"))
+	if err != nil || client.calls != 3 {
+		t.Fatalf("expected the append to succeed on the third attempt, got %v after %d calls", err, client.calls)
+	}
+	client.calls, client.errs = 0, []error{&smithy.GenericAPIError{Code: "SlowDown"}}
+	if record, err := wal.Read(ctx, offset); err != nil || string(record.Data) != "after two failures" {
+		t.Fatalf("expected the read to succeed after retrying, got %q, %v", record.Data, err)
+	}
+	client.calls, client.errs = 0, []error{statusError(http.StatusBadGateway)}
+	if n, err := wal.Count(ctx); err != nil || n != 1 {
+		t.Fatalf("expected the list to succeed after retrying, got %d, %v", n, err)
+	}
+
+	client.calls, client.errs = 0, []error{statusError(500), statusError(500), statusError(500)}
+	if _, err := wal.Read(ctx, offset); err == nil || client.calls != 3 {
+		t.Errorf("expected the read to give up after 3 attempts, got %v after %d calls", err, client.calls)
+	}
+	client.calls, client.errs = 0, nil
+	if _, err := wal.Read(ctx, offset+1); !errors.Is(err, ErrRecordNotFound) || client.calls != 1 {
+		t.Errorf("expected a missing record not to be retried, got %v after %d calls", err, client.calls)
+	}
+	client.calls = 0
+	if err := wal.putRecord(ctx, offset, 0, []byte("again"), objectAttrs{}); !errors.Is(err, ErrOffsetConflict) || client.calls != 1 {
+		t.Errorf("expected a conflict not to be retried, got %v after %d calls", err, client.calls)
+	}
+
+	// a cancelled context stops the retries at once
+	slow, err := New(client, "fake-bucket", "fake-prefix", WithRetryPolicy(5, ConstantBackoff(time.Hour)))
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	client.calls, client.errs = 0, []error{statusError(500), statusError(500)}
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := slow.Read(cancelled, offset); err == nil || client.calls != 1 {
+		t.Errorf("expected the read to stop on cancellation, got %v after %d calls", err, client.calls)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the cancelled read to return promptly, took %v", elapsed)
+	}
+
+	if _, err := New(client, "fake-bucket", "fake-prefix", WithRetryPolicy(0, ConstantBackoff(0))); err == nil {
+		t.Error("expected zero attempts to be rejected")
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	ctx := context.Background()
+	done, cancel := context.WithCancel(ctx)
+	cancel()
+	coded := func(code string) error {
+		return &smithy.GenericAPIError{Code: code}
+	}
+
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"bare 500", ctx, statusError(http.StatusInternalServerError), true},
+		{"bare 503", ctx, statusError(http.StatusServiceUnavailable), true},
+		{"slow down", ctx, coded("SlowDown"), true},
+		{"throttling", ctx, coded("ThrottlingException"), true},
+		{"internal error", ctx, fmt.Errorf("put: %w", coded("InternalError")), true},
+		{"connection reset", ctx, &net.OpError{Op: "read", Err: syscall.ECONNRESET}, true},
+		{"attempt timeout", ctx, fmt.Errorf("get: %w", context.DeadlineExceeded), true},
+		{"bare 404", ctx, statusError(http.StatusNotFound), false},
+		{"no such key", ctx, coded("NoSuchKey"), false},
+		{"bare 412", ctx, statusError(http.StatusPreconditionFailed), false},
+		{"conditional conflict", ctx, coded("ConditionalRequestConflict"), false},
+		{"access denied", ctx, coded("AccessDenied"), false},
+		{"bare 400", ctx, statusError(http.StatusBadRequest), false},
+		{"checksum mismatch", ctx, fmt.Errorf("%w: offset 1", ErrChecksumMismatch), false},
+		{"cancelled", ctx, fmt.Errorf("get: %w", context.Canceled), false},
+		{"500 after cancellation", done, statusError(http.StatusInternalServerError), false},
+		{"unknown", ctx, errors.New("something else"), false},
+	} {
+		if got := isRetryable(tc.ctx, tc.err); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(10*time.Millisecond, 50*time.Millisecond)
+	for retry, want := range []time.Duration{10, 20, 40, 50, 50} {
+		if got := backoff(retry + 1); got != want*time.Millisecond {
+			t.Errorf("retry %d: expected %v, got %v", retry+1, want*time.Millisecond, got)
+		}
+	}
+}
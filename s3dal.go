@@ -3,45 +3,219 @@ package s3_dal
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/base64"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
-	"strconv"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/scritchley/orc"
 )
 
+// s3API is the subset of the S3 client used by S3DAL. *s3.Client satisfies it.
+type s3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+var _ s3API = (*s3.Client)(nil)
+
+// Records written with WithSkipCRCOnWrite before their header could flag them
+// carry this user metadata so Read knows their zero CRC trailer is not to be
+// validated.
+const (
+	metaChecksum = "dal-checksum"
+	checksumNone = "none"
+)
+
 type S3DAL struct {
-	client     *s3.Client
+	client     s3API
 	bucketName string
 	prefix     string
-	length     uint64
+	// emptyPrefix lets an empty prefix through New, see withEmptyPrefix
+	emptyPrefix bool
+	opts        []Option
+
+	// mu serialises offset allocation and the put that claims it, and
+	// guards length and size; S3DAL is safe for concurrent use
+	mu sync.Mutex
+	// length is the last offset allocated; offsets are record counters
+	length uint64
+	// size is the total payload bytes appended through this client, which
+	// is what the file size limit applies to
+	size uint64
+	// fileSizeLimit caps size; see WithFileSizeLimit
+	fileSizeLimit uint64
+	// stored is the total object bytes appended through this client, capped
+	// by storedSizeLimit; see WithStoredSizeLimit
+	stored          uint64
+	storedSizeLimit uint64
+	maxRecordSize   uint64
+	readAttempts    int
+	readBackoff     time.Duration
+	// opTimeout bounds each S3 request; see WithOperationTimeout
+	opTimeout time.Duration
+	// retryAttempts and retryBackoff retry transient S3 failures; see
+	// WithRetryPolicy
+	retryAttempts int
+	retryBackoff  Backoff
+	// limiter throttles requests; see WithRateLimit
+	limiter *rateLimiter
+
+	now         func() time.Time
+	logger      Logger
+	observer    Observer
+	maxScan     int
+	skipCRC     bool
+	compression Compression
+	checksum    Checksum
+	// checksummer is the implementation of checksum set with WithChecksum,
+	// nil if unset
+	checksummer Checksummer
+	s3Checksum  types.ChecksumAlgorithm
+	// verifyStorage compares read bodies with their S3 checksum, see
+	// WithStorageChecksum
+	verifyStorage bool
+	legacyFormat  bool
+	contentMD5    bool
+	beforeAppend  func(data []byte) ([]byte, error)
+	afterAppend   func(offset uint64) error
+	storageClass  types.StorageClass
+	sse           types.ServerSideEncryption
+	sseKMSKeyID   string
+	bucketKey     *bool
+	compaction    bool
+	// segments indexes the offsets of compacted segments, see existsCompacted
+	segments *segmentIndex
+	// fallbacks are the buckets of WithReadFallback, in the order tried
+	fallbacks []readFallback
+
+	multipartThreshold int
+	manifest           bool
+	// tags is the tag set of WithObjectTags and tagging its encoding
+	tags    map[string]string
+	tagging string
+	// contentType and metadata are set on every record object, from
+	// WithContentType and WithObjectMetadata
+	contentType string
+	metadata    map[string]string
+	// reserved holds the offsets Reserve handed out that are not yet
+	// committed; guarded by mu
+	reserved map[uint64]struct{}
+	// timestamps stores a creation time in each record; lastCreated is the
+	// last one stored, kept so they only increase
+	timestamps  bool
+	lastCreated int64
+	// packRecords is the most records per object in a packed log, or 0; see
+	// WithPacking. pending holds the records of the pack not yet written.
+	packRecords  int
+	pending      []packEntry
+	pendingBytes int
+	// shards is the number of sub-prefixes records are spread over, or 0
+	shards int
+	// keys opens encrypted records; with encrypt set, new records are sealed
+	// under encryptKeyID. See WithClientEncryption.
+	keys         keyRing
+	encryptKeyID uint32
+	encrypt      bool
+	// fence is the epoch claimed with ClaimEpoch, checked before each write
+	fence atomic.Pointer[epochClaim]
+
+	// lifetime is cancelled by Close, stopping background work with it
+	lifetime context.Context
+	stop     context.CancelFunc
+
+	batchConcurrency int
+	atomicBatch      bool
+	readConcurrency  int
+	scanPrefetch     int
+
+	encodeOffset func(uint64) string
+	decodeOffset func(string) (uint64, error)
+	// delimiter separates the prefix, shard and offset parts of keys
+	delimiter string
+	// keyVersion is the key version of WithKeyVersion records are written
+	// under; 0 and 1 both mean directly under the prefix
+	keyVersion int
+	// cache is the record cache of WithReadCache, or nil
+	cache *recordCache
+	// overwrite is the policy of WithOverwritePolicy
+	overwrite OverwritePolicy
+	// stats holds the counters and gauges of Stats
+	stats dalStats
+	// async is the append queue of WithAppendBuffer, or nil
+	async *asyncWriter
+
+	listPageSize    int32
+	listParallelism int
+	requestPayer    bool
 }
 
-func S3DALClient(client *s3.Client, bucketName, prefix string) *S3DAL {
-	return &S3DAL{
-		client:     client,
-		bucketName: bucketName,
-		prefix:     prefix,
-		length:     0,
+var _ Log = (*S3DAL)(nil)
+
+// S3DALClient is New without options, except that it accepts an empty
+// prefix, as it always has, keeping the log's keys directly under the
+// delimiter. New rejects one.
+func S3DALClient(client s3API, bucketName, prefix string) *S3DAL {
+	w, err := New(client, bucketName, prefix, withEmptyPrefix())
+	if err != nil {
+		// nothing else can fail without options
+		panic(err)
 	}
+	return w
 }
 
 func (w *S3DAL) getObjectKey(offset uint64) string {
-	return w.prefix + "/" + fmt.Sprintf("%020d", offset)
+	return w.shardPrefix(w.shardOf(offset)) + w.encodeOffset(offset)
 }
 
 func (w *S3DAL) getOffsetFromKey(key string) (uint64, error) {
-	// skip the `w.prefix` and "/"
-	numStr := key[len(w.prefix)+1:]
-	return strconv.ParseUint(numStr, 10, 64)
+	numStr, ok := strings.CutPrefix(key, w.keyPrefix())
+	if !ok {
+		return 0, fmt.Errorf("invalid offset key %q: not under prefix %q", key, w.prefix)
+	}
+	if name, rest, ok := strings.Cut(numStr, w.delimiter); ok && w.isVersionName(name) {
+		numStr = rest
+	}
+	if w.shards == 0 {
+		return w.decodeOffset(numStr)
+	}
+	return w.shardedOffset(numStr)
 }
 
+// crc16Init is the starting register of the record CRC16. It is deliberately
+// not a standard value: the algorithm is CRC-16/CCITT-FALSE (polynomial
+// 0x1021, no reflection, no final XOR), which starts from 0xFFFF, so a
+// standard CRC library gives different sums for the same bytes. Every stored
+// record depends on it; it must never change.
+const crc16Init uint16 = 0xCACA
+
 func crc16Fast(data []byte) uint16 {
+	return crc16Update(crc16Init, data)
+}
+
+// crc16Update continues a CRC16 computation over data.
+func crc16Update(crc uint16, data []byte) uint16 {
 	const polynomial uint16 = 0x1021 // CRC-16-CCITT polynomial
-	crc := uint16(0xCACA)            // Common initialization value
 	for _, b := range data {
 		crc ^= uint16(b) << 8
 		for i := 0; i < 8; i++ {
@@ -55,25 +229,20 @@ func crc16Fast(data []byte) uint16 {
 	return crc
 }
 
-func validateChecksum(data []byte) bool {
-	if len(data) < 2 {
+// validateChecksum checks the trailer of data with c.
+func validateChecksum(data []byte, c Checksummer, logger Logger) bool {
+	if len(data) < c.Size() {
 		return false
 	}
 
-	// Extract stored CRC (ensure correct endianness)
-	storedCRC := binary.BigEndian.Uint16(data[len(data)-2:])
-	// Data used for CRC calculation
-	recordData := data[:len(data)-2]
+	// Extract stored checksum (ensure correct endianness)
+	storedSum := data[len(data)-c.Size():]
+	// Data used for checksum calculation
+	recordData := data[:len(data)-c.Size()]
 
-	// Calculate CRC using corrected algorithm
-	calculatedCRC := crc16Fast(recordData)
-
-	// Debug logs
-	fmt.Printf("Stored CRC: 0x%04X\n", storedCRC)
-	fmt.Printf("Calculated CRC: 0x%04X\n", calculatedCRC)
-	fmt.Printf("Data used for CRC: %v\n", recordData)
-
-	return storedCRC == calculatedCRC
+	ok := c.Verify(recordData, storedSum)
+	logger.Debugf("stored %v 0x%X over %d bytes, verified: %t", c, storedSum, len(recordData), ok)
+	return ok
 }
 
 func convertToOrc(data []map[string]interface{}) ([]byte, error) {
@@ -102,23 +271,6 @@ func convertToOrc(data []map[string]interface{}) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func prepareBody(offset uint64, data []byte) ([]byte, error) {
-	// 8 bytes for offset, len(data) bytes for data, 2 bytes for CRC16
-	bufferLen := 8 + len(data) + 2
-	buf := bytes.NewBuffer(make([]byte, 0, bufferLen))
-	if err := binary.Write(buf, binary.BigEndian, offset); err != nil {
-		return nil, err
-	}
-	if _, err := buf.Write(data); err != nil {
-		return nil, err
-	}
-	crc := crc16Fast(buf.Bytes()) // Exclude space for CRC during calculation
-	if err := binary.Write(buf, binary.BigEndian, crc); err != nil {
-		return nil, err
-	}
-	return buf.Bytes(), nil
-}
-
 func prepareBodyOrc(offset uint64, data []map[string]interface{}) ([]byte, error) {
 	// Convert data to ORC format
 	orcData, err := convertToOrc(data)
@@ -151,117 +303,833 @@ func prepareBodyOrc(offset uint64, data []map[string]interface{}) ([]byte, error
 	return buf.Bytes(), nil
 }
 
-func (w *S3DAL) Append(ctx context.Context, data []byte, fileSizeLimit uint64) (uint64, error) {
-	// Check if adding the new data will exceed the allowed file size
-	newDataSize := uint64(len(data))
-	if w.length+newDataSize > fileSizeLimit {
-		return 0, fmt.Errorf("appending data would exceed the file size limit of %d bytes", fileSizeLimit)
+// Close releases the S3DAL: it waits for an in-flight append to finish,
+// stops the goroutines behind any Follow or Scan, and makes later appends and
+// reads fail with ErrClosed. Manifest updates are made synchronously with each
+// append, so none is left pending; buffered records are written as Flush
+// writes them, and queued ones waited for, and the DAL is closed even if that
+// fails. Closing twice is a no-op. The S3 client is not closed, as the caller owns it.
+func (w *S3DAL) Close() error {
+	var asyncErr error
+	if w.async != nil {
+		asyncErr = w.async.wait(context.Background(), true)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.lifetime.Err() != nil {
+		return nil
+	}
+	err := w.flushPack(context.Background())
+	w.stop()
+	return errors.Join(asyncErr, err)
+}
+
+// Flush writes any records Append has buffered and returns once they are
+// durable, so a caller can acknowledge them. Only a packed log (see
+// WithPacking) buffers records, and WithAppendBuffer queues them, in which
+// case Flush waits for the records appended before it and returns the first
+// write failure since the last Flush; otherwise every Append is durable when
+// it returns and Flush does nothing. If the write fails the records stay
+// buffered for the next Flush, unless another writer took their offsets, in
+// which case they are dropped and Flush fails with ErrOffsetConflict.
+func (w *S3DAL) Flush(ctx context.Context) error {
+	if w.async != nil {
+		if w.lifetime.Err() != nil {
+			return ErrClosed
+		}
+		return w.async.wait(ctx, false)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.lifetime.Err() != nil {
+		return ErrClosed
 	}
+	return w.flushPack(ctx)
+}
+
+// Sync checks that the last offset in S3 is the length, the last offset this
+// client wrote, and fails with ErrTailMismatch if not: a lower tail means a
+// write was lost or deleted, a higher one that another writer appended. It
+// finds the tail as LastRecord does but reads no record and leaves the length
+// alone. Records a packed log still buffers are not expected in S3 (Flush
+// writes them), while offsets handed out by Reserve and not yet committed
+// are. Unlike Flush it writes nothing.
+func (w *S3DAL) Sync(ctx context.Context) error {
+	if w.lifetime.Err() != nil {
+		return ErrClosed
+	}
+	local := w.durableLength()
+	remote, err := w.lastOffset(ctx)
+	if err != nil && !errors.Is(err, ErrEmptyLog) {
+		return fmt.Errorf("failed to find the tail: %w", err)
+	}
+	if remote > local {
+		// this client may have appended meanwhile
+		local = max(local, w.durableLength())
+	}
+	if remote != local {
+		return fmt.Errorf("%w: last offset in S3 is %d, this client wrote up to %d", ErrTailMismatch, remote, local)
+	}
+	return nil
+}
+
+// durableLength is the length less the records still buffered for a pack
+// or queued by WithAppendBuffer.
+func (w *S3DAL) durableLength() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.pending) > 0 {
+		return w.pending[0].offset - 1
+	}
+	if w.async != nil {
+		if low, ok := w.async.lowest(); ok {
+			return low - 1
+		}
+	}
+	return w.length
+}
+
+// Length returns the last offset this client allocated or recovered, which
+// is also the number of records it believes exist. It is not re-read from
+// S3: it advances on Append and LastRecord and is set by OpenS3DAL and
+// LoadLength, so writes made by other clients show up only after one of
+// those.
+func (w *S3DAL) Length() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.length
+}
+
+// Append writes data as the next record and returns its offset. It fails
+// without writing if the payload is larger than WithMaxRecordSize allows, or
+// if it would take the total appended bytes past the limit configured with
+// WithFileSizeLimit. Empty records are allowed. Records larger than the
+// WithMultipartThreshold are uploaded in parts. Under WithAppendBuffer it
+// returns once the record is queued, not written; see there.
+func (w *S3DAL) Append(ctx context.Context, data []byte) (uint64, error) {
+	return w.append(ctx, data, w.fileSizeLimit, w.attrs())
+}
+
+// AppendWithTags is Append with tags added to the object's tag set for this
+// record only, overriding those configured with WithObjectTags key by key.
+// The combined set is validated as WithObjectTags validates it.
+func (w *S3DAL) AppendWithTags(ctx context.Context, data []byte, tags map[string]string) (uint64, error) {
+	tagging, err := w.taggingFor(tags)
+	if err != nil {
+		return 0, err
+	}
+	attrs := w.attrs()
+	attrs.tagging = tagging
+	return w.append(ctx, data, w.fileSizeLimit, attrs)
+}
+
+// AppendWithMetadata is Append with the record's object written with
+// contentType instead of the WithContentType one, unless it is empty, and
+// with metadata added to that of WithObjectMetadata, overriding it key by key.
+// The metadata is validated as WithObjectMetadata validates it.
+func (w *S3DAL) AppendWithMetadata(ctx context.Context, data []byte, contentType string, metadata map[string]string) (uint64, error) {
+	attrs, err := w.attrsFor(contentType, metadata)
+	if err != nil {
+		return 0, err
+	}
+	return w.append(ctx, data, w.fileSizeLimit, attrs)
+}
 
+// AppendWithLimit is Append with fileSizeLimit enforced in place of the
+// configured limit, for this call only.
+//
+// Deprecated: configure the limit once with WithFileSizeLimit and use Append.
+func (w *S3DAL) AppendWithLimit(ctx context.Context, data []byte, fileSizeLimit uint64) (uint64, error) {
+	return w.append(ctx, data, fileSizeLimit, w.attrs())
+}
+
+func (w *S3DAL) append(ctx context.Context, data []byte, fileSizeLimit uint64, attrs objectAttrs) (offset uint64, err error) {
+	if w.async != nil {
+		return w.appendAsync(ctx, data, fileSizeLimit, attrs)
+	}
+	start := time.Now()
+	defer func() { w.observer.RecordAppend(len(data), time.Since(start), err) }()
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	// Calculate the next offset
 	nextOffset := w.length + 1
+	defer func() { err = w.opError("append", nextOffset, err) }()
+	if w.lifetime.Err() != nil {
+		return 0, ErrClosed
+	}
+
+	data, err = w.admitRecord(data, w.size, fileSizeLimit)
+	if err != nil {
+		return 0, err
+	}
 
 	// Prepare the body for upload
-	buf, err := prepareBody(nextOffset, data)
+	payload, err := compressPayload(w.compression, data)
 	if err != nil {
-		return 0, fmt.Errorf("failed to prepare object body: %w", err)
+		return 0, fmt.Errorf("failed to prepare object body: failed to compress payload: %w", err)
 	}
 
-	input := &s3.PutObjectInput{
-		Bucket:      aws.String(w.bucketName),
-		Key:         aws.String(w.getObjectKey(nextOffset)),
-		Body:        bytes.NewReader(buf),
-		IfNoneMatch: aws.String("*"),
+	stored := w.storedSize(len(payload))
+	if err := w.checkStoredSize(w.stored, stored); err != nil {
+		return 0, err
 	}
 
 	// Attempt to write the data to S3
-	if _, err = w.client.PutObject(ctx, input); err != nil {
-		return 0, fmt.Errorf("failed to put object to S3: %w", err)
+	if w.packRecords > 0 {
+		err = w.bufferRecord(ctx, nextOffset, payload)
+	} else {
+		err = w.putRecord(ctx, nextOffset, w.nextCreated(), payload, attrs)
+	}
+	if err != nil {
+		return 0, err
 	}
 
-	// Update the current length
-	w.length = nextOffset
+	// Update the current length and size
+	w.setLength(nextOffset)
+	w.size += uint64(len(data))
+	w.setStored(w.stored + stored)
+	w.recordInManifest(ctx, nextOffset)
+
+	if w.afterAppend != nil {
+		if err := w.afterAppend(nextOffset); err != nil {
+			return nextOffset, fmt.Errorf("after-append hook failed for committed offset %d: %w", nextOffset, err)
+		}
+	}
 	return nextOffset, nil
 }
 
-func (w *S3DAL) Read(ctx context.Context, offset uint64) (Record, error) {
-	key := w.getObjectKey(offset)
-	input := &s3.GetObjectInput{
-		Bucket: aws.String(w.bucketName),
-		Key:    aws.String(key),
+// admitRecord runs the before-append hook over data and checks the result
+// against the record and file size limits, with size bytes already in the
+// log. The caller holds mu.
+func (w *S3DAL) admitRecord(data []byte, size, fileSizeLimit uint64) ([]byte, error) {
+	if w.beforeAppend != nil {
+		transformed, err := w.beforeAppend(data)
+		if err != nil {
+			return nil, fmt.Errorf("append aborted by hook: %w", err)
+		}
+		data = transformed
+	}
+
+	if err := w.checkRecordSize(size, uint64(len(data)), fileSizeLimit); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// checkRecordSize checks a record of newDataSize bytes against the record and
+// file size limits, with size bytes already in the log: w.size, or a running
+// total for a batch. The caller holds mu.
+func (w *S3DAL) checkRecordSize(size, newDataSize, fileSizeLimit uint64) error {
+	if newDataSize > w.maxRecordSize {
+		return fmt.Errorf("%w: %d bytes exceeds the limit of %d", ErrRecordTooLarge, newDataSize, w.maxRecordSize)
+	}
+	if size+newDataSize > fileSizeLimit {
+		return &SizeLimitError{Limit: fileSizeLimit, Total: size + newDataSize}
 	}
+	return nil
+}
+
+// putRecord writes payload, already compressed, as the record at offset with
+// a conditional put, in parts if it is over the multipart threshold. The
+// payload is sealed first if encryption is on. Under OverwriteIfSame a
+// conflict with a record holding the same data is not an error.
+func (w *S3DAL) putRecord(ctx context.Context, offset uint64, created int64, payload []byte, attrs objectAttrs) error {
+	err := w.putPayload(ctx, offset, created, payload, attrs)
+	if w.overwrite == OverwriteIfSame && errors.Is(err, ErrOffsetConflict) {
+		if data, derr := decompressPayload(w.compression, payload); derr == nil {
+			return w.keepIdentical(ctx, offset, data, err)
+		}
+	}
+	return err
+}
 
-	result, err := w.client.GetObject(ctx, input)
+// putPayload is putRecord without the OverwriteIfSame check.
+func (w *S3DAL) putPayload(ctx context.Context, offset uint64, created int64, payload []byte, attrs objectAttrs) error {
+	if err := w.checkFence(ctx); err != nil {
+		return err
+	}
+	if w.encrypt {
+		var err error
+		if payload, err = w.sealPayload(offset, created, payload); err != nil {
+			return err
+		}
+	}
+	if maxHeaderLen+len(payload)+w.checksum.Size() > w.multipartThreshold {
+		header := appendHeader(nil, offset, created, w.compression, w.checksum, w.encrypt, w.skipCRC)
+		body := io.MultiReader(bytes.NewReader(header), bytes.NewReader(payload))
+		return w.putMultipart(ctx, offset, body, len(header)+len(payload), attrs)
+	}
+	buf := frameBody(offset, created, payload, w.compression, w.checksummerFor(w.checksum), w.encrypt, w.skipCRC)
+	input := w.putInput(offset, buf)
+	input.Tagging = nilIfEmpty(attrs.tagging)
+	input.ContentType = nilIfEmpty(attrs.contentType)
+	input.Metadata = w.objectMetadata(attrs.metadata)
+	if _, err := w.client.PutObject(ctx, input); err != nil {
+		return w.putRecordError(offset, err)
+	}
+	return nil
+}
+
+// nextCreated returns the creation time to store in the next record, or 0
+// without WithTimestamps. Times are strictly increasing per client even if the
+// clock steps back. The caller holds mu.
+func (w *S3DAL) nextCreated() int64 {
+	if !w.timestamps {
+		return 0
+	}
+	w.lastCreated = max(w.now().UnixNano(), w.lastCreated+1)
+	return w.lastCreated
+}
+
+// putInput builds the conditional put of a framed record body at offset.
+func (w *S3DAL) putInput(offset uint64, body []byte) *s3.PutObjectInput {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(w.bucketName),
+		Key:         aws.String(w.getObjectKey(offset)),
+		Body:        bytes.NewReader(body),
+		IfNoneMatch: w.ifNoneMatch(),
+		ContentType: nilIfEmpty(w.contentType),
+		Metadata:    w.objectMetadata(w.metadata),
+	}
+	if w.storageClass != "" {
+		input.StorageClass = w.storageClass
+	}
+	input.Tagging = nilIfEmpty(w.tagging)
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.BucketKeyEnabled = w.sseParams()
+	input.ChecksumAlgorithm = w.uploadChecksum()
+	if w.contentMD5 {
+		sum := md5.Sum(body)
+		input.ContentMD5 = aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+	}
+	return input
+}
+
+// sseParams returns the server-side encryption settings for a put; all are
+// zero unless WithSSES3 or WithSSEKMS is configured, and the bucket key
+// setting unless WithBucketKeyEnabled is.
+func (w *S3DAL) sseParams() (types.ServerSideEncryption, *string, *bool) {
+	if w.sseKMSKeyID == "" {
+		return w.sse, nil, nil
+	}
+	return w.sse, aws.String(w.sseKMSKeyID), w.bucketKey
+}
+
+// Read returns the record at offset. Offset 0 is never a record and fails
+// with ErrInvalidOffset without a request.
+func (w *S3DAL) Read(ctx context.Context, offset uint64) (record Record, err error) {
+	start := time.Now()
+	defer func() { w.observeRead(offset, start, record, err) }()
+	defer func() { err = w.opError("read", offset, err) }()
+	if offset == 0 {
+		return Record{}, errOffsetZero
+	}
+	if w.packRecords > 0 {
+		return w.readPacked(ctx, offset)
+	}
+	return w.readRecord(ctx, offset, "")
+}
+
+// ReadIfChanged reads the record at offset unless its ETag is still
+// knownETag, the Record.ETag of an earlier read, so a poll loop does not
+// download an unchanged record again. If S3 answers 304 Not Modified it
+// returns changed false and an empty Record. An empty knownETag always reads.
+func (w *S3DAL) ReadIfChanged(ctx context.Context, offset uint64, knownETag string) (record Record, changed bool, err error) {
+	start := time.Now()
+	defer func() { w.observeRead(offset, start, record, err) }()
+	if offset == 0 {
+		return Record{}, false, w.opError("read", offset, errOffsetZero)
+	}
+	record, err = w.readRecord(ctx, offset, knownETag)
+	if isNotModified(err) {
+		return Record{}, false, nil
+	}
 	if err != nil {
-		return Record{}, fmt.Errorf("failed to get object from S3: %w", err)
+		return Record{}, false, w.opError("read", offset, err)
+	}
+	return record, true, nil
+}
+
+// readRecord gets and decodes the record at offset, conditional on its ETag
+// differing from ifNoneMatch if that is set. Unconditional reads go through
+// the read cache.
+func (w *S3DAL) readRecord(ctx context.Context, offset uint64, ifNoneMatch string) (Record, error) {
+	if ifNoneMatch == "" && w.lifetime.Err() == nil {
+		if record, ok := w.cache.get(offset); ok {
+			return record, nil
+		}
+	}
+	result, err := w.getRecord(ctx, offset, ifNoneMatch)
+	if err != nil {
+		return Record{}, err
 	}
 	defer result.Body.Close()
 
 	data, err := io.ReadAll(result.Body)
 	if err != nil {
-		return Record{}, fmt.Errorf("failed to read object body: %w", err)
+		return Record{}, storageReadError(err)
+	}
+	if err := w.checkStorageChecksum(result, data); err != nil {
+		return Record{}, err
+	}
+	record, err := w.decodeBody(offset, data, result.Metadata[metaChecksum] != checksumNone)
+	if err != nil {
+		return Record{}, err
 	}
-	if len(data) < 10 {
-		return Record{}, fmt.Errorf("invalid record: data too short")
+	record.ETag = aws.ToString(result.ETag)
+	record.Size = aws.ToInt64(result.ContentLength)
+	record.LastModified = aws.ToTime(result.LastModified)
+	record.ContentType = aws.ToString(result.ContentType)
+	record.Metadata = userMetadata(result.Metadata)
+	w.cache.put(record)
+	return record, nil
+}
+
+// ReadRaw reads the record stored at the literal key, for recovery tooling
+// working from a raw listing. Unlike Read it returns the offset stored in the
+// body, and if the key is a record key of the log naming a different offset,
+// under any delimiter, shard or key version, it returns the decoded record
+// together with an *OffsetMismatchError naming both. A missing key is ErrRecordNotFound; the checksum is verified as by
+// Read, and a record that fails it is not returned.
+func (w *S3DAL) ReadRaw(ctx context.Context, key string) (Record, error) {
+	if w.lifetime.Err() != nil {
+		return Record{}, ErrClosed
 	}
+	result, err := w.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:       aws.String(w.bucketName),
+		Key:          aws.String(key),
+		ChecksumMode: w.downloadChecksum(),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return Record{}, fmt.Errorf("%w: key %q: %w", ErrRecordNotFound, key, err)
+		}
+		return Record{}, fmt.Errorf("failed to get object from S3: %w", err)
+	}
+	defer result.Body.Close()
 
-	var storedOffset uint64
-	if err = binary.Read(bytes.NewReader(data[:8]), binary.BigEndian, &storedOffset); err != nil {
-		return Record{}, err
+	body, err := io.ReadAll(result.Body)
+	if err != nil {
+		return Record{}, storageReadError(err)
+	}
+	if err := w.checkStorageChecksum(result, body); err != nil {
+		return Record{}, fmt.Errorf("key %q: %w", key, err)
+	}
+	f, err := parseFrame(body, w.legacyFormat)
+	if err != nil {
+		return Record{}, fmt.Errorf("key %q: %w", key, withSize(err, int64(len(body))))
+	}
+	if !unchecked(result.Metadata, f, body) && !validateChecksum(body, w.checksummerFor(f.checksum), w.logger) {
+		w.observer.RecordChecksumFailure(f.offset)
+		return Record{}, fmt.Errorf("%w: key %q", ErrChecksumMismatch, key)
+	}
+	data, err := w.keys.payload(f)
+	if err != nil {
+		return Record{}, fmt.Errorf("key %q: %w", key, err)
+	}
+	data, err = decompressPayload(f.codec, data)
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to decompress record at key %q: %w", key, err)
+	}
+	record := Record{
+		Offset:       f.offset,
+		Data:         data,
+		ETag:         aws.ToString(result.ETag),
+		Size:         aws.ToInt64(result.ContentLength),
+		LastModified: aws.ToTime(result.LastModified),
+		CreatedAt:    createdAt(f.created),
+	}
+	if named, err := w.getOffsetFromKey(key); err == nil && named != f.offset {
+		return record, &OffsetMismatchError{Key: key, KeyOffset: named, BodyOffset: f.offset}
+	}
+	return record, nil
+}
+
+// Exists reports whether a record exists at offset, with a single HeadObject
+// call, or one per version with WithKeyVersion. A missing key is false with a
+// nil error, as is offset 0 without any call; any other failure is returned.
+// The body is not read, so the record's checksum is not checked.
+func (w *S3DAL) Exists(ctx context.Context, offset uint64) (bool, error) {
+	if w.packRecords > 0 {
+		return false, ErrPackedLog
+	}
+	if offset == 0 {
+		return false, nil
+	}
+	var err error
+	for _, key := range w.objectKeys(offset) {
+		if _, err = w.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(w.bucketName),
+			Key:    aws.String(key),
+		}); !isNotFound(err) {
+			break
+		}
+	}
+	if err != nil {
+		if isNotFound(err) && w.compaction {
+			return w.existsCompacted(ctx, offset)
+		}
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to head object in S3: %w", err)
 	}
-	if storedOffset != offset {
-		return Record{}, fmt.Errorf("offset mismatch: expected %d, got %d", offset, storedOffset)
+	return true, nil
+}
+
+// getRecord fetches the object at offset. A missing key is retried as
+// configured with WithReadRetry, waiting twice as long before each attempt,
+// and reported as ErrRecordNotFound once attempts run out. The keys of older
+// key versions and then the fallback buckets are tried, if any.
+func (w *S3DAL) getRecord(ctx context.Context, offset uint64, ifNoneMatch string) (*s3.GetObjectOutput, error) {
+	result, err := w.getPrimaryRecord(ctx, offset, ifNoneMatch)
+	if err != nil && len(w.fallbacks) > 0 && canFailOver(ctx, err) {
+		return w.getFallbackRecord(ctx, offset, ifNoneMatch, err)
+	}
+	return result, err
+}
+
+// getPrimaryRecord is getRecord from the log's own bucket.
+func (w *S3DAL) getPrimaryRecord(ctx context.Context, offset uint64, ifNoneMatch string) (*s3.GetObjectOutput, error) {
+	if w.lifetime.Err() != nil {
+		return nil, ErrClosed
 	}
-	if !validateChecksum(data) {
-		return Record{}, fmt.Errorf("CRC mismatch")
+	if w.packRecords > 0 {
+		return nil, ErrPackedLog
+	}
+	input := &s3.GetObjectInput{
+		Bucket:       aws.String(w.bucketName),
+		Key:          aws.String(w.getObjectKey(offset)),
+		IfNoneMatch:  nilIfEmpty(ifNoneMatch),
+		ChecksumMode: w.downloadChecksum(),
+	}
+	backoff := w.readBackoff
+	for attempt := 1; ; attempt++ {
+		result, err := w.client.GetObject(ctx, input)
+		if err == nil {
+			return result, nil
+		}
+		if isNotFound(err) && attempt >= w.readAttempts && w.keyVersion > 1 {
+			var result *s3.GetObjectOutput
+			if result, err = w.getOlderVersion(ctx, offset, input); err == nil {
+				return result, nil
+			}
+		}
+		if isNotFound(err) && attempt >= w.readAttempts && w.compaction {
+			return w.getCompacted(ctx, offset, ifNoneMatch, err)
+		}
+		if !isNotFound(err) || attempt >= w.readAttempts {
+			return nil, getRecordError(offset, err)
+		}
+		w.logger.Debugf("offset %d not found on attempt %d, retrying in %v", offset, attempt, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
 	}
-	return Record{
-		Offset: storedOffset,
-		Data:   data[8 : len(data)-2],
-	}, nil
 }
 
+// LastRecord returns the record at the highest offset. It advances the length
+// to that offset if it is behind, under the lock appends hold, but never moves
+// it back, so an append that lands while the tail is being looked up is not
+// handed out again. To resynchronise the length with the log, as after
+// another client truncated it, use OpenS3DAL or LoadLength.
+//
+// With a known length, as after an Append or OpenS3DAL, only the keys after
+// it are listed with StartAfter, typically a single small page, and the tail
+// is the last of them, or the record at the length if there are none. If that
+// record is gone, e.g. trimmed or truncated by another client, the guess is
+// stale and the searches below are used.
+//
+// They assume offsets are dense: every offset from the first surviving record
+// up to the last is present. Under that assumption the tail is found with
+// O(log n) HeadObject calls, then confirmed with a single list for keys past
+// it. If the log is sparse (gaps from failed or deleted writes) the check
+// catches it and LastRecord falls back to listing the whole prefix. With
+// WithManifest the tail is read from the manifest instead, confirmed by the
+// same single list.
 func (w *S3DAL) LastRecord(ctx context.Context) (Record, error) {
-	// Set up the input for listing objects with reversed order
-	input := &s3.ListObjectsV2Input{
-		Bucket: aws.String(w.bucketName),
-		Prefix: aws.String(w.prefix + "/"),
+	maxOffset, err := w.lastOffset(ctx)
+	if err != nil {
+		return Record{}, err
 	}
 
-	// Initialize paginator
-	paginator := s3.NewListObjectsV2Paginator(w.client, input)
+	w.mu.Lock()
+	w.setLength(max(w.length, maxOffset))
+	w.mu.Unlock()
+	return w.Read(ctx, maxOffset)
+}
 
-	var lastKey string
-	for paginator.HasMorePages() {
-		output, err := paginator.NextPage(ctx)
-		if err != nil {
-			return Record{}, fmt.Errorf("failed to list objects from S3: %w", err)
+// lastOffset returns the highest record offset, or ErrEmptyLog if there are
+// no records. See LastRecord for how it is found.
+func (w *S3DAL) lastOffset(ctx context.Context) (uint64, error) {
+	if w.packRecords > 0 {
+		return w.lastPackedOffset(ctx)
+	}
+	m, ok, err := w.freshManifest(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if ok && m.Count == 0 {
+		return 0, ErrEmptyLog
+	}
+	if ok {
+		// the tail may have been trimmed by a writer not maintaining it
+		if found, err := w.Exists(ctx, m.Last); err != nil || found {
+			return m.Last, err
 		}
+	}
+	if last, ok, err := w.listTailOffset(ctx); err != nil || ok {
+		return last, err
+	}
 
-		// Get the last key in this page (keys are lexicographically sorted)
-		if len(output.Contents) > 0 {
-			lastKey = *output.Contents[len(output.Contents)-1].Key
+	last, ok, err := w.probeLastOffset(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return last, nil
+	}
+	return w.listLastOffset(ctx)
+}
+
+// listTailOffset finds the last offset by listing only the keys after the
+// length. ok is false if the length is 0 or stale, with no record at or
+// after it.
+func (w *S3DAL) listTailOffset(ctx context.Context) (last uint64, ok bool, err error) {
+	w.mu.Lock()
+	known := w.length
+	w.mu.Unlock()
+	if known == 0 {
+		return 0, false, nil
+	}
+
+	err = w.listRecords(ctx, known, 0, func(offset uint64, _ types.Object) (bool, error) {
+		last, ok = offset, true
+		return true, nil
+	})
+	if err != nil || ok {
+		return last, ok, err
+	}
+	if ok, err = w.Exists(ctx, known); err != nil || !ok {
+		return 0, false, err
+	}
+	return known, true, nil
+}
+
+// probeLastOffset finds the last offset of a dense log with HeadObject: it
+// gallops forward from a known record until an offset is missing, then
+// binary searches between the two. ok is false if there was no record to
+// start from or records exist past the result, i.e. the log is not dense.
+func (w *S3DAL) probeLastOffset(ctx context.Context) (last uint64, ok bool, err error) {
+	w.mu.Lock()
+	lo := w.length
+	w.mu.Unlock()
+
+	found := false
+	if lo > 0 {
+		if found, err = w.Exists(ctx, lo); err != nil {
+			return 0, false, err
+		}
+	}
+	if !found {
+		lo = 1
+		if found, err = w.Exists(ctx, lo); err != nil || !found {
+			return 0, false, err
 		}
 	}
 
-	if lastKey == "" {
-		return Record{}, fmt.Errorf("WAL is empty")
+	// invariant: lo exists, hi does not
+	var hi uint64
+	for step := uint64(1); ; step *= 2 {
+		if lo == math.MaxUint64 {
+			return lo, true, nil
+		}
+		next := lo + step
+		if next < lo {
+			next = math.MaxUint64
+		}
+		found, err := w.Exists(ctx, next)
+		if err != nil {
+			return 0, false, err
+		}
+		if !found {
+			hi = next
+			break
+		}
+		lo = next
+	}
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		found, err := w.Exists(ctx, mid)
+		if err != nil {
+			return 0, false, err
+		}
+		if found {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	beyond, err := w.hasRecordAfter(ctx, lo)
+	if err != nil || beyond {
+		return 0, false, err
 	}
+	return lo, true, nil
+}
 
-	// Extract the offset from the last key
-	maxOffset, err := w.getOffsetFromKey(lastKey)
+// hasRecordAfter reports whether any record exists after offset. It stops at
+// the first one, so it costs a single list call per shard on a dense log.
+func (w *S3DAL) hasRecordAfter(ctx context.Context, offset uint64) (bool, error) {
+	found := false
+	err := w.listRecords(ctx, offset, 0, func(uint64, types.Object) (bool, error) {
+		found = true
+		return false, nil
+	})
+	return found, err
+}
+
+// listLastOffset lists the whole prefix and returns the highest record
+// offset, or ErrEmptyLog if there are no records.
+func (w *S3DAL) listLastOffset(ctx context.Context) (uint64, error) {
+	var maxOffset uint64
+	found := false
+	err := w.listAll(ctx, 0, func(offset uint64, _ types.Object) (bool, error) {
+		maxOffset, found = offset, true
+		return true, nil
+	})
 	if err != nil {
-		return Record{}, fmt.Errorf("failed to parse offset from key: %w", err)
+		return 0, err
 	}
+	if !found {
+		return 0, ErrEmptyLog
+	}
+	return maxOffset, nil
+}
 
-	w.length = maxOffset
-	return w.Read(ctx, maxOffset)
+// isRecordKey reports whether key names a record under the prefix. Anything
+// else listed there, such as a zero-byte "prefix/" folder marker, a control
+// object like _tail, a stray non-numeric key or one for offset 0, is skipped
+// by listings.
+func (w *S3DAL) isRecordKey(key string) bool {
+	if len(key) <= len(w.keyPrefix()) || !strings.HasPrefix(key, w.keyPrefix()) {
+		return false
+	}
+	offset, err := w.getOffsetFromKey(key)
+	return err == nil && offset != 0
+}
+
+// isInternalKey reports whether key names one of the log's own objects, such
+// as the manifest, whose names under the prefix all start with "_".
+func (w *S3DAL) isInternalKey(key string) bool {
+	name, ok := strings.CutPrefix(key, w.keyPrefix())
+	return ok && strings.HasPrefix(name, "_")
+}
+
+// listAllRecords returns every record under the prefix in ascending offset
+// order, each with the offset listing found it at. Callers needing offsets
+// take them from here rather than parsing keys, which on a compacted log name
+// segments rather than records.
+func (w *S3DAL) listAllRecords(ctx context.Context) ([]listedRecord, error) {
+	var records []listedRecord
+	err := w.listAll(ctx, 0, func(offset uint64, obj types.Object) (bool, error) {
+		records = append(records, listedRecord{offset: offset, obj: obj})
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// listObjects returns every record object under the prefix in ascending offset order.
+func (w *S3DAL) listObjects(ctx context.Context) ([]types.Object, error) {
+	var objects []types.Object
+	err := w.listAll(ctx, 0, func(_ uint64, obj types.Object) (bool, error) {
+		objects = append(objects, obj)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// Count returns the number of records under the prefix. It counts objects
+// rather than offsets, so it stays correct across holes and trimmed prefixes,
+// and it reads no bodies, but it costs one ListObjectsV2 call per 1000 records.
+// Callers polling it frequently should cache the result, or use WithManifest,
+// with which the count is read from the manifest unless records exist past
+// the tail it records.
+func (w *S3DAL) Count(ctx context.Context) (uint64, error) {
+	if m, ok, err := w.freshManifest(ctx); err != nil || ok {
+		return m.Count, err
+	}
+
+	var count uint64
+	err := w.listAll(ctx, 0, func(uint64, types.Object) (bool, error) {
+		count++
+		return true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Stat returns the first and last offsets of the log and its record count,
+// or ErrEmptyLog. With WithManifest they are read from the manifest, as by
+// Count; otherwise a single listing yields all three, as the count needs one
+// anyway. Holes make count less than last-first+1.
+func (w *S3DAL) Stat(ctx context.Context) (first, last, count uint64, err error) {
+	m, ok, err := w.freshManifest(ctx)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if !ok {
+		err = w.listAll(ctx, 0, func(offset uint64, _ types.Object) (bool, error) {
+			if m.Count == 0 {
+				m.First = offset
+			}
+			m.Last = offset
+			m.Count++
+			return true, nil
+		})
+		if err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	if m.Count == 0 {
+		return 0, 0, 0, ErrEmptyLog
+	}
+	return m.First, m.Last, m.Count, nil
+}
+
+// FirstRecord returns the record with the smallest offset. Keys are listed in
+// ascending order, so the first record key listed is the minimum; pages are
+// kept small, with room for a leading "prefix/" folder marker.
+func (w *S3DAL) FirstRecord(ctx context.Context) (Record, error) {
+	var minOffset uint64
+	found := false
+	err := w.listRecords(ctx, 0, 2, func(offset uint64, _ types.Object) (bool, error) {
+		minOffset, found = offset, true
+		return false, nil
+	})
+	if err != nil {
+		return Record{}, err
+	}
+	if !found {
+		return Record{}, ErrEmptyLog
+	}
+	return w.Read(ctx, minOffset)
 }
 
 /* func (w *S3DAL) LastRecord(ctx context.Context) (Record, error) {
 	input := &s3.ListObjectsV2Input{
 		Bucket: aws.String(w.bucketName),
-		Prefix: aws.String(w.prefix + "/"),
+		Prefix: aws.String(w.keyPrefix()),
 	}
 	paginator := s3.NewListObjectsV2Paginator(w.client, input)
 
@@ -285,6 +1153,6 @@ func (w *S3DAL) LastRecord(ctx context.Context) (Record, error) {
 	if maxOffset == 0 {
 		return Record{}, fmt.Errorf("WAL is empty")
 	}
-	w.length = maxOffset
+	w.setLength(maxOffset)
 	return w.Read(ctx, maxOffset)
 } */
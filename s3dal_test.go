@@ -2,16 +2,24 @@ package s3_dal
 
 import (
 	"context"
+	"crypto/md5"
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 )
 
 func generateRandomStr() string {
@@ -104,7 +112,7 @@ func TestAppendAndReadSingle(t *testing.T) {
 	ctx := context.Background()
 	testData := []byte("hello world")
 
-	offset, err := wal.Append(ctx, testData, uint64(1048576))
+	offset, err := wal.Append(ctx, testData)
 	if err != nil {
 		t.Fatalf("failed to append: %v", err)
 	}
@@ -141,7 +149,7 @@ func TestAppendMultiple(t *testing.T) {
 
 	var offsets []uint64
 	for _, data := range testData {
-		offset, err := wal.Append(ctx, data, uint64(1048576))
+		offset, err := wal.Append(ctx, data)
 		if err != nil {
 			t.Fatalf("failed to append: %v", err)
 		}
@@ -179,7 +187,7 @@ func TestAppendEmpty(t *testing.T) {
 	defer cleanup()
 	ctx := context.Background()
 
-	offset, err := wal.Append(ctx, []byte{}, uint64(1048576))
+	offset, err := wal.Append(ctx, []byte{})
 	if err != nil {
 		t.Fatalf("failed to append empty data: %v", err)
 	}
@@ -204,7 +212,7 @@ func TestAppendLarge(t *testing.T) {
 		largeData[i] = byte(i % 256)
 	}
 
-	offset, err := wal.Append(ctx, largeData, uint64(1048576))
+	offset, err := wal.Append(ctx, largeData)
 	if err != nil {
 		t.Fatalf("failed to append large data: %v", err)
 	}
@@ -233,14 +241,14 @@ func TestSameOffset(t *testing.T) {
 	defer cleanup()
 	ctx := context.Background()
 	data := []byte("threads are evil")
-	_, err := wal.Append(ctx, data, uint64(1048576))
+	_, err := wal.Append(ctx, data)
 	if err != nil {
 		t.Fatalf("failed to append first record: %v", err)
 	}
 
 	// reset the WAL counter so that it uses the same offset
 	wal.length = 0
-	_, err = wal.Append(ctx, data, uint64(1048576))
+	_, err = wal.Append(ctx, data)
 	if err == nil {
 		t.Error("expected error when appending at same offset, got nil")
 	}
@@ -259,7 +267,7 @@ func TestLastRecord(t *testing.T) {
 	var lastData []byte
 	for i := 0; i < 80; i++ {
 		lastData = []byte(generateRandomStr())
-		_, err = wal.Append(ctx, lastData, uint64(1048576))
+		_, err = wal.Append(ctx, lastData)
 		if err != nil {
 			t.Fatalf("failed to append record: %v", err)
 		}
@@ -278,3 +286,1036 @@ func TestLastRecord(t *testing.T) {
 		t.Errorf("data mismatch: expected %q, got %q", lastData, record.Data)
 	}
 }
+
+func TestOffsetZero(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	if _, err := wal.Read(ctx, 0); !errors.Is(err, ErrInvalidOffset) {
+		t.Errorf("expected ErrInvalidOffset reading offset 0, got %v", err)
+	}
+	if _, _, err := wal.ReadIfChanged(ctx, 0, ""); !errors.Is(err, ErrInvalidOffset) {
+		t.Errorf("expected ErrInvalidOffset from ReadIfChanged, got %v", err)
+	}
+	if found, err := wal.Exists(ctx, 0); found || err != nil {
+		t.Errorf("expected offset 0 not to exist, got %v, %v", found, err)
+	}
+	if fake.getCalls+fake.headCalls != 0 {
+		t.Errorf("expected no requests for offset 0, got %d gets and %d heads", fake.getCalls, fake.headCalls)
+	}
+
+	// a stray object at offset 0's key is not a record
+	body, err := prepareBody(0, 0, []byte("stray"), CompressionNone, ChecksumCRC16, false)
+	if err != nil {
+		t.Fatalf("failed to prepare body: %v", err)
+	}
+	fake.objects[wal.getObjectKey(0)] = fakeObject{body: body, etag: `"stray"`}
+	if _, err := wal.LastRecord(ctx); !errors.Is(err, ErrEmptyLog) {
+		t.Errorf("expected LastRecord to find the log empty, got %v", err)
+	}
+	if _, _, _, err := wal.Stat(ctx); !errors.Is(err, ErrEmptyLog) {
+		t.Errorf("expected Stat to find the log empty, got %v", err)
+	}
+	if count, err := wal.Count(ctx); err != nil || count != 0 {
+		t.Errorf("expected a count of 0, got %d, %v", count, err)
+	}
+
+	offset, err := wal.Append(ctx, []byte("first"))
+	if err != nil || offset != 1 {
+		t.Fatalf("expected the first append at offset 1, got %d, %v", offset, err)
+	}
+	if record, err := wal.LastRecord(ctx); err != nil || record.Offset != 1 {
+		t.Errorf("expected the last record at offset 1, got %d, %v", record.Offset, err)
+	}
+}
+
+func TestStat(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	if _, _, _, err := wal.Stat(ctx); !errors.Is(err, ErrEmptyLog) {
+		t.Fatalf("expected ErrEmptyLog, got %v", err)
+	}
+	for i := 0; i < 30; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	if _, err := wal.TrimBefore(ctx, 6); err != nil {
+		t.Fatalf("failed to trim: %v", err)
+	}
+	delete(fake.objects, wal.getObjectKey(20))
+
+	fake.getCalls, fake.listCalls = 0, 0
+	first, last, count, err := wal.Stat(ctx)
+	if err != nil || first != 6 || last != 30 || count != 24 {
+		t.Errorf("expected 6, 30, 24, got %d, %d, %d, %v", first, last, count, err)
+	}
+	if fake.getCalls != 0 || fake.listCalls != 1 {
+		t.Errorf("expected a single list and no gets, got %d and %d", fake.listCalls, fake.getCalls)
+	}
+
+	managed, _ := newFakeDAL(t, WithManifest())
+	for i := 0; i < 5; i++ {
+		if _, err := managed.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	if first, last, count, err := managed.Stat(ctx); err != nil || first != 1 || last != 5 || count != 5 {
+		t.Errorf("expected 1, 5, 5 from the manifest, got %d, %d, %d, %v", first, last, count, err)
+	}
+}
+
+func TestFirstRecord(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	if _, err := wal.FirstRecord(ctx); !errors.Is(err, ErrEmptyLog) {
+		t.Fatalf("expected ErrEmptyLog from empty WAL, got %v", err)
+	}
+
+	for i := 0; i < 1500; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	fake.listCalls = 0
+	record, err := wal.FirstRecord(ctx)
+	if err != nil {
+		t.Fatalf("failed to get first record: %v", err)
+	}
+	if record.Offset != 1 {
+		t.Errorf("expected offset 1, got %d", record.Offset)
+	}
+	if fake.listCalls != 1 {
+		t.Errorf("expected a single list page, got %d", fake.listCalls)
+	}
+}
+
+func TestSkipCRCOnWriteRoundTrip(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	if _, err := wal.Append(ctx, []byte("checked")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	// a second writer on the same log skips the CRC
+	fast, err := New(fake, "fake-bucket", "fake-prefix", WithSkipCRCOnWrite())
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	fast.length = wal.length
+	if _, err := fast.Append(ctx, []byte("unchecked")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	raw := fake.objects[wal.getObjectKey(2)].body
+	if raw[len(raw)-2] != 0 || raw[len(raw)-1] != 0 {
+		t.Errorf("expected zero CRC trailer, got %v", raw[len(raw)-2:])
+	}
+	if raw[3]&flagUnchecked == 0 {
+		t.Errorf("expected the header flagged unchecked, got flags 0x%02X", raw[3])
+	}
+
+	// records from before the flag are marked in their metadata only
+	body, err := prepareBody(3, 0, []byte("unchecked"), CompressionNone, ChecksumCRC16, true)
+	if err != nil {
+		t.Fatalf("failed to frame: %v", err)
+	}
+	body[3] &^= flagUnchecked
+	fake.objects[wal.getObjectKey(3)] = fakeObject{body: body, metadata: map[string]string{metaChecksum: checksumNone}}
+	wal.length = 3
+
+	for offset, want := range map[uint64]string{1: "checked", 2: "unchecked", 3: "unchecked"} {
+		record, err := wal.Read(ctx, offset)
+		if err != nil {
+			t.Fatalf("failed to read offset %d: %v", offset, err)
+		}
+		if string(record.Data) != want {
+			t.Errorf("data mismatch at offset %d: expected %q, got %q", offset, want, record.Data)
+		}
+	}
+}
+
+func benchmarkAppend(b *testing.B, opts ...Option) {
+	fake := newFakeS3()
+	wal, err := New(fake, "fake-bucket", "fake-prefix", opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := make([]byte, 64*1024)
+	ctx := context.Background()
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := wal.Append(ctx, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAppend(b *testing.B) { benchmarkAppend(b) }
+
+func BenchmarkAppendSkipCRC(b *testing.B) { benchmarkAppend(b, WithSkipCRCOnWrite()) }
+
+func TestAppendHookTransform(t *testing.T) {
+	var committed []uint64
+	wal, _ := newFakeDAL(t, WithAppendHook(
+		func(data []byte) ([]byte, error) {
+			return append([]byte("signed:"), data...), nil
+		},
+		func(offset uint64) error {
+			committed = append(committed, offset)
+			return nil
+		},
+	))
+	ctx := context.Background()
+
+	offset, err := wal.Append(ctx, []byte("payload"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	record, err := wal.Read(ctx, offset)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if string(record.Data) != "signed:payload" {
+		t.Errorf("expected transformed payload, got %q", record.Data)
+	}
+	if len(committed) != 1 || committed[0] != offset {
+		t.Errorf("expected after hook to see offset %d, got %v", offset, committed)
+	}
+}
+
+func TestAppendHookAbort(t *testing.T) {
+	errReject := errors.New("rejected")
+	wal, fake := newFakeDAL(t, WithAppendHook(
+		func(data []byte) ([]byte, error) { return nil, errReject },
+		nil,
+	))
+
+	if _, err := wal.Append(context.Background(), []byte("payload")); !errors.Is(err, errReject) {
+		t.Fatalf("expected hook error, got %v", err)
+	}
+	if fake.putCalls != 0 {
+		t.Errorf("expected no put after aborted append, got %d", fake.putCalls)
+	}
+	if wal.length != 0 {
+		t.Errorf("expected length to be unchanged, got %d", wal.length)
+	}
+}
+
+func TestContentMD5(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithContentMD5())
+	ctx := context.Background()
+
+	offset, err := wal.Append(ctx, []byte("integrity"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	got := aws.ToString(fake.lastPut.ContentMD5)
+	sum := md5.Sum(fake.objects[wal.getObjectKey(offset)].body)
+	if want := base64.StdEncoding.EncodeToString(sum[:]); got != want {
+		t.Errorf("expected Content-MD5 %q, got %q", want, got)
+	}
+}
+
+func TestFolderMarkerIgnored(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	fake.objects[wal.prefix+"/"] = fakeObject{}
+	fake.objects[wal.prefix+"/notes.txt"] = fakeObject{body: []byte("stray")}
+
+	if _, err := wal.FirstRecord(ctx); !errors.Is(err, ErrEmptyLog) {
+		t.Fatalf("expected ErrEmptyLog with only non-record keys, got %v", err)
+	}
+	if _, err := wal.LastRecord(ctx); !errors.Is(err, ErrEmptyLog) {
+		t.Fatalf("expected ErrEmptyLog with only non-record keys, got %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := wal.Append(ctx, []byte("same")); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	first, err := wal.FirstRecord(ctx)
+	if err != nil || first.Offset != 1 {
+		t.Errorf("expected first offset 1, got %d (%v)", first.Offset, err)
+	}
+	last, err := wal.LastRecord(ctx)
+	if err != nil || last.Offset != 5 {
+		t.Errorf("expected last offset 5, got %d (%v)", last.Offset, err)
+	}
+
+	scanned := 0
+	if _, err := wal.ScanPage(ctx, "", 100, func(Record) error { scanned++; return nil }); err != nil {
+		t.Fatalf("failed to scan: %v", err)
+	}
+	if scanned != 5 {
+		t.Errorf("expected 5 scanned records, got %d", scanned)
+	}
+
+	dups, err := wal.FindDuplicates(ctx)
+	if err != nil {
+		t.Fatalf("failed to find duplicates: %v", err)
+	}
+	if len(dups) != 1 {
+		t.Errorf("expected one duplicated payload, got %v", dups)
+	}
+
+	inspector, err := NewInspector(wal)
+	if err != nil {
+		t.Fatalf("failed to create inspector: %v", err)
+	}
+	stats, err := inspector.Stats(ctx)
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if stats.Count != 5 {
+		t.Errorf("expected 5 records in stats, got %d", stats.Count)
+	}
+
+	removed, err := wal.TrimToLast(ctx, 2)
+	if err != nil {
+		t.Fatalf("failed to trim: %v", err)
+	}
+	if removed != 3 {
+		t.Errorf("expected 3 removed records, got %d", removed)
+	}
+	if _, ok := fake.objects[wal.prefix+"/"]; !ok {
+		t.Error("expected the folder marker to be left alone")
+	}
+}
+
+func TestOffsetAndSizeLimitIndependent(t *testing.T) {
+	wal, _ := newFakeDAL(t, WithFileSizeLimit(100))
+	ctx := context.Background()
+	record := make([]byte, 30)
+
+	// 3 x 30 bytes fits a 100 byte limit; the 4th would not
+	for want := uint64(1); want <= 3; want++ {
+		offset, err := wal.Append(ctx, record)
+		if err != nil {
+			t.Fatalf("failed to append record %d: %v", want, err)
+		}
+		if offset != want {
+			t.Errorf("expected offset %d, got %d", want, offset)
+		}
+	}
+	if wal.size != 90 {
+		t.Errorf("expected tracked size 90, got %d", wal.size)
+	}
+	if _, err := wal.Append(ctx, record); err == nil {
+		t.Fatal("expected the size limit to reject a 4th record")
+	}
+	if wal.length != 3 || wal.size != 90 {
+		t.Errorf("expected a rejected append to change nothing, got length %d size %d", wal.length, wal.size)
+	}
+
+	// many tiny records fit even though the record count exceeds the limit
+	for i := 0; i < 10; i++ {
+		if _, err := wal.Append(ctx, []byte{1}); err != nil {
+			t.Fatalf("failed to append tiny record: %v", err)
+		}
+	}
+	if wal.length != 13 || wal.size != 100 {
+		t.Errorf("expected length 13 and size 100, got %d and %d", wal.length, wal.size)
+	}
+}
+
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) Debugf(format string, args ...any) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestReadIsSilentByDefault(t *testing.T) {
+	wal, _ := newFakeDAL(t)
+	ctx := context.Background()
+	offset, err := wal.Append(ctx, []byte("quiet"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	stdout := os.Stdout
+	r, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = pw
+	_, readErr := wal.Read(ctx, offset)
+	os.Stdout = stdout
+	pw.Close()
+	out, _ := io.ReadAll(r)
+
+	if readErr != nil {
+		t.Fatalf("failed to read: %v", readErr)
+	}
+	if len(out) != 0 {
+		t.Errorf("expected no output from Read, got %q", out)
+	}
+}
+
+func TestReadDebugLogger(t *testing.T) {
+	logger := &recordingLogger{}
+	wal, _ := newFakeDAL(t, WithLogger(logger))
+	ctx := context.Background()
+	offset, err := wal.Append(ctx, []byte("secret payload"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if _, err := wal.Read(ctx, offset); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "CRC") {
+		t.Fatalf("expected one CRC debug line, got %q", logger.lines)
+	}
+	if strings.Contains(logger.lines[0], "secret") {
+		t.Errorf("debug output leaks the payload: %q", logger.lines[0])
+	}
+}
+
+func TestConcurrentAppend(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+	const writers, perWriter = 8, 25
+
+	var mu sync.Mutex
+	seen := make(map[uint64]string)
+	var wg sync.WaitGroup
+	for g := 0; g < writers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				data := fmt.Sprintf("writer-%d-%d", g, i)
+				offset, err := wal.Append(ctx, []byte(data))
+				if err != nil {
+					t.Errorf("failed to append: %v", err)
+					return
+				}
+				mu.Lock()
+				if prev, dup := seen[offset]; dup {
+					t.Errorf("offset %d handed out twice (%q and %q)", offset, prev, data)
+				}
+				seen[offset] = data
+				mu.Unlock()
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if len(seen) != writers*perWriter || len(fake.objects) != writers*perWriter {
+		t.Fatalf("expected %d records, got %d offsets and %d objects", writers*perWriter, len(seen), len(fake.objects))
+	}
+	for offset := uint64(1); offset <= writers*perWriter; offset++ {
+		record, err := wal.Read(ctx, offset)
+		if err != nil {
+			t.Fatalf("gap at offset %d: %v", offset, err)
+		}
+		if string(record.Data) != seen[offset] {
+			t.Errorf("offset %d overwritten: expected %q, got %q", offset, seen[offset], record.Data)
+		}
+	}
+}
+
+func TestAppendOffsetConflict(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	other := S3DALClient(fake, wal.bucketName, wal.prefix)
+	if _, err := other.Append(ctx, []byte("first")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	_, err := wal.Append(ctx, []byte("second"))
+	if !errors.Is(err, ErrOffsetConflict) {
+		t.Fatalf("expected ErrOffsetConflict, got %v", err)
+	}
+	if wal.length != 0 {
+		t.Errorf("expected length to stay 0 after a conflict, got %d", wal.length)
+	}
+
+	// re-resolving the tail lets the retry succeed
+	if _, err := wal.LastRecord(ctx); err != nil {
+		t.Fatalf("failed to resolve tail: %v", err)
+	}
+	offset, err := wal.Append(ctx, []byte("second"))
+	if err != nil {
+		t.Fatalf("failed to retry append: %v", err)
+	}
+	if offset != 2 {
+		t.Errorf("expected offset 2, got %d", offset)
+	}
+
+	// other failures are not conflicts
+	fake.putErr = &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}
+	if _, err := wal.Append(ctx, []byte("third")); errors.Is(err, ErrOffsetConflict) {
+		t.Errorf("expected a generic error, got %v", err)
+	}
+}
+
+func TestOpenS3DAL(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	empty, err := OpenS3DAL(ctx, fake, wal.bucketName, wal.prefix)
+	if err != nil {
+		t.Fatalf("failed to open empty log: %v", err)
+	}
+	if empty.length != 0 {
+		t.Errorf("expected length 0 for an empty log, got %d", empty.length)
+	}
+
+	for i := 0; i < 1200; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	fake.getCalls = 0
+	reopened, err := OpenS3DAL(ctx, fake, wal.bucketName, wal.prefix)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	if reopened.length != 1200 {
+		t.Errorf("expected recovered length 1200, got %d", reopened.length)
+	}
+	if fake.getCalls != 0 {
+		t.Errorf("expected no bodies read while opening, got %d", fake.getCalls)
+	}
+
+	offset, err := reopened.Append(ctx, []byte("continued"))
+	if err != nil {
+		t.Fatalf("failed to append after reopening: %v", err)
+	}
+	if offset != 1201 {
+		t.Errorf("expected offset 1201, got %d", offset)
+	}
+}
+
+func TestReadSentinelErrors(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	if _, err := wal.Read(ctx, 1); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound for a missing offset, got %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := wal.Append(ctx, []byte("payload")); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	obj := fake.objects[wal.getObjectKey(1)]
+	obj.body[len(obj.body)-3] ^= 0xFF
+	if _, err := wal.Read(ctx, 1); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+
+	fake.objects[wal.getObjectKey(2)] = fake.objects[wal.getObjectKey(3)]
+	if _, err := wal.Read(ctx, 2); !errors.Is(err, ErrOffsetMismatch) {
+		t.Errorf("expected ErrOffsetMismatch, got %v", err)
+	}
+
+	obj = fake.objects[wal.getObjectKey(3)]
+	obj.body = obj.body[:5]
+	fake.objects[wal.getObjectKey(3)] = obj
+	if _, err := wal.Read(ctx, 3); !errors.Is(err, ErrRecordTooShort) {
+		t.Errorf("expected ErrRecordTooShort, got %v", err)
+	}
+
+	if !errors.Is(ErrEmpty, ErrEmptyLog) {
+		t.Error("expected the deprecated ErrEmpty to match ErrEmptyLog")
+	}
+}
+
+func TestReadRaw(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := wal.Append(ctx, []byte(fmt.Sprintf("record %d", i+1))); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	record, err := wal.ReadRaw(ctx, wal.getObjectKey(2))
+	if err != nil || record.Offset != 2 || string(record.Data) != "record 2" {
+		t.Errorf("expected record 2, got %d %q, %v", record.Offset, record.Data, err)
+	}
+
+	// the body of 3 filed under the key of 2
+	fake.objects[wal.getObjectKey(2)] = fake.objects[wal.getObjectKey(3)]
+	record, err = wal.ReadRaw(ctx, wal.getObjectKey(2))
+	if !errors.Is(err, ErrOffsetMismatch) {
+		t.Errorf("expected ErrOffsetMismatch, got %v", err)
+	}
+	if record.Offset != 3 || string(record.Data) != "record 3" {
+		t.Errorf("expected the misfiled record 3 to be returned, got %d %q", record.Offset, record.Data)
+	}
+
+	// a key outside the log's naming is read for its body alone
+	fake.objects["recovered/copy"] = fake.objects[wal.getObjectKey(1)]
+	if record, err := wal.ReadRaw(ctx, "recovered/copy"); err != nil || record.Offset != 1 {
+		t.Errorf("expected record 1 from a foreign key, got %d, %v", record.Offset, err)
+	}
+	if _, err := wal.ReadRaw(ctx, "recovered/missing"); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound for a missing key, got %v", err)
+	}
+
+	// the key names an offset under any delimiter and sharding
+	piped, pipedFake := newFakeDAL(t, WithKeyDelimiter("|"), WithShards(2))
+	for i := 0; i < 3; i++ {
+		if _, err := piped.Append(ctx, []byte(fmt.Sprintf("record %d", i+1))); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	pipedFake.objects[piped.getObjectKey(1)] = pipedFake.objects[piped.getObjectKey(3)]
+	var mismatch *OffsetMismatchError
+	if _, err := piped.ReadRaw(ctx, piped.getObjectKey(1)); !errors.As(err, &mismatch) || mismatch.KeyOffset != 1 || mismatch.BodyOffset != 3 {
+		t.Errorf("expected an offset mismatch of key 1 and body 3 under a | delimiter, got %v", err)
+	}
+}
+
+func TestReadObjectMetadata(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+	written := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	fake.now = func() time.Time { return written }
+
+	offset, err := wal.Append(ctx, []byte("tracked"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	obj := fake.objects[wal.getObjectKey(offset)]
+
+	record, err := wal.Read(ctx, offset)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if record.ETag != obj.etag || record.Size != int64(len(obj.body)) || !record.LastModified.Equal(written) {
+		t.Errorf("expected ETag %s, size %d, modified %v, got %s, %d, %v",
+			obj.etag, len(obj.body), written, record.ETag, record.Size, record.LastModified)
+	}
+
+	_, err = wal.ScanPage(ctx, "", 10, func(r Record) error {
+		if r.ETag != obj.etag {
+			t.Errorf("expected scanned record ETag %s, got %s", obj.etag, r.ETag)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to scan: %v", err)
+	}
+}
+
+func TestExists(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	offset, err := wal.Append(ctx, []byte("present"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	// a corrupt body still exists; only Read validates it
+	obj := fake.objects[wal.getObjectKey(offset)]
+	obj.body = obj.body[:3]
+	fake.objects[wal.getObjectKey(offset)] = obj
+
+	if found, err := wal.Exists(ctx, offset); err != nil || !found {
+		t.Errorf("expected offset %d to exist, got %v, %v", offset, found, err)
+	}
+	if found, err := wal.Exists(ctx, offset+1); err != nil || found {
+		t.Errorf("expected offset %d to be missing without error, got %v, %v", offset+1, found, err)
+	}
+	if fake.getCalls != 0 {
+		t.Errorf("expected no GetObject calls, got %d", fake.getCalls)
+	}
+
+	fake.headErr = &smithy.GenericAPIError{Code: "Forbidden", Message: "Forbidden"}
+	if _, err := wal.Exists(ctx, offset); err == nil {
+		t.Error("expected a head failure other than not found to be returned")
+	}
+}
+
+func TestLastRecordProbesDenseLog(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 2500; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	reader, err := New(fake, wal.bucketName, wal.prefix)
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	fake.listCalls, fake.headCalls = 0, 0
+	record, err := reader.LastRecord(ctx)
+	if err != nil {
+		t.Fatalf("failed to get last record: %v", err)
+	}
+	if record.Offset != 2500 {
+		t.Errorf("expected last offset 2500, got %d", record.Offset)
+	}
+	if fake.listCalls != 1 {
+		t.Errorf("expected a single confirming list call, got %d", fake.listCalls)
+	}
+	if fake.headCalls > 30 {
+		t.Errorf("expected O(log n) head calls, got %d", fake.headCalls)
+	}
+}
+
+func TestLastRecordListsPastKnownLength(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3000; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	reader, err := OpenS3DAL(ctx, fake, wal.bucketName, wal.prefix)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	// another writer appends past the reader's cached length, leaving a hole
+	for i := 0; i < 5; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	delete(fake.objects, wal.getObjectKey(3003))
+
+	fake.listCalls, fake.headCalls = 0, 0
+	record, err := reader.LastRecord(ctx)
+	if err != nil || record.Offset != 3005 {
+		t.Fatalf("expected last offset 3005, got %d, %v", record.Offset, err)
+	}
+	if fake.listCalls != 1 || fake.headCalls != 0 {
+		t.Errorf("expected a single list and no heads, got %d lists and %d heads", fake.listCalls, fake.headCalls)
+	}
+
+	// no new records: the list is empty and the cached tail is confirmed
+	fake.listCalls, fake.headCalls = 0, 0
+	if record, err = reader.LastRecord(ctx); err != nil || record.Offset != 3005 {
+		t.Fatalf("expected last offset 3005, got %d, %v", record.Offset, err)
+	}
+	if fake.listCalls != 1 || fake.headCalls != 1 {
+		t.Errorf("expected a list and a head, got %d lists and %d heads", fake.listCalls, fake.headCalls)
+	}
+
+	// a stale guess falls back to the search
+	if _, err := wal.TruncateAfter(ctx, 2990); err != nil {
+		t.Fatalf("failed to truncate: %v", err)
+	}
+	if record, err = reader.LastRecord(ctx); err != nil || record.Offset != 2990 {
+		t.Errorf("expected last offset 2990, got %d, %v", record.Offset, err)
+	}
+}
+
+func TestLastRecordFallsBackOnSparseLog(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 40; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	// gaps in the middle and a trimmed head
+	for _, offset := range []uint64{1, 2, 3, 17, 33} {
+		delete(fake.objects, wal.getObjectKey(offset))
+	}
+
+	reader, err := New(fake, wal.bucketName, wal.prefix)
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	record, err := reader.LastRecord(ctx)
+	if err != nil {
+		t.Fatalf("failed to get last record: %v", err)
+	}
+	if record.Offset != 40 {
+		t.Errorf("expected last offset 40, got %d", record.Offset)
+	}
+
+	// a gap found by the probe is caught by the confirming list
+	fake.objects[wal.getObjectKey(1)] = fake.objects[wal.getObjectKey(4)]
+	reader.length = 0
+	if record, err = reader.LastRecord(ctx); err != nil {
+		t.Fatalf("failed to get last record: %v", err)
+	}
+	if record.Offset != 40 {
+		t.Errorf("expected last offset 40 past the gaps, got %d", record.Offset)
+	}
+}
+
+func TestLastRecordDuringAppends(t *testing.T) {
+	wal, _ := newFakeDAL(t)
+	ctx := context.Background()
+	const appends = 100
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if _, err := wal.LastRecord(ctx); err != nil && !errors.Is(err, ErrEmptyLog) {
+				t.Errorf("failed to get last record: %v", err)
+				return
+			}
+		}
+	}()
+	for i := uint64(1); i <= appends; i++ {
+		offset, err := wal.Append(ctx, []byte(generateRandomStr()))
+		if err != nil {
+			t.Fatalf("append %d failed: %v", i, err)
+		}
+		if offset != i {
+			t.Fatalf("expected append %d to land at offset %d, got %d", i, i, offset)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	// a stale lookup never moves the length back
+	other, err := OpenS3DAL(ctx, wal.client, wal.bucketName, wal.prefix)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	if _, err := other.TruncateAfter(ctx, appends-1); err != nil {
+		t.Fatalf("failed to truncate: %v", err)
+	}
+	if _, err := wal.LastRecord(ctx); err != nil {
+		t.Fatalf("failed to get last record: %v", err)
+	}
+	if got := wal.Length(); got != appends {
+		t.Errorf("expected LastRecord to leave the length at %d, got %d", appends, got)
+	}
+	if got, err := wal.LoadLength(ctx); err != nil || got != appends-1 {
+		t.Errorf("expected LoadLength to resynchronise the length to %d, got %d, %v", appends-1, got, err)
+	}
+}
+
+func TestLength(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	if got := wal.Length(); got != 0 {
+		t.Errorf("expected length 0 for a new DAL, got %d", got)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	if got := wal.Length(); got != 3 {
+		t.Errorf("expected length 3 after three appends, got %d", got)
+	}
+
+	other, err := OpenS3DAL(ctx, fake, wal.bucketName, wal.prefix)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	if got := other.Length(); got != 3 {
+		t.Errorf("expected reopened length 3, got %d", got)
+	}
+
+	// writes through another client are not seen until the tail is reloaded
+	if _, err := other.Append(ctx, []byte(generateRandomStr())); err != nil {
+		t.Fatalf("failed to append record: %v", err)
+	}
+	if got := wal.Length(); got != 3 {
+		t.Errorf("expected length to stay 3 before reloading, got %d", got)
+	}
+	if _, err := wal.LastRecord(ctx); err != nil {
+		t.Fatalf("failed to get last record: %v", err)
+	}
+	if got := wal.Length(); got != 4 {
+		t.Errorf("expected length 4 after LastRecord, got %d", got)
+	}
+}
+
+func TestSync(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	if err := wal.Sync(ctx); err != nil {
+		t.Fatalf("expected an empty log to be in sync, got %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	puts := fake.putCalls
+	if err := wal.Sync(ctx); err != nil {
+		t.Fatalf("expected the log to be in sync, got %v", err)
+	}
+	if fake.putCalls != puts {
+		t.Errorf("expected Sync to write nothing, got %d puts", fake.putCalls-puts)
+	}
+
+	// a lost write
+	delete(fake.objects, wal.getObjectKey(3))
+	if err := wal.Sync(ctx); !errors.Is(err, ErrTailMismatch) {
+		t.Errorf("expected ErrTailMismatch for a lost write, got %v", err)
+	}
+	if got := wal.Length(); got != 3 {
+		t.Errorf("expected Sync to leave the length at 3, got %d", got)
+	}
+
+	// an interfering writer
+	other, err := OpenS3DAL(ctx, fake, wal.bucketName, wal.prefix)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := other.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	if err := wal.Sync(ctx); !errors.Is(err, ErrTailMismatch) {
+		t.Errorf("expected ErrTailMismatch for another writer's appends, got %v", err)
+	}
+	if err := other.Sync(ctx); err != nil {
+		t.Errorf("expected the other writer to be in sync, got %v", err)
+	}
+
+	// records still buffered for a pack are not expected in S3
+	packed, _ := newFakeDAL(t, WithPacking(10))
+	if _, err := packed.Append(ctx, []byte("buffered")); err != nil {
+		t.Fatalf("failed to append record: %v", err)
+	}
+	if err := packed.Sync(ctx); err != nil {
+		t.Errorf("expected a buffered record not to count, got %v", err)
+	}
+	if err := packed.Flush(ctx); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+	if err := packed.Sync(ctx); err != nil {
+		t.Errorf("expected the flushed log to be in sync, got %v", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	wal, _ := newFakeDAL(t)
+	ctx := context.Background()
+
+	offset, err := wal.Append(ctx, []byte("before close"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	records, errs := wal.Follow(ctx, 1, time.Millisecond)
+	<-records
+
+	if err := wal.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if err := wal.Close(); err != nil {
+		t.Errorf("expected a second Close to be a no-op, got %v", err)
+	}
+	if _, err := wal.Append(ctx, []byte("after close")); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected Append after Close to fail with ErrClosed, got %v", err)
+	}
+	if _, err := wal.AppendBatch(ctx, [][]byte{[]byte("after close")}); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected AppendBatch after Close to fail with ErrClosed, got %v", err)
+	}
+	if _, err := wal.Read(ctx, offset); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected Read after Close to fail with ErrClosed, got %v", err)
+	}
+
+	// the follower stops with the DAL
+	for range records {
+	}
+	for range errs {
+	}
+}
+
+func TestReadIfChanged(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	offset, err := wal.Append(ctx, []byte("original"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	cached, err := wal.Read(ctx, offset)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	record, changed, err := wal.ReadIfChanged(ctx, offset, cached.ETag)
+	if err != nil || changed || record.Data != nil {
+		t.Fatalf("expected an unchanged record with no body, got %q, %v, %v", record.Data, changed, err)
+	}
+	if aws.ToString(fake.lastGet.IfNoneMatch) != cached.ETag {
+		t.Errorf("expected the get to be conditional on %s, got %v", cached.ETag, fake.lastGet.IfNoneMatch)
+	}
+
+	// a repair tool rewrites the record in place
+	body, err := prepareBody(offset, 0, []byte("repaired"), CompressionNone, ChecksumCRC16, false)
+	if err != nil {
+		t.Fatalf("failed to prepare body: %v", err)
+	}
+	fake.objects[wal.getObjectKey(offset)] = fakeObject{body: body, etag: "\"repaired\""}
+	record, changed, err = wal.ReadIfChanged(ctx, offset, cached.ETag)
+	if err != nil || !changed || string(record.Data) != "repaired" || record.ETag != "\"repaired\"" {
+		t.Errorf("expected the rewritten record, got %q (etag %s), %v, %v", record.Data, record.ETag, changed, err)
+	}
+
+	if _, changed, err := wal.ReadIfChanged(ctx, offset+1, cached.ETag); !errors.Is(err, ErrRecordNotFound) || changed {
+		t.Errorf("expected ErrRecordNotFound for a missing record, got %v, %v", changed, err)
+	}
+}
+
+func TestOpError(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	if _, err := wal.Append(ctx, []byte("first")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	var opErr *OpError
+	_, err := wal.Read(ctx, 7)
+	if !errors.As(err, &opErr) || opErr.Op != "read" || opErr.Offset != 7 || opErr.Key != wal.getObjectKey(7) {
+		t.Fatalf("expected an *OpError for the read of offset 7, got %#v", err)
+	}
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound through the OpError, got %v", err)
+	}
+
+	fake.putErr = errPreconditionFailed()
+	_, err = wal.Append(ctx, []byte("second"))
+	if !errors.As(err, &opErr) || opErr.Op != "append" || opErr.Offset != 2 || opErr.Key != wal.getObjectKey(2) {
+		t.Fatalf("expected an *OpError for the append at offset 2, got %#v", err)
+	}
+	if !errors.Is(err, ErrOffsetConflict) {
+		t.Errorf("expected ErrOffsetConflict through the OpError, got %v", err)
+	}
+	fake.putErr = nil
+
+	_, err = wal.ReadRange(ctx, 1, 3)
+	var gap *RangeGapError
+	if !errors.As(err, &gap) || !errors.As(err, &opErr) || opErr.Offset != 2 {
+		t.Errorf("expected the range gap to carry the read's OpError, got %v", err)
+	}
+}
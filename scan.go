@@ -0,0 +1,379 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ScanPage calls fn for up to limit records in ascending offset order,
+// starting after the position encoded in token ("" starts at the beginning).
+// It returns an opaque token to resume from, or "" once the end of the log
+// has been reached. The token records the last processed offset, so a scan
+// resumed from it is deterministic regardless of which client resumes it.
+// Offsets are discovered by listing, so trimmed prefixes and holes are
+// skipped, as are records deleted between listing and reading.
+func (w *S3DAL) ScanPage(ctx context.Context, token string, limit int, fn func(Record) error) (nextToken string, err error) {
+	if limit <= 0 {
+		return "", fmt.Errorf("invalid scan limit %d", limit)
+	}
+	after, err := parseScanToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	offsets, more, err := w.listOffsetsAfter(ctx, after, limit)
+	if err != nil {
+		return token, err
+	}
+	for _, offset := range offsets {
+		record, err := w.Read(ctx, offset)
+		if errors.Is(err, ErrRecordNotFound) {
+			// deleted since it was listed, e.g. by a concurrent trim
+			token = strconv.FormatUint(offset, 10)
+			continue
+		}
+		if err != nil {
+			return token, err
+		}
+		if err := fn(record); err != nil {
+			return token, err
+		}
+		token = strconv.FormatUint(offset, 10)
+	}
+
+	if !more {
+		return "", nil
+	}
+	return token, nil
+}
+
+func parseScanToken(token string) (uint64, error) {
+	if token == "" {
+		return 0, nil
+	}
+	after, err := strconv.ParseUint(token, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid scan token %q: %w", token, err)
+	}
+	return after, nil
+}
+
+// ListOffsets returns the offsets in [from, to) that hold a record, in
+// ascending order, with to 0 meaning the end of the log. They come from
+// listing alone, one ListObjectsV2 call per page, so a trimmed prefix or a
+// hole shows as a gap between them. Keys under the prefix that do not parse
+// as offsets are skipped, and logged at debug level.
+func (w *S3DAL) ListOffsets(ctx context.Context, from, to uint64) ([]uint64, error) {
+	if to != 0 {
+		if err := checkRange(from, to); err != nil {
+			return nil, err
+		}
+	}
+	offsets := []uint64{}
+	err := w.listRecords(ctx, max(from, 1)-1, 0, func(offset uint64, _ types.Object) (bool, error) {
+		if to != 0 && offset >= to {
+			return false, nil
+		}
+		offsets = append(offsets, offset)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return offsets, nil
+}
+
+// listOffsetsAfter returns up to limit existing offsets greater than after, in
+// ascending order, and whether any further offsets exist beyond them.
+func (w *S3DAL) listOffsetsAfter(ctx context.Context, after uint64, limit int) (offsets []uint64, more bool, err error) {
+	// one key past the limit tells whether more follow
+	err = w.listRecords(ctx, after, int32(min(limit+1, 1000)), func(offset uint64, _ types.Object) (bool, error) {
+		if len(offsets) == limit {
+			more = true
+			return false, nil
+		}
+		offsets = append(offsets, offset)
+		return true, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return offsets, more, nil
+}
+
+const defaultScanPrefetch = 4
+
+// RecordIterator walks records in ascending offset order.
+//
+// When Next returns false, Err reports why. A nil Err means the end of the
+// log. A per-record failure (CRC or offset mismatch, short body) is reported
+// the same way but is not terminal: calling Next again skips that record and
+// continues, so the consumer can choose to stop or skip. Holes in the log and
+// records deleted between listing and reading (for example by a concurrent
+// TrimBefore) are skipped silently rather than reported. Listing failures and
+// cancellation are terminal. Close releases the prefetching goroutines and
+// must be called if iteration is abandoned early.
+type RecordIterator interface {
+	Next() bool
+	Record() Record
+	Err() error
+	Close() error
+}
+
+type scanResult struct {
+	offset uint64
+	record Record
+	err    error
+	fatal  bool
+}
+
+type scanIterator struct {
+	cancel    context.CancelFunc
+	results   chan chan scanResult
+	onDamaged func(offset uint64, err error)
+	current   Record
+	err       error
+	done      bool
+}
+
+// Scan returns an iterator over the records at or after from. Keys are
+// discovered with the ListObjectsV2 paginator, so a from below a trimmed
+// watermark starts at the first surviving record, and bodies are fetched
+// lazily, up to WithScanPrefetch records ahead of the consumer.
+func (w *S3DAL) Scan(ctx context.Context, from uint64) (RecordIterator, error) {
+	return w.scan(ctx, from, nil), nil
+}
+
+// ScanTolerant is Scan for recovery: a damaged record, one whose body is torn,
+// fails its checksum, has an unreadable header or does not hold the offset
+// its key names, is passed to
+// onDamaged with the error and skipped, so the caller can truncate the log at
+// the first damage or repair records one by one. An offset with no object,
+// such as a hole or a trimmed record, is not damage and is skipped silently as
+// by Scan. Other failures to read a record, such as a failed request, are
+// still reported by Err. onDamaged is called from Next.
+func (w *S3DAL) ScanTolerant(ctx context.Context, from uint64, onDamaged func(offset uint64, err error)) (RecordIterator, error) {
+	if onDamaged == nil {
+		return nil, fmt.Errorf("invalid scan: onDamaged is nil")
+	}
+	return w.scan(ctx, from, onDamaged), nil
+}
+
+func (w *S3DAL) scan(ctx context.Context, from uint64, onDamaged func(offset uint64, err error)) *scanIterator {
+	ctx, cancel := context.WithCancel(ctx)
+	// once listing is done, reads that are still queued fail on their own
+	// after Close
+	stop := context.AfterFunc(w.lifetime, cancel)
+	it := &scanIterator{
+		cancel:    cancel,
+		results:   make(chan chan scanResult, w.scanPrefetch),
+		onDamaged: onDamaged,
+	}
+	go func() {
+		defer stop()
+		w.scanProducer(ctx, from, it.results)
+	}()
+	return it
+}
+
+// scanProducer lists offsets from from onwards and queues one pending read per
+// offset; the buffered results channel bounds how far it runs ahead.
+func (w *S3DAL) scanProducer(ctx context.Context, from uint64, results chan<- chan scanResult) {
+	defer close(results)
+
+	queue := func(res chan scanResult) bool {
+		select {
+		case results <- res:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	err := w.listAll(ctx, max(from, 1)-1, func(offset uint64, obj types.Object) (bool, error) {
+		res := make(chan scanResult, 1)
+		if !queue(res) {
+			return false, nil
+		}
+		go func() {
+			record, err := w.scanRead(ctx, offset, aws.ToString(obj.Key))
+			res <- scanResult{offset: offset, record: record, err: err, fatal: ctx.Err() != nil}
+		}()
+		return true, nil
+	})
+	if err != nil {
+		res := make(chan scanResult, 1)
+		res <- scanResult{err: err, fatal: true}
+		queue(res)
+	}
+}
+
+// scanRead reads the record listed at key, whose name gave offset, and
+// checks the offset its body holds against it. A key Read would not look at,
+// such as a copy under a differently padded name, is read as it is rather
+// than skipped as missing.
+func (w *S3DAL) scanRead(ctx context.Context, offset uint64, key string) (Record, error) {
+	var record Record
+	var err error
+	if w.isSegmentKey(key) || slices.Contains(w.objectKeys(offset), key) {
+		record, err = w.Read(ctx, offset)
+	} else {
+		record, err = w.ReadRaw(ctx, key)
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	if record.Offset != offset {
+		return Record{}, &OffsetMismatchError{Key: key, KeyOffset: offset, BodyOffset: record.Offset}
+	}
+	return record, nil
+}
+
+func (it *scanIterator) Next() bool {
+	if it.done {
+		return false
+	}
+	it.err = nil
+
+	for {
+		res, ok := <-it.results
+		if !ok {
+			it.done = true
+			return false
+		}
+		result := <-res
+		if errors.Is(result.err, ErrRecordNotFound) && !result.fatal {
+			// deleted since it was listed
+			continue
+		}
+		if it.onDamaged != nil && !result.fatal && isCorruptRecord(result.err) {
+			it.onDamaged(result.offset, result.err)
+			continue
+		}
+		if result.err != nil {
+			it.err = result.err
+			if result.fatal {
+				it.done = true
+				it.cancel()
+			}
+			return false
+		}
+		it.current = result.record
+		return true
+	}
+}
+
+func (it *scanIterator) Record() Record { return it.current }
+
+func (it *scanIterator) Err() error { return it.err }
+
+func (it *scanIterator) Close() error {
+	it.cancel()
+	it.done = true
+	// drain so the producer and any in-flight reads can exit
+	for res := range it.results {
+		<-res
+	}
+	return nil
+}
+
+// RecordError is a failure to read one record, reported by ReadAll without
+// ending it.
+type RecordError struct {
+	Offset uint64
+	Err    error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("failed to read record at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *RecordError) Unwrap() error { return e.Err }
+
+// ReadAll streams the records at or after from in ascending offset order,
+// reading up to concurrency of them at once and holding at most that many
+// read ahead of the consumer. It is the throughput-oriented counterpart of
+// Scan, for replaying a whole log.
+//
+// A record that fails to read, as with a CRC mismatch, is reported on the
+// error channel as a *RecordError and skipped; holes and records deleted since
+// listing are skipped silently. A listing failure ends the read: it is sent
+// on the error channel and both channels are closed. Receive from both until
+// they are closed, or cancel ctx to stop early, after which the error channel
+// yields ctx.Err() if it has room.
+func (w *S3DAL) ReadAll(ctx context.Context, from uint64, concurrency int) (<-chan Record, <-chan error) {
+	records := make(chan Record)
+	errs := make(chan error, 1)
+	if concurrency < 1 {
+		errs <- fmt.Errorf("invalid read concurrency %d: must be at least 1", concurrency)
+		close(records)
+		close(errs)
+		return records, errs
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(w.lifetime, cancel)
+	// with the result being waited on, concurrency reads are in flight
+	results := make(chan chan scanResult, concurrency-1)
+	go func() {
+		defer stop()
+		w.scanProducer(ctx, from, results)
+	}()
+
+	go func() {
+		defer close(errs)
+		defer close(records)
+		defer func() {
+			cancel()
+			// drain so the producer and any in-flight reads can exit
+			for res := range results {
+				<-res
+			}
+		}()
+	loop:
+		for res := range results {
+			result := <-res
+			switch {
+			case ctx.Err() != nil:
+				// reported below
+				break loop
+			case result.fatal:
+				select {
+				case errs <- result.err:
+				case <-ctx.Done():
+				}
+				return
+			case errors.Is(result.err, ErrRecordNotFound):
+				// deleted since it was listed
+			case result.err != nil:
+				select {
+				case errs <- &RecordError{Offset: result.offset, Err: result.err}:
+				case <-ctx.Done():
+				}
+			default:
+				select {
+				case records <- result.record:
+				case <-ctx.Done():
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			err := parent.Err()
+			if err == nil {
+				err = ErrClosed
+			}
+			select {
+			case errs <- err:
+			default:
+			}
+		}
+	}()
+	return records, errs
+}
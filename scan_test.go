@@ -0,0 +1,481 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestScanPageResume(t *testing.T) {
+	wal, _ := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 25; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	var offsets []uint64
+	collect := func(r Record) error {
+		offsets = append(offsets, r.Offset)
+		return nil
+	}
+
+	token, err := wal.ScanPage(ctx, "", 10, collect)
+	if err != nil {
+		t.Fatalf("failed to scan first page: %v", err)
+	}
+	if token == "" || len(offsets) != 10 {
+		t.Fatalf("expected 10 records and a resume token, got %d records and %q", len(offsets), token)
+	}
+
+	// resume from the token, as a restarted processor would
+	for token != "" {
+		token, err = wal.ScanPage(ctx, token, 10, collect)
+		if err != nil {
+			t.Fatalf("failed to resume scan: %v", err)
+		}
+	}
+
+	if len(offsets) != 25 {
+		t.Fatalf("expected 25 records, got %d", len(offsets))
+	}
+	for i, offset := range offsets {
+		if offset != uint64(i+1) {
+			t.Errorf("expected offset %d at position %d, got %d", i+1, i, offset)
+		}
+	}
+}
+
+func TestScanPageEnd(t *testing.T) {
+	wal, _ := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	count := 0
+	token, err := wal.ScanPage(ctx, "", 10, func(Record) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to scan: %v", err)
+	}
+	if token != "" {
+		t.Errorf("expected empty token at end of log, got %q", token)
+	}
+	if count != 10 {
+		t.Errorf("expected 10 records, got %d", count)
+	}
+}
+
+func TestScanIterator(t *testing.T) {
+	wal, _ := newFakeDAL(t, WithScanPrefetch(3))
+	ctx := context.Background()
+
+	var payloads []string
+	for i := 0; i < 2500; i++ {
+		payloads = append(payloads, generateRandomStr())
+		if _, err := wal.Append(ctx, []byte(payloads[i])); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	it, err := wal.Scan(ctx, 100)
+	if err != nil {
+		t.Fatalf("failed to start scan: %v", err)
+	}
+	defer it.Close()
+
+	next := uint64(100)
+	for it.Next() {
+		r := it.Record()
+		if r.Offset != next || string(r.Data) != payloads[next-1] {
+			t.Fatalf("expected offset %d, got %d", next, r.Offset)
+		}
+		next++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if next != 2501 {
+		t.Errorf("expected to scan through offset 2500, stopped at %d", next-1)
+	}
+}
+
+func TestScanIteratorSkipsCorrupt(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	corrupt := fake.objects[wal.getObjectKey(3)]
+	corrupt.body[len(corrupt.body)-3] ^= 0xFF
+
+	it, err := wal.Scan(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to start scan: %v", err)
+	}
+	defer it.Close()
+
+	var offsets []uint64
+	failures := 0
+	for {
+		if it.Next() {
+			offsets = append(offsets, it.Record().Offset)
+			continue
+		}
+		if it.Err() == nil {
+			break
+		}
+		// skip the corrupt record and keep going
+		failures++
+	}
+
+	if failures != 1 {
+		t.Errorf("expected one corrupt record, got %d", failures)
+	}
+	if !slices.Equal(offsets, []uint64{1, 2, 4, 5}) {
+		t.Errorf("expected offsets [1 2 4 5], got %v", offsets)
+	}
+}
+
+func TestScanIteratorCloseEarly(t *testing.T) {
+	wal, _ := newFakeDAL(t, WithScanPrefetch(2))
+	ctx := context.Background()
+
+	for i := 0; i < 50; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	it, err := wal.Scan(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to start scan: %v", err)
+	}
+	if !it.Next() {
+		t.Fatalf("expected a record, got %v", it.Err())
+	}
+	if err := it.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if it.Next() {
+		t.Error("expected no records after Close")
+	}
+}
+
+func TestScanAfterTrim(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 30; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	if _, err := wal.TrimBefore(ctx, 11); err != nil {
+		t.Fatalf("failed to trim: %v", err)
+	}
+	// a partial delete punches a hole in the middle
+	for offset := uint64(15); offset <= 19; offset++ {
+		delete(fake.objects, wal.getObjectKey(offset))
+	}
+	// and offset 25 vanishes after listing, just before its read
+	fake.beforeGet = func(key string) {
+		if key == wal.getObjectKey(25) {
+			fake.mu.Lock()
+			delete(fake.objects, key)
+			fake.mu.Unlock()
+		}
+	}
+
+	var want []uint64
+	for offset := uint64(11); offset <= 30; offset++ {
+		if (offset < 15 || offset > 19) && offset != 25 {
+			want = append(want, offset)
+		}
+	}
+
+	it, err := wal.Scan(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to start scan: %v", err)
+	}
+	defer it.Close()
+	var got []uint64
+	for it.Next() {
+		got = append(got, it.Record().Offset)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("expected the scan to jump the gaps, got %v", err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected offsets %v, got %v", want, got)
+	}
+
+	got = nil
+	token := ""
+	for {
+		token, err = wal.ScanPage(ctx, token, 4, func(r Record) error {
+			got = append(got, r.Offset)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("expected ScanPage to jump the gaps, got %v", err)
+		}
+		if token == "" {
+			break
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected paged offsets %v, got %v", want, got)
+	}
+}
+
+// delayedS3 holds back the gets of keys in delays, so reads complete out of
+// order.
+type delayedS3 struct {
+	*fakeS3
+	delays map[string]time.Duration
+}
+
+func (s *delayedS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	time.Sleep(s.delays[aws.ToString(params.Key)])
+	return s.fakeS3.GetObject(ctx, params, optFns...)
+}
+
+// drainReadAll collects what ReadAll delivers until both channels close.
+func drainReadAll(records <-chan Record, errs <-chan error) (offsets []uint64, failures []error) {
+	for records != nil || errs != nil {
+		select {
+		case record, ok := <-records:
+			if !ok {
+				records = nil
+				continue
+			}
+			offsets = append(offsets, record.Offset)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			failures = append(failures, err)
+		}
+	}
+	return offsets, failures
+}
+
+func TestListOffsets(t *testing.T) {
+	logger := &recordingLogger{}
+	wal, fake := newFakeDAL(t, WithLogger(logger))
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	if _, err := wal.TrimBefore(ctx, 3); err != nil {
+		t.Fatalf("failed to trim: %v", err)
+	}
+	delete(fake.objects, wal.getObjectKey(6))
+	delete(fake.objects, wal.getObjectKey(7))
+	if err := wal.PersistLength(ctx); err != nil {
+		t.Fatalf("failed to persist length: %v", err)
+	}
+	stray := wal.keyPrefix() + "notes.txt"
+	fake.objects[stray] = fakeObject{body: []byte("not a record")}
+
+	for _, tc := range []struct {
+		from, to uint64
+		want     string
+	}{
+		{0, 0, "[3 4 5 8 9 10]"},
+		{4, 9, "[4 5 8]"},
+		{6, 8, "[]"},
+		{11, 0, "[]"},
+	} {
+		offsets, err := wal.ListOffsets(ctx, tc.from, tc.to)
+		if err != nil {
+			t.Fatalf("failed to list offsets [%d, %d): %v", tc.from, tc.to, err)
+		}
+		if offsets == nil || fmt.Sprint(offsets) != tc.want {
+			t.Errorf("expected offsets [%d, %d) to be %s, got %v", tc.from, tc.to, tc.want, offsets)
+		}
+	}
+
+	var skipped []string
+	for _, line := range logger.lines {
+		if strings.Contains(line, "skipping key") {
+			skipped = append(skipped, line)
+		}
+	}
+	if len(skipped) == 0 || !strings.Contains(skipped[0], stray) {
+		t.Errorf("expected the stray key logged, got %q", skipped)
+	}
+	for _, line := range skipped {
+		if !strings.Contains(line, stray) {
+			t.Errorf("expected only the stray key logged, got %q", line)
+		}
+	}
+
+	if _, err := wal.ListOffsets(ctx, 5, 4); !errors.Is(err, ErrInvalidRange) {
+		t.Errorf("expected ErrInvalidRange, got %v", err)
+	}
+}
+
+func TestReadAll(t *testing.T) {
+	client := &delayedS3{fakeS3: newFakeS3(), delays: map[string]time.Duration{}}
+	wal, err := New(client, "fake-bucket", "fake-prefix")
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 12; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	for offset := uint64(1); offset <= 4; offset++ {
+		client.delays[wal.getObjectKey(offset)] = time.Duration(5-offset) * 5 * time.Millisecond
+	}
+	corrupt := client.objects[wal.getObjectKey(7)]
+	corrupt.body[len(corrupt.body)-3] ^= 0xFF
+
+	offsets, failures := drainReadAll(wal.ReadAll(ctx, 2, 4))
+	if !slices.Equal(offsets, []uint64{2, 3, 4, 5, 6, 8, 9, 10, 11, 12}) {
+		t.Errorf("expected the records in order without 7, got %v", offsets)
+	}
+	var recordErr *RecordError
+	if len(failures) != 1 || !errors.As(failures[0], &recordErr) || recordErr.Offset != 7 || !errors.Is(failures[0], ErrChecksumMismatch) {
+		t.Errorf("expected one checksum failure at offset 7, got %v", failures)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	records, errs := wal.ReadAll(cancelled, 1, 2)
+	<-records
+	cancel()
+	_, failures = drainReadAll(records, errs)
+	if len(failures) != 1 || !errors.Is(failures[0], context.Canceled) {
+		t.Errorf("expected the read to end with context.Canceled, got %v", failures)
+	}
+
+	if _, failures := drainReadAll(wal.ReadAll(ctx, 1, 0)); len(failures) != 1 {
+		t.Errorf("expected zero concurrency to be rejected, got %v", failures)
+	}
+	packed, _ := newFakeDAL(t, WithPacking(2))
+	if _, failures := drainReadAll(packed.ReadAll(ctx, 1, 2)); len(failures) != 1 || !errors.Is(failures[0], ErrPackedLog) {
+		t.Errorf("expected a packed log to fail with ErrPackedLog, got %v", failures)
+	}
+}
+
+func TestScanTolerant(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 8; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	torn := fake.objects[wal.getObjectKey(3)]
+	torn.body = torn.body[:5]
+	fake.objects[wal.getObjectKey(3)] = torn
+	corrupt := fake.objects[wal.getObjectKey(5)]
+	corrupt.body[len(corrupt.body)-3] ^= 0xFF
+	delete(fake.objects, wal.getObjectKey(6))
+
+	damaged := map[uint64]error{}
+	it, err := wal.ScanTolerant(ctx, 1, func(offset uint64, err error) { damaged[offset] = err })
+	if err != nil {
+		t.Fatalf("failed to start scan: %v", err)
+	}
+	defer it.Close()
+	var offsets []uint64
+	for it.Next() {
+		offsets = append(offsets, it.Record().Offset)
+	}
+	if it.Err() != nil {
+		t.Fatalf("expected the scan to reach the end, got %v", it.Err())
+	}
+	if !slices.Equal(offsets, []uint64{1, 2, 4, 7, 8}) {
+		t.Errorf("expected offsets [1 2 4 7 8], got %v", offsets)
+	}
+	if len(damaged) != 2 || !errors.Is(damaged[3], ErrRecordTooShort) || !errors.Is(damaged[5], ErrChecksumMismatch) {
+		t.Errorf("expected 3 torn and 5 corrupt, and the gap at 6 not damage, got %v", damaged)
+	}
+}
+
+func TestScanOffsetMismatch(t *testing.T) {
+	// a codec that also accepts unpadded names, as a hand-copied key might be
+	encode := func(offset uint64) string { return fmt.Sprintf("%020d", offset) }
+	decode := func(s string) (uint64, error) { return strconv.ParseUint(s, 10, 64) }
+	wal, fake := newFakeDAL(t, WithKeyCodec(encode, decode))
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	// offset 2's body under offset 3's key, and offset 4's under a stray name
+	fake.objects[wal.getObjectKey(3)] = fake.objects[wal.getObjectKey(2)]
+	stray := "fake-prefix/9"
+	fake.objects[stray] = fake.objects[wal.getObjectKey(4)]
+
+	it, err := wal.Scan(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to start scan: %v", err)
+	}
+	defer it.Close()
+	var offsets []uint64
+	var mismatches []OffsetMismatchError
+	for {
+		if it.Next() {
+			offsets = append(offsets, it.Record().Offset)
+			continue
+		}
+		if it.Err() == nil {
+			break
+		}
+		var mismatch *OffsetMismatchError
+		if !errors.As(it.Err(), &mismatch) || !errors.Is(it.Err(), ErrOffsetMismatch) {
+			t.Fatalf("expected an *OffsetMismatchError, got %v", it.Err())
+		}
+		mismatches = append(mismatches, *mismatch)
+	}
+
+	if !slices.Equal(offsets, []uint64{1, 2, 4}) {
+		t.Errorf("expected offsets [1 2 4], got %v", offsets)
+	}
+	want := []OffsetMismatchError{
+		{Key: wal.getObjectKey(3), KeyOffset: 3, BodyOffset: 2},
+		{Key: stray, KeyOffset: 9, BodyOffset: 4},
+	}
+	if !slices.Equal(mismatches, want) {
+		t.Errorf("expected mismatches %+v, got %+v", want, mismatches)
+	}
+
+	// Read names the key too
+	var mismatch *OffsetMismatchError
+	if _, err := wal.Read(ctx, 3); !errors.As(err, &mismatch) || *mismatch != want[0] {
+		t.Errorf("expected Read to report %+v, got %v", want[0], err)
+	}
+}
@@ -0,0 +1,220 @@
+package s3_dal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// A segment file is a range of records packed for storage outside S3:
+//
+//	[magic][entry]...[entry][end][count][crc]
+//
+// magic is the 8 bytes "S3DALSEG" and a version byte. Each entry is the
+// record's big-endian uint64 offset and creation time in Unix nanoseconds (0
+// if it has none), a big-endian uint32 data length and the data. end is a
+// zero offset, which no record has. count is a big-endian uint64 number of
+// entries and crc the big-endian CRC32C of every byte before it, so a
+// truncated or damaged file is rejected whole.
+const (
+	segmentMagic   = "S3DALSEG"
+	segmentVersion = 1
+)
+
+var ErrInvalidSegment = errors.New("invalid segment file")
+
+// Export writes the records at offsets [start, end) to out as a segment
+// file. Each record is read and verified as Read would; holes in
+// the range are left out. The file is streamed, so on error out holds a
+// partial file that Import rejects.
+func (w *S3DAL) Export(ctx context.Context, start, end uint64, out io.Writer) error {
+	if err := checkRange(start, end); err != nil {
+		return err
+	}
+	crc := crc32.New(castagnoli)
+	buf := bufio.NewWriter(io.MultiWriter(out, crc))
+	buf.WriteString(segmentMagic)
+	buf.WriteByte(segmentVersion)
+
+	var count uint64
+	err := w.listRecords(ctx, max(start, 1)-1, 0, func(offset uint64, _ types.Object) (bool, error) {
+		if offset >= end {
+			return false, nil
+		}
+		record, err := w.Read(ctx, offset)
+		if err != nil {
+			return false, err
+		}
+		if uint64(len(record.Data)) > uint64(^uint32(0)) {
+			return false, fmt.Errorf("failed to export offset %d: %d bytes do not fit a segment entry", offset, len(record.Data))
+		}
+		binary.Write(buf, binary.BigEndian, offset)
+		binary.Write(buf, binary.BigEndian, unixNanos(record.CreatedAt))
+		binary.Write(buf, binary.BigEndian, uint32(len(record.Data)))
+		if _, err := buf.Write(record.Data); err != nil {
+			return false, fmt.Errorf("failed to write segment: %w", err)
+		}
+		count++
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	binary.Write(buf, binary.BigEndian, uint64(0))
+	binary.Write(buf, binary.BigEndian, count)
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write segment: %w", err)
+	}
+	if err := binary.Write(out, binary.BigEndian, crc.Sum32()); err != nil {
+		return fmt.Errorf("failed to write segment: %w", err)
+	}
+	return nil
+}
+
+// segmentEntry is one record read back from a segment file.
+type segmentEntry struct {
+	offset  uint64
+	created int64
+	data    []byte
+}
+
+// Import writes every record of a segment file read from r back to its
+// original offset and returns the first and last offsets imported. The whole
+// file is read and its checksum verified before anything is written, so a
+// truncated file fails with ErrInvalidSegment and imports nothing. Like
+// RestoreSnapshot it overwrites only as WithOverwritePolicy allows: by
+// default a record at an offset already taken fails with ErrOffsetConflict,
+// after the entries before it were written.
+func (w *S3DAL) Import(ctx context.Context, r io.Reader) (first, last uint64, err error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read segment: %w", err)
+	}
+	entries, err := parseSegment(raw)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.lifetime.Err() != nil {
+		return 0, 0, ErrClosed
+	}
+	var offsets []uint64
+	defer func() { w.recordInManifest(ctx, offsets...) }()
+	for _, e := range entries {
+		payload, err := compressPayload(w.compression, e.data)
+		if err != nil {
+			return first, last, fmt.Errorf("failed to prepare object body: failed to compress payload: %w", err)
+		}
+		if err := w.putRecord(ctx, e.offset, e.created, payload, w.attrs()); err != nil {
+			return first, last, err
+		}
+		w.setLength(max(w.length, e.offset))
+		w.size += uint64(len(e.data))
+		w.setStored(w.stored + w.storedSize(len(payload)))
+		offsets = append(offsets, e.offset)
+		if first == 0 {
+			first = e.offset
+		}
+		last = e.offset
+	}
+	return first, last, nil
+}
+
+// RestoreRecord writes data as the record at offset, whatever the length, as
+// when restoring records one by one from an export or filling a hole, and
+// advances the length to offset if it is behind. An object already at offset
+// is overwritten only as WithOverwritePolicy allows; by default the restore
+// fails with ErrOffsetConflict. The size limits apply as for Append, but not
+// the append hooks, as data is a record already appended once. It is not
+// supported with packing.
+func (w *S3DAL) RestoreRecord(ctx context.Context, offset uint64, data []byte) (err error) {
+	if w.packRecords > 0 {
+		return ErrPackedLog
+	}
+	if offset == 0 {
+		return errOffsetZero
+	}
+	start := time.Now()
+	defer func() { w.observer.RecordAppend(len(data), time.Since(start), err) }()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	defer func() { err = w.opError("restore", offset, err) }()
+	if w.lifetime.Err() != nil {
+		return ErrClosed
+	}
+
+	if err := w.checkRecordSize(w.size, uint64(len(data)), w.fileSizeLimit); err != nil {
+		return err
+	}
+	payload, err := compressPayload(w.compression, data)
+	if err != nil {
+		return fmt.Errorf("failed to prepare object body: failed to compress payload: %w", err)
+	}
+	stored := w.storedSize(len(payload))
+	if err := w.checkStoredSize(w.stored, stored); err != nil {
+		return err
+	}
+	// an overwrite replaces what the cache may hold
+	defer w.cache.evict(offset)
+	if err := w.putRecord(ctx, offset, w.nextCreated(), payload, w.attrs()); err != nil {
+		return err
+	}
+	w.setLength(max(w.length, offset))
+	w.size += uint64(len(data))
+	w.setStored(w.stored + stored)
+	w.recordInManifest(ctx, offset)
+	return nil
+}
+
+// parseSegment verifies a whole segment file and decodes its entries.
+func parseSegment(raw []byte) ([]segmentEntry, error) {
+	if len(raw) < len(segmentMagic)+1+8+8+crc32.Size || string(raw[:len(segmentMagic)]) != segmentMagic {
+		return nil, fmt.Errorf("%w: bad header", ErrInvalidSegment)
+	}
+	if v := raw[len(segmentMagic)]; v != segmentVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidSegment, v)
+	}
+	body, sum := raw[:len(raw)-crc32.Size], binary.BigEndian.Uint32(raw[len(raw)-crc32.Size:])
+	if crc32.Checksum(body, castagnoli) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch, the file is truncated or damaged", ErrInvalidSegment)
+	}
+
+	rd := bytes.NewReader(body[len(segmentMagic)+1:])
+	var entries []segmentEntry
+	for {
+		var offset uint64
+		if err := binary.Read(rd, binary.BigEndian, &offset); err != nil {
+			return nil, fmt.Errorf("%w: missing end marker", ErrInvalidSegment)
+		}
+		if offset == 0 {
+			break
+		}
+		if len(entries) > 0 && offset <= entries[len(entries)-1].offset {
+			return nil, fmt.Errorf("%w: offset %d out of order", ErrInvalidSegment, offset)
+		}
+		e := segmentEntry{offset: offset}
+		var n uint32
+		if binary.Read(rd, binary.BigEndian, &e.created) != nil || binary.Read(rd, binary.BigEndian, &n) != nil || uint64(n) > uint64(rd.Len()) {
+			return nil, fmt.Errorf("%w: entry for offset %d is truncated", ErrInvalidSegment, offset)
+		}
+		e.data = make([]byte, n)
+		io.ReadFull(rd, e.data)
+		entries = append(entries, e)
+	}
+	var count uint64
+	if err := binary.Read(rd, binary.BigEndian, &count); err != nil || rd.Len() != 0 || count != uint64(len(entries)) {
+		return nil, fmt.Errorf("%w: bad trailer", ErrInvalidSegment)
+	}
+	return entries, nil
+}
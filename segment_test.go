@@ -0,0 +1,127 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	src, _ := newFakeDAL(t, WithTimestamps())
+	ctx := context.Background()
+	for i := 1; i <= 6; i++ {
+		if i == 4 {
+			if _, err := src.Reserve(ctx); err != nil {
+				t.Fatalf("failed to reserve: %v", err)
+			}
+			continue
+		}
+		if _, err := src.Append(ctx, []byte(fmt.Sprintf("record %d", i))); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+
+	var file bytes.Buffer
+	if err := src.Export(ctx, 2, 6, &file); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	segment := file.Bytes()
+
+	dst, fake := newFakeDAL(t)
+	for name, damaged := range map[string][]byte{
+		"truncated":   segment[:len(segment)-10],
+		"flipped bit": append(append([]byte(nil), segment[:20]...), append([]byte{segment[20] ^ 1}, segment[21:]...)...),
+		"empty":       nil,
+	} {
+		if _, _, err := dst.Import(ctx, bytes.NewReader(damaged)); !errors.Is(err, ErrInvalidSegment) {
+			t.Errorf("%s: expected ErrInvalidSegment, got %v", name, err)
+		}
+	}
+	if fake.putCalls != 0 {
+		t.Fatalf("expected a damaged file to import nothing, got %d puts", fake.putCalls)
+	}
+
+	first, last, err := dst.Import(ctx, bytes.NewReader(segment))
+	if err != nil || first != 2 || last != 5 {
+		t.Fatalf("expected offsets 2 to 5 imported, got %d to %d, %v", first, last, err)
+	}
+	for _, offset := range []uint64{2, 3, 5} {
+		want, _ := src.Read(ctx, offset)
+		got, err := dst.Read(ctx, offset)
+		if err != nil || !bytes.Equal(got.Data, want.Data) || !got.CreatedAt.Equal(want.CreatedAt) {
+			t.Errorf("offset %d: expected %q created %v, got %q created %v, %v", offset, want.Data, want.CreatedAt, got.Data, got.CreatedAt, err)
+		}
+	}
+	if _, err := dst.Read(ctx, 4); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected the hole at offset 4 to stay a hole, got %v", err)
+	}
+	if dst.Length() != 5 {
+		t.Errorf("expected length 5 after the import, got %d", dst.Length())
+	}
+
+	if _, _, err := dst.Import(ctx, bytes.NewReader(segment)); !errors.Is(err, ErrOffsetConflict) {
+		t.Errorf("expected importing twice to conflict, got %v", err)
+	}
+}
+
+func TestRestoreRecord(t *testing.T) {
+	wal, _ := newFakeDAL(t, WithReadCache(16, 1<<20))
+	ctx := context.Background()
+	for _, data := range []string{"one", "two", "three"} {
+		if _, err := wal.Append(ctx, []byte(data)); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	if _, err := wal.DeleteRange(ctx, 2, 3, false); err != nil {
+		t.Fatalf("failed to delete offset 2: %v", err)
+	}
+
+	// into the hole, leaving the length alone
+	if err := wal.RestoreRecord(ctx, 2, []byte("two again")); err != nil {
+		t.Fatalf("failed to restore into the hole: %v", err)
+	}
+	if record, err := wal.Read(ctx, 2); err != nil || string(record.Data) != "two again" || record.Offset != 2 {
+		t.Errorf("expected the restored record at offset 2, got %d %q, %v", record.Offset, record.Data, err)
+	}
+	if wal.Length() != 3 {
+		t.Errorf("expected the length kept at 3, got %d", wal.Length())
+	}
+
+	// beyond the tail, advancing the length
+	if err := wal.RestoreRecord(ctx, 10, []byte("ten")); err != nil {
+		t.Fatalf("failed to restore beyond the tail: %v", err)
+	}
+	if wal.Length() != 10 {
+		t.Errorf("expected the length advanced to 10, got %d", wal.Length())
+	}
+	if offset, err := wal.Append(ctx, []byte("eleven")); err != nil || offset != 11 {
+		t.Errorf("expected the next append at 11, got %d, %v", offset, err)
+	}
+
+	// strict by default
+	if err := wal.RestoreRecord(ctx, 1, []byte("clobber")); !errors.Is(err, ErrOffsetConflict) {
+		t.Errorf("expected ErrOffsetConflict restoring over offset 1, got %v", err)
+	}
+	if err := wal.RestoreRecord(ctx, 0, []byte("zero")); !errors.Is(err, ErrInvalidOffset) {
+		t.Errorf("expected ErrInvalidOffset for offset 0, got %v", err)
+	}
+}
+
+func TestRestoreRecordOverwrite(t *testing.T) {
+	wal, _ := newFakeDAL(t, WithOverwritePolicy(OverwriteAlways), WithReadCache(16, 1<<20))
+	ctx := context.Background()
+	if _, err := wal.Append(ctx, []byte("original")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if _, err := wal.Read(ctx, 1); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if err := wal.RestoreRecord(ctx, 1, []byte("restored")); err != nil {
+		t.Fatalf("failed to restore over offset 1: %v", err)
+	}
+	if record, err := wal.Read(ctx, 1); err != nil || string(record.Data) != "restored" {
+		t.Errorf("expected the restored record, not a cached one, got %q, %v", record.Data, err)
+	}
+}
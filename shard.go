@@ -0,0 +1,228 @@
+package s3_dal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// maxShards keeps shard names to two digits.
+const maxShards = 100
+
+// shardOf is the shard holding offset, always 0 for an unsharded log.
+func (w *S3DAL) shardOf(offset uint64) int {
+	if w.shards == 0 {
+		return 0
+	}
+	return int(offset % uint64(w.shards))
+}
+
+// shardPrefix is the key prefix, with its trailing delimiter, of the records in
+// shard under the current key version. An unsharded log keeps every record
+// directly under the prefix, or under the version's sub-prefix.
+func (w *S3DAL) shardPrefix(shard int) string {
+	return w.recordPrefix(w.keyVersion, shard)
+}
+
+// recordPrefix is shardPrefix under key version version.
+func (w *S3DAL) recordPrefix(version, shard int) string {
+	prefix := w.keyPrefix()
+	if version > 1 {
+		prefix += versionName(version) + w.delimiter
+	}
+	if w.shards > 0 {
+		prefix += shardName(shard) + w.delimiter
+	}
+	return prefix
+}
+
+func shardName(shard int) string {
+	return fmt.Sprintf("shard-%02d", shard)
+}
+
+// shardedOffset parses "shard-XX/<offset>", the part of a sharded record key
+// after the prefix, rejecting a record filed under the wrong shard.
+func (w *S3DAL) shardedOffset(name string) (uint64, error) {
+	shard, numStr, ok := strings.Cut(name, w.delimiter)
+	if !ok {
+		return 0, fmt.Errorf("key %q is not under a shard", name)
+	}
+	offset, err := w.decodeOffset(numStr)
+	if err != nil {
+		return 0, err
+	}
+	if want := shardName(w.shardOf(offset)); shard != want {
+		return 0, fmt.Errorf("offset %d is filed under %s, not %s", offset, shard, want)
+	}
+	return offset, nil
+}
+
+// listRecords calls fn with each record object whose offset is above after,
+// in ascending offset order, until fn returns false or an error. pageSize, if
+// positive, caps the keys per list call, as WithMaxListPageSize otherwise
+// does. A sharded log runs one listing per
+// shard and merges them, so every call lists every shard at least once, and
+// with WithKeyVersion each version's keys are listed and merged the same way.
+func (w *S3DAL) listRecords(ctx context.Context, after uint64, pageSize int32, fn func(offset uint64, obj types.Object) (bool, error)) error {
+	if w.packRecords > 0 {
+		return ErrPackedLog
+	}
+	if pageSize <= 0 {
+		pageSize = w.listPageSize
+	}
+	var cursors []*shardCursor
+	for _, version := range w.keyVersions() {
+		for shard := range max(w.shards, 1) {
+			prefix := w.recordPrefix(version, shard)
+			input := &s3.ListObjectsV2Input{
+				Bucket: aws.String(w.bucketName),
+				Prefix: aws.String(prefix),
+			}
+			if version == 1 && w.shards == 0 && w.keyVersion > 1 {
+				// the other versions' keys are under this prefix too
+				input.Delimiter = aws.String(w.delimiter)
+			}
+			if after > 0 {
+				input.StartAfter = aws.String(prefix + w.encodeOffset(after))
+			}
+			if pageSize > 0 {
+				input.MaxKeys = aws.Int32(pageSize)
+			}
+			cursors = append(cursors, &shardCursor{w: w, pages: s3.NewListObjectsV2Paginator(w.client, input)})
+		}
+	}
+	if w.compaction {
+		cursors = append(cursors, w.segmentCursor(after, pageSize))
+	}
+
+	var last uint64
+	for {
+		var next *shardCursor
+		for _, c := range cursors {
+			ok, err := c.fill(ctx)
+			if err != nil {
+				return err
+			}
+			if ok && (next == nil || c.page[0].offset < next.page[0].offset) {
+				next = c
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		head := next.page[0]
+		next.page = next.page[1:]
+		if head.offset <= last {
+			// also in a segment, from a Compact that failed before deleting it
+			continue
+		}
+		last = head.offset
+		if more, err := fn(head.offset, head.obj); err != nil || !more {
+			return err
+		}
+	}
+}
+
+type listedRecord struct {
+	offset uint64
+	obj    types.Object
+}
+
+// shardCursor buffers the listed records of one shard, in ascending order.
+// The cursor of a compacted log's segments also holds the segments listed but
+// not yet read, and skips their records up to after.
+type shardCursor struct {
+	w     *S3DAL
+	pages *s3.ListObjectsV2Paginator
+	page  []listedRecord
+
+	compacted bool
+	segments  []types.Object
+	after     uint64
+}
+
+// segmentCursor lists the segments that can hold records above after.
+func (w *S3DAL) segmentCursor(after uint64, pageSize int32) *shardCursor {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(w.bucketName),
+		Prefix: aws.String(w.compactedPrefix()),
+	}
+	if after > maxPackRecords {
+		input.StartAfter = aws.String(w.compactedPrefix() + w.encodeOffset(after-maxPackRecords))
+	}
+	if pageSize > 0 {
+		input.MaxKeys = aws.Int32(pageSize)
+	}
+	return &shardCursor{w: w, pages: s3.NewListObjectsV2Paginator(w.client, input), compacted: true, after: after}
+}
+
+// fill lists pages until one holds a record, and reports whether any is left.
+// Segments are read one at a time, as their records are reached.
+func (c *shardCursor) fill(ctx context.Context) (bool, error) {
+	if c.compacted {
+		return c.fillSegments(ctx)
+	}
+	for len(c.page) == 0 && c.pages.HasMorePages() {
+		output, err := c.pages.NextPage(ctx)
+		if err != nil {
+			return false, fmt.Errorf("failed to list objects from S3: %w", err)
+		}
+		for _, obj := range output.Contents {
+			key := aws.ToString(obj.Key)
+			if !c.w.isRecordKey(key) {
+				if !c.w.isInternalKey(key) {
+					c.w.logger.Debugf("skipping key %s: not a record key", key)
+				}
+				continue
+			}
+			offset, err := c.w.getOffsetFromKey(key)
+			if err != nil {
+				return false, fmt.Errorf("failed to parse offset from key: %w", err)
+			}
+			c.page = append(c.page, listedRecord{offset: offset, obj: obj})
+		}
+	}
+	return len(c.page) > 0, nil
+}
+
+func (c *shardCursor) fillSegments(ctx context.Context) (bool, error) {
+	for len(c.page) == 0 {
+		if len(c.segments) == 0 {
+			if !c.pages.HasMorePages() {
+				return false, nil
+			}
+			output, err := c.pages.NextPage(ctx)
+			if err != nil {
+				return false, fmt.Errorf("failed to list objects from S3: %w", err)
+			}
+			c.segments = append(c.segments, output.Contents...)
+			continue
+		}
+		obj := c.segments[0]
+		c.segments = c.segments[1:]
+		if _, _, err := c.w.parseSegmentKey(aws.ToString(obj.Key)); err != nil {
+			continue
+		}
+		body, err := c.w.getRange(ctx, aws.ToString(obj.Key), "")
+		if err != nil {
+			return false, err
+		}
+		entries, err := packEntries(body)
+		if err != nil {
+			return false, fmt.Errorf("%w: segment %s", err, aws.ToString(obj.Key))
+		}
+		c.w.segments.put(aws.ToString(obj.Key), aws.ToString(obj.ETag), entries)
+		for _, e := range entries {
+			if e.offset > c.after {
+				entry := obj
+				entry.Size = aws.Int64(int64(len(e.data)))
+				c.page = append(c.page, listedRecord{offset: e.offset, obj: entry})
+			}
+		}
+	}
+	return true, nil
+}
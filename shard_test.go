@@ -0,0 +1,121 @@
+package s3_dal
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestShardedLog(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithShards(3))
+	ctx := context.Background()
+	for i := 0; i < 25; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+
+	for key := range fake.objects {
+		offset, err := wal.getOffsetFromKey(key)
+		if err != nil {
+			t.Fatalf("unexpected key %q: %v", key, err)
+		}
+		if want := "fake-prefix/" + shardName(int(offset%3)) + "/"; !strings.HasPrefix(key, want) {
+			t.Errorf("expected offset %d under %s, got %q", offset, want, key)
+		}
+	}
+
+	reopened, err := OpenS3DAL(ctx, fake, wal.bucketName, wal.prefix, WithShards(3))
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	if reopened.Length() != 25 {
+		t.Errorf("expected length 25 after reopening, got %d", reopened.Length())
+	}
+	if last, err := reopened.LastRecord(ctx); err != nil || last.Offset != 25 {
+		t.Errorf("expected last record 25, got %d, %v", last.Offset, err)
+	}
+	if last, err := wal.listLastOffset(ctx); err != nil || last != 25 {
+		t.Errorf("expected the listed tail to be 25, got %d, %v", last, err)
+	}
+	if first, err := wal.FirstRecord(ctx); err != nil || first.Offset != 1 {
+		t.Errorf("expected first record 1, got %d, %v", first.Offset, err)
+	}
+	if count, err := wal.Count(ctx); err != nil || count != 25 {
+		t.Errorf("expected count 25, got %d, %v", count, err)
+	}
+
+	var scanned []uint64
+	it, err := wal.Scan(ctx, 5)
+	if err != nil {
+		t.Fatalf("failed to scan: %v", err)
+	}
+	for it.Next() {
+		scanned = append(scanned, it.Record().Offset)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	it.Close()
+	if want := offsetRange(5, 25); !slices.Equal(scanned, want) {
+		t.Errorf("expected scan to merge shards as %v, got %v", want, scanned)
+	}
+
+	var paged []uint64
+	token := ""
+	for {
+		token, err = wal.ScanPage(ctx, token, 4, func(r Record) error {
+			paged = append(paged, r.Offset)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to scan page: %v", err)
+		}
+		if token == "" {
+			break
+		}
+	}
+	if want := offsetRange(1, 25); !slices.Equal(paged, want) {
+		t.Errorf("expected pages to merge shards as %v, got %v", want, paged)
+	}
+
+	if deleted, err := wal.TrimBefore(ctx, 11); err != nil || deleted != 10 {
+		t.Fatalf("expected to trim 10 records, got %d, %v", deleted, err)
+	}
+	if first, err := wal.FirstRecord(ctx); err != nil || first.Offset != 11 {
+		t.Errorf("expected first record 11 after trimming, got %d, %v", first.Offset, err)
+	}
+}
+
+func TestShardedKeysRejectWrongShard(t *testing.T) {
+	wal, _ := newFakeDAL(t, WithShards(4))
+	if key := wal.getObjectKey(6); !wal.isRecordKey(key) {
+		t.Errorf("expected %q to be a record key", key)
+	}
+	for _, key := range []string{
+		"fake-prefix/" + wal.encodeOffset(6),
+		"fake-prefix/shard-01/" + wal.encodeOffset(6),
+		"fake-prefix/_manifest",
+	} {
+		if wal.isRecordKey(key) {
+			t.Errorf("expected %q not to be a record key", key)
+		}
+	}
+}
+
+func TestWithShards(t *testing.T) {
+	for _, n := range []int{0, 1, maxShards + 1} {
+		if _, err := New(newFakeS3(), "fake-bucket", "fake-prefix", WithShards(n)); err == nil {
+			t.Errorf("expected WithShards(%d) to be rejected", n)
+		}
+	}
+}
+
+func offsetRange(from, to uint64) []uint64 {
+	var offsets []uint64
+	for o := from; o <= to; o++ {
+		offsets = append(offsets, o)
+	}
+	return offsets
+}
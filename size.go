@@ -0,0 +1,114 @@
+package s3_dal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// RecordSize returns the stored size of the record at offset with a single
+// HeadObject, without downloading it. The size is that of the object: it
+// includes the header and checksum trailer, and is of the payload as stored,
+// after any compression or encryption. A missing record is ErrRecordNotFound.
+func (w *S3DAL) RecordSize(ctx context.Context, offset uint64) (int64, error) {
+	if w.packRecords > 0 {
+		return 0, ErrPackedLog
+	}
+	output, err := w.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(w.getObjectKey(offset)),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return 0, fmt.Errorf("%w: offset %d: %w", ErrRecordNotFound, offset, err)
+		}
+		return 0, fmt.Errorf("failed to head object in S3: %w", err)
+	}
+	return aws.ToInt64(output.ContentLength), nil
+}
+
+// TotalBytes returns the stored size of the records at offsets [start, end),
+// summed from the listing alone, so it costs one
+// ListObjectsV2 call per 1000 records and reads no bodies. Sizes are counted
+// as by RecordSize; holes add nothing.
+func (w *S3DAL) TotalBytes(ctx context.Context, start, end uint64) (int64, error) {
+	if err := checkRange(start, end); err != nil {
+		return 0, err
+	}
+	var total int64
+	err := w.listRecords(ctx, max(start, 1)-1, 0, func(offset uint64, obj types.Object) (bool, error) {
+		if offset >= end {
+			return false, nil
+		}
+		total += aws.ToInt64(obj.Size)
+		return true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// SizeLimitError is returned when an append would take the bytes appended
+// through this client past a limit: the payload bytes WithFileSizeLimit caps,
+// or, with Stored set, the object bytes WithStoredSizeLimit caps.
+type SizeLimitError struct {
+	Stored bool
+	Limit  uint64
+	// Total is what the bytes would have come to with the record
+	Total uint64
+}
+
+func (e *SizeLimitError) Error() string {
+	if e.Stored {
+		return fmt.Sprintf("appending data would exceed the stored size limit of %d object bytes (%d with the record)", e.Limit, e.Total)
+	}
+	return fmt.Sprintf("appending data would exceed the file size limit of %d payload bytes (%d with the record)", e.Limit, e.Total)
+}
+
+// LogicalBytes returns the payload bytes appended through this client, before
+// compression and framing; WithFileSizeLimit applies to them.
+func (w *S3DAL) LogicalBytes() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size
+}
+
+// StoredBytes returns the object bytes appended through this client: each
+// record's header, payload as stored and checksum, as RecordSize counts them,
+// or for a packed log its pack entry. WithStoredSizeLimit applies to them.
+func (w *S3DAL) StoredBytes() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stored
+}
+
+// storedSize is the object size of a record whose payload, after any
+// compression, is payloadLen bytes.
+func (w *S3DAL) storedSize(payloadLen int) uint64 {
+	if w.packRecords > 0 {
+		return uint64(packEntryLen + payloadLen)
+	}
+	n := recordHeaderLen + 8 + payloadLen + w.checksum.Size()
+	if w.timestamps {
+		n += 8
+	}
+	if w.encrypt {
+		aead := w.keys[w.encryptKeyID]
+		n += encryptionHeaderLen + aead.NonceSize() + aead.Overhead()
+	}
+	return uint64(n)
+}
+
+// checkStoredSize checks a record whose object is stored bytes against the
+// stored size limit, with total bytes already stored: w.stored, or a running
+// total for a batch. The caller holds mu.
+func (w *S3DAL) checkStoredSize(total, stored uint64) error {
+	if total+stored > w.storedSizeLimit {
+		return &SizeLimitError{Stored: true, Limit: w.storedSizeLimit, Total: total + stored}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRecordSize(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	var want int64
+	for i := 1; i <= 10; i++ {
+		offset, err := wal.Append(ctx, make([]byte, i*10))
+		if err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+		size := int64(len(fake.objects[wal.getObjectKey(offset)].body))
+		if size != int64(recordHeaderLen+8+i*10+ChecksumCRC16.Size()) {
+			t.Fatalf("unexpected stored size %d for %d bytes of data", size, i*10)
+		}
+		if offset >= 3 && offset <= 7 && offset != 5 {
+			want += size
+		}
+	}
+	delete(fake.objects, wal.getObjectKey(5))
+
+	fake.getCalls = 0
+	if size, err := wal.RecordSize(ctx, 4); err != nil || size != recordHeaderLen+8+40+2 {
+		t.Errorf("expected the stored size of offset 4, got %d, %v", size, err)
+	}
+	if _, err := wal.RecordSize(ctx, 5); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound, got %v", err)
+	}
+
+	fake.listCalls = 0
+	if total, err := wal.TotalBytes(ctx, 3, 8); err != nil || total != want {
+		t.Errorf("expected %d bytes, got %d, %v", want, total, err)
+	}
+	if fake.getCalls != 0 || fake.listCalls != 1 {
+		t.Errorf("expected a single list and no gets, got %d lists and %d gets", fake.listCalls, fake.getCalls)
+	}
+	if _, err := wal.TotalBytes(ctx, 7, 3); err == nil {
+		t.Error("expected an inverted range to be rejected")
+	}
+}
+
+func TestStoredBytes(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"plain":      nil,
+		"timestamps": {WithTimestamps(), WithChecksum(ChecksumSHA256)},
+		"encrypted":  {WithClientEncryption(1, newGCM(t, 1)), WithCompression(CompressionGzip)},
+	} {
+		wal, fake := newFakeDAL(t, opts...)
+		ctx := context.Background()
+		var logical uint64
+		for i := range 5 {
+			data := bytes.Repeat([]byte("x"), 10*i)
+			if _, err := wal.Append(ctx, data); err != nil {
+				t.Fatalf("%s: failed to append: %v", name, err)
+			}
+			logical += uint64(len(data))
+		}
+		if _, err := wal.AppendBatch(ctx, [][]byte{[]byte("batch one"), []byte("batch two")}); err != nil {
+			t.Fatalf("%s: failed to append batch: %v", name, err)
+		}
+		logical += 18
+
+		var stored uint64
+		for _, obj := range fake.objects {
+			stored += uint64(len(obj.body))
+		}
+		if got := wal.LogicalBytes(); got != logical {
+			t.Errorf("%s: expected %d logical bytes, got %d", name, logical, got)
+		}
+		if got := wal.StoredBytes(); got != stored {
+			t.Errorf("%s: expected %d stored bytes, the objects' total, got %d", name, stored, got)
+		}
+	}
+}
+
+func TestStoredSizeLimit(t *testing.T) {
+	ctx := context.Background()
+
+	// 20 payload bytes fit the logical limit, but not with the 14 bytes of
+	// header and CRC16 around them
+	wal, _ := newFakeDAL(t, WithFileSizeLimit(100), WithStoredSizeLimit(30))
+	_, err := wal.Append(ctx, make([]byte, 20))
+	var limitErr *SizeLimitError
+	if !errors.As(err, &limitErr) || !limitErr.Stored || limitErr.Limit != 30 || limitErr.Total != 34 {
+		t.Fatalf("expected the stored size limit hit at 34 bytes, got %v", err)
+	}
+	if _, err := wal.Append(ctx, make([]byte, 16)); err != nil {
+		t.Errorf("expected a record framed to 30 bytes to fit, got %v", err)
+	}
+	if _, err := wal.AppendBatch(ctx, [][]byte{nil}); !errors.As(err, &limitErr) || !limitErr.Stored {
+		t.Errorf("expected AppendBatch to hit the stored size limit, got %v", err)
+	}
+
+	// compressed, 200 payload bytes are stored well under the stored limit
+	// but over the logical one
+	wal, _ = newFakeDAL(t, WithCompression(CompressionGzip), WithFileSizeLimit(100), WithStoredSizeLimit(1000))
+	_, err = wal.Append(ctx, bytes.Repeat([]byte("a"), 200))
+	if !errors.As(err, &limitErr) || limitErr.Stored || limitErr.Limit != 100 {
+		t.Fatalf("expected the file size limit hit, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "file size limit of 100 payload bytes") {
+		t.Errorf("expected the error to name the file size limit, got %q", err)
+	}
+	if wal.LogicalBytes() != 0 || wal.StoredBytes() != 0 {
+		t.Errorf("expected a refused record not counted, got %d and %d bytes", wal.LogicalBytes(), wal.StoredBytes())
+	}
+}
@@ -0,0 +1,247 @@
+package s3_dal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// A snapshot is a single object holding every record of a log:
+//
+//	[frame]...[frame][index entry]...[index entry][count][magic]
+//
+// Each frame is a record object as Append writes it, the magic, version and
+// flags header, the offset, the creation time if flagged, the data and the
+// checksum trailer, framed with the DAL's compression, checksum and
+// encryption, then gzip-compressed on its own, so it can be fetched and
+// inflated without touching its neighbours. Each index entry is three big-endian uint64s:
+// the record offset, the frame's byte position and its compressed length,
+// sorted by offset. count is a big-endian uint64 number of index entries and
+// magic is the 8 bytes "S3DALSNP".
+const (
+	snapshotMagic      = "S3DALSNP"
+	snapshotTrailerLen = 16
+	snapshotEntryLen   = 24
+)
+
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+type snapshotEntry struct {
+	offset   uint64
+	position uint64
+	length   uint64
+}
+
+// ExportSnapshot writes every record of the log into one compressed object at
+// snapshotKey in the same bucket and returns how many records it holds. The
+// snapshot is assembled in memory before upload. Records are framed with this
+// DAL's compression, checksum and encryption, so under WithClientEncryption
+// the snapshot holds them sealed and reading or restoring it needs the key. A
+// key under the log's own prefix should start with "_" so listings do not
+// mistake it for a record.
+func (w *S3DAL) ExportSnapshot(ctx context.Context, snapshotKey string) (int, error) {
+	records, err := w.listAllRecords(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var buf bytes.Buffer
+	entries := make([]snapshotEntry, 0, len(records))
+	for _, r := range records {
+		offset := r.offset
+		record, err := w.Read(ctx, offset)
+		if err != nil {
+			return 0, err
+		}
+		// framed as a new record is, so an encrypted log's snapshot stays sealed
+		body, err := w.encodeBody(record.Offset, unixNanos(record.CreatedAt), record.Data, false)
+		if err != nil {
+			return 0, fmt.Errorf("failed to prepare object body: %w", err)
+		}
+
+		position := uint64(buf.Len())
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return 0, fmt.Errorf("failed to compress record %d: %w", offset, err)
+		}
+		if err := zw.Close(); err != nil {
+			return 0, fmt.Errorf("failed to compress record %d: %w", offset, err)
+		}
+		entries = append(entries, snapshotEntry{offset: offset, position: position, length: uint64(buf.Len()) - position})
+	}
+
+	for _, e := range entries {
+		binary.Write(&buf, binary.BigEndian, e.offset)
+		binary.Write(&buf, binary.BigEndian, e.position)
+		binary.Write(&buf, binary.BigEndian, e.length)
+	}
+	binary.Write(&buf, binary.BigEndian, uint64(len(entries)))
+	buf.WriteString(snapshotMagic)
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(snapshotKey),
+		Body:   bytes.NewReader(buf.Bytes()),
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.BucketKeyEnabled = w.sseParams()
+	if _, err := w.client.PutObject(ctx, input); err != nil {
+		return 0, fmt.Errorf("failed to put snapshot to S3%s: %w", w.sseHint(err), err)
+	}
+	return len(entries), nil
+}
+
+// ReadFromSnapshot returns one record from a snapshot using ranged GETs for
+// the trailer, the index and the record's frame, without downloading the rest.
+func (w *S3DAL) ReadFromSnapshot(ctx context.Context, snapshotKey string, offset uint64) (Record, error) {
+	entries, err := w.readSnapshotIndex(ctx, snapshotKey)
+	if err != nil {
+		return Record{}, err
+	}
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].offset >= offset })
+	if i == len(entries) || entries[i].offset != offset {
+		return Record{}, fmt.Errorf("offset %d not in snapshot %s", offset, snapshotKey)
+	}
+
+	e := entries[i]
+	frame, err := w.getRange(ctx, snapshotKey, fmt.Sprintf("bytes=%d-%d", e.position, e.position+e.length-1))
+	if err != nil {
+		return Record{}, err
+	}
+	return w.decodeSnapshotFrame(frame, offset)
+}
+
+// RestoreSnapshot writes every record of a snapshot back to its original
+// offset in this log and returns how many were restored. Existing records are
+// overwritten only as WithOverwritePolicy allows; by default a collision
+// fails the restore.
+func (w *S3DAL) RestoreSnapshot(ctx context.Context, snapshotKey string) (int, error) {
+	raw, err := w.getRange(ctx, snapshotKey, "")
+	if err != nil {
+		return 0, err
+	}
+	entries, err := parseSnapshotIndex(raw)
+	if err != nil {
+		return 0, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.checkFence(ctx); err != nil {
+		return 0, err
+	}
+	var offsets []uint64
+	defer func() { w.recordInManifest(ctx, offsets...) }()
+	restored := 0
+	for _, e := range entries {
+		if e.position+e.length > uint64(len(raw)) {
+			return restored, fmt.Errorf("%w: frame for offset %d out of bounds", ErrInvalidSnapshot, e.offset)
+		}
+		record, err := w.decodeSnapshotFrame(raw[e.position:e.position+e.length], e.offset)
+		if err != nil {
+			return restored, err
+		}
+		body, err := w.encodeBody(record.Offset, unixNanos(record.CreatedAt), record.Data, false)
+		if err != nil {
+			return restored, fmt.Errorf("failed to prepare object body: %w", err)
+		}
+		if _, err := w.client.PutObject(ctx, w.putInput(record.Offset, body)); err != nil {
+			if err := w.keepIdentical(ctx, record.Offset, record.Data, w.putRecordError(record.Offset, err)); err != nil {
+				return restored, err
+			}
+		}
+		w.setLength(max(w.length, record.Offset))
+		w.size += uint64(len(record.Data))
+		w.setStored(w.stored + uint64(len(body)))
+		offsets = append(offsets, record.Offset)
+		restored++
+	}
+	return restored, nil
+}
+
+func (w *S3DAL) readSnapshotIndex(ctx context.Context, snapshotKey string) ([]snapshotEntry, error) {
+	trailer, err := w.getRange(ctx, snapshotKey, fmt.Sprintf("bytes=-%d", snapshotTrailerLen))
+	if err != nil {
+		return nil, err
+	}
+	if len(trailer) != snapshotTrailerLen || string(trailer[8:]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: bad trailer", ErrInvalidSnapshot)
+	}
+	count := binary.BigEndian.Uint64(trailer[:8])
+	if count == 0 {
+		return nil, nil
+	}
+
+	indexLen := count * snapshotEntryLen
+	index, err := w.getRange(ctx, snapshotKey, fmt.Sprintf("bytes=-%d", indexLen+snapshotTrailerLen))
+	if err != nil {
+		return nil, err
+	}
+	return parseSnapshotIndex(index)
+}
+
+// parseSnapshotIndex decodes the index from a buffer that ends with the
+// snapshot trailer.
+func parseSnapshotIndex(raw []byte) ([]snapshotEntry, error) {
+	if len(raw) < snapshotTrailerLen || string(raw[len(raw)-8:]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: bad trailer", ErrInvalidSnapshot)
+	}
+	count := binary.BigEndian.Uint64(raw[len(raw)-snapshotTrailerLen:])
+	indexLen := count * snapshotEntryLen
+	if indexLen+snapshotTrailerLen > uint64(len(raw)) {
+		return nil, fmt.Errorf("%w: index of %d entries is truncated", ErrInvalidSnapshot, count)
+	}
+
+	index := raw[uint64(len(raw))-snapshotTrailerLen-indexLen : len(raw)-snapshotTrailerLen]
+	entries := make([]snapshotEntry, count)
+	for i := range entries {
+		e := index[i*snapshotEntryLen:]
+		entries[i] = snapshotEntry{
+			offset:   binary.BigEndian.Uint64(e[0:8]),
+			position: binary.BigEndian.Uint64(e[8:16]),
+			length:   binary.BigEndian.Uint64(e[16:24]),
+		}
+	}
+	return entries, nil
+}
+
+func (w *S3DAL) decodeSnapshotFrame(frame []byte, offset uint64) (Record, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(frame))
+	if err != nil {
+		return Record{}, fmt.Errorf("%w: frame for offset %d: %v", ErrInvalidSnapshot, offset, err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		return Record{}, fmt.Errorf("%w: frame for offset %d: %v", ErrInvalidSnapshot, offset, err)
+	}
+	return w.decodeBody(offset, body, true)
+}
+
+// getRange fetches key, or only the given HTTP byte range of it.
+func (w *S3DAL) getRange(ctx context.Context, key, byteRange string) ([]byte, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(key),
+	}
+	if byteRange != "" {
+		input.Range = aws.String(byteRange)
+	}
+	result, err := w.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object from S3: %w", err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object body: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,134 @@
+package s3_dal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"testing"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	var payloads []string
+	for i := 0; i < 20; i++ {
+		payloads = append(payloads, generateRandomStr())
+		if _, err := wal.Append(ctx, []byte(payloads[i])); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	// the snapshot spans a gap
+	delete(fake.objects, wal.getObjectKey(7))
+
+	count, err := wal.ExportSnapshot(ctx, "snapshots/one")
+	if err != nil {
+		t.Fatalf("failed to export snapshot: %v", err)
+	}
+	if count != 19 {
+		t.Errorf("expected 19 records in snapshot, got %d", count)
+	}
+
+	target, _ := newFakeDAL(t)
+	target.client.(*fakeS3).objects["snapshots/one"] = fake.objects["snapshots/one"]
+	restored, err := target.RestoreSnapshot(ctx, "snapshots/one")
+	if err != nil {
+		t.Fatalf("failed to restore snapshot: %v", err)
+	}
+	if restored != 19 || target.length != 20 {
+		t.Errorf("expected 19 restored up to length 20, got %d and %d", restored, target.length)
+	}
+	for i, want := range payloads {
+		offset := uint64(i + 1)
+		record, err := target.Read(ctx, offset)
+		if offset == 7 {
+			if err == nil {
+				t.Error("expected the gap at offset 7 to survive the restore")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("failed to read restored offset %d: %v", offset, err)
+		}
+		if string(record.Data) != want {
+			t.Errorf("offset %d: expected %q, got %q", offset, want, record.Data)
+		}
+	}
+}
+
+func TestReadFromSnapshot(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	var payloads []string
+	for i := 0; i < 10; i++ {
+		payloads = append(payloads, generateRandomStr())
+		if _, err := wal.Append(ctx, []byte(payloads[i])); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	if _, err := wal.ExportSnapshot(ctx, "snapshots/one"); err != nil {
+		t.Fatalf("failed to export snapshot: %v", err)
+	}
+
+	getsBefore := fake.getCalls
+	record, err := wal.ReadFromSnapshot(ctx, "snapshots/one", 6)
+	if err != nil {
+		t.Fatalf("failed to read from snapshot: %v", err)
+	}
+	if record.Offset != 6 || string(record.Data) != payloads[5] {
+		t.Errorf("expected offset 6 with %q, got %d with %q", payloads[5], record.Offset, record.Data)
+	}
+	if fake.getCalls-getsBefore != 3 {
+		t.Errorf("expected 3 ranged reads, got %d", fake.getCalls-getsBefore)
+	}
+	if fake.lastGet.Range == nil {
+		t.Error("expected the frame to be fetched with a ranged GET")
+	}
+
+	if _, err := wal.ReadFromSnapshot(ctx, "snapshots/one", 11); err == nil {
+		t.Error("expected error for an offset outside the snapshot")
+	}
+}
+
+func TestSnapshotEncrypted(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithClientEncryption(1, newGCM(t, 1)))
+	ctx := context.Background()
+	secret := []byte("plaintext that must stay sealed")
+	if _, err := wal.Append(ctx, secret); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if _, err := wal.ExportSnapshot(ctx, "fake-prefix/_snapshot"); err != nil {
+		t.Fatalf("failed to export snapshot: %v", err)
+	}
+
+	raw := fake.objects["fake-prefix/_snapshot"].body
+	entries, err := parseSnapshotIndex(raw)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one index entry, got %d, %v", len(entries), err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw[entries[0].position : entries[0].position+entries[0].length]))
+	if err != nil {
+		t.Fatalf("failed to open frame: %v", err)
+	}
+	frame, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("failed to inflate frame: %v", err)
+	}
+	if bytes.Contains(frame, secret) {
+		t.Error("expected the snapshot frame sealed, found the plaintext")
+	}
+
+	record, err := wal.ReadFromSnapshot(ctx, "fake-prefix/_snapshot", 1)
+	if err != nil || !bytes.Equal(record.Data, secret) {
+		t.Errorf("expected the snapshot to read back with the key, got %q, %v", record.Data, err)
+	}
+	plain, err := New(fake, wal.bucketName, wal.prefix)
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	if _, err := plain.ReadFromSnapshot(ctx, "fake-prefix/_snapshot", 1); err == nil {
+		t.Error("expected the snapshot unreadable without the key")
+	}
+}
@@ -0,0 +1,130 @@
+package s3_dal
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DALStats is a snapshot of an S3DAL's counters, for a metrics endpoint that
+// pulls rather than being pushed to through an Observer. The counters cover
+// what this client did since it was created and only grow; the gauges are
+// its current view of the log.
+type DALStats struct {
+	// Appends and AppendErrors count records written and writes that failed,
+	// as reported to Observer.RecordAppend.
+	Appends      uint64
+	AppendErrors uint64
+	// Reads and ReadErrors count Reads, as reported to Observer.RecordRead.
+	Reads      uint64
+	ReadErrors uint64
+	// BytesWritten and BytesRead are the payload bytes of successful
+	// appends and reads, before compression.
+	BytesWritten uint64
+	BytesRead    uint64
+	// ChecksumFailures counts records that failed their checksum.
+	ChecksumFailures uint64
+	// Conflicts counts appends that lost their offset to another writer.
+	Conflicts uint64
+	// Retries counts S3 requests sent again under WithRetryPolicy.
+	Retries uint64
+
+	// LastOffset is the length: the last offset this client allocated or
+	// recovered.
+	LastOffset uint64
+	// StoredBytes is what StoredBytes returns, the object bytes appended
+	// through this client.
+	StoredBytes uint64
+}
+
+// Stats returns a snapshot of the counters and gauges in DALStats. It reads
+// atomics only and takes no lock, so it is cheap enough for every scrape;
+// the fields are each current but not taken at one instant, so they may be
+// out of step by the operations in flight.
+func (w *S3DAL) Stats() DALStats {
+	s := &w.stats
+	return DALStats{
+		Appends:          s.appends.Load(),
+		AppendErrors:     s.appendErrors.Load(),
+		Reads:            s.reads.Load(),
+		ReadErrors:       s.readErrors.Load(),
+		BytesWritten:     s.bytesWritten.Load(),
+		BytesRead:        s.bytesRead.Load(),
+		ChecksumFailures: s.checksumFailures.Load(),
+		Conflicts:        s.conflicts.Load(),
+		Retries:          s.retries.Load(),
+		LastOffset:       s.length.Load(),
+		StoredBytes:      s.stored.Load(),
+	}
+}
+
+// dalStats holds the counters of Stats. The counters are fed by
+// statsObserver, and the gauges mirror length and stored, which are only set
+// through setLength and setStored.
+type dalStats struct {
+	appends, appendErrors   atomic.Uint64
+	reads, readErrors       atomic.Uint64
+	bytesWritten, bytesRead atomic.Uint64
+	checksumFailures        atomic.Uint64
+	conflicts               atomic.Uint64
+	retries                 atomic.Uint64
+
+	length atomic.Uint64
+	stored atomic.Uint64
+}
+
+// setLength sets the length. The caller holds mu.
+func (w *S3DAL) setLength(n uint64) {
+	w.length = n
+	w.stats.length.Store(n)
+}
+
+// setStored sets the stored bytes. The caller holds mu.
+func (w *S3DAL) setStored(n uint64) {
+	w.stored = n
+	w.stats.stored.Store(n)
+}
+
+// statsObserver counts what it is told into stats before passing it on to the
+// configured Observer.
+type statsObserver struct {
+	Observer
+	stats *dalStats
+}
+
+func (o *statsObserver) RecordAppend(bytes int, dur time.Duration, err error) {
+	if err != nil {
+		o.stats.appendErrors.Add(1)
+	} else {
+		o.stats.appends.Add(1)
+		o.stats.bytesWritten.Add(uint64(bytes))
+	}
+	o.Observer.RecordAppend(bytes, dur, err)
+}
+
+func (o *statsObserver) RecordRead(bytes int, dur time.Duration, err error) {
+	if err != nil {
+		o.stats.readErrors.Add(1)
+	} else {
+		o.stats.reads.Add(1)
+		o.stats.bytesRead.Add(uint64(bytes))
+	}
+	o.Observer.RecordRead(bytes, dur, err)
+}
+
+func (o *statsObserver) RecordChecksumFailure(offset uint64) {
+	o.stats.checksumFailures.Add(1)
+	o.Observer.RecordChecksumFailure(offset)
+}
+
+func (o *statsObserver) RecordConflict(offset uint64) {
+	o.stats.conflicts.Add(1)
+	o.Observer.RecordConflict(offset)
+}
+
+// RecordRetention passes a retention pass on if the configured Observer is a
+// RetentionObserver.
+func (o *statsObserver) RecordRetention(trimmed int, err error) {
+	if r, ok := o.Observer.(RetentionObserver); ok {
+		r.RecordRetention(trimmed, err)
+	}
+}
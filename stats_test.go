@@ -0,0 +1,91 @@
+package s3_dal
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	client := &flakyS3{fakeS3: newFakeS3()}
+	observer := &retentionObserver{}
+	// flakyS3 is not safe for concurrent puts
+	wal, err := New(client, "fake-bucket", "fake-prefix", WithRetryPolicy(3, ConstantBackoff(time.Millisecond)), WithObserver(observer), WithBatchConcurrency(1))
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	ctx := context.Background()
+	if stats := wal.Stats(); stats != (DALStats{}) {
+		t.Fatalf("expected zero stats for a new DAL, got %+v", stats)
+	}
+
+	for _, data := range []string{"one", "two", "three"} {
+		if _, err := wal.Append(ctx, []byte(data)); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	if _, err := wal.AppendBatch(ctx, [][]byte{[]byte("four"), []byte("five")}); err != nil {
+		t.Fatalf("failed to append batch: %v", err)
+	}
+	// one retried read, one missing record and one corrupt one
+	client.errs = []error{statusError(http.StatusInternalServerError)}
+	if _, err := wal.Read(ctx, 2); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if _, err := wal.Read(ctx, 1); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if _, err := wal.Read(ctx, 9); err == nil {
+		t.Fatal("expected reading past the tail to fail")
+	}
+	key := wal.getObjectKey(3)
+	obj := client.objects[key]
+	obj.body[len(obj.body)-1] ^= 0xFF
+	client.objects[key] = obj
+	if _, err := wal.Read(ctx, 3); err == nil {
+		t.Fatal("expected the corrupt record to fail")
+	}
+	// another writer takes offset 6
+	other, err := New(client.fakeS3, "fake-bucket", "fake-prefix")
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	if _, err := other.AppendAt(ctx, 5, []byte("theirs")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if _, err := wal.Append(ctx, []byte("lost")); err == nil {
+		t.Fatal("expected the append to conflict")
+	}
+
+	var stored uint64
+	for i := uint64(1); i <= 5; i++ {
+		stored += uint64(len(client.objects[wal.getObjectKey(i)].body))
+	}
+	want := DALStats{
+		Appends:          5,
+		AppendErrors:     1,
+		Reads:            2,
+		ReadErrors:       2,
+		BytesWritten:     uint64(len("onetwothreefourfive")),
+		BytesRead:        uint64(len("twoone")),
+		ChecksumFailures: 1,
+		Conflicts:        1,
+		Retries:          1,
+		LastOffset:       5,
+		StoredBytes:      stored,
+	}
+	if got := wal.Stats(); got != want {
+		t.Errorf("expected stats\n%+v, got\n%+v", want, got)
+	}
+
+	// the configured observer still gets retention passes
+	if o, ok := wal.observer.(RetentionObserver); !ok {
+		t.Error("expected the observer to still receive retention passes")
+	} else {
+		o.RecordRetention(1, nil)
+		if observer.count() != 1 {
+			t.Error("expected the retention pass passed on to the configured observer")
+		}
+	}
+}
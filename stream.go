@@ -0,0 +1,305 @@
+package s3_dal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// ReadStream returns a reader over the payload of the record at offset, for
+// callers that pass large records on without holding them in memory. The
+// header and offset are checked before it returns. The checksum is checked as
+// the payload is consumed: the Read that reaches the end returns
+// ErrChecksumMismatch instead of io.EOF if it does not match, and Close
+// reports the same. A stream closed before the end is not verified. The
+// caller must Close the reader. Read remains the simpler choice for small
+// records.
+func (w *S3DAL) ReadStream(ctx context.Context, offset uint64) (io.ReadCloser, uint64, error) {
+	result, err := w.getRecord(ctx, offset, "")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	body := bufio.NewReader(result.Body)
+	// a short peek is reported by parseHeader
+	prefix, _ := body.Peek(maxHeaderLen)
+	f, n, err := parseHeader(prefix, w.legacyFormat)
+	if err != nil {
+		result.Body.Close()
+		return nil, 0, fmt.Errorf("offset %d: %w", offset, withSize(err, aws.ToInt64(result.ContentLength)))
+	}
+	if f.offset != offset {
+		result.Body.Close()
+		return nil, 0, offsetMismatch(offset, f.offset)
+	}
+	if f.sealed {
+		// a sealed payload only authenticates whole
+		defer result.Body.Close()
+		raw, err := io.ReadAll(body)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read object body: %w", err)
+		}
+		record, err := w.decodeBody(offset, raw, result.Metadata[metaChecksum] != checksumNone)
+		if err != nil {
+			return nil, 0, err
+		}
+		return io.NopCloser(bytes.NewReader(record.Data)), offset, nil
+	}
+
+	v := &verifyingReader{
+		src:      body,
+		checksum: f.checksum,
+		verify:   result.Metadata[metaChecksum] != checksumNone,
+		flagged:  f.unchecked,
+		offset:   offset,
+		sum:      f.checksum.newHash(),
+		observer: w.observer,
+	}
+	v.sum.Write(prefix[:n])
+	if _, err := body.Discard(n); err != nil {
+		result.Body.Close()
+		return nil, 0, fmt.Errorf("failed to read object body: %w", err)
+	}
+	data, err := decompressReader(f.codec, v)
+	if err != nil {
+		result.Body.Close()
+		return nil, 0, fmt.Errorf("failed to decompress record %d: %w", offset, err)
+	}
+	return &recordStream{data: data, verify: v, body: result.Body}, offset, nil
+}
+
+// verifyingReader passes through the stored payload of a record after its
+// header, holding back the trailer and checking it once src is exhausted.
+type verifyingReader struct {
+	src      io.Reader
+	checksum Checksum
+	verify   bool
+	// flagged is set for a header flagged unchecked, whose trailer is not
+	// checked if it is zero
+	flagged  bool
+	offset   uint64
+	sum      hash.Hash
+	observer Observer
+
+	// pending was read from src but not yet returned; its last
+	// checksum.Size() bytes may be the trailer
+	pending []byte
+	chunk   []byte
+	eof     bool
+	// err is sticky: io.EOF once verified, otherwise the failure
+	err error
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	keep := v.checksum.Size()
+	for v.err == nil {
+		if len(v.pending) > keep {
+			n := copy(p, v.pending[:len(v.pending)-keep])
+			v.sum.Write(p[:n])
+			v.pending = v.pending[n:]
+			return n, nil
+		}
+		if v.eof {
+			v.err = v.finish()
+			break
+		}
+		if v.chunk == nil {
+			v.chunk = make([]byte, 32*1024)
+		}
+		n, err := v.src.Read(v.chunk)
+		v.pending = append(v.pending, v.chunk[:n]...)
+		if err == io.EOF {
+			v.eof = true
+		} else if err != nil {
+			v.err = fmt.Errorf("failed to read object body: %w", err)
+		}
+	}
+	return 0, v.err
+}
+
+func (v *verifyingReader) finish() error {
+	if len(v.pending) < v.checksum.Size() {
+		return fmt.Errorf("%w: offset %d", ErrRecordTooShort, v.offset)
+	}
+	if v.verify && !(v.flagged && isZeroTrailer(v.pending)) && !bytes.Equal(v.pending, v.sum.Sum(nil)) {
+		v.observer.RecordChecksumFailure(v.offset)
+		return fmt.Errorf("%w: offset %d", ErrChecksumMismatch, v.offset)
+	}
+	return io.EOF
+}
+
+// recordStream is the reader ReadStream returns.
+type recordStream struct {
+	data   io.ReadCloser
+	verify *verifyingReader
+	body   io.Closer
+}
+
+func (s *recordStream) Read(p []byte) (int, error) {
+	n, err := s.data.Read(p)
+	if err == io.EOF {
+		// a decompressor can stop short of the trailer; drain to check it
+		if _, err := io.Copy(io.Discard, s.verify); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+func (s *recordStream) Close() error {
+	s.data.Close()
+	closeErr := s.body.Close()
+	if err := s.verify.err; err != nil && err != io.EOF {
+		return err
+	}
+	return closeErr
+}
+
+// ErrSizeMismatch is returned by AppendReader when the reader yields fewer or
+// more bytes than the size it was given.
+var ErrSizeMismatch = errors.New("record reader size mismatch")
+
+// AppendReader writes the size bytes read from r as the next record and
+// returns its offset, for callers whose data is behind a reader. Records
+// above the WithMultipartThreshold are streamed in parts, buffering one part
+// at a time; smaller ones are staged in one buffer. The checksum is computed
+// as the bytes are staged. The record is stored uncompressed whatever
+// WithCompression says, and the before-append hook, which needs the data
+// whole, is not supported. If r ends early or holds more than size bytes,
+// nothing is written and the error is ErrSizeMismatch.
+func (w *S3DAL) AppendReader(ctx context.Context, r io.Reader, size int64) (offset uint64, err error) {
+	start := time.Now()
+	defer func() {
+		written := 0
+		if err == nil {
+			written = int(size)
+		}
+		w.observer.RecordAppend(written, time.Since(start), err)
+	}()
+	if size < 0 {
+		return 0, fmt.Errorf("invalid record size %d: must not be negative", size)
+	}
+	if w.beforeAppend != nil {
+		return 0, fmt.Errorf("append aborted: AppendReader does not support the before-append hook")
+	}
+	if w.packRecords > 0 {
+		return 0, ErrPackedLog
+	}
+	if w.encrypt {
+		return 0, fmt.Errorf("append aborted: AppendReader does not support client-side encryption")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.lifetime.Err() != nil {
+		return 0, ErrClosed
+	}
+	if err := w.checkRecordSize(w.size, uint64(size), w.fileSizeLimit); err != nil {
+		return 0, err
+	}
+	stored := w.storedSize(int(size))
+	if err := w.checkStoredSize(w.stored, stored); err != nil {
+		return 0, err
+	}
+
+	if err := w.checkFence(ctx); err != nil {
+		return 0, err
+	}
+	nextOffset := w.length + 1
+	header := appendHeader(nil, nextOffset, w.nextCreated(), CompressionNone, w.checksum, false, w.skipCRC)
+	src := &exactReader{r: r, n: size, size: size}
+	if total := int64(len(header)) + size; total+int64(w.checksum.Size()) > int64(w.multipartThreshold) {
+		err = w.putMultipart(ctx, nextOffset, io.MultiReader(bytes.NewReader(header), src), int(total), w.attrs())
+	} else {
+		err = w.putFromReader(ctx, nextOffset, header, src)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	w.setLength(nextOffset)
+	w.size += uint64(size)
+	w.setStored(w.stored + stored)
+	w.recordInManifest(ctx, nextOffset)
+	if w.afterAppend != nil {
+		if err := w.afterAppend(nextOffset); err != nil {
+			return nextOffset, fmt.Errorf("after-append hook failed for committed offset %d: %w", nextOffset, err)
+		}
+	}
+	return nextOffset, nil
+}
+
+// putFromReader stages header and the rest of src in one buffer and writes it
+// as the record at offset with a conditional put.
+func (w *S3DAL) putFromReader(ctx context.Context, offset uint64, header []byte, src *exactReader) error {
+	buf := make([]byte, len(header)+int(src.n), len(header)+int(src.n)+w.checksum.Size())
+	copy(buf, header)
+	if _, err := io.ReadFull(src, buf[len(header):]); err != nil {
+		return err
+	}
+	if err := expectEOF(src); err != nil {
+		return err
+	}
+	if w.skipCRC {
+		buf = append(buf, make([]byte, w.checksum.Size())...)
+	} else {
+		buf = append(buf, w.checksum.Sum(buf)...)
+	}
+	if _, err := w.client.PutObject(ctx, w.putInput(offset, buf)); err != nil {
+		return w.putRecordError(offset, err)
+	}
+	return nil
+}
+
+// exactReader reads n more bytes from r, failing with ErrSizeMismatch if r
+// ends before them or, once they are read, has more.
+type exactReader struct {
+	r    io.Reader
+	n    int64
+	size int64
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	if e.n == 0 {
+		var extra [1]byte
+		if n, err := io.ReadAtLeast(e.r, extra[:], 1); n > 0 {
+			return 0, fmt.Errorf("%w: reader holds more than %d bytes", ErrSizeMismatch, e.size)
+		} else if err != io.EOF {
+			return 0, fmt.Errorf("failed to read record: %w", err)
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > e.n {
+		p = p[:e.n]
+	}
+	n, err := e.r.Read(p)
+	e.n -= int64(n)
+	switch {
+	case err == io.EOF && e.n > 0:
+		return n, fmt.Errorf("%w: reader ended after %d of %d bytes", ErrSizeMismatch, e.size-e.n, e.size)
+	case err == io.EOF:
+		return n, nil
+	case err != nil:
+		return n, fmt.Errorf("failed to read record: %w", err)
+	}
+	return n, nil
+}
+
+// expectEOF confirms src has nothing left to read.
+func expectEOF(src io.Reader) error {
+	var extra [1]byte
+	n, err := io.ReadAtLeast(src, extra[:], 1)
+	if n > 0 {
+		return fmt.Errorf("%w: body longer than its size", ErrSizeMismatch)
+	}
+	if err != io.EOF {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReadStream(t *testing.T) {
+	payload := bytes.Repeat([]byte("streamed record payload "), 10000)
+
+	for _, opts := range [][]Option{
+		nil,
+		{WithChecksum(ChecksumCRC32C)},
+		{WithCompression(CompressionGzip)},
+		{WithCompression(CompressionZstd), WithChecksum(ChecksumCRC32C)},
+		{WithCompression(CompressionGzip), WithChecksum(ChecksumSHA256)},
+	} {
+		wal, _ := newFakeDAL(t, opts...)
+		ctx := context.Background()
+
+		offset, err := wal.Append(ctx, payload)
+		if err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+		stream, got, err := wal.ReadStream(ctx, offset)
+		if err != nil {
+			t.Fatalf("failed to open stream: %v", err)
+		}
+		if got != offset {
+			t.Errorf("expected offset %d, got %d", offset, got)
+		}
+		data, err := io.ReadAll(iotest.OneByteReader(stream))
+		if err != nil {
+			t.Fatalf("failed to read stream: %v", err)
+		}
+		if !bytes.Equal(data, payload) {
+			t.Errorf("streamed payload did not round-trip (%d of %d bytes)", len(data), len(payload))
+		}
+		if err := stream.Close(); err != nil {
+			t.Errorf("failed to close stream: %v", err)
+		}
+	}
+}
+
+func TestReadStreamDetectsCorruption(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	offset, err := wal.Append(ctx, []byte("about to be corrupted"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	corrupt := fake.objects[wal.getObjectKey(offset)]
+	corrupt.body[len(corrupt.body)-3] ^= 0xFF
+
+	stream, _, err := wal.ReadStream(ctx, offset)
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	if _, err := io.ReadAll(stream); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch at the end of the stream, got %v", err)
+	}
+	if err := stream.Close(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected Close to report ErrChecksumMismatch, got %v", err)
+	}
+
+	if _, _, err := wal.ReadStream(ctx, offset+1); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound for a missing offset, got %v", err)
+	}
+	fake.objects[wal.getObjectKey(offset+1)] = fake.objects[wal.getObjectKey(offset)]
+	if _, _, err := wal.ReadStream(ctx, offset+1); !errors.Is(err, ErrOffsetMismatch) {
+		t.Errorf("expected ErrOffsetMismatch, got %v", err)
+	}
+}
+
+func TestAppendReader(t *testing.T) {
+	payload := make([]byte, multipartPartSize+4321)
+	for i := range payload {
+		payload[i] = byte(i * 7 / 3)
+	}
+	wal, fake := newFakeDAL(t, WithMultipartThreshold(minMultipartThreshold), WithCompression(CompressionGzip))
+	ctx := context.Background()
+
+	small, err := wal.AppendReader(ctx, bytes.NewReader(payload[:100]), 100)
+	if err != nil {
+		t.Fatalf("failed to append from a reader: %v", err)
+	}
+	// io.LimitReader hides the underlying type, as a network body would
+	large, err := wal.AppendReader(ctx, io.LimitReader(bytes.NewReader(payload), int64(len(payload))), int64(len(payload)))
+	if err != nil {
+		t.Fatalf("failed to append a multipart record from a reader: %v", err)
+	}
+	if fake.putCalls != 1 || fake.partCalls != 2 {
+		t.Errorf("expected one put and two parts, got %d and %d", fake.putCalls, fake.partCalls)
+	}
+	for offset, want := range map[uint64][]byte{small: payload[:100], large: payload} {
+		record, err := wal.Read(ctx, offset)
+		if err != nil || !bytes.Equal(record.Data, want) {
+			t.Errorf("offset %d: expected the %d bytes back, got %d, %v", offset, len(want), len(record.Data), err)
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		data []byte
+		size int64
+	}{
+		"short":         {payload[:99], 100},
+		"long":          {payload[:101], 100},
+		"short parts":   {payload[:len(payload)-1], int64(len(payload))},
+		"long in parts": {payload, int64(len(payload)) - 1},
+	} {
+		puts, parts := fake.putCalls, fake.abortCalls
+		if _, err := wal.AppendReader(ctx, bytes.NewReader(tc.data), tc.size); !errors.Is(err, ErrSizeMismatch) {
+			t.Errorf("%s: expected ErrSizeMismatch, got %v", name, err)
+		}
+		if fake.putCalls != puts || (tc.size > minMultipartThreshold && fake.abortCalls != parts+1) {
+			t.Errorf("%s: expected nothing written", name)
+		}
+	}
+	if wal.Length() != large || len(fake.objects) != 2 {
+		t.Errorf("expected the failed appends to take no offset, got length %d, %d objects", wal.Length(), len(fake.objects))
+	}
+}
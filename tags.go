@@ -0,0 +1,87 @@
+package s3_dal
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// S3's limits on object tags.
+const (
+	maxObjectTags  = 10
+	maxTagKeyLen   = 128
+	maxTagValueLen = 256
+	// tagPunctuation is what tags may hold besides letters and digits
+	tagPunctuation    = " +-=._:/@"
+	reservedTagPrefix = "aws:"
+)
+
+// validateTags rejects a tag set S3 would refuse.
+func validateTags(tags map[string]string) error {
+	if len(tags) > maxObjectTags {
+		return fmt.Errorf("invalid object tags: %d tags, at most %d are allowed", len(tags), maxObjectTags)
+	}
+	for key, value := range tags {
+		if n := utf8.RuneCountInString(key); n == 0 || n > maxTagKeyLen {
+			return fmt.Errorf("invalid object tag key %q: must be 1 to %d characters", key, maxTagKeyLen)
+		}
+		if strings.HasPrefix(strings.ToLower(key), reservedTagPrefix) {
+			return fmt.Errorf("invalid object tag key %q: the %s prefix is reserved", key, reservedTagPrefix)
+		}
+		if n := utf8.RuneCountInString(value); n > maxTagValueLen {
+			return fmt.Errorf("invalid object tag value %q for key %q: must be at most %d characters", value, key, maxTagValueLen)
+		}
+		for _, s := range []string{key, value} {
+			if !validTagText(s) {
+				return fmt.Errorf("invalid object tag %q=%q: only letters, digits, spaces and %q are allowed", key, value, tagPunctuation[1:])
+			}
+		}
+	}
+	return nil
+}
+
+func validTagText(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(tagPunctuation, r) {
+			return false
+		}
+	}
+	return utf8.ValidString(s)
+}
+
+// encodeTags formats tags as the URL query string S3 expects in the
+// x-amz-tagging header, sorted by key so the encoding is stable.
+func encodeTags(tags map[string]string) string {
+	values := make(url.Values, len(tags))
+	for key, value := range tags {
+		values.Set(key, value)
+	}
+	return values.Encode()
+}
+
+func nilIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// taggingFor is the tagging string for an append whose own tags override the
+// configured ones key by key. It is the configured string if tags is empty.
+func (w *S3DAL) taggingFor(tags map[string]string) (string, error) {
+	if len(tags) == 0 {
+		return w.tagging, nil
+	}
+	merged := maps.Clone(w.tags)
+	if merged == nil {
+		merged = make(map[string]string, len(tags))
+	}
+	maps.Copy(merged, tags)
+	if err := validateTags(merged); err != nil {
+		return "", err
+	}
+	return encodeTags(merged), nil
+}
@@ -0,0 +1,64 @@
+package s3_dal
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestWithObjectTags(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithObjectTags(map[string]string{
+		"team":        "storage logs",
+		"cost-center": "a+b=c",
+		"path":        "logs/2024",
+	}))
+	ctx := context.Background()
+
+	if _, err := wal.Append(ctx, []byte("tagged")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	want := "cost-center=a%2Bb%3Dc&path=logs%2F2024&team=storage+logs"
+	if got := aws.ToString(fake.lastPut.Tagging); got != want {
+		t.Errorf("expected tagging %q, got %q", want, got)
+	}
+
+	if _, err := wal.AppendWithTags(ctx, []byte("retained"), map[string]string{"team": "audit", "retain": "yes"}); err != nil {
+		t.Fatalf("failed to append with tags: %v", err)
+	}
+	want = "cost-center=a%2Bb%3Dc&path=logs%2F2024&retain=yes&team=audit"
+	if got := aws.ToString(fake.lastPut.Tagging); got != want {
+		t.Errorf("expected the per-append tags to override, got %q", got)
+	}
+	if _, err := wal.AppendWithTags(ctx, []byte("bad"), map[string]string{"aws:owner": "me"}); err == nil {
+		t.Error("expected a reserved per-append tag key to be rejected")
+	}
+
+	untagged, fake := newFakeDAL(t)
+	if _, err := untagged.Append(ctx, []byte("plain")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if fake.lastPut.Tagging != nil {
+		t.Errorf("expected no tagging by default, got %q", aws.ToString(fake.lastPut.Tagging))
+	}
+}
+
+func TestWithObjectTagsRejectsInvalid(t *testing.T) {
+	tooMany := make(map[string]string)
+	for i := 0; i <= maxObjectTags; i++ {
+		tooMany[string(rune('a'+i))] = "v"
+	}
+	for name, tags := range map[string]map[string]string{
+		"too many":     tooMany,
+		"empty key":    {"": "v"},
+		"long key":     {strings.Repeat("k", maxTagKeyLen+1): "v"},
+		"long value":   {"k": strings.Repeat("v", maxTagValueLen+1)},
+		"reserved key": {"AWS:cost": "v"},
+		"bad char":     {"k": "semi;colon"},
+	} {
+		if _, err := New(newFakeS3(), "fake-bucket", "fake-prefix", WithObjectTags(tags)); err == nil {
+			t.Errorf("%s: expected the tags to be rejected", name)
+		}
+	}
+}
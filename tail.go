@@ -0,0 +1,118 @@
+package s3_dal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const tailHintName = "_tail"
+
+func (w *S3DAL) tailHintKey() string {
+	return w.keyUnder(tailHintName)
+}
+
+// PersistLength checkpoints the current length to prefix/_tail so a
+// restarting writer can resume with LoadLength instead of listing the log.
+func (w *S3DAL) PersistLength(ctx context.Context) error {
+	w.mu.Lock()
+	length := w.length
+	w.mu.Unlock()
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(w.tailHintKey()),
+		Body:   bytes.NewReader([]byte(strconv.FormatUint(length, 10))),
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.BucketKeyEnabled = w.sseParams()
+	if _, err := w.client.PutObject(ctx, input); err != nil {
+		return fmt.Errorf("failed to put tail hint to S3%s: %w", w.sseHint(err), err)
+	}
+	return nil
+}
+
+// LoadLength restores the length from the prefix/_tail checkpoint and
+// returns it. The checkpoint is only a hint: it is spot-checked against the
+// log and corrected if records were appended after it was written (by probing
+// forward) or if it points past the real tail (by falling back to a full
+// listing, as does a missing checkpoint).
+func (w *S3DAL) LoadLength(ctx context.Context) (uint64, error) {
+	hint, err := w.readTailHint(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if hint > 0 {
+		exists, err := w.Exists(ctx, hint)
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			hint = 0
+		}
+	}
+	if hint == 0 {
+		return w.loadLengthFromListing(ctx)
+	}
+
+	for {
+		exists, err := w.Exists(ctx, hint+1)
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			break
+		}
+		hint++
+	}
+
+	w.mu.Lock()
+	w.resetLength(hint)
+	w.mu.Unlock()
+	return hint, nil
+}
+
+// readTailHint returns the persisted length, or 0 if none was persisted.
+func (w *S3DAL) readTailHint(ctx context.Context) (uint64, error) {
+	result, err := w.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(w.bucketName),
+		Key:    aws.String(w.tailHintKey()),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get tail hint from S3: %w", err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read tail hint: %w", err)
+	}
+	hint, err := strconv.ParseUint(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid tail hint %q: %w", data, err)
+	}
+	return hint, nil
+}
+
+func (w *S3DAL) loadLengthFromListing(ctx context.Context) (uint64, error) {
+	last, err := w.lastOffset(ctx)
+	if err != nil {
+		if errors.Is(err, ErrEmptyLog) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.resetLength(last)
+	return w.length, nil
+}
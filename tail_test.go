@@ -0,0 +1,103 @@
+package s3_dal
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPersistAndLoadLength(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	if err := wal.PersistLength(ctx); err != nil {
+		t.Fatalf("failed to persist length: %v", err)
+	}
+
+	restarted := S3DALClient(fake, wal.bucketName, wal.prefix)
+	fake.listCalls = 0
+	length, err := restarted.LoadLength(ctx)
+	if err != nil {
+		t.Fatalf("failed to load length: %v", err)
+	}
+	if length != 5 || restarted.length != 5 {
+		t.Errorf("expected length 5, got %d (field %d)", length, restarted.length)
+	}
+	if fake.listCalls != 0 {
+		t.Errorf("expected no listing with a fresh hint, got %d list calls", fake.listCalls)
+	}
+
+	// the hint must not show up as a record
+	last, err := restarted.LastRecord(ctx)
+	if err != nil {
+		t.Fatalf("failed to get last record: %v", err)
+	}
+	if last.Offset != 5 {
+		t.Errorf("expected last offset 5, got %d", last.Offset)
+	}
+
+	offset, err := restarted.Append(ctx, []byte("after restart"))
+	if err != nil {
+		t.Fatalf("failed to append after restart: %v", err)
+	}
+	if offset != 6 {
+		t.Errorf("expected offset 6, got %d", offset)
+	}
+}
+
+func TestLoadLengthStaleHint(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	if err := wal.PersistLength(ctx); err != nil {
+		t.Fatalf("failed to persist length: %v", err)
+	}
+	// appends after the checkpoint make the hint stale
+	for i := 0; i < 4; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	restarted := S3DALClient(fake, wal.bucketName, wal.prefix)
+	length, err := restarted.LoadLength(ctx)
+	if err != nil {
+		t.Fatalf("failed to load length: %v", err)
+	}
+	if length != 7 {
+		t.Errorf("expected corrected length 7, got %d", length)
+	}
+
+	// a hint past the real tail falls back to listing
+	wal.length = 50
+	if err := wal.PersistLength(ctx); err != nil {
+		t.Fatalf("failed to persist length: %v", err)
+	}
+	length, err = restarted.LoadLength(ctx)
+	if err != nil {
+		t.Fatalf("failed to load length: %v", err)
+	}
+	if length != 7 {
+		t.Errorf("expected corrected length 7, got %d", length)
+	}
+}
+
+func TestLoadLengthWithoutHint(t *testing.T) {
+	wal, _ := newFakeDAL(t)
+	length, err := wal.LoadLength(context.Background())
+	if err != nil {
+		t.Fatalf("failed to load length: %v", err)
+	}
+	if length != 0 {
+		t.Errorf("expected length 0 for an empty log, got %d", length)
+	}
+}
@@ -0,0 +1,172 @@
+package s3_dal
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// slowDownAttempts bounds the tries of a request S3 keeps answering with
+	// SlowDown.
+	slowDownAttempts = 5
+	// slowDownBackoff is the wait before the first retry; it doubles after
+	// each one.
+	slowDownBackoff = 50 * time.Millisecond
+)
+
+// rateLimiter is a token bucket refilled at rate tokens a second, holding at
+// most burst.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rps, burst int) *rateLimiter {
+	return &rateLimiter{rate: float64(rps), burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait blocks until a token is available and takes it, or returns ctx.Err()
+// if ctx is done first.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// throttledClient passes every request through a rate limiter, and retries
+// requests S3 rejects with SlowDown with exponential backoff.
+type throttledClient struct {
+	s3API
+	limiter  *rateLimiter
+	attempts int
+	backoff  time.Duration
+}
+
+// throttle runs call under c's limiter, retrying it on SlowDown. A request
+// with a body is only retried if the body can be rewound.
+func throttle[T any](ctx context.Context, c *throttledClient, body io.Reader, call func() (T, error)) (T, error) {
+	backoff := c.backoff
+	for attempt := 1; ; attempt++ {
+		if err := c.limiter.wait(ctx); err != nil {
+			var zero T
+			return zero, err
+		}
+		out, err := call()
+		if err == nil || !isSlowDown(err) || attempt == c.attempts || !rewind(body) {
+			return out, err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return out, err
+		}
+		backoff *= 2
+	}
+}
+
+// rewind seeks body back to its start for a retry, reporting whether it could.
+func rewind(body io.Reader) bool {
+	if body == nil {
+		return true
+	}
+	seeker, ok := body.(io.Seeker)
+	if !ok {
+		return false
+	}
+	_, err := seeker.Seek(0, io.SeekStart)
+	return err == nil
+}
+
+func (c *throttledClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return throttle(ctx, c, params.Body, func() (*s3.PutObjectOutput, error) {
+		return c.s3API.PutObject(ctx, params, optFns...)
+	})
+}
+
+func (c *throttledClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return throttle(ctx, c, nil, func() (*s3.GetObjectOutput, error) {
+		return c.s3API.GetObject(ctx, params, optFns...)
+	})
+}
+
+func (c *throttledClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return throttle(ctx, c, nil, func() (*s3.ListObjectsV2Output, error) {
+		return c.s3API.ListObjectsV2(ctx, params, optFns...)
+	})
+}
+
+func (c *throttledClient) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	return throttle(ctx, c, nil, func() (*s3.DeleteObjectsOutput, error) {
+		return c.s3API.DeleteObjects(ctx, params, optFns...)
+	})
+}
+
+func (c *throttledClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return throttle(ctx, c, nil, func() (*s3.HeadObjectOutput, error) {
+		return c.s3API.HeadObject(ctx, params, optFns...)
+	})
+}
+
+func (c *throttledClient) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	return throttle(ctx, c, nil, func() (*s3.HeadBucketOutput, error) {
+		return c.s3API.HeadBucket(ctx, params, optFns...)
+	})
+}
+
+func (c *throttledClient) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	return throttle(ctx, c, nil, func() (*s3.CopyObjectOutput, error) {
+		return c.s3API.CopyObject(ctx, params, optFns...)
+	})
+}
+
+func (c *throttledClient) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return throttle(ctx, c, nil, func() (*s3.CreateMultipartUploadOutput, error) {
+		return c.s3API.CreateMultipartUpload(ctx, params, optFns...)
+	})
+}
+
+func (c *throttledClient) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	return throttle(ctx, c, params.Body, func() (*s3.UploadPartOutput, error) {
+		return c.s3API.UploadPart(ctx, params, optFns...)
+	})
+}
+
+func (c *throttledClient) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return throttle(ctx, c, nil, func() (*s3.CompleteMultipartUploadOutput, error) {
+		return c.s3API.CompleteMultipartUpload(ctx, params, optFns...)
+	})
+}
+
+func (c *throttledClient) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return throttle(ctx, c, nil, func() (*s3.AbortMultipartUploadOutput, error) {
+		return c.s3API.AbortMultipartUpload(ctx, params, optFns...)
+	})
+}
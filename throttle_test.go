@@ -0,0 +1,121 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// slowDownS3 answers the first failures puts and gets with 503 SlowDown.
+type slowDownS3 struct {
+	*fakeS3
+	failures int
+}
+
+func errSlowDown() error {
+	return &smithy.GenericAPIError{Code: "SlowDown", Message: "Please reduce your request rate."}
+}
+
+func (s *slowDownS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if s.failures > 0 {
+		s.failures--
+		return nil, errSlowDown()
+	}
+	return s.fakeS3.PutObject(ctx, params, optFns...)
+}
+
+func (s *slowDownS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if s.failures > 0 {
+		s.failures--
+		return nil, errSlowDown()
+	}
+	return s.fakeS3.GetObject(ctx, params, optFns...)
+}
+
+func TestRateLimitRetriesSlowDown(t *testing.T) {
+	client := &slowDownS3{fakeS3: newFakeS3()}
+	wal, err := New(client, "fake-bucket", "fake-prefix", WithRateLimit(100, 10))
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	wal.client.(*throttledClient).backoff = time.Millisecond
+	ctx := context.Background()
+
+	client.failures = 2
+	offset, err := wal.Append(ctx, []byte("after two 503s"))
+	if err != nil {
+		t.Fatalf("expected the append to succeed after retrying, got %v", err)
+	}
+	if client.putCalls != 1 {
+		t.Errorf("expected the body to reach S3 once, got %d puts", client.putCalls)
+	}
+
+	client.failures = 2
+	record, err := wal.Read(ctx, offset)
+	if err != nil || string(record.Data) != "after two 503s" {
+		t.Fatalf("expected the read to succeed after retrying, got %q, %v", record.Data, err)
+	}
+
+	client.failures = slowDownAttempts
+	if _, err := wal.Read(ctx, offset); !isSlowDown(err) {
+		t.Errorf("expected SlowDown once retries are exhausted, got %v", err)
+	}
+}
+
+func TestRateLimitHonorsContext(t *testing.T) {
+	limiter := newRateLimiter(1, 1)
+	if err := limiter.wait(context.Background()); err != nil {
+		t.Fatalf("expected the burst token at once, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := limiter.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to end with the context, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the wait to stop at the deadline, took %v", elapsed)
+	}
+}
+
+func TestWithRateLimit(t *testing.T) {
+	for _, limit := range [][2]int{{0, 1}, {1, 0}, {-1, 5}} {
+		if _, err := New(newFakeS3(), "fake-bucket", "fake-prefix", WithRateLimit(limit[0], limit[1])); err == nil {
+			t.Errorf("expected WithRateLimit(%d, %d) to be rejected", limit[0], limit[1])
+		}
+	}
+
+	dal, err := New(newFakeS3(), "fake-bucket", "fake-prefix", WithRateLimit(10, 1))
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	inspector, err := NewInspector(dal)
+	if err != nil {
+		t.Fatalf("failed to create inspector: %v", err)
+	}
+	inner := inspector.dal.client.(*throttledClient).s3API
+	if _, ok := inner.(readOnlyClient); !ok {
+		t.Errorf("expected the inspector to throttle its read-only client once, got %T", inner)
+	}
+}
+
+func TestRateLimitCoversFallbacks(t *testing.T) {
+	replica := newFakeS3()
+	wal, err := New(newFakeS3(), "primary-bucket", "fake-prefix", WithRateLimit(10, 1), WithReadFallback(replica, "replica-bucket"), WithRetryPolicy(2, ConstantBackoff(0)))
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	primary := wal.client.(*retryClient).s3API.(*throttledClient)
+	fallback, ok := wal.fallbacks[0].client.(*retryClient).s3API.(*throttledClient)
+	if !ok || fallback.limiter != primary.limiter {
+		t.Fatalf("expected the fallback throttled by the primary's limiter, got %T", wal.fallbacks[0].client)
+	}
+	if inner := unwrapClient(wal.fallbacks[0].client); inner != replica {
+		t.Errorf("expected unwrapClient to reach the replica client, got %T", inner)
+	}
+}
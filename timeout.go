@@ -0,0 +1,150 @@
+package s3_dal
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// timeoutClient bounds every request with a timeout, so a stalled S3 cannot
+// hang a caller whose context has no deadline.
+type timeoutClient struct {
+	s3API
+	timeout time.Duration
+}
+
+// unwrapClient returns the client wrapClient put its wrappers around.
+func unwrapClient(client s3API) s3API {
+	if r, ok := client.(*retryClient); ok {
+		client = r.s3API
+	}
+	if t, ok := client.(*throttledClient); ok {
+		client = t.s3API
+	}
+	if t, ok := client.(*timeoutClient); ok {
+		client = t.s3API
+	}
+	if r, ok := client.(*requesterPaysClient); ok {
+		client = r.s3API
+	}
+	return client
+}
+
+// withTimeout runs call under a context derived from ctx with c's timeout,
+// unless ctx already has a deadline at least as tight. The returned cancel
+// must be called once the result is no longer in use.
+func withTimeout[T any](ctx context.Context, c *timeoutClient, call func(ctx context.Context) (T, error)) (T, context.CancelFunc, error) {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= c.timeout {
+		out, err := call(ctx)
+		return out, func() {}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	out, err := call(ctx)
+	return out, cancel, err
+}
+
+// cancelOnClose releases a GetObject's context when its body is closed, as
+// cancelling it sooner would cut the body off.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+func (c *timeoutClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	out, cancel, err := withTimeout(ctx, c, func(ctx context.Context) (*s3.PutObjectOutput, error) {
+		return c.s3API.PutObject(ctx, params, optFns...)
+	})
+	cancel()
+	return out, err
+}
+
+func (c *timeoutClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	out, cancel, err := withTimeout(ctx, c, func(ctx context.Context) (*s3.GetObjectOutput, error) {
+		return c.s3API.GetObject(ctx, params, optFns...)
+	})
+	if err != nil || out.Body == nil {
+		cancel()
+		return out, err
+	}
+	out.Body = cancelOnClose{ReadCloser: out.Body, cancel: cancel}
+	return out, nil
+}
+
+func (c *timeoutClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	out, cancel, err := withTimeout(ctx, c, func(ctx context.Context) (*s3.ListObjectsV2Output, error) {
+		return c.s3API.ListObjectsV2(ctx, params, optFns...)
+	})
+	cancel()
+	return out, err
+}
+
+func (c *timeoutClient) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	out, cancel, err := withTimeout(ctx, c, func(ctx context.Context) (*s3.DeleteObjectsOutput, error) {
+		return c.s3API.DeleteObjects(ctx, params, optFns...)
+	})
+	cancel()
+	return out, err
+}
+
+func (c *timeoutClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	out, cancel, err := withTimeout(ctx, c, func(ctx context.Context) (*s3.HeadObjectOutput, error) {
+		return c.s3API.HeadObject(ctx, params, optFns...)
+	})
+	cancel()
+	return out, err
+}
+
+func (c *timeoutClient) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	out, cancel, err := withTimeout(ctx, c, func(ctx context.Context) (*s3.HeadBucketOutput, error) {
+		return c.s3API.HeadBucket(ctx, params, optFns...)
+	})
+	cancel()
+	return out, err
+}
+
+func (c *timeoutClient) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	out, cancel, err := withTimeout(ctx, c, func(ctx context.Context) (*s3.CopyObjectOutput, error) {
+		return c.s3API.CopyObject(ctx, params, optFns...)
+	})
+	cancel()
+	return out, err
+}
+
+func (c *timeoutClient) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	out, cancel, err := withTimeout(ctx, c, func(ctx context.Context) (*s3.CreateMultipartUploadOutput, error) {
+		return c.s3API.CreateMultipartUpload(ctx, params, optFns...)
+	})
+	cancel()
+	return out, err
+}
+
+func (c *timeoutClient) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	out, cancel, err := withTimeout(ctx, c, func(ctx context.Context) (*s3.UploadPartOutput, error) {
+		return c.s3API.UploadPart(ctx, params, optFns...)
+	})
+	cancel()
+	return out, err
+}
+
+func (c *timeoutClient) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	out, cancel, err := withTimeout(ctx, c, func(ctx context.Context) (*s3.CompleteMultipartUploadOutput, error) {
+		return c.s3API.CompleteMultipartUpload(ctx, params, optFns...)
+	})
+	cancel()
+	return out, err
+}
+
+func (c *timeoutClient) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	out, cancel, err := withTimeout(ctx, c, func(ctx context.Context) (*s3.AbortMultipartUploadOutput, error) {
+		return c.s3API.AbortMultipartUpload(ctx, params, optFns...)
+	})
+	cancel()
+	return out, err
+}
@@ -0,0 +1,65 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// stallingS3 never answers puts while stall is set, like a wedged connection.
+type stallingS3 struct {
+	*fakeS3
+	stall bool
+}
+
+func (s *stallingS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if s.stall {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return s.fakeS3.PutObject(ctx, params, optFns...)
+}
+
+func TestOperationTimeout(t *testing.T) {
+	client := &stallingS3{fakeS3: newFakeS3()}
+	wal, err := New(client, "fake-bucket", "fake-prefix", WithOperationTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to create DAL: %v", err)
+	}
+	ctx := context.Background()
+
+	offset, err := wal.Append(ctx, []byte("before the stall"))
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if record, err := wal.Read(ctx, offset); err != nil || string(record.Data) != "before the stall" {
+		t.Fatalf("expected the read to succeed, got %q, %v", record.Data, err)
+	}
+
+	client.stall = true
+	start := time.Now()
+	if _, err := wal.Append(ctx, []byte("stalled")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline exceeded error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the stalled append to fail promptly, took %v", elapsed)
+	}
+
+	// a tighter caller deadline is kept
+	tight, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if _, err := wal.Append(tight, []byte("stalled")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline exceeded error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 20*time.Millisecond {
+		t.Errorf("expected the caller's deadline to apply, took %v", elapsed)
+	}
+
+	if _, err := New(client, "fake-bucket", "fake-prefix", WithOperationTimeout(0)); err == nil {
+		t.Error("expected a zero timeout to be rejected")
+	}
+}
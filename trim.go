@@ -0,0 +1,297 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3 accepts at most 1000 keys per DeleteObjects call.
+const maxDeleteBatch = 1000
+
+// DeleteFailure describes one key that S3 refused to delete.
+type DeleteFailure struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+// BatchDeleteError is returned by the deleting methods, TrimBefore,
+// TrimToLast, DeleteRange, TruncateAfter and DeleteAll, when DeleteObjects
+// reports per-key failures. There is no separate Reset; DeleteAll is the
+// whole-log reset. Deleted counts the keys that were removed; Failed lists
+// the rest so callers can retry just those.
+type BatchDeleteError struct {
+	Deleted int
+	Failed  []DeleteFailure
+}
+
+func (e *BatchDeleteError) Error() string {
+	if len(e.Failed) == 1 {
+		f := e.Failed[0]
+		return fmt.Sprintf("failed to delete object %s: %s: %s", f.Key, f.Code, f.Message)
+	}
+	return fmt.Sprintf("failed to delete %d objects (first %s: %s)", len(e.Failed), e.Failed[0].Key, e.Failed[0].Code)
+}
+
+// deleteKeys removes the given keys in DeleteObjects batches and returns how
+// many were deleted. Per-key failures do not stop later batches; they are
+// collected into a *BatchDeleteError. The manifest, if any, is rebuilt
+// afterwards. A compacted segment is deleted, and counted as its records, only
+// if keys name it once for each of them.
+func (w *S3DAL) deleteKeys(ctx context.Context, keys []string) (int, error) {
+	w.evictKeys(keys)
+	keys, weights, err := w.collapseSegments(keys)
+	if err != nil {
+		return 0, err
+	}
+	return w.deleteObjects(ctx, keys, weights)
+}
+
+// deleteObjects is deleteKeys for keys naming each object once, counting a key
+// as its weight if it has one and as 1 otherwise.
+func (w *S3DAL) deleteObjects(ctx context.Context, keys []string, weights map[string]int) (removed int, err error) {
+	weight := func(key string) int {
+		if n, ok := weights[key]; ok {
+			return n
+		}
+		return 1
+	}
+	defer func() {
+		if removed > 0 {
+			w.rebuildManifest(ctx)
+		}
+	}()
+	if err := w.checkFence(ctx); err != nil {
+		return 0, err
+	}
+	return w.deleteBatches(ctx, keys, weight)
+}
+
+// deleteBatches deletes keys in DeleteObjects batches, counting each as its
+// weight.
+func (w *S3DAL) deleteBatches(ctx context.Context, keys []string, weight func(string) int) (removed int, err error) {
+	var failed []DeleteFailure
+	for start := 0; start < len(keys); start += maxDeleteBatch {
+		end := min(start+maxDeleteBatch, len(keys))
+		objectIds := make([]types.ObjectIdentifier, 0, end-start)
+		for _, key := range keys[start:end] {
+			objectIds = append(objectIds, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		output, err := w.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(w.bucketName),
+			Delete: &types.Delete{
+				Objects: objectIds,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return removed, fmt.Errorf("failed to delete objects from S3: %w", err)
+		}
+		for _, key := range keys[start:end] {
+			removed += weight(key)
+		}
+		for _, e := range output.Errors {
+			removed -= weight(aws.ToString(e.Key))
+			failed = append(failed, DeleteFailure{
+				Key:     aws.ToString(e.Key),
+				Code:    aws.ToString(e.Code),
+				Message: aws.ToString(e.Message),
+			})
+		}
+	}
+	if len(failed) > 0 {
+		return removed, &BatchDeleteError{Deleted: removed, Failed: failed}
+	}
+	return removed, nil
+}
+
+// TrimToLast deletes the oldest records so that only the most recent keep
+// records remain.
+func (w *S3DAL) TrimToLast(ctx context.Context, keep uint64) (removed int, err error) {
+	objects, err := w.listObjects(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if uint64(len(objects)) <= keep {
+		return 0, nil
+	}
+
+	// keys are listed in ascending offset order, so the oldest come first
+	stale := objects[:uint64(len(objects))-keep]
+	keys := make([]string, 0, len(stale))
+	for _, obj := range stale {
+		keys = append(keys, aws.ToString(obj.Key))
+	}
+	return w.deleteKeys(ctx, keys)
+}
+
+// TrimOlderThan deletes every record whose LastModified is older than
+// now - maxAge, using the DAL's clock.
+func (w *S3DAL) TrimOlderThan(ctx context.Context, maxAge time.Duration) (removed int, err error) {
+	objects, err := w.listObjects(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := w.now().Add(-maxAge)
+	var keys []string
+	for _, obj := range objects {
+		if obj.LastModified != nil && obj.LastModified.Before(cutoff) {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	}
+	return w.deleteKeys(ctx, keys)
+}
+
+// TrimBefore deletes every record with an offset strictly below offset and
+// returns how many it removed. Records at or above offset are never touched,
+// and listing stops at the first of them. Calling it again with the same
+// watermark deletes nothing.
+func (w *S3DAL) TrimBefore(ctx context.Context, offset uint64) (deleted int, err error) {
+	var keys []string
+	err = w.listRecords(ctx, 0, 0, func(o uint64, obj types.Object) (bool, error) {
+		if o >= offset {
+			return false, nil
+		}
+		keys = append(keys, aws.ToString(obj.Key))
+		return true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return w.deleteKeys(ctx, keys)
+}
+
+// DeleteRange deletes the records at offsets [start, end) and returns their
+// keys. Records outside the range are never touched. With
+// dryRun set nothing is deleted and the keys that would be are returned for
+// review. If S3 refuses some keys, the returned keys are those deleted and
+// the error is a *BatchDeleteError listing the others.
+func (w *S3DAL) DeleteRange(ctx context.Context, start, end uint64, dryRun bool) (keys []string, err error) {
+	if err := checkRange(start, end); err != nil {
+		return nil, err
+	}
+	err = w.listRecords(ctx, max(start, 1)-1, 0, func(o uint64, obj types.Object) (bool, error) {
+		if o >= end {
+			return false, nil
+		}
+		keys = append(keys, aws.ToString(obj.Key))
+		return true, nil
+	})
+	if err != nil || dryRun {
+		return keys, err
+	}
+
+	_, err = w.deleteKeys(ctx, keys)
+	var batchErr *BatchDeleteError
+	if errors.As(err, &batchErr) {
+		failed := make(map[string]bool, len(batchErr.Failed))
+		for _, f := range batchErr.Failed {
+			failed[f.Key] = true
+		}
+		keys = slices.DeleteFunc(keys, func(key string) bool { return failed[key] })
+		return keys, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// TruncateAfter deletes every record with an offset above offset and sets the
+// length to offset, so the next Append lands at offset+1, and returns how many
+// it deleted. The record at offset must exist, unless offset is 0, which
+// empties the log; otherwise nothing is deleted and the error wraps
+// ErrRecordNotFound. Truncating at the tail deletes nothing, so a failed call
+// can be retried; the length is only set once every delete succeeded. Appends
+// wait while it runs, and it fails if an offset above offset is reserved.
+func (w *S3DAL) TruncateAfter(ctx context.Context, offset uint64) (deleted int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.lifetime.Err() != nil {
+		return 0, ErrClosed
+	}
+	for reserved := range w.reserved {
+		if reserved > offset {
+			return 0, fmt.Errorf("cannot truncate after offset %d: offset %d is reserved", offset, reserved)
+		}
+	}
+	if offset > 0 {
+		found, err := w.Exists(ctx, offset)
+		if err != nil {
+			return 0, err
+		}
+		if !found {
+			return 0, fmt.Errorf("cannot truncate after offset %d: %w", offset, ErrRecordNotFound)
+		}
+	}
+
+	var keys []string
+	err = w.listRecords(ctx, offset, 0, func(_ uint64, obj types.Object) (bool, error) {
+		keys = append(keys, aws.ToString(obj.Key))
+		return true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if deleted, err = w.deleteKeys(ctx, keys); err != nil {
+		return deleted, err
+	}
+	w.setLength(offset)
+	return deleted, nil
+}
+
+// DeleteAll deletes every object under the prefix, records and the manifest,
+// epoch, tail hint, idempotency and compaction objects alike, in DeleteObjects
+// batches, and returns how many it deleted. On success the length is reset
+// to 0, records a packed log still buffers and any reservations are dropped,
+// and an epoch claimed with ClaimEpoch is released, so the DAL can start the
+// log afresh.
+//
+// It is for tearing down fixtures and decommissioning logs, not for running
+// alongside writers: it deletes the objects its listing saw, so an append
+// made meanwhile survives it. Appends through this client wait while it runs.
+func (w *S3DAL) DeleteAll(ctx context.Context) (deleted int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.lifetime.Err() != nil {
+		return 0, ErrClosed
+	}
+	if err := w.checkFence(ctx); err != nil {
+		return 0, err
+	}
+
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(w.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(w.bucketName),
+		Prefix: aws.String(w.keyPrefix()),
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list objects from S3: %w", err)
+		}
+		for _, obj := range output.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	}
+	w.cache.purge()
+	if deleted, err = w.deleteBatches(ctx, keys, func(string) int { return 1 }); err != nil {
+		return deleted, err
+	}
+	w.setLength(0)
+	w.size = 0
+	w.setStored(0)
+	w.pending, w.pendingBytes = nil, 0
+	clear(w.reserved)
+	w.fence.Store(nil)
+	return deleted, nil
+}
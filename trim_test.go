@@ -0,0 +1,344 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTrimToLast(t *testing.T) {
+	wal, _ := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 100; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	removed, err := wal.TrimToLast(ctx, 10)
+	if err != nil {
+		t.Fatalf("failed to trim: %v", err)
+	}
+	if removed != 90 {
+		t.Errorf("expected 90 removed records, got %d", removed)
+	}
+
+	first, err := wal.FirstRecord(ctx)
+	if err != nil {
+		t.Fatalf("failed to get first record: %v", err)
+	}
+	if first.Offset != 91 {
+		t.Errorf("expected first offset 91, got %d", first.Offset)
+	}
+	last, err := wal.LastRecord(ctx)
+	if err != nil {
+		t.Fatalf("failed to get last record: %v", err)
+	}
+	if last.Offset != 100 {
+		t.Errorf("expected last offset 100, got %d", last.Offset)
+	}
+
+	// trimming again is a no-op
+	removed, err = wal.TrimToLast(ctx, 10)
+	if err != nil {
+		t.Fatalf("failed to trim: %v", err)
+	}
+	if removed != 0 {
+		t.Errorf("expected nothing removed, got %d", removed)
+	}
+}
+
+func TestTrimOlderThan(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// records written 10, 8, 6, 4 and 2 hours before "now"
+	for i := 0; i < 5; i++ {
+		written := base.Add(time.Duration(i*2) * time.Hour)
+		fake.now = func() time.Time { return written }
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	wal.now = func() time.Time { return base.Add(10 * time.Hour) }
+
+	removed, err := wal.TrimOlderThan(ctx, 5*time.Hour)
+	if err != nil {
+		t.Fatalf("failed to trim: %v", err)
+	}
+	if removed != 3 {
+		t.Errorf("expected 3 removed records, got %d", removed)
+	}
+
+	first, err := wal.FirstRecord(ctx)
+	if err != nil {
+		t.Fatalf("failed to get first record: %v", err)
+	}
+	if first.Offset != 4 {
+		t.Errorf("expected first offset 4, got %d", first.Offset)
+	}
+}
+
+func TestTrimPartialDeleteFailure(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	fake.deleteErrors = map[string]string{
+		wal.getObjectKey(2): "AccessDenied",
+		wal.getObjectKey(5): "InternalError",
+	}
+
+	removed, err := wal.TrimToLast(ctx, 4)
+	var bde *BatchDeleteError
+	if !errors.As(err, &bde) {
+		t.Fatalf("expected BatchDeleteError, got %v", err)
+	}
+	if removed != 4 || bde.Deleted != 4 {
+		t.Errorf("expected 4 deleted, got %d (error reports %d)", removed, bde.Deleted)
+	}
+	want := []DeleteFailure{
+		{Key: wal.getObjectKey(2), Code: "AccessDenied", Message: "AccessDenied"},
+		{Key: wal.getObjectKey(5), Code: "InternalError", Message: "InternalError"},
+	}
+	if !slices.Equal(bde.Failed, want) {
+		t.Errorf("expected failures %v, got %v", want, bde.Failed)
+	}
+
+	// the failed keys are still present, the others are gone
+	for offset := uint64(1); offset <= 6; offset++ {
+		_, present := fake.objects[wal.getObjectKey(offset)]
+		if present != (offset == 2 || offset == 5) {
+			t.Errorf("offset %d: unexpected presence %v", offset, present)
+		}
+	}
+}
+
+func TestTrimBefore(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 2500; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	if err := wal.PersistLength(ctx); err != nil {
+		t.Fatalf("failed to persist length: %v", err)
+	}
+
+	deleted, err := wal.TrimBefore(ctx, 1201)
+	if err != nil {
+		t.Fatalf("failed to trim: %v", err)
+	}
+	if deleted != 1200 {
+		t.Errorf("expected 1200 deleted records, got %d", deleted)
+	}
+	if fake.deleteCalls != 2 {
+		t.Errorf("expected 2 DeleteObjects batches, got %d", fake.deleteCalls)
+	}
+	first, err := wal.FirstRecord(ctx)
+	if err != nil {
+		t.Fatalf("failed to get first record: %v", err)
+	}
+	if first.Offset != 1201 {
+		t.Errorf("expected the watermark record to survive as first, got %d", first.Offset)
+	}
+	if _, ok := fake.objects[wal.tailHintKey()]; !ok {
+		t.Error("expected the tail hint to be left alone")
+	}
+
+	// the same watermark again, or a lower one, deletes nothing
+	for _, watermark := range []uint64{1201, 1, 0} {
+		deleted, err := wal.TrimBefore(ctx, watermark)
+		if err != nil {
+			t.Fatalf("failed to trim: %v", err)
+		}
+		if deleted != 0 {
+			t.Errorf("watermark %d: expected nothing deleted, got %d", watermark, deleted)
+		}
+	}
+}
+
+func TestCountAfterTrim(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	if count, err := wal.Count(ctx); err != nil || count != 0 {
+		t.Fatalf("expected an empty log to count 0, got %d, %v", count, err)
+	}
+	for i := 0; i < 1500; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	if err := wal.PersistLength(ctx); err != nil {
+		t.Fatalf("failed to persist length: %v", err)
+	}
+	if _, err := wal.TrimBefore(ctx, 101); err != nil {
+		t.Fatalf("failed to trim: %v", err)
+	}
+	delete(fake.objects, wal.getObjectKey(700))
+
+	fake.getCalls, fake.listCalls = 0, 0
+	count, err := wal.Count(ctx)
+	if err != nil {
+		t.Fatalf("failed to count: %v", err)
+	}
+	if count != 1399 {
+		t.Errorf("expected 1399 records, got %d", count)
+	}
+	if fake.getCalls != 0 || fake.listCalls != 2 {
+		t.Errorf("expected 2 list calls and no gets, got %d and %d", fake.listCalls, fake.getCalls)
+	}
+}
+
+func TestDeleteRange(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	want := []string{wal.getObjectKey(4), wal.getObjectKey(5), wal.getObjectKey(6), wal.getObjectKey(7)}
+
+	keys, err := wal.DeleteRange(ctx, 4, 8, true)
+	if err != nil || !slices.Equal(keys, want) {
+		t.Fatalf("expected the dry run to list %v, got %v, %v", want, keys, err)
+	}
+	if len(fake.objects) != 10 || fake.deleteCalls != 0 {
+		t.Fatalf("expected a dry run to delete nothing, %d objects left after %d deletes", len(fake.objects), fake.deleteCalls)
+	}
+
+	fake.deleteErrors = map[string]string{wal.getObjectKey(6): "AccessDenied"}
+	keys, err = wal.DeleteRange(ctx, 4, 8, false)
+	var bde *BatchDeleteError
+	if !errors.As(err, &bde) || len(bde.Failed) != 1 || bde.Failed[0].Key != wal.getObjectKey(6) {
+		t.Fatalf("expected offset 6 reported as failed, got %v", err)
+	}
+	if !slices.Equal(keys, slices.Delete(slices.Clone(want), 2, 3)) {
+		t.Errorf("expected the deleted keys without offset 6, got %v", keys)
+	}
+	for offset := uint64(1); offset <= 10; offset++ {
+		_, present := fake.objects[wal.getObjectKey(offset)]
+		if present != (offset < 4 || offset == 6 || offset > 7) {
+			t.Errorf("offset %d: unexpected presence %v", offset, present)
+		}
+	}
+
+	fake.deleteErrors = nil
+	if keys, err := wal.DeleteRange(ctx, 4, 8, false); err != nil || !slices.Equal(keys, []string{wal.getObjectKey(6)}) {
+		t.Errorf("expected the retry to delete only offset 6, got %v, %v", keys, err)
+	}
+	if _, err := wal.DeleteRange(ctx, 7, 4, true); err == nil {
+		t.Error("expected an inverted range to be rejected")
+	}
+}
+
+func TestTruncateAfter(t *testing.T) {
+	wal, fake := newFakeDAL(t)
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	if deleted, err := wal.TruncateAfter(ctx, 6); err != nil || deleted != 4 || wal.Length() != 6 {
+		t.Fatalf("expected 4 deleted and length 6, got %d, %d, %v", deleted, wal.Length(), err)
+	}
+	if offset, err := wal.Append(ctx, []byte("resumed")); err != nil || offset != 7 {
+		t.Fatalf("expected the next append at 7, got %d, %v", offset, err)
+	}
+
+	// at the tail it deletes nothing, and again is a no-op
+	for i := 0; i < 2; i++ {
+		if deleted, err := wal.TruncateAfter(ctx, 7); err != nil || deleted != 0 || wal.Length() != 7 {
+			t.Errorf("expected a no-op at the tail, got %d, %d, %v", deleted, wal.Length(), err)
+		}
+	}
+
+	if _, err := wal.TruncateAfter(ctx, 20); !errors.Is(err, ErrRecordNotFound) || wal.Length() != 7 {
+		t.Errorf("expected truncating past the end to fail, got %v, length %d", err, wal.Length())
+	}
+	delete(fake.objects, wal.getObjectKey(3))
+	if _, err := wal.TruncateAfter(ctx, 3); !errors.Is(err, ErrRecordNotFound) || len(fake.objects) != 6 {
+		t.Errorf("expected truncating at a hole to delete nothing, got %v, %d left", err, len(fake.objects))
+	}
+
+	if deleted, err := wal.TruncateAfter(ctx, 0); err != nil || deleted != 6 || wal.Length() != 0 {
+		t.Fatalf("expected the log emptied, got %d, %d, %v", deleted, wal.Length(), err)
+	}
+	if offset, err := wal.Append(ctx, []byte("fresh")); err != nil || offset != 1 {
+		t.Errorf("expected the next append at 1, got %d, %v", offset, err)
+	}
+}
+
+func TestDeleteAll(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithManifest())
+	ctx := context.Background()
+
+	if _, err := wal.ClaimEpoch(ctx); err != nil {
+		t.Fatalf("failed to claim epoch: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := wal.Append(ctx, []byte("doomed")); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	if _, _, err := wal.AppendIdempotent(ctx, "request-1", []byte("doomed too")); err != nil {
+		t.Fatalf("failed to append idempotently: %v", err)
+	}
+	if err := wal.PersistLength(ctx); err != nil {
+		t.Fatalf("failed to persist length: %v", err)
+	}
+	objects := len(fake.objects)
+
+	deleted, err := wal.DeleteAll(ctx)
+	if err != nil {
+		t.Fatalf("failed to delete the log: %v", err)
+	}
+	if deleted != objects || len(fake.objects) != 0 {
+		t.Errorf("expected all %d objects deleted, deleted %d and %d remain", objects, deleted, len(fake.objects))
+	}
+	if got := wal.Length(); got != 0 {
+		t.Errorf("expected length 0, got %d", got)
+	}
+	if _, err := wal.LastRecord(ctx); !errors.Is(err, ErrEmptyLog) {
+		t.Errorf("expected ErrEmptyLog after DeleteAll, got %v", err)
+	}
+
+	// the log starts afresh
+	if offset, err := wal.Append(ctx, []byte("reborn")); err != nil || offset != 1 {
+		t.Errorf("expected the next append at offset 1, got %d, %v", offset, err)
+	}
+	if deleted, err := wal.DeleteAll(ctx); err != nil || deleted != 2 {
+		t.Errorf("expected the record and manifest deleted, got %d, %v", deleted, err)
+	}
+
+	// a partial failure keeps the length and names the key left behind
+	for i := 0; i < 3; i++ {
+		if _, err := wal.Append(ctx, []byte("stubborn")); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	fake.deleteErrors = map[string]string{wal.getObjectKey(2): "AccessDenied"}
+	deleted, err = wal.DeleteAll(ctx)
+	var bde *BatchDeleteError
+	if !errors.As(err, &bde) || len(bde.Failed) != 1 || bde.Failed[0].Key != wal.getObjectKey(2) {
+		t.Fatalf("expected a BatchDeleteError for offset 2, got %v", err)
+	}
+	if deleted != bde.Deleted || wal.Length() != 3 {
+		t.Errorf("expected the length kept at 3 after %d deletes, got %d", deleted, wal.Length())
+	}
+}
@@ -0,0 +1,107 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const defaultReadConcurrency = 8
+
+// ReadValidateRange reads every record in [start, end), from offset 1 if
+// start is 0, with bounded concurrency and returns the offsets that failed
+// (CRC or offset mismatch, too short, not found) mapped to why. An empty map means the whole range is
+// valid. Records are found by listing: the missing offsets below the last
+// one, such as holes, are reported as ErrRecordNotFound without a read, and
+// those past it are not checked. The error is only set if the sweep itself
+// could not complete.
+func (w *S3DAL) ReadValidateRange(ctx context.Context, start, end uint64) (map[uint64]error, error) {
+	if err := checkRange(start, end); err != nil {
+		return nil, err
+	}
+	start = max(start, 1)
+
+	bad := make(map[uint64]error)
+	var mu sync.Mutex
+	sem := make(chan struct{}, w.readConcurrency)
+	var wg sync.WaitGroup
+	next := start
+	err := w.eachOffset(ctx, start, end, func(offset uint64) (bool, error) {
+		mu.Lock()
+		for ; next < offset; next++ {
+			bad[next] = w.opError("read", next, fmt.Errorf("%w: offset %d is not listed", ErrRecordNotFound, next))
+		}
+		next = offset + 1
+		mu.Unlock()
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if _, err := w.Read(ctx, offset); err != nil {
+				mu.Lock()
+				bad[offset] = err
+				mu.Unlock()
+			}
+		}()
+		return true, nil
+	})
+	wg.Wait()
+	if err != nil {
+		return bad, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return bad, err
+	}
+	return bad, nil
+}
+
+// VerifyAll checks every record at or after from: its checksum, and that the
+// offset it stores matches its key. It returns the offsets that failed in
+// ascending order; an empty slice means the log is healthy. Records are found
+// by listing, so holes are not reported, nor are records deleted during the
+// sweep. Reads run with the WithReadConcurrency bound and a bad record does
+// not stop the sweep. The error is only set if the sweep could not complete,
+// for example because ctx was cancelled, in which case the offsets found so
+// far are still returned.
+func (w *S3DAL) VerifyAll(ctx context.Context, from uint64) ([]uint64, error) {
+	bad := []uint64{}
+	var mu sync.Mutex
+	sem := make(chan struct{}, w.readConcurrency)
+	var wg sync.WaitGroup
+	err := w.listRecords(ctx, max(from, 1)-1, 0, func(offset uint64, _ types.Object) (bool, error) {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			_, err := w.Read(ctx, offset)
+			if err == nil || errors.Is(err, ErrRecordNotFound) || ctx.Err() != nil {
+				return
+			}
+			mu.Lock()
+			bad = append(bad, offset)
+			mu.Unlock()
+		}()
+		return true, nil
+	})
+	wg.Wait()
+	slices.Sort(bad)
+	if err == nil {
+		err = ctx.Err()
+	}
+	return bad, err
+}
@@ -0,0 +1,92 @@
+package s3_dal
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestReadValidateRange(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithReadConcurrency(2))
+	ctx := context.Background()
+
+	for i := 0; i < 8; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	// 3: bad CRC, 4: body of another offset, 5: too short, 6: missing
+	corrupt := fake.objects[wal.getObjectKey(3)]
+	corrupt.body[len(corrupt.body)-3] ^= 0xFF
+	fake.objects[wal.getObjectKey(4)] = fake.objects[wal.getObjectKey(8)]
+	fake.objects[wal.getObjectKey(5)] = fakeObject{body: []byte{1, 2, 3}}
+	delete(fake.objects, wal.getObjectKey(6))
+
+	bad, err := wal.ReadValidateRange(ctx, 2, 8)
+	if err != nil {
+		t.Fatalf("failed to validate range: %v", err)
+	}
+
+	want := map[uint64]error{3: ErrChecksumMismatch, 4: ErrOffsetMismatch, 5: ErrRecordTooShort, 6: ErrRecordNotFound}
+	if len(bad) != len(want) {
+		t.Fatalf("expected %d bad offsets, got %v", len(want), bad)
+	}
+	for offset, reason := range want {
+		if err, ok := bad[offset]; !ok || !errors.Is(err, reason) {
+			t.Errorf("offset %d: expected %v, got %v", offset, reason, err)
+		}
+	}
+
+	bad, err = wal.ReadValidateRange(ctx, 1, 3)
+	if err != nil {
+		t.Fatalf("failed to validate range: %v", err)
+	}
+	if len(bad) != 0 {
+		t.Errorf("expected a valid range, got %v", bad)
+	}
+
+	// offsets past the tail are not checked
+	bad, err = wal.ReadValidateRange(ctx, 7, math.MaxUint64)
+	if err != nil {
+		t.Fatalf("failed to validate range: %v", err)
+	}
+	if len(bad) != 0 {
+		t.Errorf("expected an open-ended range to be valid, got %v", bad)
+	}
+}
+
+func TestVerifyAll(t *testing.T) {
+	wal, fake := newFakeDAL(t, WithReadConcurrency(3))
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		if _, err := wal.Append(ctx, []byte(generateRandomStr())); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+	// 3: bad CRC, 7: body of another offset, 10: missing, which is not a failure
+	corrupt := fake.objects[wal.getObjectKey(3)]
+	corrupt.body[len(corrupt.body)-3] ^= 0xFF
+	fake.objects[wal.getObjectKey(7)] = fake.objects[wal.getObjectKey(8)]
+	delete(fake.objects, wal.getObjectKey(10))
+
+	bad, err := wal.VerifyAll(ctx, 0)
+	if err != nil {
+		t.Fatalf("failed to verify: %v", err)
+	}
+	if !slices.Equal(bad, []uint64{3, 7}) {
+		t.Errorf("expected offsets 3 and 7 to fail, got %v", bad)
+	}
+	if bad, err = wal.VerifyAll(ctx, 5); err != nil || !slices.Equal(bad, []uint64{7}) {
+		t.Errorf("expected only offset 7 to fail from 5, got %v, %v", bad, err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := wal.VerifyAll(cancelled, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled sweep to report context.Canceled, got %v", err)
+	}
+}